@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/treenq/treenq/src/domain"
 )
 
 type Client struct {
@@ -75,6 +78,17 @@ type GithubWebhookRequest struct {
 	RepositoriesRemoved []InstalledRepository `json:"repositories_removed"`
 	Ref                 string                `json:"ref"`
 	Repository          Repository            `json:"repository"`
+	HeadCommit          Commit                `json:"head_commit"`
+	Commits             []Commit              `json:"commits"`
+	Membership          *OrgMembership        `json:"membership"`
+	Member              *Sender               `json:"member"`
+	Scope               string                `json:"scope"`
+	Event               string                `json:"-"`
+}
+type GithubWebhookResponse struct {
+	Deployments []WebhookDeployment `json:"deployments,omitempty"`
+	Queued      bool                `json:"queued,omitempty"`
+	RetryAfter  int                 `json:"retryAfter,omitempty"`
 }
 type Installation struct {
 	ID      int                 `json:"id"`
@@ -89,45 +103,115 @@ type Sender struct {
 	Login string `json:"login"`
 }
 type InstalledRepository struct {
-	ID       int    `json:"id"`
-	FullName string `json:"full_name"`
-	Private  bool   `json:"private"`
-	Branch   string `json:"branch"`
+	ID             int    `json:"id"`
+	FullName       string `json:"full_name"`
+	Private        bool   `json:"private"`
+	TreenqID       string `json:"treenqID"`
+	Branch         string `json:"branch"`
+	AuthType       string `json:"authType"`
+	InstallationID int    `json:"installationID"`
 }
 type Repository struct {
-	ID       int    `json:"id"`
-	CloneUrl string `json:"clone_url"`
-	FullName string `json:"full_name"`
-	Private  bool   `json:"private"`
+	ID            int    `json:"id"`
+	CloneUrl      string `json:"clone_url"`
+	FullName      string `json:"full_name"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
+}
+type Commit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+type OrgMembership struct {
+	User Sender `json:"user"`
+}
+type WebhookDeployment struct {
+	RepoID       int    `json:"repoId"`
+	Outcome      string `json:"outcome"`
+	DeploymentID string `json:"deploymentId,omitempty"`
+	Sha          string `json:"sha,omitempty"`
+	SkipReason   string `json:"skipReason,omitempty"`
 }
 
-func (c *Client) GithubWebhook(ctx context.Context, req GithubWebhookRequest) error {
+func (c *Client) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (GithubWebhookResponse, error) {
+	var res GithubWebhookResponse
 
 	bodyBytes, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return res, fmt.Errorf("failed to marshal request: %w", err)
 	}
 	body := bytes.NewBuffer(bodyBytes)
 
 	r, err := http.NewRequest("POST", c.baseUrl+"/githubWebhook", body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return res, fmt.Errorf("failed to create request: %w", err)
 	}
 	r = r.WithContext(ctx)
 	r.Header = c.headers
 
 	resp, err := c.client.Do(r)
 	if err != nil {
-		return fmt.Errorf("failed to call githubWebhook: %w", err)
+		return res, fmt.Errorf("failed to call githubWebhook: %w", err)
 	}
 	defer resp.Body.Close()
 
 	err = HandleErr(resp)
 	if err != nil {
-		return err
+		return res, err
 	}
 
-	return nil
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode githubWebhook response: %w", err)
+	}
+
+	return res, nil
+}
+
+type StatusResponse struct {
+	Builds      SlotsUsage `json:"builds"`
+	Pushes      SlotsUsage `json:"pushes"`
+	Draining    bool       `json:"draining"`
+	Deployments int        `json:"deployments"`
+}
+type SlotsUsage struct {
+	InFlight int `json:"inFlight"`
+	Queued   int `json:"queued"`
+	Limit    int `json:"limit"`
+}
+
+func (c *Client) Status(ctx context.Context) (StatusResponse, error) {
+	var res StatusResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/status", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode status response: %w", err)
+	}
+
+	return res, nil
 }
 
 type InfoResponse struct {
@@ -239,3 +323,1283 @@ func (c *Client) GetRepos(ctx context.Context) (GetReposResponse, error) {
 
 	return res, nil
 }
+
+type VerifyInstallationRequest struct {
+	InstallationID int `json:"installationId"`
+}
+type VerifyInstallationResponse struct {
+	Permissions InstallationPermissions `json:"permissions"`
+	CanClone    bool                    `json:"canClone"`
+}
+type InstallationPermissions struct {
+	Permissions         map[string]string `json:"permissions"`
+	RepositorySelection string            `json:"repositorySelection"`
+	CheckedAt           time.Time         `json:"checkedAt"`
+}
+
+func (c *Client) VerifyInstallation(ctx context.Context, req VerifyInstallationRequest) (VerifyInstallationResponse, error) {
+	var res VerifyInstallationResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/verifyInstallation", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call verifyInstallation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode verifyInstallation response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ApproveDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+type ApproveDeploymentResponse struct {
+	Deployment AppDefinition
+}
+type AppDefinition struct {
+	ID                 string
+	AppID              string
+	App                Space
+	Tag                string
+	Sha                string
+	User               string
+	Environment        string
+	Status             string
+	ApprovalExpiresAt  time.Time
+	PromotionExpiresAt time.Time
+	Failure            *DeploymentFailure
+	ConfigPath         string
+	SkipReason         string
+	BuildMetrics       map[string]BuildMetrics
+	Signatures         map[string]string
+	Digests            map[string]string
+	SkipMigrations     bool
+	MigrationLogs      string
+	CreatedAt          time.Time
+	FinishedAt         time.Time
+	Timeline           []TimelineEvent
+	ImportedFrom       string
+	Message            string
+	Event              string
+	Action             string
+	Ref                string
+	Objects            []ObjectRef
+	ForceRebuild       bool
+	BuildInputs        map[string]string
+	Env                map[string][]domain.EnvVar
+	RebuildRequired    bool
+}
+type Space struct {
+	Key                string
+	Region             string
+	Service            Service
+	Services           []Service
+	ServiceConcurrency int
+	Environments       []Environment
+	Builder            string
+	Migrations         *Migrations
+	Paths              []string
+	PauseAfterDeploy   bool
+}
+type Service struct {
+	Key              string
+	Builder          string
+	DockerfilePath   string
+	BuildEnvs        map[string]string
+	RuntimeEnvs      map[string]string
+	BuildSecrets     []string
+	RuntimeSecrets   []string
+	HttpPort         int
+	Replicas         int
+	Host             string
+	Name             string
+	SizeSlug         string
+	DependsOn        []string
+	SmokeTest        *SmokeTest
+	ReadinessCommand []string
+	MaintenanceMode  bool
+}
+type SmokeTest struct {
+	Path              string
+	ExpectedStatus    int
+	Timeout           int64
+	Retries           int
+	RollbackOnFailure bool
+}
+type Environment struct {
+	Name            string
+	Branch          string
+	RequireApproval bool
+	Approvers       []string
+	Debounce        int64
+}
+type Migrations struct {
+	Service       string
+	Image         string
+	Command       []string
+	Timeout       int64
+	RestartPolicy string
+	BackoffLimit  int
+}
+type DeploymentFailure struct {
+	Stage     string `json:"stage"`
+	Class     string `json:"class"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+type BuildMetrics struct {
+	Duration     int64 `json:"duration"`
+	CachedLayers int   `json:"cachedLayers"`
+	TotalLayers  int   `json:"totalLayers"`
+}
+type TimelineEvent struct {
+	Milestone string    `json:"milestone"`
+	At        time.Time `json:"at"`
+}
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+}
+
+func (c *Client) ApproveDeployment(ctx context.Context, req ApproveDeploymentRequest) (ApproveDeploymentResponse, error) {
+	var res ApproveDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/approveDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call approveDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode approveDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RejectDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+type RejectDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+func (c *Client) RejectDeployment(ctx context.Context, req RejectDeploymentRequest) (RejectDeploymentResponse, error) {
+	var res RejectDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/rejectDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call rejectDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode rejectDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type PromoteDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+type PromoteDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+func (c *Client) PromoteDeployment(ctx context.Context, req PromoteDeploymentRequest) (PromoteDeploymentResponse, error) {
+	var res PromoteDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/promoteDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call promoteDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode promoteDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetAppEnvRequest struct {
+	AppID       string `json:"appId"`
+	Environment string `json:"environment"`
+}
+type GetAppEnvResponse struct {
+	Envs []AppEnv `json:"envs"`
+}
+type AppEnv struct {
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Secret      bool   `json:"secret"`
+}
+
+func (c *Client) GetAppEnv(ctx context.Context, req GetAppEnvRequest) (GetAppEnvResponse, error) {
+	var res GetAppEnvResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getAppEnv", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getAppEnv: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getAppEnv response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SetAppEnvRequest struct {
+	AppID       string   `json:"appId"`
+	Environment string   `json:"environment"`
+	Envs        []AppEnv `json:"envs"`
+	Remove      []string `json:"remove"`
+	Redeploy    bool     `json:"redeploy"`
+}
+type SetAppEnvResponse struct {
+	Envs         []AppEnv `json:"envs"`
+	DeploymentID string   `json:"deploymentId"`
+}
+
+func (c *Client) SetAppEnv(ctx context.Context, req SetAppEnvRequest) (SetAppEnvResponse, error) {
+	var res SetAppEnvResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setAppEnv", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call setAppEnv: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode setAppEnv response: %w", err)
+	}
+
+	return res, nil
+}
+
+type DeployArchiveRequest struct {
+	AppID        string  `json:"appId"`
+	Archive      []uint8 `json:"archive"`
+	Sha          string  `json:"sha"`
+	Branch       string  `json:"branch"`
+	ForceRebuild bool    `json:"forceRebuild"`
+}
+type DeployArchiveResponse struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+func (c *Client) DeployArchive(ctx context.Context, req DeployArchiveRequest) (DeployArchiveResponse, error) {
+	var res DeployArchiveResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/deployArchive", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call deployArchive: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode deployArchive response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RedeployRequest struct {
+	AppID        string `json:"appId"`
+	Sha          string `json:"sha"`
+	ForceRebuild bool   `json:"forceRebuild"`
+}
+type RedeployResponse struct {
+	Deployment AppDefinition
+}
+
+func (c *Client) Redeploy(ctx context.Context, req RedeployRequest) (RedeployResponse, error) {
+	var res RedeployResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/redeploy", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call redeploy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode redeploy response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RollbackRequest struct {
+	AppID string `json:"appId"`
+	Tag   string `json:"tag"`
+	Sha   string `json:"sha"`
+}
+type RollbackResponse struct {
+	Deployment AppDefinition
+	History    []AppDefinition
+}
+
+func (c *Client) Rollback(ctx context.Context, req RollbackRequest) (RollbackResponse, error) {
+	var res RollbackResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/rollback", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call rollback: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode rollback response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetAppResourcesRequest struct {
+	AppID string `json:"appId"`
+}
+type GetAppResourcesResponse struct {
+	Resources []KubeResource `json:"resources"`
+}
+type KubeResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Manifest   string `json:"manifest"`
+}
+
+func (c *Client) GetAppResources(ctx context.Context, req GetAppResourcesRequest) (GetAppResourcesResponse, error) {
+	var res GetAppResourcesResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getAppResources", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getAppResources: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getAppResources response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+type GetDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+func (c *Client) GetDeployment(ctx context.Context, req GetDeploymentRequest) (GetDeploymentResponse, error) {
+	var res GetDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetDeploymentTimelineRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+type GetDeploymentTimelineResponse struct {
+	Timeline []TimelineEvent `json:"timeline"`
+}
+
+func (c *Client) GetDeploymentTimeline(ctx context.Context, req GetDeploymentTimelineRequest) (GetDeploymentTimelineResponse, error) {
+	var res GetDeploymentTimelineResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getDeploymentTimeline", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getDeploymentTimeline: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getDeploymentTimeline response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetUsageResponse struct {
+	Usage       Usage      `json:"usage"`
+	Limits      PlanLimits `json:"limits"`
+	PeriodStart time.Time  `json:"periodStart"`
+}
+type Usage struct {
+	Apps         int `json:"apps"`
+	Deployments  int `json:"deployments"`
+	BuildMinutes int `json:"buildMinutes"`
+}
+type PlanLimits struct {
+	Apps         int `json:"apps"`
+	Deployments  int `json:"deployments"`
+	BuildMinutes int `json:"buildMinutes"`
+}
+
+func (c *Client) GetUsage(ctx context.Context) (GetUsageResponse, error) {
+	var res GetUsageResponse
+
+	body := bytes.NewBuffer(nil)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getUsage", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getUsage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getUsage response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetDeploymentStatsRequest struct {
+	AppID string    `json:"appId"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+}
+type GetDeploymentStatsResponse struct {
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+	Stats DeploymentStats `json:"stats"`
+}
+type DeploymentStats struct {
+	Total                int                             `json:"total"`
+	Statuses             map[domain.DeploymentStatus]int `json:"statuses"`
+	SuccessRate          float64                         `json:"successRate"`
+	MeanBuildDuration    int64                           `json:"meanBuildDuration"`
+	MedianBuildDuration  int64                           `json:"medianBuildDuration"`
+	MeanDeployDuration   int64                           `json:"meanDeployDuration"`
+	MedianDeployDuration int64                           `json:"medianDeployDuration"`
+	DeploysPerDay        float64                         `json:"deploysPerDay"`
+}
+
+func (c *Client) GetDeploymentStats(ctx context.Context, req GetDeploymentStatsRequest) (GetDeploymentStatsResponse, error) {
+	var res GetDeploymentStatsResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getDeploymentStats", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getDeploymentStats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getDeploymentStats response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SetDeployKeyRequest struct {
+	AppID      string `json:"appId"`
+	PrivateKey string `json:"privateKey"`
+}
+type SetDeployKeyResponse struct {
+	PublicKey string `json:"publicKey"`
+}
+
+func (c *Client) SetDeployKey(ctx context.Context, req SetDeployKeyRequest) (SetDeployKeyResponse, error) {
+	var res SetDeployKeyResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setDeployKey", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call setDeployKey: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode setDeployKey response: %w", err)
+	}
+
+	return res, nil
+}
+
+type PlanDeploymentRequest struct {
+	AppID  string `json:"appId"`
+	Branch string `json:"branch"`
+}
+type PlanDeploymentResponse struct {
+	Plan DeploymentPlan `json:"plan"`
+}
+type DeploymentPlan struct {
+	Environment     string        `json:"environment"`
+	RequireApproval bool          `json:"requireApproval"`
+	ConfigPath      string        `json:"configPath"`
+	Services        []ServicePlan `json:"services"`
+	Objects         []ObjectPlan  `json:"objects"`
+}
+type ServicePlan struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Cached bool   `json:"cached"`
+}
+type ObjectPlan struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	Action     string `json:"action"`
+}
+
+func (c *Client) PlanDeployment(ctx context.Context, req PlanDeploymentRequest) (PlanDeploymentResponse, error) {
+	var res PlanDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/planDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call planDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode planDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SimulateWebhookRequest struct {
+	AppID        string   `json:"appId"`
+	Ref          string   `json:"ref"`
+	ChangedPaths []string `json:"changedPaths"`
+	Message      string   `json:"message"`
+}
+type SimulateWebhookResponse struct {
+	Deploy          bool     `json:"deploy"`
+	SkipReason      string   `json:"skipReason"`
+	ConfigKnown     bool     `json:"configKnown"`
+	Environment     string   `json:"environment"`
+	RequireApproval bool     `json:"requireApproval"`
+	Services        []string `json:"services"`
+}
+
+func (c *Client) SimulateWebhook(ctx context.Context, req SimulateWebhookRequest) (SimulateWebhookResponse, error) {
+	var res SimulateWebhookResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/simulateWebhook", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call simulateWebhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode simulateWebhook response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ConnectRepositoryRequest struct {
+	AppID  string `json:"appId"`
+	Branch string `json:"branch"`
+	Deploy bool   `json:"deploy"`
+}
+type ConnectRepositoryResponse struct {
+	Setup RepositorySetup `json:"setup"`
+}
+type RepositorySetup struct {
+	Branch          string `json:"branch"`
+	BranchValid     bool   `json:"branchValid"`
+	Connected       bool   `json:"connected"`
+	Sha             string `json:"sha"`
+	ConfigFound     bool   `json:"configFound"`
+	ConfigPath      string `json:"configPath"`
+	DockerfileFound bool   `json:"dockerfileFound"`
+	ConfigError     string `json:"configError"`
+	DeploymentID    string `json:"deploymentId"`
+}
+
+func (c *Client) ConnectRepository(ctx context.Context, req ConnectRepositoryRequest) (ConnectRepositoryResponse, error) {
+	var res ConnectRepositoryResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/connectRepository", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call connectRepository: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode connectRepository response: %w", err)
+	}
+
+	return res, nil
+}
+
+type ImportAppRequest struct {
+	AppID     string `json:"appId"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+type ImportAppResponse struct {
+	DeploymentID string `json:"deploymentId"`
+	Space        Space  `json:"space"`
+}
+
+func (c *Client) ImportApp(ctx context.Context, req ImportAppRequest) (ImportAppResponse, error) {
+	var res ImportAppResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/importApp", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call importApp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode importApp response: %w", err)
+	}
+
+	return res, nil
+}
+
+type BuildImageRequest struct {
+	AppID        string `json:"appId"`
+	Branch       string `json:"branch"`
+	ForceRebuild bool   `json:"forceRebuild"`
+}
+type BuildImageResponse struct {
+	Sha    string           `json:"sha"`
+	Images map[string]Image `json:"images"`
+}
+type Image struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+	Signature  string
+}
+
+func (c *Client) BuildImage(ctx context.Context, req BuildImageRequest) (BuildImageResponse, error) {
+	var res BuildImageResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/buildImage", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call buildImage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode buildImage response: %w", err)
+	}
+
+	return res, nil
+}
+
+type IssueFeedTokenRequest struct {
+	AppID string `json:"appId"`
+}
+type IssueFeedTokenResponse struct {
+	Token string `json:"token"`
+}
+
+func (c *Client) IssueFeedToken(ctx context.Context, req IssueFeedTokenRequest) (IssueFeedTokenResponse, error) {
+	var res IssueFeedTokenResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/issueFeedToken", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call issueFeedToken: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode issueFeedToken response: %w", err)
+	}
+
+	return res, nil
+}
+
+type CancelDeploymentRequest struct {
+	AppID        string `json:"appId"`
+	DeploymentID string `json:"deploymentId"`
+}
+type CancelDeploymentResponse struct {
+	Cancelled int `json:"cancelled"`
+}
+
+func (c *Client) CancelDeployment(ctx context.Context, req CancelDeploymentRequest) (CancelDeploymentResponse, error) {
+	var res CancelDeploymentResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/cancelDeployment", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call cancelDeployment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode cancelDeployment response: %w", err)
+	}
+
+	return res, nil
+}
+
+type GetAppHistoryRequest struct {
+	AppID string `json:"appId"`
+}
+type GetAppHistoryResponse struct {
+	Events []AppEvent `json:"events"`
+}
+type AppEvent struct {
+	AppID      string    `json:"appId"`
+	Version    int       `json:"version"`
+	Change     string    `json:"change"`
+	Config     AppConfig `json:"config"`
+	User       string    `json:"user"`
+	RevertedTo int       `json:"revertedTo"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+type AppConfig struct {
+	Branch string   `json:"branch"`
+	Envs   []AppEnv `json:"envs"`
+}
+
+func (c *Client) GetAppHistory(ctx context.Context, req GetAppHistoryRequest) (GetAppHistoryResponse, error) {
+	var res GetAppHistoryResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/getAppHistory", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call getAppHistory: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode getAppHistory response: %w", err)
+	}
+
+	return res, nil
+}
+
+type RevertToVersionRequest struct {
+	AppID   string `json:"appId"`
+	Version int    `json:"version"`
+}
+type RevertToVersionResponse struct {
+	Event AppEvent `json:"event"`
+}
+
+func (c *Client) RevertToVersion(ctx context.Context, req RevertToVersionRequest) (RevertToVersionResponse, error) {
+	var res RevertToVersionResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/revertToVersion", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call revertToVersion: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode revertToVersion response: %w", err)
+	}
+
+	return res, nil
+}
+
+type SetDrainingRequest struct {
+	Draining bool `json:"draining"`
+}
+type SetDrainingResponse struct {
+	Draining    bool `json:"draining"`
+	Deployments int  `json:"deployments"`
+}
+
+func (c *Client) SetDraining(ctx context.Context, req SetDrainingRequest) (SetDrainingResponse, error) {
+	var res SetDrainingResponse
+
+	bodyBytes, err := json.Marshal(req)
+	if err != nil {
+		return res, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	body := bytes.NewBuffer(bodyBytes)
+
+	r, err := http.NewRequest("POST", c.baseUrl+"/setDraining", body)
+	if err != nil {
+		return res, fmt.Errorf("failed to create request: %w", err)
+	}
+	r = r.WithContext(ctx)
+	r.Header = c.headers
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return res, fmt.Errorf("failed to call setDraining: %w", err)
+	}
+	defer resp.Body.Close()
+
+	err = HandleErr(resp)
+	if err != nil {
+		return res, err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	if err != nil {
+		return res, fmt.Errorf("failed to decode setDraining response: %w", err)
+	}
+
+	return res, nil
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func main() {
-	router := api.NewRouter(&domain.Handler{}, vel.NoopMiddleware, vel.NoopMiddleware)
+	router := api.NewRouter(&domain.Handler{}, vel.NoopMiddleware, vel.NoopMiddleware, vel.NoopMiddleware, vel.NoopMiddleware, vel.NoopMiddleware)
 	gener, err := gen.New(gen.ClientDesc{
 		TypeName:    "Client",
 		PackageName: "client",
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/treenq/treenq/src/api"
 )
@@ -12,13 +17,31 @@ func main() {
 	if err != nil {
 		log.Fatalln("failed to load config:", err)
 	}
-	m, err := api.New(conf)
+	m, shutdown, err := api.New(conf)
 	if err != nil {
 		log.Fatalln("failed to build api:", err)
 	}
 	log.Println("service is running on:", conf.HttpPort)
 
-	if err := http.ListenAndServe(":"+conf.HttpPort, m); err != nil {
-		log.Println(err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":" + conf.HttpPort, Handler: m}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println(err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("failed to drain requests:", err)
+	}
+	// the background deployments are awaited and the buffered writes are flushed once no request can start new ones
+	if err := shutdown(shutdownCtx); err != nil {
+		log.Println("failed to shut down deployments:", err)
 	}
 }
@@ -47,7 +47,7 @@ func TestGithubAppInstallation(t *testing.T) {
 	var installAppReq client.GithubWebhookRequest
 	err = json.Unmarshal(appInstallRequestBody, &installAppReq)
 	require.NoError(t, err, "install app request must be unmarshalled")
-	err = apiClient.GithubWebhook(ctx, installAppReq)
+	_, err = apiClient.GithubWebhook(ctx, installAppReq)
 	require.NoError(t, err, "installation github webhook must proceed")
 	// validate the app has been installed and the repos are saved
 	reposResponse, err := apiClient.GetRepos(ctx)
@@ -0,0 +1,3 @@
+ALTER TABLE deployments DROP COLUMN IF EXISTS approvalExpiresAt;
+ALTER TABLE deployments DROP COLUMN IF EXISTS status;
+ALTER TABLE deployments DROP COLUMN IF EXISTS environment;
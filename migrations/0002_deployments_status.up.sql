@@ -0,0 +1,3 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS environment varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS status varchar(40) NOT NULL DEFAULT 'deployed';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS approvalExpiresAt TIMESTAMP;
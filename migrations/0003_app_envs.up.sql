@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS appEnvs (
+    appId uuid REFERENCES installedRepos(id) ON DELETE CASCADE NOT NULL,
+    key varchar(255) NOT NULL,
+    value text NOT NULL,
+    secret boolean NOT NULL DEFAULT false,
+
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (appId, key)
+);
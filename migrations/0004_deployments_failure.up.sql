@@ -0,0 +1 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS failure jsonb;
@@ -0,0 +1,4 @@
+DELETE FROM appEnvs WHERE environment != '';
+ALTER TABLE appEnvs DROP CONSTRAINT IF EXISTS appEnvs_pkey;
+ALTER TABLE appEnvs ADD PRIMARY KEY (appId, key);
+ALTER TABLE appEnvs DROP COLUMN IF EXISTS environment;
@@ -0,0 +1,3 @@
+ALTER TABLE appEnvs ADD COLUMN IF NOT EXISTS environment varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE appEnvs DROP CONSTRAINT IF EXISTS appEnvs_pkey;
+ALTER TABLE appEnvs ADD PRIMARY KEY (appId, environment, key);
@@ -0,0 +1 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS skipReason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE deployments DROP COLUMN IF EXISTS migrationLogs;
+ALTER TABLE deployments DROP COLUMN IF EXISTS skipMigrations;
@@ -0,0 +1,2 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS skipMigrations BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS migrationLogs TEXT NOT NULL DEFAULT '';
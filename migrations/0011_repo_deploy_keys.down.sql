@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS repoDeployKeys;
+
+ALTER TABLE installedRepos DROP COLUMN IF EXISTS authType;
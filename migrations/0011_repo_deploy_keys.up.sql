@@ -0,0 +1,8 @@
+ALTER TABLE installedRepos ADD COLUMN IF NOT EXISTS authType TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS repoDeployKeys (
+    appId uuid REFERENCES installedRepos(id) ON DELETE CASCADE PRIMARY KEY,
+    privateKey text NOT NULL,
+
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
@@ -0,0 +1 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS importedFrom TEXT NOT NULL DEFAULT '';
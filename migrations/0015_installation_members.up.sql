@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS installationMembers (
+    installationGithubId integer NOT NULL,
+    login varchar(255) NOT NULL,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (installationGithubId, login)
+);
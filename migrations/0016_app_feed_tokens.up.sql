@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS appFeedTokens (
+    appId uuid REFERENCES installedRepos(id) ON DELETE CASCADE PRIMARY KEY,
+    tokenHash text NOT NULL,
+
+    updatedAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
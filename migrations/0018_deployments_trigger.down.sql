@@ -0,0 +1,3 @@
+ALTER TABLE deployments DROP COLUMN IF EXISTS ref;
+ALTER TABLE deployments DROP COLUMN IF EXISTS action;
+ALTER TABLE deployments DROP COLUMN IF EXISTS event;
@@ -0,0 +1,3 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS event TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS action TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS ref TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS appEvents (
+    appId uuid NOT NULL,
+    version integer NOT NULL,
+    change text NOT NULL,
+    config jsonb NOT NULL,
+    "user" text NOT NULL DEFAULT '',
+    revertedTo integer NOT NULL DEFAULT 0,
+
+    createdAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (appId, version)
+);
@@ -0,0 +1 @@
+ALTER TABLE deployments DROP COLUMN IF EXISTS promotionExpiresAt;
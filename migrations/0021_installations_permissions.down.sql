@@ -0,0 +1,3 @@
+ALTER TABLE installations DROP COLUMN IF EXISTS permissionsCheckedAt;
+ALTER TABLE installations DROP COLUMN IF EXISTS repositorySelection;
+ALTER TABLE installations DROP COLUMN IF EXISTS permissions;
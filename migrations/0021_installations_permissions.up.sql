@@ -0,0 +1,3 @@
+ALTER TABLE installations ADD COLUMN IF NOT EXISTS permissions jsonb;
+ALTER TABLE installations ADD COLUMN IF NOT EXISTS repositorySelection varchar(40);
+ALTER TABLE installations ADD COLUMN IF NOT EXISTS permissionsCheckedAt TIMESTAMP;
@@ -0,0 +1 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS forceRebuild BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS buildInputs jsonb;
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS rebuildRequired BOOLEAN NOT NULL DEFAULT true;
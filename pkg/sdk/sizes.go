@@ -1,6 +1,7 @@
 package tqsdk
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -14,32 +15,42 @@ type ComputationResource struct {
 }
 
 func (s SizeSlug) ToComputationResource() ComputationResource {
-	parts := strings.Split(string(s), "-")
-	if len(parts) != 3 {
-		panic("expected 3 parts in SizeSlug value, given=" + s)
-	}
-
-	cpuStr, memStr, diskStr := parts[0], parts[1], parts[2]
-	cpu, err := strconv.Atoi(cpuStr)
+	res, err := ParseSizeSlug(s)
 	if err != nil {
 		panic(err)
 	}
+	return res
+}
 
-	mem, err := strconv.Atoi(memStr)
-	if err != nil {
-		panic(err)
+// ParseSizeSlug parses the cpu millis, the memory mebibytes and the disk gibibytes of the slug, e.g. 500-1024-2
+func ParseSizeSlug(s SizeSlug) (ComputationResource, error) {
+	parts := strings.Split(string(s), "-")
+	if len(parts) != 3 {
+		return ComputationResource{}, fmt.Errorf("expected 3 parts in SizeSlug value, given=%s", s)
 	}
 
-	disk, err := strconv.Atoi(diskStr)
-	if err != nil {
-		panic(err)
+	values := make([]int, len(parts))
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return ComputationResource{}, fmt.Errorf("invalid SizeSlug value %s: %w", s, err)
+		}
+		if value <= 0 {
+			return ComputationResource{}, fmt.Errorf("invalid SizeSlug value %s: every part must be positive", s)
+		}
+		values[i] = value
 	}
 
 	return ComputationResource{
-		CpuUnits:   cpu,
-		MemoryMibs: mem,
-		DiskGibs:   disk,
-	}
+		CpuUnits:   values[0],
+		MemoryMibs: values[1],
+		DiskGibs:   values[2],
+	}, nil
+}
+
+// SizeSlug returns the slug of the resources
+func (r ComputationResource) SizeSlug() SizeSlug {
+	return SizeSlug(fmt.Sprintf("%d-%d-%d", r.CpuUnits, r.MemoryMibs, r.DiskGibs))
 }
 
 const (
@@ -1,15 +1,104 @@
 package tqsdk
 
+import "time"
+
 type Space struct {
 	Key    string
 	Region string
 
 	Service Service
+	// Services holds additional services deployed within the same space.
+	Services []Service
+	// ServiceConcurrency limits how many service images are built at the same time.
+	// Zero means all the services of a dependency level are built in parallel.
+	// It orders the builds only, the services are applied at once after all of them are built.
+	ServiceConcurrency int
+	// Environments maps the repo branches to the deploy environments.
+	Environments []Environment
+	// Builder is a name of the docker buildx builder the space images are built with,
+	// e.g. a builder pinned to a specific BuildKit version. The system builder is used if empty.
+	Builder string
+	// Migrations run before the services are rolled out, the rollout is blocked until they succeed.
+	Migrations *Migrations
+	// Paths limits the deployments to the pushes changing a matching repo path.
+	// A pattern is matched with path.Match, a pattern ending with /** matches the whole dir, e.g. src/**.
+	// Every push is deployed if empty.
+	Paths []string
+	// PauseAfterDeploy runs the new version without routing the traffic to it until the deployment is promoted,
+	// e.g. to verify it manually. A deployment not promoted in time is rolled back.
+	PauseAfterDeploy bool
+}
+
+// Migrations is a one-off Job run before every rollout of the space, e.g. to migrate the database schema.
+// The Job runs on every deployment, so the migrations must be idempotent.
+// A commit with the [skip migrations] directive in its message is deployed without running them.
+type Migrations struct {
+	// Service is a name of the service whose image and runtime envs the Job runs with, the primary service if empty.
+	Service string
+	// Image runs the migrations instead of the service image, e.g. an image of a migration tool.
+	Image string
+	// Command overrides the image entrypoint.
+	Command []string
+	// Timeout limits the Job, 10 minutes if empty.
+	Timeout time.Duration
+	// RestartPolicy of the Job pod is Never or OnFailure, Never if empty.
+	// Always is rejected, a Job pod must terminate.
+	RestartPolicy string
+	// BackoffLimit is how many times the failed Job is retried, the migrations run once if empty.
+	BackoffLimit int
+}
+
+// Environment describes where and how a branch is deployed.
+type Environment struct {
+	// Name of the environment, e.g. production or staging.
+	Name string
+	// Branch is a git branch deployed to the environment.
+	Branch string
+	// RequireApproval holds a deployment until it's approved manually.
+	RequireApproval bool
+	// Approvers is a list of github logins allowed to approve or reject the environment deployments.
+	// If empty, anyone with access to the app can do it.
+	Approvers []string
+	// Debounce holds a push for the duration, the further pushes to the branch are coalesced
+	// into one deployment of the latest commit once it elapses. Every push is deployed immediately if empty.
+	Debounce time.Duration
+}
+
+// Environment returns the environment the given branch is deployed to.
+func (s Space) Environment(branch string) (Environment, bool) {
+	for _, env := range s.Environments {
+		if env.Branch == branch {
+			return env, true
+		}
+	}
+	return Environment{}, false
+}
+
+// AllServices returns the primary service followed by the additional ones.
+func (s Space) AllServices() []Service {
+	services := make([]Service, 0, len(s.Services)+1)
+	if s.Service.Name != "" {
+		services = append(services, s.Service)
+	}
+	return append(services, s.Services...)
 }
 
+// Service builders select how a service image is built.
+const (
+	// BuilderDocker builds the service Dockerfile.
+	BuilderDocker = "docker"
+	// BuilderBuildpack builds the repo source with Cloud Native Buildpacks, no Dockerfile is needed.
+	BuilderBuildpack = "buildpack"
+)
+
 type Service struct {
 	Key string
+	// Builder is BuilderDocker or BuilderBuildpack. If empty, the Dockerfile is built if there's one,
+	// otherwise the source is built with buildpacks if treenq enables them.
+	// The space Builder selects the docker buildx builder, it's not used to build with buildpacks.
+	Builder string
 	// The path to a Dockerfile relative to the root of the repo. If set, overrides usage of buildpacks.
+	// If empty, the only Dockerfile found in the root of the repo is used.
 	DockerfilePath string
 	BuildEnvs      map[string]string
 	RuntimeEnvs    map[string]string
@@ -26,4 +115,29 @@ type Service struct {
 	// The name of the component.
 	Name     string
 	SizeSlug SizeSlug
+	// DependsOn lists the names of the services which must be built before this one,
+	// the services are applied together, so it doesn't wait for them to be ready.
+	DependsOn []string
+	// SmokeTest checks the service once it's deployed, the deployment fails if the check doesn't pass.
+	SmokeTest *SmokeTest
+	// ReadinessCommand is run in the service container to check it's ready, e.g. a queue consumer has connected.
+	// The service is ready once the command exits with 0, the rollout waits for it.
+	ReadinessCommand []string
+	// MaintenanceMode routes the service traffic to the treenq maintenance page
+	// while the service is deployed, until the new version is ready.
+	MaintenanceMode bool
+}
+
+// SmokeTest is an HTTP GET request made to the service Host after the deployment.
+type SmokeTest struct {
+	// Path is requested on the service host, e.g. /healthz.
+	Path string
+	// ExpectedStatus is the expected response status code, 200 if empty.
+	ExpectedStatus int
+	// Timeout limits a single request, 10 seconds if empty.
+	Timeout time.Duration
+	// Retries is how many times a failed check is repeated before the deployment fails.
+	Retries int
+	// RollbackOnFailure applies the previous successful deployment if the smoke test fails.
+	RollbackOnFailure bool
 }
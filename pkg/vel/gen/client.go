@@ -87,7 +87,7 @@ func collectStructs(field Field, dataTypeSet map[string]struct{}) ([]DataType, e
 	if field.Type.Kind() == reflect.Pointer {
 		field.Type = field.Type.Elem()
 	}
-	if field.Type.Kind() == reflect.Struct {
+	if field.Type.Kind() == reflect.Struct && !isTime(field.Type) {
 		subTypes, err := collectTypes(field, dataTypeSet)
 		if err != nil {
 			return nil, err
@@ -110,7 +110,7 @@ func collectTypes(field Field, dataTypeSet map[string]struct{}) ([]DataType, err
 		dataTypeSet[name] = struct{}{}
 
 		for _, subField := range subType.Fields {
-			if subField.Type.Kind() == reflect.Struct {
+			if subField.Type.Kind() == reflect.Struct && !isTime(subField.Type) {
 				subTypes, err := collectTypes(subField, dataTypeSet)
 				if err != nil {
 					return nil, err
@@ -122,7 +122,7 @@ func collectTypes(field Field, dataTypeSet map[string]struct{}) ([]DataType, err
 				if subField.Type.Elem().Kind() == reflect.Pointer {
 					subField.Type = subField.Type.Elem()
 				}
-				if subField.Type.Elem().Kind() == reflect.Struct {
+				if subField.Type.Elem().Kind() == reflect.Struct && !isTime(subField.Type.Elem()) {
 					subField.Type = subField.Type.Elem()
 					subTypes, err := collectTypes(subField, dataTypeSet)
 					if err != nil {
@@ -165,9 +165,15 @@ func extractDataType(t reflect.Type) (DataType, error) {
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		typeName := field.Type.String()
+		if isNamedBasic(field.Type) {
+			typeName = field.Type.Kind().String()
+		}
 		if field.Type.Kind() == reflect.Struct {
 			typeName = field.Type.Name()
 		}
+		if isTime(field.Type) {
+			typeName = "time.Time"
+		}
 		if field.Type.Kind() == reflect.Pointer && field.Type.Elem().Kind() == reflect.Struct {
 			typeName = "*" + field.Type.Elem().Name()
 		}
@@ -271,6 +277,20 @@ func (g *ClientGen) Generate(w io.Writer) error {
 	return nil
 }
 
+// isTime reports whether the type is time.Time, it's generated as is instead of copying its fields
+func isTime(t reflect.Type) bool {
+	return t.PkgPath() == "time" && t.Name() == "Time"
+}
+
+// isNamedBasic reports whether the type is a named type over a basic kind, e.g. type Status string,
+// such types are generated as their underlying kind
+func isNamedBasic(t reflect.Type) bool {
+	if t.PkgPath() == "" {
+		return false
+	}
+	return t.Kind() >= reflect.Bool && t.Kind() <= reflect.Complex128 || t.Kind() == reflect.String
+}
+
 func Capitalize(s string) string {
 	r := []rune(s)
 	r[0] = unicode.ToUpper(r[0])
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	_ "embed"
 	"log"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -67,6 +69,13 @@ type HighPointer struct {
 type Empty struct {
 }
 
+type Status string
+
+type TestTypeTimeAndNamedTypes struct {
+	CreatedAt time.Time
+	Status    Status
+}
+
 func TestGenClient(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skip: requires goimports installation")
@@ -91,7 +100,7 @@ func TestGenClient(t *testing.T) {
 func TestJo(t *testing.T) {
 	buf := &bytes.Buffer{}
 
-	router := api.NewRouter(&domain.Handler{}, vel.NoopMiddleware, vel.NoopMiddleware)
+	router := api.NewRouter(&domain.Handler{}, vel.NoopMiddleware, vel.NoopMiddleware, vel.NoopMiddleware, vel.NoopMiddleware, vel.NoopMiddleware)
 	gener, err := New(ClientDesc{
 		TypeName:    "Client",
 		PackageName: "client",
@@ -104,3 +113,15 @@ func TestJo(t *testing.T) {
 	t.Log(buf.String())
 	require.NoError(t, err)
 }
+
+func TestExtractDataTypeTimeAndNamedTypes(t *testing.T) {
+	dataType, err := extractDataType(reflect.TypeOf(TestTypeTimeAndNamedTypes{}))
+	require.NoError(t, err)
+	require.Len(t, dataType.Fields, 2)
+	assert.Equal(t, "time.Time", dataType.Fields[0].TypeName)
+	assert.Equal(t, "string", dataType.Fields[1].TypeName)
+
+	types, err := collectStructs(dataType.Fields[0], map[string]struct{}{})
+	require.NoError(t, err)
+	assert.Empty(t, types, "time.Time fields must not be generated")
+}
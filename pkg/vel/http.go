@@ -11,3 +11,10 @@ func Redirect(ctx context.Context, url string, status int) {
 
 	http.Redirect(w, r, url, status)
 }
+
+// WriteStatus sets the status code of the response the handler returns, it's 200 unless set
+func WriteStatus(ctx context.Context, status int) {
+	if w := WriterFromContext(ctx); w != nil {
+		w.WriteHeader(status)
+	}
+}
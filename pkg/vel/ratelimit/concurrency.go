@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+var ErrServerBusy = &vel.Error{
+	Code:    "SERVER_BUSY",
+	Message: "too many requests in progress, try again later",
+}
+
+// NewConcurrencyMiddleware runs at most limit requests at once, a request over the limit waits for a free slot
+// up to wait and is responded with 503 then. Each path gets its own middleware, so a flood of one path
+// never holds the slots of the other. A zero limit doesn't limit the requests.
+func NewConcurrencyMiddleware(limit int, wait time.Duration, l *slog.Logger) vel.Middleware {
+	if limit <= 0 {
+		return vel.NoopMiddleware
+	}
+	slots := make(chan struct{}, limit)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				l.WarnContext(r.Context(), "request concurrency limited", "path", r.URL.Path, "limit", limit)
+				w.Header().Set("Retry-After", "10")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				if err := json.NewEncoder(w).Encode(ErrServerBusy); err != nil {
+					l.ErrorContext(r.Context(), "failed to encode error", "err", err)
+				}
+				return
+			case <-r.Context().Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyMiddlewareRejectsRequestsOverLimit(t *testing.T) {
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	webhook := NewConcurrencyMiddleware(2, 10*time.Millisecond, l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	api := NewConcurrencyMiddleware(2, 10*time.Millisecond, l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := httptest.NewRecorder()
+			webhook.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/githubWebhook", nil))
+			codes <- res.Code
+		}()
+	}
+	<-started
+	<-started
+
+	res := httptest.NewRecorder()
+	webhook.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/githubWebhook", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "10", res.Header().Get("Retry-After"))
+
+	res = httptest.NewRecorder()
+	api.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/getProfile", nil))
+	assert.Equal(t, http.StatusOK, res.Code, "the api path is limited on its own")
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		require.Equal(t, http.StatusOK, code)
+	}
+}
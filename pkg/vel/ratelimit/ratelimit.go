@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+	"golang.org/x/time/rate"
+)
+
+var ErrTooManyRequests = &vel.Error{
+	Code:    "TOO_MANY_REQUESTS",
+	Message: "too many requests, try again later",
+}
+
+// idleTtl is how long the limiter of an inactive client is kept
+const idleTtl = 10 * time.Minute
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// IPRateLimiter limits the request rate of every client IP separately using a token bucket
+type IPRateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+// NewIPRateLimiter allows a client IP to make burst requests at once and refills them at the given rate
+func NewIPRateLimiter(limit rate.Limit, burst int) *IPRateLimiter {
+	return &IPRateLimiter{
+		limit:     limit,
+		burst:     burst,
+		clients:   make(map[string]*client),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether the ip is allowed to make a request now
+func (l *IPRateLimiter) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleTtl {
+		for key, c := range l.clients {
+			if now.Sub(c.lastSeen) > idleTtl {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.lastSeen = now
+	return c.limiter.AllowN(now, 1)
+}
+
+// clientIP takes the connection remote address,
+// the forwarded headers are not trusted since the client can set them to bypass the limit
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NewMiddleware responds with 429 once the client IP exceeds the limiter rate
+func NewMiddleware(limiter *IPRateLimiter, l *slog.Logger) vel.Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := clientIP(r)
+			if !limiter.Allow(ip) {
+				l.WarnContext(r.Context(), "request rate limited", "ip", ip, "path", r.URL.Path)
+				w.Header().Set("Retry-After", "60")
+				w.WriteHeader(http.StatusTooManyRequests)
+				if err := json.NewEncoder(w).Encode(ErrTooManyRequests); err != nil {
+					l.ErrorContext(r.Context(), "failed to encode error", "err", err)
+				}
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestMiddlewareThrottlesCallbackAttemptsFromOneIP(t *testing.T) {
+	var calls int
+	callback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	})
+	// a single token a minute to keep the bucket empty during the test
+	limiter := NewIPRateLimiter(rate.Every(time.Minute), 3)
+	handler := NewMiddleware(limiter, slog.New(slog.NewTextHandler(io.Discard, nil)))(callback)
+
+	attempt := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/authCallback?state=guess&code=guess", nil)
+		req.RemoteAddr = remoteAddr
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusTemporaryRedirect, attempt("203.0.113.7:51000"))
+	}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, attempt("203.0.113.7:51001"), "another port of the same IP must share the limit")
+	}
+	assert.Equal(t, 3, calls)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, attempt("198.51.100.1:40000"), "other IPs must not be affected")
+}
@@ -121,6 +121,16 @@ func NoopMiddleware(h http.Handler) http.Handler {
 	return h
 }
 
+// Chain combines the middlewares into one, they're applied in the Register order, so the last one runs first
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler http.Handler) http.Handler {
+		for i := range middlewares {
+			handler = middlewares[i](handler)
+		}
+		return handler
+	}
+}
+
 func Register[I, O any](r *Router, operationID string, handler Handler[I, O], middlewares ...Middleware) {
 	var i I
 	var o O
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -15,9 +18,11 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/treenq/treenq/pkg/crypto"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
 	"github.com/treenq/treenq/pkg/vel"
 	"github.com/treenq/treenq/pkg/vel/auth"
 	"github.com/treenq/treenq/pkg/vel/log"
+	"github.com/treenq/treenq/pkg/vel/ratelimit"
 	"github.com/treenq/treenq/src/domain"
 	"github.com/treenq/treenq/src/repo"
 	"github.com/treenq/treenq/src/repo/artifacts"
@@ -25,6 +30,8 @@ import (
 
 	authService "github.com/treenq/treenq/src/services/auth"
 	"github.com/treenq/treenq/src/services/cdk"
+	"github.com/treenq/treenq/src/services/notify"
+	"golang.org/x/time/rate"
 )
 
 func OpenDB(dbDsn, migrationsDirName string) (*sqlx.DB, error) {
@@ -52,20 +59,27 @@ func OpenDB(dbDsn, migrationsDirName string) (*sqlx.DB, error) {
 	return db, nil
 }
 
-func New(conf Config) (http.Handler, error) {
+// New builds the api handler, the returned shutdown flushes the buffered writes once the server is drained
+func New(conf Config) (http.Handler, func(context.Context) error, error) {
 	wd, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	l := log.NewLogger(os.Stdout, slog.LevelDebug)
 
 	db, err := OpenDB(conf.DbDsn, conf.MigrationsDir)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	store, err := repo.NewStore(db)
+	db.SetMaxOpenConns(conf.ApiDbMaxConns)
+	webhookDB, err := sqlx.Connect("pgx", conf.DbDsn)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to connect the webhook pool to postgres: %w", err)
+	}
+	webhookDB.SetMaxOpenConns(conf.WebhookDbMaxConns)
+	store, err := repo.NewStore(db, webhookDB)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	githubJwtIssuer := auth.NewJwtIssuer(conf.GithubClientID, []byte(conf.GithubPrivateKey), nil, conf.JwtTtl)
@@ -73,8 +87,12 @@ func New(conf Config) (http.Handler, error) {
 	githubClient := repo.NewGithubClient(githubJwtIssuer, http.DefaultClient)
 	gitDir := filepath.Join(wd, "gits")
 	gitClient := repo.NewGit(gitDir)
-	docker := artifacts.NewDockerArtifactory(conf.DockerRegistry)
-	extractor := extract.NewExtractor(filepath.Join(wd, "builder"), conf.BuilderPackage)
+	docker := artifacts.NewDockerArtifactory(conf.DockerRegistry, conf.DockerBuilders, conf.BuildpackBuilder)
+	var registry domain.ImageRegistry
+	if conf.ImageCheck {
+		registry = artifacts.NewRegistry(http.DefaultClient, conf.RegistryInsecure, conf.RegistryUsername, conf.RegistryPassword)
+	}
+	extractor := extract.NewExtractor(filepath.Join(wd, "builder"), conf.BuilderPackage, conf.StrictConfigOverlays)
 
 	authMiddleware := auth.NewJwtMiddleware(authJwtIssuer, l)
 	githubAuthMiddleware := vel.NoopMiddleware
@@ -84,38 +102,159 @@ func New(conf Config) (http.Handler, error) {
 	}
 
 	oauthProvider := authService.New(conf.GithubClientID, conf.GithubSecret, conf.GithubRedirectURL)
-	kube := cdk.NewKube()
+	kube := cdk.NewKube(conf.MaintenanceHost)
+	var notifier domain.Notifier
+	if conf.NotifyWebhookURL != "" {
+		notifier = notify.NewWebhookNotifier(http.DefaultClient, conf.NotifyWebhookURL)
+	}
+	visibility := domain.VisibilityPolicy{
+		Default: domain.RepoVisibility(conf.RepoVisibility),
+		Orgs:    make(map[string]domain.RepoVisibility, len(conf.RepoVisibilityOrgs)),
+	}
+	for org, orgVisibility := range conf.RepoVisibilityOrgs {
+		visibility.Orgs[org] = domain.RepoVisibility(orgVisibility)
+	}
+	if err := visibility.Validate(); err != nil {
+		return nil, nil, err
+	}
+	signing := domain.ImageSigning{Required: conf.CosignRequired}
+	if conf.CosignKey != "" {
+		signing.Signer = artifacts.NewCosignSigner(conf.CosignKey)
+	}
+	if err := signing.Validate(); err != nil {
+		return nil, nil, err
+	}
+	var tagImmutability domain.TagImmutability
+	if conf.ImmutableTagPattern != "" {
+		immutable, err := regexp.Compile(conf.ImmutableTagPattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid immutable tag pattern: %w", err)
+		}
+		tagImmutability.Immutable = immutable
+	}
+	resources := domain.ResourceProfile{
+		Default: tqsdk.SizeSlug(conf.DefaultSizeSlug),
+		Max:     tqsdk.SizeSlug(conf.MaxSizeSlug),
+		Ceiling: domain.ResourceCeilingPolicy(conf.SizeCeilingPolicy),
+	}
+	if err := resources.Validate(); err != nil {
+		return nil, nil, err
+	}
+	// the status buffer is started last, an error above must not leak its flush
+	statusBuffer := domain.NewStatusBuffer(store, conf.StatusFlushInterval, l)
 	handlers := domain.NewHandler(
-		store,
+		statusBuffer,
 		githubClient,
 		gitClient,
 		extractor,
 		docker,
+		registry,
 		kube,
+		notifier,
 		conf.KubeConfig,
+		conf.DeployApprovalTtl,
+		conf.PromotionTtl,
+		domain.DeployTimeouts{
+			Deploy: conf.DeployTimeout,
+			Build:  conf.BuildTimeout,
+			Apply:  conf.ApplyTimeout,
+			Slow:   conf.SlowDeployThreshold,
+			Ack:    conf.WebhookAckTimeout,
+		},
+		conf.ArchiveMaxSize,
+		domain.DeploymentRetention{
+			Count: conf.DeploymentRetentionCount,
+			Age:   time.Duration(conf.DeploymentRetentionDays) * 24 * time.Hour,
+		},
+		domain.ImageConcurrency{
+			Builds: conf.BuildConcurrency,
+			Pushes: conf.PushConcurrency,
+		},
+		conf.ExtractorPoolSize,
+		visibility,
+		signing,
+		tagImmutability,
+		domain.PlanLimits{
+			Apps:         conf.PlanApps,
+			Deployments:  conf.PlanDeployments,
+			BuildMinutes: conf.PlanBuildMinutes,
+		},
+		resources,
+		domain.BaseImagePolicy{Allowed: conf.AllowedBaseImages},
+		domain.CloneProtocol(conf.CloneProtocol),
+		conf.LegacyDefaultBranches,
+		domain.WebhookEvents(conf.GithubWebhookEvents),
+		domain.Admins(conf.AdminLogins),
 		oauthProvider,
 		authJwtIssuer,
 		conf.GithubWebhookURL,
 		l,
 	)
-	return NewRouter(handlers, authMiddleware, githubAuthMiddleware, log.NewLoggingMiddleware(l)).Mux(), nil
+	go func() {
+		if err := handlers.MigrateConnectionBranches(context.Background()); err != nil {
+			l.Error("failed to migrate connection branches", "err", err)
+		}
+	}()
+	authRateLimiter := ratelimit.NewIPRateLimiter(rate.Limit(float64(conf.AuthRateLimit)/60), conf.AuthRateBurst)
+	authRateLimit := ratelimit.NewMiddleware(authRateLimiter, l)
+	webhookLimit := vel.Chain(repo.WebhookPoolMiddleware, ratelimit.NewConcurrencyMiddleware(conf.WebhookConcurrency, conf.ConcurrencyWait, l))
+	apiLimit := ratelimit.NewConcurrencyMiddleware(conf.ApiConcurrency, conf.ConcurrencyWait, l)
+	// the background deployments write their statuses, the buffer is closed once they're done
+	shutdown := func(ctx context.Context) error {
+		return errors.Join(handlers.Shutdown(ctx), statusBuffer.Close(ctx))
+	}
+	return NewRouter(handlers, authMiddleware, githubAuthMiddleware, authRateLimit, webhookLimit, apiLimit, log.NewLoggingMiddleware(l)).Mux(), shutdown, nil
 }
 
-func NewRouter(handlers *domain.Handler, auth, githubAuth vel.Middleware, middlewares ...vel.Middleware) *vel.Router {
+// NewRouter registers the handlers, the webhook is limited by webhookLimit and the interactive requests by apiLimit,
+// the feed and the status are not limited as a feed is held open and the status serves the health checks
+func NewRouter(handlers *domain.Handler, auth, githubAuth, authRateLimit, webhookLimit, apiLimit vel.Middleware, middlewares ...vel.Middleware) *vel.Router {
 	router := vel.NewRouter()
 	for i := range middlewares {
 		router.Use(middlewares[i])
 	}
+	auth = vel.Chain(auth, apiLimit)
+	authRateLimit = vel.Chain(authRateLimit, apiLimit)
 
-	vel.RegisterHandlerFunc(router, "/auth", handlers.GithubAuthHandler)
-	vel.RegisterHandlerFunc(router, "/authCallback", handlers.GithubCallbackHandler)
+	vel.RegisterHandlerFunc(router, "/auth", handlers.GithubAuthHandler, authRateLimit)
+	vel.RegisterHandlerFunc(router, "/authCallback", handlers.GithubCallbackHandler, authRateLimit)
+	// the feed is authorized by the app feed token
+	vel.RegisterHandlerFunc(router, "GET /apps/{id}/feed", handlers.AppFeedHandler)
 
-	vel.Register(router, "githubWebhook", handlers.GithubWebhook, githubAuth)
+	// a draining instance rejects the deliveries before they wait for a webhook slot
+	vel.Register(router, "githubWebhook", handlers.GithubWebhook, githubAuth, webhookLimit, handlers.DrainingMiddleware)
+	// the instance load is public as the health check is
+	vel.Register(router, "status", handlers.Status)
 
 	// regular authentication handlers
 	vel.Register(router, "info", handlers.Info, auth)
 	vel.Register(router, "getProfile", handlers.GetProfile, auth)
 	vel.Register(router, "getRepos", handlers.GetRepos, auth)
+	vel.Register(router, "verifyInstallation", handlers.VerifyInstallation, auth)
+	vel.Register(router, "approveDeployment", handlers.ApproveDeployment, auth)
+	vel.Register(router, "rejectDeployment", handlers.RejectDeployment, auth)
+	vel.Register(router, "promoteDeployment", handlers.PromoteDeployment, auth)
+	vel.Register(router, "getAppEnv", handlers.GetAppEnv, auth)
+	vel.Register(router, "setAppEnv", handlers.SetAppEnv, auth)
+	vel.Register(router, "deployArchive", handlers.DeployArchive, auth)
+	vel.Register(router, "redeploy", handlers.Redeploy, auth)
+	vel.Register(router, "rollback", handlers.Rollback, auth)
+	vel.Register(router, "getAppResources", handlers.GetAppResources, auth)
+	vel.Register(router, "getDeployment", handlers.GetDeployment, auth)
+	vel.Register(router, "getDeploymentTimeline", handlers.GetDeploymentTimeline, auth)
+	vel.Register(router, "getUsage", handlers.GetUsage, auth)
+	vel.Register(router, "getDeploymentStats", handlers.GetDeploymentStats, auth)
+	vel.Register(router, "setDeployKey", handlers.SetDeployKey, auth)
+	vel.Register(router, "planDeployment", handlers.PlanDeployment, auth)
+	vel.Register(router, "simulateWebhook", handlers.SimulateWebhook, auth)
+	vel.Register(router, "connectRepository", handlers.ConnectRepository, auth)
+	vel.Register(router, "importApp", handlers.ImportApp, auth)
+	vel.Register(router, "buildImage", handlers.BuildImage, auth)
+	vel.Register(router, "issueFeedToken", handlers.IssueFeedToken, auth)
+	vel.Register(router, "cancelDeployment", handlers.CancelDeployment, auth)
+	vel.Register(router, "getAppHistory", handlers.GetAppHistory, auth)
+	vel.Register(router, "revertToVersion", handlers.RevertToVersion, auth)
+	vel.Register(router, "setDraining", handlers.SetDraining, auth)
 
 	return router
 }
@@ -24,19 +24,127 @@ type Config struct {
 
 	DoToken        string `envconfig:"DO_TOKEN" required:"true"`
 	DockerRegistry string `envconfig:"DOCKER_REGISTRY" required:"true"`
+	// RegistryUsername and RegistryPassword are the credentials the cluster pulls the images with,
+	// RegistryInsecure queries the registry over plain http, e.g. a local one.
+	// ImageCheck makes sure the registry holds the deployed images before they are applied
+	RegistryUsername string `envconfig:"REGISTRY_USERNAME" required:"false"`
+	RegistryPassword string `envconfig:"REGISTRY_PASSWORD" required:"false"`
+	RegistryInsecure bool   `envconfig:"REGISTRY_INSECURE" default:"false"`
+	ImageCheck       bool   `envconfig:"IMAGE_CHECK" default:"true"`
+	// DockerBuilders is a comma separated list of the docker buildx builders the apps can select
+	DockerBuilders []string `envconfig:"DOCKER_BUILDERS" required:"false"`
+	// BuildpackBuilder is the Cloud Native Buildpacks builder image the services without a Dockerfile are built with,
+	// e.g. paketobuildpacks/builder-jammy-base. Buildpacks are disabled if it's empty
+	BuildpackBuilder string `envconfig:"BUILDPACK_BUILDER" required:"false"`
 
 	DbDsn         string `envconfig:"DB_DSN" required:"true"`
 	MigrationsDir string `envconfig:"MIGRATIONS_DIR" required:"true"`
 
 	HttpPort string `envconfig:"HTTP_PORT" default:"8000"`
+	// ShutdownTimeout limits draining the requests and the background deployments on shutdown
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	// StatusFlushInterval is how often the intermediate deployment statuses are written in a batch
+	StatusFlushInterval time.Duration `envconfig:"STATUS_FLUSH_INTERVAL" default:"2s"`
 
 	BuilderPackage string `envconfig:"BUILDER_PACKAGE" required:"false"`
+	// StrictConfigOverlays fails the .treenq repo config once two of its overlays set a value differently
+	StrictConfigOverlays bool `envconfig:"STRICT_CONFIG_OVERLAYS" default:"false"`
 
 	KubeConfig string `envconfig:"KUBE_CONFIG" required:"true"`
 
+	// RepoVisibility selects the deployed repos by visibility: all, public or private,
+	// RepoVisibilityOrgs overrides it per github org, e.g. "treenq:public,acme:private"
+	RepoVisibility     string            `envconfig:"REPO_VISIBILITY" default:"all"`
+	RepoVisibilityOrgs map[string]string `envconfig:"REPO_VISIBILITY_ORGS" required:"false"`
+	// MaintenanceHost is a host of the maintenance page backend the maintenance mode services are routed to
+	MaintenanceHost string `envconfig:"MAINTENANCE_HOST" default:"maintenance.treenq.svc.cluster.local"`
+
+	// DeployApprovalTtl is how long a deployment awaits approval before it expires, zero never expires it
+	DeployApprovalTtl time.Duration `envconfig:"DEPLOY_APPROVAL_TTL" default:"24h"`
+	// PromotionTtl is how long a paused deployment awaits promotion before it's rolled back
+	PromotionTtl time.Duration `envconfig:"PROMOTION_TTL" default:"24h"`
+	// DeployTimeout is a deadline of the whole repo deployment, BuildTimeout and ApplyTimeout limit its stages
+	DeployTimeout time.Duration `envconfig:"DEPLOY_TIMEOUT" default:"30m"`
+	BuildTimeout  time.Duration `envconfig:"BUILD_TIMEOUT" default:"15m"`
+	ApplyTimeout  time.Duration `envconfig:"APPLY_TIMEOUT" default:"2m"`
+	// SlowDeployThreshold is how long a deployment runs before it's notified as slow to the NotifyWebhookURL,
+	// the deployment goes on, zero disables the notification
+	SlowDeployThreshold time.Duration `envconfig:"SLOW_DEPLOY_THRESHOLD" default:"10m"`
+	// WebhookAckTimeout is how long a webhook delivery waits for its deployments before it's acked with them queued,
+	// github gives up on a delivery after 10 seconds, zero waits until the deployments are done
+	WebhookAckTimeout time.Duration `envconfig:"WEBHOOK_ACK_TIMEOUT" default:"8s"`
+	// NotifyWebhookURL receives the deployment notifications posted as json, nothing is sent if it's empty
+	NotifyWebhookURL string `envconfig:"NOTIFY_WEBHOOK_URL" required:"false"`
+
+	// BuildConcurrency and PushConcurrency limit the image builds and pushes made at the same time by all the deployments
+	// sharing the docker daemon, the builds are CPU bound and serialized by default while the pushes wait for the registry.
+	// The waiting builds are queued, the status endpoint reports them
+	BuildConcurrency int `envconfig:"BUILD_CONCURRENCY" default:"1"`
+	PushConcurrency  int `envconfig:"PUSH_CONCURRENCY" default:"4"`
+	// ExtractorPoolSize caps the config extractors opened at the same time, the deployments reuse the released ones
+	// and wait for one while all of them are taken. Zero opens an extractor for every deployment
+	ExtractorPoolSize int `envconfig:"EXTRACTOR_POOL_SIZE" default:"4"`
+
+	// CosignKey is a cosign key the pushed images are signed with, the images aren't signed if empty.
+	// CosignRequired fails the deployments of the images which can't be signed
+	CosignKey      string `envconfig:"COSIGN_KEY" required:"false"`
+	CosignRequired bool   `envconfig:"COSIGN_REQUIRED" default:"false"`
+
+	// ImmutableTagPattern matches the image tags which must never be moved once pushed, the sha tags by default,
+	// an empty pattern allows to move any tag
+	ImmutableTagPattern string `envconfig:"IMMUTABLE_TAG_PATTERN" default:"^[0-9a-f]{7,40}$"`
+
+	// DefaultSizeSlug is the size of a service declaring none, MaxSizeSlug caps every resource of the declared sizes,
+	// SizeCeilingPolicy clamps a size above the max to it or rejects the deployment: clamp or reject
+	DefaultSizeSlug   string `envconfig:"DEFAULT_SIZE_SLUG" default:"500-1024-2"`
+	MaxSizeSlug       string `envconfig:"MAX_SIZE_SLUG" required:"false"`
+	SizeCeilingPolicy string `envconfig:"SIZE_CEILING_POLICY" default:"clamp"`
+
+	// AllowedBaseImages are the comma separated image prefixes the Dockerfile FROM images must start with,
+	// e.g. gcr.io/distroless/,golang, any base image is allowed if it's empty
+	AllowedBaseImages []string `envconfig:"ALLOWED_BASE_IMAGES" required:"false"`
+	// CloneProtocol is the protocol the repos are cloned over first, https or ssh,
+	// the other one is tried if the remote isn't reachable over it
+	CloneProtocol string `envconfig:"CLONE_PROTOCOL" default:"https"`
+	// LegacyDefaultBranches deploys both main and master of the repos connected without a branch,
+	// once it's off the repos are connected to their default branch at the start
+	LegacyDefaultBranches bool `envconfig:"LEGACY_DEFAULT_BRANCHES" default:"false"`
+	// GithubWebhookEvents are the X-GitHub-Event types the webhook processes, the other deliveries are acknowledged only.
+	// The default events are the handled ones, repository, organization and membership keep the renames and the members in sync.
+	GithubWebhookEvents []string `envconfig:"GITHUB_WEBHOOK_EVENTS" default:"push,installation,installation_repositories,pull_request,repository,organization,membership"`
+	// AdminLogins are the comma separated github logins allowed to operate the instance, e.g. to drain it, nobody if it's empty
+	AdminLogins []string `envconfig:"ADMIN_LOGINS" required:"false"`
+
+	// ArchiveMaxSize limits the source archive size in bytes accepted by deployArchive, 100MB by default
+	ArchiveMaxSize int64 `envconfig:"ARCHIVE_MAX_SIZE" default:"104857600"`
+
+	// DeploymentRetentionCount is how many latest deployments of an app are stored,
+	// DeploymentRetentionDays keeps the younger deployments beyond the count, zero disables each of them
+	DeploymentRetentionCount int `envconfig:"DEPLOYMENT_RETENTION_COUNT" default:"100"`
+	DeploymentRetentionDays  int `envconfig:"DEPLOYMENT_RETENTION_DAYS" default:"0"`
+
+	// PlanApps, PlanDeployments and PlanBuildMinutes are the plan limits reported to the users,
+	// the deployments and build minutes are counted per calendar month, zero is unlimited
+	PlanApps         int `envconfig:"PLAN_APPS" default:"0"`
+	PlanDeployments  int `envconfig:"PLAN_DEPLOYMENTS" default:"0"`
+	PlanBuildMinutes int `envconfig:"PLAN_BUILD_MINUTES" default:"0"`
+
 	AuthPrivateKey StringBase64  `envconfig:"AUTH_PRIVATE_KEY" required:"true"`
 	AuthPublicKey  StringBase64  `envconfig:"AUTH_PUBLIC_KEY" required:"true"`
 	AuthTtl        time.Duration `envconfig:"AUTH_TTL" default:"24h"`
+	// AuthRateLimit is how many auth requests per minute a client IP can make after AuthRateBurst is used
+	AuthRateLimit int `envconfig:"AUTH_RATE_LIMIT" default:"10"`
+	AuthRateBurst int `envconfig:"AUTH_RATE_BURST" default:"5"`
+
+	// ApiDbMaxConns and WebhookDbMaxConns size the db connection pools of the interactive and the webhook requests,
+	// so a webhook storm can't exhaust the connections the logins need
+	ApiDbMaxConns     int `envconfig:"API_DB_MAX_CONNS" default:"20"`
+	WebhookDbMaxConns int `envconfig:"WEBHOOK_DB_MAX_CONNS" default:"10"`
+	// ApiConcurrency and WebhookConcurrency limit the requests served at once on each path, zero is unlimited,
+	// a request over the limit waits up to ConcurrencyWait for a slot and is responded with 503 then
+	ApiConcurrency     int           `envconfig:"API_CONCURRENCY" default:"200"`
+	WebhookConcurrency int           `envconfig:"WEBHOOK_CONCURRENCY" default:"50"`
+	ConcurrencyWait    time.Duration `envconfig:"CONCURRENCY_WAIT" default:"10s"`
 }
 
 type StringBase64 string
@@ -0,0 +1,275 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// maskedEnvValue replaces secret values returned to the api callers
+const maskedEnvValue = "******"
+
+// AppEnv is a runtime env variable set via api, it overrides the variable of the repo config
+type AppEnv struct {
+	// Environment scopes the variable to the space environment,
+	// the plain variables of an empty environment are shared by all the environments
+	Environment string `json:"environment"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Secret      bool   `json:"secret"`
+}
+
+type GetAppEnvRequest struct {
+	AppID       string `json:"appId"`
+	Environment string `json:"environment"`
+}
+
+type GetAppEnvResponse struct {
+	Envs []AppEnv `json:"envs"`
+}
+
+func (h *Handler) GetAppEnv(ctx context.Context, req GetAppEnvRequest) (GetAppEnvResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return GetAppEnvResponse{}, rpcErr
+	}
+
+	envs, err := h.db.GetAppEnvs(ctx, req.AppID)
+	if err != nil {
+		return GetAppEnvResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	return GetAppEnvResponse{Envs: maskAppEnvs(environmentAppEnvs(envs, req.Environment))}, nil
+}
+
+type SetAppEnvRequest struct {
+	AppID string `json:"appId"`
+	// Environment is a scope of the set and removed envs
+	Environment string   `json:"environment"`
+	Envs        []AppEnv `json:"envs"`
+	// Remove lists the env keys to delete
+	Remove []string `json:"remove"`
+	// Redeploy applies the latest deployment with the updated env, the images are not rebuilt
+	Redeploy bool `json:"redeploy"`
+}
+
+type SetAppEnvResponse struct {
+	Envs []AppEnv `json:"envs"`
+	// DeploymentID is set if the app has been redeployed
+	DeploymentID string `json:"deploymentId"`
+}
+
+func (h *Handler) SetAppEnv(ctx context.Context, req SetAppEnvRequest) (SetAppEnvResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return SetAppEnvResponse{}, rpcErr
+	}
+	for _, env := range req.Envs {
+		if env.Key == "" {
+			return SetAppEnvResponse{}, &vel.Error{
+				Code:    "INVALID_ENV_KEY",
+				Message: "env key must not be empty",
+			}
+		}
+	}
+
+	if err := h.db.SetAppEnvs(ctx, req.AppID, req.Environment, req.Envs, req.Remove); err != nil {
+		return SetAppEnvResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if _, err := h.recordAppChange(ctx, req.AppID, AppChangeEnv, 0); err != nil {
+		return SetAppEnvResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	envs, err := h.db.GetAppEnvs(ctx, req.AppID)
+	if err != nil {
+		return SetAppEnvResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	res := SetAppEnvResponse{Envs: maskAppEnvs(environmentAppEnvs(envs, req.Environment))}
+
+	if req.Redeploy {
+		def, rpcErr := h.redeployLatest(ctx, req.AppID)
+		if rpcErr != nil {
+			return res, rpcErr
+		}
+		res.DeploymentID = def.ID
+	}
+
+	return res, nil
+}
+
+// redeployLatest applies the latest successful app deployment again using its built images
+func (h *Handler) redeployLatest(ctx context.Context, appID string) (AppDefinition, *vel.Error) {
+	history, err := h.db.GetDeploymentHistory(ctx, appID)
+	if err != nil {
+		return AppDefinition{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	idx := slices.IndexFunc(history, func(def AppDefinition) bool {
+		return def.Status == DeploymentStatusDeployed
+	})
+	if idx == -1 {
+		return AppDefinition{}, &vel.Error{
+			Code:    "NO_DEPLOYMENT_TO_REDEPLOY",
+			Message: "app has no successful deployment",
+		}
+	}
+
+	return h.replayDeployment(ctx, history[idx])
+}
+
+// authorizeApp checks the app is connected by the current user
+func (h *Handler) authorizeApp(ctx context.Context, appID string) *vel.Error {
+	_, rpcErr := h.appRepo(ctx, appID)
+	return rpcErr
+}
+
+// appRepo returns the app repo connected by the current user
+func (h *Handler) appRepo(ctx context.Context, appID string) (InstalledRepository, *vel.Error) {
+	repos, rpcErr := h.GetRepos(ctx, GetReposRequest{})
+	if rpcErr != nil {
+		return InstalledRepository{}, rpcErr
+	}
+
+	for _, repo := range repos.Repos {
+		if repo.TreenqID == appID {
+			return repo, nil
+		}
+	}
+
+	return InstalledRepository{}, &vel.Error{
+		Code:    "APP_NOT_FOUND",
+		Message: "app " + appID + " is not found",
+	}
+}
+
+// withAppEnv returns the space with the app env of the environment set via api,
+// the api values override the runtime envs of the repo config
+func (h *Handler) withAppEnv(ctx context.Context, appID, environment string, space tqsdk.Space) (tqsdk.Space, error) {
+	resolved, err := h.appEnvs(ctx, appID, environment)
+	if err != nil {
+		return space, err
+	}
+	return mergeAppEnvs(space, resolved), nil
+}
+
+// appEnvs returns the app envs of the environment set via api,
+// the secret values are redacted from the records logged with the context
+func (h *Handler) appEnvs(ctx context.Context, appID, environment string) ([]AppEnv, error) {
+	if appID == "" {
+		return nil, nil
+	}
+	envs, err := h.db.GetAppEnvs(ctx, appID)
+	if err != nil {
+		return nil, SystemFailure(fmt.Errorf("failed to get app env: %w", err))
+	}
+	resolved, err := resolveAppEnvs(envs, environment)
+	if err != nil {
+		return nil, UserFailure(err)
+	}
+	for _, env := range resolved {
+		if env.Secret {
+			redactValues(ctx, env.Value)
+		}
+	}
+	return resolved, nil
+}
+
+// resolveAppEnvs selects the envs of the environment.
+// The plain variables of the environment override the shared ones,
+// the secrets are never shared: a secret set for another environment must be set for this one too.
+func resolveAppEnvs(envs []AppEnv, environment string) ([]AppEnv, error) {
+	resolved := make(map[string]AppEnv)
+	for _, env := range envs {
+		if env.Environment == "" && !env.Secret {
+			resolved[env.Key] = env
+		}
+	}
+	for _, env := range envs {
+		if env.Environment == environment {
+			resolved[env.Key] = env
+		}
+	}
+
+	for _, env := range envs {
+		if !env.Secret || env.Environment == environment {
+			continue
+		}
+		if current, ok := resolved[env.Key]; !ok || !current.Secret {
+			return nil, fmt.Errorf("secret %q is not set for environment %q", env.Key, environment)
+		}
+	}
+
+	keys := slices.Sorted(maps.Keys(resolved))
+	result := make([]AppEnv, len(keys))
+	for i, key := range keys {
+		result[i] = resolved[key]
+	}
+	return result, nil
+}
+
+// environmentAppEnvs returns the envs set exactly for the environment
+func environmentAppEnvs(envs []AppEnv, environment string) []AppEnv {
+	var result []AppEnv
+	for _, env := range envs {
+		if env.Environment == environment {
+			result = append(result, env)
+		}
+	}
+	return result
+}
+
+func mergeAppEnvs(space tqsdk.Space, envs []AppEnv) tqsdk.Space {
+	if len(envs) == 0 {
+		return space
+	}
+
+	merge := func(service tqsdk.Service) tqsdk.Service {
+		runtimeEnvs := make(map[string]string, len(service.RuntimeEnvs)+len(envs))
+		maps.Copy(runtimeEnvs, service.RuntimeEnvs)
+		for _, env := range envs {
+			runtimeEnvs[env.Key] = env.Value
+		}
+		service.RuntimeEnvs = runtimeEnvs
+		return service
+	}
+
+	if space.Service.Name != "" {
+		space.Service = merge(space.Service)
+	}
+	services := make([]tqsdk.Service, len(space.Services))
+	for i := range space.Services {
+		services[i] = merge(space.Services[i])
+	}
+	if space.Services != nil {
+		space.Services = services
+	}
+
+	return space
+}
+
+func maskAppEnvs(envs []AppEnv) []AppEnv {
+	masked := make([]AppEnv, len(envs))
+	for i, env := range envs {
+		if env.Secret {
+			env.Value = maskedEnvValue
+		}
+		masked[i] = env
+	}
+	return masked
+}
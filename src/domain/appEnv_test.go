@@ -0,0 +1,198 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestSetAppEnvRoundTrip(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	ctx := userCtx("testing")
+
+	_, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID: testAppID,
+		Envs: []AppEnv{
+			{Key: "LOG_LEVEL", Value: "debug"},
+			{Key: "DB_PASSWORD", Value: "s3cr3t", Secret: true},
+		},
+	})
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.GetAppEnv(ctx, GetAppEnvRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	assert.ElementsMatch(t, []AppEnv{
+		{Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "DB_PASSWORD", Value: maskedEnvValue, Secret: true},
+	}, res.Envs)
+
+	_, rpcErr = th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID:  testAppID,
+		Envs:   []AppEnv{{Key: "LOG_LEVEL", Value: "info"}},
+		Remove: []string{"DB_PASSWORD"},
+	})
+	require.Nil(t, rpcErr)
+
+	res, rpcErr = th.GetAppEnv(ctx, GetAppEnvRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, []AppEnv{{Key: "LOG_LEVEL", Value: "info"}}, res.Envs)
+}
+
+func TestGetAppEnvUnknownApp(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+
+	_, rpcErr := th.GetAppEnv(userCtx("testing"), GetAppEnvRequest{AppID: "another-app"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+}
+
+func TestAppEnvOverridesRepoConfig(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{
+		Key: "space",
+		Service: tqsdk.Service{
+			Name:        "api",
+			RuntimeEnvs: map[string]string{"LOG_LEVEL": "info", "PORT": "8000"},
+		},
+	})
+	ctx := userCtx("testing")
+
+	_, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID: testAppID,
+		Envs: []AppEnv{
+			{Key: "LOG_LEVEL", Value: "debug"},
+			{Key: "DB_PASSWORD", Value: "s3cr3t", Secret: true},
+		},
+	})
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, testAppID, def.AppID)
+	assert.Equal(t, map[string]string{"LOG_LEVEL": "info", "PORT": "8000"}, def.App.Service.RuntimeEnvs, "stored repo config must stay untouched")
+	assert.Equal(t, map[string]string{
+		"LOG_LEVEL":   "debug",
+		"PORT":        "8000",
+		"DB_PASSWORD": "s3cr3t",
+	}, th.kube.defined[def.ID].Service.RuntimeEnvs)
+}
+
+func TestSetAppEnvRedeploy(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	ctx := userCtx("testing")
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.builds, 1)
+
+	res, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID:    testAppID,
+		Envs:     []AppEnv{{Key: "LOG_LEVEL", Value: "debug"}},
+		Redeploy: true,
+	})
+	require.Nil(t, rpcErr)
+	require.NotEmpty(t, res.DeploymentID)
+
+	assert.Len(t, th.docker.builds, 1, "config only redeploy must not rebuild the images")
+	assert.Len(t, th.kube.applied, 2)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, res.DeploymentID).Status)
+	assert.Equal(t, "debug", th.kube.defined[res.DeploymentID].Service.RuntimeEnvs["LOG_LEVEL"])
+}
+
+func multiEnvironmentSpace() tqsdk.Space {
+	return tqsdk.Space{
+		Key:     "space",
+		Service: tqsdk.Service{Name: "api"},
+		Environments: []tqsdk.Environment{
+			{Name: "production", Branch: "main"},
+			{Name: "staging", Branch: "staging"},
+		},
+	}
+}
+
+func TestAppEnvSecretsScopedByEnvironment(t *testing.T) {
+	th := newTestHandler(t, multiEnvironmentSpace())
+	ctx := userCtx("testing")
+
+	_, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID: testAppID,
+		Envs:  []AppEnv{{Key: "LOG_LEVEL", Value: "info"}},
+	})
+	require.Nil(t, rpcErr)
+	for environment, password := range map[string]string{"production": "prod-s3cr3t", "staging": "staging-s3cr3t"} {
+		_, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+			AppID:       testAppID,
+			Environment: environment,
+			Envs:        []AppEnv{{Key: "DB_PASSWORD", Value: password, Secret: true}},
+		})
+		require.Nil(t, rpcErr)
+	}
+
+	production, rpcErr := th.DeployArchive(ctx, DeployArchiveRequest{AppID: testAppID, Archive: []byte("archive"), Branch: "main"})
+	require.Nil(t, rpcErr)
+	staging, rpcErr := th.DeployArchive(ctx, DeployArchiveRequest{AppID: testAppID, Archive: []byte("archive"), Branch: "staging"})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, map[string]string{
+		"LOG_LEVEL":   "info",
+		"DB_PASSWORD": "prod-s3cr3t",
+	}, th.kube.defined[production.DeploymentID].Service.RuntimeEnvs)
+	assert.Equal(t, map[string]string{
+		"LOG_LEVEL":   "info",
+		"DB_PASSWORD": "staging-s3cr3t",
+	}, th.kube.defined[staging.DeploymentID].Service.RuntimeEnvs)
+
+	res, rpcErr := th.GetAppEnv(ctx, GetAppEnvRequest{AppID: testAppID, Environment: "staging"})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, []AppEnv{{Environment: "staging", Key: "DB_PASSWORD", Value: maskedEnvValue, Secret: true}}, res.Envs)
+}
+
+func TestAppEnvMissingEnvironmentSecret(t *testing.T) {
+	th := newTestHandler(t, multiEnvironmentSpace())
+	ctx := userCtx("testing")
+
+	_, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID:       testAppID,
+		Environment: "production",
+		Envs:        []AppEnv{{Key: "DB_PASSWORD", Value: "prod-s3cr3t", Secret: true}},
+	})
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.DeployArchive(ctx, DeployArchiveRequest{AppID: testAppID, Archive: []byte("archive"), Branch: "staging"})
+	require.NotNil(t, rpcErr)
+	assert.Contains(t, rpcErr.Message, `secret "DB_PASSWORD" is not set for environment "staging"`)
+
+	def := th.db.deployment(t, res.DeploymentID)
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.Empty(t, th.kube.applied, "production secret must not leak into staging")
+}
+
+func TestResolveAppEnvs(t *testing.T) {
+	envs := []AppEnv{
+		{Key: "LOG_LEVEL", Value: "info"},
+		{Environment: "staging", Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "SHARED_SECRET", Value: "shared", Secret: true},
+	}
+
+	resolved, err := resolveAppEnvs(envs, "staging")
+	assert.ErrorContains(t, err, `secret "SHARED_SECRET" is not set for environment "staging"`)
+	assert.Nil(t, resolved)
+
+	resolved, err = resolveAppEnvs(envs[:2], "staging")
+	require.NoError(t, err)
+	assert.Equal(t, []AppEnv{{Environment: "staging", Key: "LOG_LEVEL", Value: "debug"}}, resolved)
+
+	resolved, err = resolveAppEnvs(envs, "")
+	require.NoError(t, err)
+	assert.Equal(t, []AppEnv{
+		{Key: "LOG_LEVEL", Value: "info"},
+		{Key: "SHARED_SECRET", Value: "shared", Secret: true},
+	}, resolved)
+}
@@ -0,0 +1,204 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+var ErrFeedTokenNotFound = errors.New("feed token not found")
+
+// feedSize limits the deployments listed by the app feed
+const feedSize = 50
+
+// feedMaxAge is how long the feed readers may cache the feed
+const feedMaxAge = time.Minute
+
+type IssueFeedTokenRequest struct {
+	AppID string `json:"appId"`
+}
+
+type IssueFeedTokenResponse struct {
+	// Token reads the app feed only, it's shown once, a new token replaces the previous one
+	Token string `json:"token"`
+}
+
+// IssueFeedToken issues the app scoped token of the app deployments feed
+func (h *Handler) IssueFeedToken(ctx context.Context, req IssueFeedTokenRequest) (IssueFeedTokenResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return IssueFeedTokenResponse{}, rpcErr
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return IssueFeedTokenResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	token := hex.EncodeToString(secret)
+	if err := h.db.SetAppFeedToken(ctx, req.AppID, feedTokenHash(token)); err != nil {
+		return IssueFeedTokenResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	return IssueFeedTokenResponse{Token: token}, nil
+}
+
+// feedTokenHash is stored instead of the token, a leaked database doesn't expose the feeds
+func feedTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppFeed is a JSON Feed of the app deployments, https://www.jsonfeed.org/version/1.1
+type AppFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	Items   []AppFeedEntry `json:"items"`
+}
+
+type AppFeedEntry struct {
+	ID            string          `json:"id"`
+	Title         string          `json:"title"`
+	ContentText   string          `json:"content_text"`
+	DatePublished time.Time       `json:"date_published"`
+	DateModified  *time.Time      `json:"date_modified,omitempty"`
+	Authors       []AppFeedAuthor `json:"authors"`
+	// Deployment is the feed extension with the deployment fields
+	Deployment AppFeedDeployment `json:"_treenq"`
+}
+
+type AppFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type AppFeedDeployment struct {
+	Sha         string           `json:"sha"`
+	Status      DeploymentStatus `json:"status"`
+	Environment string           `json:"environment"`
+}
+
+// AppFeedHandler serves the recent app deployments as a JSON Feed ordered from the newest, GET /apps/{id}/feed.
+// The app feed token is passed as a bearer token or as the basic auth password,
+// it's never read from the url, so it doesn't get to the request logs.
+func (h *Handler) AppFeedHandler(w http.ResponseWriter, r *http.Request) {
+	appID := r.PathValue("id")
+	if !h.feedAuthorized(r, appID) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="treenq feed"`)
+		http.Error(w, "invalid feed token", http.StatusUnauthorized)
+		return
+	}
+
+	deployments, err := h.db.ListRecentDeployments(r.Context(), appID, feedSize)
+	if err != nil {
+		h.l.ErrorContext(r.Context(), "failed to list feed deployments", "appID", appID, "err", err)
+		http.Error(w, "failed to list deployments", http.StatusInternalServerError)
+		return
+	}
+	feed := appFeed(appID, deployments)
+
+	payload, err := json.Marshal(feed)
+	if err != nil {
+		http.Error(w, "failed to encode feed", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(payload)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(feedMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+	if len(feed.Items) > 0 {
+		w.Header().Set("Last-Modified", feedModified(feed).Format(http.TimeFormat))
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/feed+json")
+	if _, err := w.Write(payload); err != nil {
+		h.l.ErrorContext(r.Context(), "failed to write feed", "appID", appID, "err", err)
+	}
+}
+
+// feedAuthorized checks the request token against the app feed token
+func (h *Handler) feedAuthorized(r *http.Request, appID string) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		_, token, ok = r.BasicAuth()
+	}
+	if !ok || token == "" || appID == "" {
+		return false
+	}
+
+	tokenHash, err := h.db.GetAppFeedToken(r.Context(), appID)
+	if err != nil {
+		if !errors.Is(err, ErrFeedTokenNotFound) {
+			h.l.ErrorContext(r.Context(), "failed to get feed token", "appID", appID, "err", err)
+		}
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(feedTokenHash(token)), []byte(tokenHash)) == 1
+}
+
+// appFeed lists the latest deployments, they are ordered from the newest and limited to feedSize already
+func appFeed(appID string, deployments []AppDefinition) AppFeed {
+	feed := AppFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   "treenq app " + appID + " deployments",
+		Items:   make([]AppFeedEntry, 0, len(deployments)),
+	}
+	for _, def := range deployments {
+		entry := AppFeedEntry{
+			ID:            def.ID,
+			Title:         fmt.Sprintf("%s %s", shortSha(def.Sha), def.Status),
+			ContentText:   def.Message,
+			DatePublished: def.CreatedAt,
+			Authors:       []AppFeedAuthor{{Name: def.User}},
+			Deployment: AppFeedDeployment{
+				Sha:         def.Sha,
+				Status:      def.Status,
+				Environment: def.Environment,
+			},
+		}
+		if !def.FinishedAt.IsZero() {
+			entry.DateModified = &def.FinishedAt
+		}
+		feed.Items = append(feed.Items, entry)
+	}
+	return feed
+}
+
+// feedModified is the latest change of the feed entries
+func feedModified(feed AppFeed) time.Time {
+	var modified time.Time
+	for _, entry := range feed.Items {
+		changed := entry.DatePublished
+		if entry.DateModified != nil {
+			changed = *entry.DateModified
+		}
+		if changed.After(modified) {
+			modified = changed
+		}
+	}
+	return modified
+}
+
+// shortSha is the abbreviated commit sha as github shows it
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func feedRequest(t *testing.T, th *testHandler, token string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/apps/"+testAppID+"/feed", nil)
+	r.SetPathValue("id", testAppID)
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	th.AppFeedHandler(w, r)
+	return w
+}
+
+func TestAppFeedListsDeploymentsNewestFirst(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	th.db.deployments = []AppDefinition{
+		{ID: "1", AppID: testAppID, Sha: "1111111aaaa", Status: DeploymentStatusDeployed, User: "alice", Message: "first", CreatedAt: created},
+		{ID: "other", AppID: "other", Sha: "ffff", Status: DeploymentStatusDeployed, CreatedAt: created.Add(time.Hour)},
+		{ID: "2", AppID: testAppID, Sha: "2222222bbbb", Status: DeploymentStatusFailed, User: "bob", Message: "second", CreatedAt: created.Add(2 * time.Hour), FinishedAt: created.Add(3 * time.Hour)},
+	}
+
+	res, rpcErr := th.IssueFeedToken(userCtx("testing"), IssueFeedTokenRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	require.NotEmpty(t, res.Token)
+	assert.NotEqual(t, res.Token, th.db.feedTokens[testAppID], "only the token hash is stored")
+
+	w := feedRequest(t, th, res.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/feed+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "private, max-age=60", w.Header().Get("Cache-Control"))
+	assert.Equal(t, created.Add(3*time.Hour).Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	var feed AppFeed
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+	require.Len(t, feed.Items, 2)
+	assert.Equal(t, "2", feed.Items[0].ID)
+	assert.Equal(t, "2222222 failed", feed.Items[0].Title)
+	assert.Equal(t, "second", feed.Items[0].ContentText)
+	assert.Equal(t, []AppFeedAuthor{{Name: "bob"}}, feed.Items[0].Authors)
+	assert.Equal(t, "2222222bbbb", feed.Items[0].Deployment.Sha)
+	assert.Equal(t, DeploymentStatusFailed, feed.Items[0].Deployment.Status)
+	assert.True(t, created.Add(2*time.Hour).Equal(feed.Items[0].DatePublished))
+	assert.Equal(t, "1", feed.Items[1].ID)
+	assert.Nil(t, feed.Items[1].DateModified)
+
+	w = feedRequest(t, th, res.Token, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+}
+
+func TestAppFeedIsLimitedToFeedSize(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	created := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i := range feedSize + 5 {
+		th.db.deployments = append(th.db.deployments, AppDefinition{
+			ID: strconv.Itoa(i), AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: created.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	res, rpcErr := th.IssueFeedToken(userCtx("testing"), IssueFeedTokenRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	w := feedRequest(t, th, res.Token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var feed AppFeed
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feed))
+	require.Len(t, feed.Items, feedSize)
+	assert.Equal(t, strconv.Itoa(feedSize+4), feed.Items[0].ID, "the newest deployment goes first")
+}
+
+func TestAppFeedRequiresAppToken(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	th.db.deployments = []AppDefinition{{ID: "1", AppID: testAppID, Status: DeploymentStatusDeployed}}
+
+	w := feedRequest(t, th, "token", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "no token is issued")
+
+	_, rpcErr := th.IssueFeedToken(userCtx("testing"), IssueFeedTokenRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	w = feedRequest(t, th, "token", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotContains(t, w.Body.String(), "1")
+}
+
+func TestIssueFeedTokenOfForeignApp(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+
+	_, rpcErr := th.IssueFeedToken(userCtx("testing"), IssueFeedTokenRequest{AppID: "unknown"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+	assert.Empty(t, th.db.feedTokens)
+}
@@ -0,0 +1,207 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// AppChange is a kind of the app config change
+type AppChange string
+
+const (
+	// AppChangeConnect is the first connection of the app repo branch
+	AppChangeConnect AppChange = "connect"
+	// AppChangeBranch connects another branch of the app repo
+	AppChangeBranch AppChange = "branch"
+	// AppChangeEnv sets or removes the app envs
+	AppChangeEnv AppChange = "env"
+	// AppChangeRevert re-applies the config of a prior version
+	AppChangeRevert AppChange = "revert"
+)
+
+// AppConfig is the app config managed via api, the space config is versioned by the repo itself
+type AppConfig struct {
+	Branch string   `json:"branch"`
+	Envs   []AppEnv `json:"envs"`
+}
+
+// AppEvent is a versioned app config change of the append-only app history,
+// it holds the whole config the change has resulted in, so any version can be re-applied
+type AppEvent struct {
+	AppID string `json:"appId"`
+	// Version is assigned by the store, the versions of an app start from 1 and grow by 1
+	Version int       `json:"version"`
+	Change  AppChange `json:"change"`
+	Config  AppConfig `json:"config"`
+	User    string    `json:"user"`
+	// RevertedTo is the version re-applied by a revert
+	RevertedTo int       `json:"revertedTo"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// recordAppChange appends the current app config to the app history
+func (h *Handler) recordAppChange(ctx context.Context, appID string, change AppChange, revertedTo int) (AppEvent, error) {
+	repo, rpcErr := h.appRepo(ctx, appID)
+	if rpcErr != nil {
+		return AppEvent{}, fmt.Errorf("failed to get app repo: %s", rpcErr.Message)
+	}
+	envs, err := h.db.GetAppEnvs(ctx, appID)
+	if err != nil {
+		return AppEvent{}, err
+	}
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return AppEvent{}, fmt.Errorf("failed to get profile: %s", rpcErr.Message)
+	}
+
+	return h.db.AppendAppEvent(ctx, AppEvent{
+		AppID:      appID,
+		Change:     change,
+		Config:     AppConfig{Branch: repo.Branch, Envs: envs},
+		User:       profile.UserInfo.DisplayName,
+		RevertedTo: revertedTo,
+	})
+}
+
+// branchChange tells how connecting the branch changes the app config,
+// an app without history is connected for the first time, connecting the same branch again changes nothing
+func (h *Handler) branchChange(ctx context.Context, repo InstalledRepository, branch string) (AppChange, error) {
+	history, err := h.db.GetAppEvents(ctx, repo.TreenqID)
+	if err != nil {
+		return "", err
+	}
+	if len(history) == 0 {
+		return AppChangeConnect, nil
+	}
+	if history[len(history)-1].Config.Branch == branch {
+		return "", nil
+	}
+	return AppChangeBranch, nil
+}
+
+type GetAppHistoryRequest struct {
+	AppID string `json:"appId"`
+}
+
+type GetAppHistoryResponse struct {
+	// Events are ordered by the version, the secret env values are masked
+	Events []AppEvent `json:"events"`
+}
+
+// GetAppHistory returns the app config changes from the oldest one
+func (h *Handler) GetAppHistory(ctx context.Context, req GetAppHistoryRequest) (GetAppHistoryResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return GetAppHistoryResponse{}, rpcErr
+	}
+
+	events, err := h.db.GetAppEvents(ctx, req.AppID)
+	if err != nil {
+		return GetAppHistoryResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	for i := range events {
+		events[i].Config.Envs = maskAppEnvs(events[i].Config.Envs)
+	}
+
+	return GetAppHistoryResponse{Events: events}, nil
+}
+
+type RevertToVersionRequest struct {
+	AppID   string `json:"appId"`
+	Version int    `json:"version"`
+}
+
+type RevertToVersionResponse struct {
+	// Event is the revert appended to the app history
+	Event AppEvent `json:"event"`
+}
+
+// RevertToVersion re-applies the app config of the prior version: the branch is connected and the envs are replaced,
+// the revert is a new version of the app history. The app isn't redeployed, the next deployment uses the reverted config.
+func (h *Handler) RevertToVersion(ctx context.Context, req RevertToVersionRequest) (RevertToVersionResponse, *vel.Error) {
+	repo, rpcErr := h.appRepo(ctx, req.AppID)
+	if rpcErr != nil {
+		return RevertToVersionResponse{}, rpcErr
+	}
+
+	history, err := h.db.GetAppEvents(ctx, req.AppID)
+	if err != nil {
+		return RevertToVersionResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	idx := slices.IndexFunc(history, func(event AppEvent) bool {
+		return event.Version == req.Version
+	})
+	if idx == -1 {
+		return RevertToVersionResponse{}, &vel.Error{
+			Code:    "APP_VERSION_NOT_FOUND",
+			Message: fmt.Sprintf("app has no version %d", req.Version),
+		}
+	}
+	config := history[idx].Config
+
+	if config.Branch != "" && config.Branch != repo.Branch {
+		if err := h.db.ConnectRepoBranch(ctx, repo.ID, config.Branch); err != nil {
+			return RevertToVersionResponse{}, &vel.Error{
+				Code:    "UNKNOWN",
+				Message: err.Error(),
+			}
+		}
+	}
+	if err := h.replaceAppEnvs(ctx, req.AppID, config.Envs); err != nil {
+		return RevertToVersionResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	event, err := h.recordAppChange(ctx, req.AppID, AppChangeRevert, req.Version)
+	if err != nil {
+		return RevertToVersionResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	event.Config.Envs = maskAppEnvs(event.Config.Envs)
+	return RevertToVersionResponse{Event: event}, nil
+}
+
+// replaceAppEnvs sets the app envs of every environment to the given ones, the envs missing from them are removed
+func (h *Handler) replaceAppEnvs(ctx context.Context, appID string, envs []AppEnv) error {
+	current, err := h.db.GetAppEnvs(ctx, appID)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string][]AppEnv)
+	remove := make(map[string][]string)
+	for _, env := range envs {
+		set[env.Environment] = append(set[env.Environment], env)
+	}
+	for _, env := range current {
+		kept := slices.ContainsFunc(envs, func(target AppEnv) bool {
+			return target.Environment == env.Environment && target.Key == env.Key
+		})
+		if !kept {
+			remove[env.Environment] = append(remove[env.Environment], env.Key)
+		}
+	}
+
+	environments := slices.Concat(slices.Collect(maps.Keys(set)), slices.Collect(maps.Keys(remove)))
+	slices.Sort(environments)
+	for _, environment := range slices.Compact(environments) {
+		if err := h.db.SetAppEnvs(ctx, appID, environment, set[environment], remove[environment]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// changeAppConfig connects main, sets the envs, then connects the release branch
+func changeAppConfig(t *testing.T, th *testHandler) {
+	ctx := userCtx("testing")
+	th.github.branchTips = map[string]string{
+		"treenq/treenq:main":    "64263a02d293b1d4ec638ed98d3f3a93f0f788cb",
+		"treenq/treenq:release": "0d1f5a0e2a1b9e0f7f3c4a5b6c7d8e9f0a1b2c3d",
+	}
+
+	_, rpcErr := th.ConnectRepository(ctx, ConnectRepositoryRequest{AppID: testAppID, Branch: "main"})
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.SetAppEnv(ctx, SetAppEnvRequest{AppID: testAppID, Envs: []AppEnv{
+		{Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "API_TOKEN", Value: "secret-token", Secret: true},
+	}})
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.SetAppEnv(ctx, SetAppEnvRequest{AppID: testAppID, Envs: []AppEnv{{Key: "LOG_LEVEL", Value: "info"}}, Remove: []string{"API_TOKEN"}})
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.ConnectRepository(ctx, ConnectRepositoryRequest{AppID: testAppID, Branch: "main"})
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.ConnectRepository(ctx, ConnectRepositoryRequest{AppID: testAppID, Branch: "release"})
+	require.Nil(t, rpcErr)
+}
+
+func TestGetAppHistoryRecordsChanges(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	changeAppConfig(t, th)
+
+	res, rpcErr := th.GetAppHistory(userCtx("testing"), GetAppHistoryRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	require.Len(t, res.Events, 4, "connecting the same branch again changes nothing")
+
+	var changes []AppChange
+	for i, event := range res.Events {
+		assert.Equal(t, i+1, event.Version)
+		assert.Equal(t, "testing", event.User)
+		changes = append(changes, event.Change)
+	}
+	assert.Equal(t, []AppChange{AppChangeConnect, AppChangeEnv, AppChangeEnv, AppChangeBranch}, changes)
+
+	assert.Equal(t, "main", res.Events[0].Config.Branch)
+	assert.Empty(t, res.Events[0].Config.Envs)
+	assert.ElementsMatch(t, []AppEnv{
+		{Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "API_TOKEN", Value: maskedEnvValue, Secret: true},
+	}, res.Events[1].Config.Envs, "the secrets are masked")
+	assert.Equal(t, "release", res.Events[3].Config.Branch)
+	assert.Equal(t, []AppEnv{{Key: "LOG_LEVEL", Value: "info"}}, res.Events[3].Config.Envs)
+}
+
+func TestRevertToVersion(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	changeAppConfig(t, th)
+
+	res, rpcErr := th.RevertToVersion(userCtx("testing"), RevertToVersionRequest{AppID: testAppID, Version: 2})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, 5, res.Event.Version)
+	assert.Equal(t, AppChangeRevert, res.Event.Change)
+	assert.Equal(t, 2, res.Event.RevertedTo)
+
+	assert.Equal(t, "main", th.db.repos[0].Branch)
+	assert.ElementsMatch(t, []AppEnv{
+		{Key: "LOG_LEVEL", Value: "debug"},
+		{Key: "API_TOKEN", Value: "secret-token", Secret: true},
+	}, th.db.envs[testAppID], "the secret value of the version is restored")
+
+	history, rpcErr := th.GetAppHistory(userCtx("testing"), GetAppHistoryRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	require.Len(t, history.Events, 5)
+	assert.Equal(t, history.Events[1].Config.Branch, history.Events[4].Config.Branch)
+	assert.ElementsMatch(t, history.Events[1].Config.Envs, history.Events[4].Config.Envs)
+
+	// the revert is a version of its own
+	_, rpcErr = th.RevertToVersion(userCtx("testing"), RevertToVersionRequest{AppID: testAppID, Version: 4})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, "release", th.db.repos[0].Branch)
+	assert.Equal(t, []AppEnv{{Key: "LOG_LEVEL", Value: "info"}}, th.db.envs[testAppID])
+}
+
+func TestRevertToUnknownVersion(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.RevertToVersion(userCtx("testing"), RevertToVersionRequest{AppID: testAppID, Version: 1})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_VERSION_NOT_FOUND", rpcErr.Code)
+}
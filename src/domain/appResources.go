@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// KubeResource is a live cluster object treenq manages for the app
+type KubeResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	// Manifest is the object YAML as kubectl get -o yaml shows it, the secret values are redacted
+	Manifest string `json:"manifest"`
+}
+
+type GetAppResourcesRequest struct {
+	AppID string `json:"appId"`
+}
+
+type GetAppResourcesResponse struct {
+	Resources []KubeResource `json:"resources"`
+}
+
+// GetAppResources returns the app objects fetched live from the cluster to debug the deployment
+func (h *Handler) GetAppResources(ctx context.Context, req GetAppResourcesRequest) (GetAppResourcesResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return GetAppResourcesResponse{}, rpcErr
+	}
+
+	resources, err := h.kube.GetResources(ctx, h.kubeConfig, req.AppID)
+	if err != nil {
+		return GetAppResourcesResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	return GetAppResourcesResponse{Resources: resources}, nil
+}
@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGetAppResources(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	ctx := userCtx("testing")
+	deployment := KubeResource{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "id-1234-space", Name: "api", Manifest: "kind: Deployment"}
+	th.kube.resources = map[string][]KubeResource{
+		testAppID:   {deployment},
+		"other-app": {{APIVersion: "v1", Kind: "Service", Name: "other"}},
+	}
+
+	res, rpcErr := th.GetAppResources(ctx, GetAppResourcesRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, []KubeResource{deployment}, res.Resources)
+
+	_, rpcErr = th.GetAppResources(ctx, GetAppResourcesRequest{AppID: "other-app"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+}
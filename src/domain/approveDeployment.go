@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
+type ApproveDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+type ApproveDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+// ApproveDeployment applies a deployment awaiting approval
+func (h *Handler) ApproveDeployment(ctx context.Context, req ApproveDeploymentRequest) (ApproveDeploymentResponse, *vel.Error) {
+	def, rpcErr := h.getDeploymentAwaitingApproval(ctx, req.DeploymentID)
+	if rpcErr != nil {
+		return ApproveDeploymentResponse{}, rpcErr
+	}
+
+	if err := h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusDeploying); err != nil {
+		return ApproveDeploymentResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	// the images built before the approval are applied, the tag may have moved to a newer build since
+	images, err := h.recordedImages(def)
+	if err != nil {
+		return ApproveDeploymentResponse{}, deployError(h.failDeployment(ctx, def, DeploymentStageApply, err))
+	}
+	ctx = withRedaction(ctx)
+	ctx, run, stop := h.runs.start(ctx, def.AppID, def.ID)
+	defer stop()
+	defer h.watchSlow(ctx, def.AppID, run)()
+	if err := h.applyDeployment(ctx, def, images); err != nil {
+		return ApproveDeploymentResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	def.Status = appliedStatus(def.App)
+	return ApproveDeploymentResponse{Deployment: def}, nil
+}
+
+type RejectDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+type RejectDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+// RejectDeployment discards a deployment awaiting approval
+func (h *Handler) RejectDeployment(ctx context.Context, req RejectDeploymentRequest) (RejectDeploymentResponse, *vel.Error) {
+	def, rpcErr := h.getDeploymentAwaitingApproval(ctx, req.DeploymentID)
+	if rpcErr != nil {
+		return RejectDeploymentResponse{}, rpcErr
+	}
+
+	if err := h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusRejected); err != nil {
+		return RejectDeploymentResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	def.Status = DeploymentStatusRejected
+	return RejectDeploymentResponse{Deployment: def}, nil
+}
+
+// getDeploymentAwaitingApproval returns a deployment the current user is allowed to approve or reject,
+// a deployment with an expired approval window is marked expired.
+func (h *Handler) getDeploymentAwaitingApproval(ctx context.Context, deploymentID string) (AppDefinition, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return AppDefinition{}, rpcErr
+	}
+
+	def, err := h.db.GetDeployment(ctx, deploymentID)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return AppDefinition{}, &vel.Error{
+				Code:    "DEPLOYMENT_NOT_FOUND",
+				Message: err.Error(),
+			}
+		}
+		return AppDefinition{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if rpcErr := h.authorizeApp(ctx, def.AppID); rpcErr != nil {
+		return AppDefinition{}, rpcErr
+	}
+
+	if def.Status != DeploymentStatusAwaitingApproval {
+		return AppDefinition{}, &vel.Error{
+			Code:    "DEPLOYMENT_NOT_AWAITING_APPROVAL",
+			Message: "deployment status is " + string(def.Status),
+		}
+	}
+
+	for _, env := range def.App.Environments {
+		if env.Name != def.Environment || len(env.Approvers) == 0 {
+			continue
+		}
+		if !slices.Contains(env.Approvers, profile.UserInfo.DisplayName) {
+			return AppDefinition{}, &vel.Error{
+				Code:    "NOT_APPROVER",
+				Message: "user is not allowed to approve " + env.Name + " deployments",
+			}
+		}
+	}
+
+	if !def.ApprovalExpiresAt.IsZero() && now().After(def.ApprovalExpiresAt) {
+		if err := h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusApprovalExpired); err != nil {
+			return AppDefinition{}, &vel.Error{
+				Code:    "UNKNOWN",
+				Message: err.Error(),
+			}
+		}
+		return AppDefinition{}, &vel.Error{
+			Code:    "APPROVAL_EXPIRED",
+			Message: "deployment approval has expired at " + def.ApprovalExpiresAt.String(),
+		}
+	}
+
+	return def, nil
+}
@@ -0,0 +1,163 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func approvalSpace() tqsdk.Space {
+	return tqsdk.Space{
+		Key:     "space",
+		Service: tqsdk.Service{Name: "api"},
+		Environments: []tqsdk.Environment{{
+			Name:            "production",
+			Branch:          "main",
+			RequireApproval: true,
+			Approvers:       []string{"approver"},
+		}},
+	}
+}
+
+func TestApproveDeployment(t *testing.T) {
+	th := newTestHandler(t, approvalSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusAwaitingApproval, def.Status)
+	assert.Equal(t, "production", def.Environment)
+	assert.Empty(t, th.kube.applied, "deployment must not be applied before approval")
+
+	_, rpcErr = th.ApproveDeployment(userCtx("stranger"), ApproveDeploymentRequest{DeploymentID: def.ID})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "NOT_APPROVER", rpcErr.Code)
+	assert.Empty(t, th.kube.applied)
+
+	res, rpcErr := th.ApproveDeployment(userCtx("approver"), ApproveDeploymentRequest{DeploymentID: def.ID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusDeployed, res.Deployment.Status)
+	assert.Equal(t, []string{def.ID}, th.kube.applied)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, def.ID).Status)
+
+	_, rpcErr = th.ApproveDeployment(userCtx("approver"), ApproveDeploymentRequest{DeploymentID: def.ID})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "DEPLOYMENT_NOT_AWAITING_APPROVAL", rpcErr.Code)
+}
+
+func TestApproveDeploymentAppliesRecordedImages(t *testing.T) {
+	th := newTestHandler(t, approvalSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	awaiting := th.db.deployments[0]
+	assert.Equal(t, map[string]string{"api": "sha256:api"}, awaiting.Digests)
+
+	// a newer push moves the tag to another image while the first deployment awaits approval
+	th.docker.push = func(ctx context.Context, image Image) (Image, error) {
+		image.Digest = "sha256:newer"
+		return image, nil
+	}
+	_, rpcErr = th.GithubWebhook(context.Background(), pushOf("sha-2"))
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.ApproveDeployment(userCtx("approver"), ApproveDeploymentRequest{DeploymentID: awaiting.ID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, "sha256:api", th.kube.images[awaiting.ID]["api"].Digest, "the approved deployment applies the image it has built")
+}
+
+func TestApproveDeploymentOfForeignApp(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Environments: []tqsdk.Environment{{
+		Name:            "production",
+		Branch:          "main",
+		RequireApproval: true,
+	}}}
+	th := newTestHandler(t, space)
+	th.db.deployments = []AppDefinition{{
+		ID:                "foreign",
+		AppID:             "foreign-app",
+		App:               space,
+		Environment:       "production",
+		Status:            DeploymentStatusAwaitingApproval,
+		ApprovalExpiresAt: time.Now().Add(time.Hour),
+		Digests:           map[string]string{"api": "sha256:api"},
+	}}
+
+	_, rpcErr := th.ApproveDeployment(userCtx("testing"), ApproveDeploymentRequest{DeploymentID: "foreign"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code, "an environment without approvers doesn't let anyone approve other users' deployments")
+
+	_, rpcErr = th.RejectDeployment(userCtx("testing"), RejectDeploymentRequest{DeploymentID: "foreign"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+	assert.Equal(t, DeploymentStatusAwaitingApproval, th.db.deployment(t, "foreign").Status)
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestRejectDeployment(t *testing.T) {
+	th := newTestHandler(t, approvalSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	def := th.db.deployments[0]
+
+	res, rpcErr := th.RejectDeployment(userCtx("approver"), RejectDeploymentRequest{DeploymentID: def.ID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusRejected, res.Deployment.Status)
+	assert.Equal(t, DeploymentStatusRejected, th.db.deployment(t, def.ID).Status)
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestApproveDeploymentExpired(t *testing.T) {
+	th := newTestHandler(t, approvalSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	def := th.db.deployments[0]
+
+	originalNow := now
+	now = func() time.Time { return originalNow().Add(th.approvalTtl + time.Minute) }
+	t.Cleanup(func() { now = originalNow })
+
+	_, rpcErr = th.ApproveDeployment(userCtx("approver"), ApproveDeploymentRequest{DeploymentID: def.ID})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APPROVAL_EXPIRED", rpcErr.Code)
+	assert.Equal(t, DeploymentStatusApprovalExpired, th.db.deployment(t, def.ID).Status)
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestApproveDeploymentWithoutApprovalTtl(t *testing.T) {
+	th := newTestHandler(t, approvalSpace())
+	th.approvalTtl = 0
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	def := th.db.deployments[0]
+	assert.True(t, def.ApprovalExpiresAt.IsZero(), "a zero ttl never expires the approval")
+
+	originalNow := now
+	now = func() time.Time { return originalNow().Add(30 * 24 * time.Hour) }
+	t.Cleanup(func() { now = originalNow })
+
+	res, rpcErr := th.ApproveDeployment(userCtx("approver"), ApproveDeploymentRequest{DeploymentID: def.ID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusDeployed, res.Deployment.Status)
+	assert.Equal(t, []string{def.ID}, th.kube.applied)
+}
+
+func TestDeploymentWithoutApproval(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+	assert.Len(t, th.kube.applied, 1)
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"log"
@@ -43,9 +44,9 @@ type TokenPair struct {
 // GithubCallbackHandler is the handler for the callback from Github
 // It exchanges the code for an access token and returns the given access and refresh tokens
 func (h *Handler) GithubCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	oauthState, _ := r.Cookie("authstate")
-
-	if r.URL.Query().Get("state") != oauthState.Value {
+	oauthState, err := r.Cookie("authstate")
+	// constant time comparison doesn't reveal how much of a guessed state matches
+	if err != nil || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("state")), []byte(oauthState.Value)) != 1 {
 		log.Println("invalid auth state")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
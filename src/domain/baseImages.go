@@ -0,0 +1,148 @@
+package domain
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// BaseImageNotAllowedError is returned if a Dockerfile builds on a base image the policy doesn't allow
+type BaseImageNotAllowedError struct {
+	Service string
+	Image   string
+}
+
+func (e *BaseImageNotAllowedError) Error() string {
+	return fmt.Sprintf("service %q builds on base image %s which is not allowed", e.Service, e.Image)
+}
+
+// BaseImagePolicy restricts the base images the services are built on
+type BaseImagePolicy struct {
+	// Allowed are the image prefixes a FROM image must start with, e.g. gcr.io/distroless/ or golang,
+	// the images of docker hub are matched by their full name, so golang and docker.io/library/golang are the same.
+	// Any base image is allowed if it's empty
+	Allowed []string
+}
+
+// check rejects the Dockerfile of the service if any of its external base images is not allowed
+func (p BaseImagePolicy) check(service, dockerfile string) error {
+	if len(p.Allowed) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(dockerfile)
+	if err != nil {
+		return UserFailure(fmt.Errorf("failed to read service %q Dockerfile: %w", service, err))
+	}
+	for _, image := range dockerfileBaseImages(data) {
+		if !p.allowed(image) {
+			return UserFailure(&BaseImageNotAllowedError{Service: service, Image: image})
+		}
+	}
+	return nil
+}
+
+func (p BaseImagePolicy) allowed(image string) bool {
+	name := normalizeImageName(image)
+	return slices.ContainsFunc(p.Allowed, func(prefix string) bool {
+		return strings.HasPrefix(name, normalizeImageName(prefix))
+	})
+}
+
+// normalizeImageName qualifies a docker hub image name the way docker pulls it, e.g. golang is docker.io/library/golang
+func normalizeImageName(image string) string {
+	first, rest, found := strings.Cut(image, "/")
+	if !found {
+		return "docker.io/library/" + image
+	}
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return image
+	}
+	if first == "library" {
+		return "docker.io/" + image
+	}
+	return "docker.io/" + first + "/" + rest
+}
+
+// dockerfileBaseImages returns the images of the FROM instructions, the stages built on a previous stage and scratch are skipped.
+// The image arguments are expanded with the ARG defaults declared before the first FROM.
+func dockerfileBaseImages(dockerfile []byte) []string {
+	var images []string
+	stages := make(map[string]bool)
+	args := make(map[string]string)
+	seenFrom := false
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			if seenFrom || len(fields) < 2 {
+				continue
+			}
+			name, value, _ := strings.Cut(fields[1], "=")
+			args[name] = strings.Trim(value, `"'`)
+		case "FROM":
+			seenFrom = true
+			var params []string
+			for _, field := range fields[1:] {
+				if !strings.HasPrefix(field, "--") {
+					params = append(params, field)
+				}
+			}
+			if len(params) == 0 {
+				continue
+			}
+			image := expandDockerfileArgs(params[0], args)
+			if !stages[strings.ToLower(image)] && !strings.EqualFold(image, "scratch") {
+				images = append(images, image)
+			}
+			// a stage is declared after its own FROM, so it may only refer to the previous stages
+			if len(params) >= 3 && strings.EqualFold(params[1], "AS") {
+				stages[strings.ToLower(params[2])] = true
+			}
+		}
+	}
+	return images
+}
+
+// dockerfileInstructions returns the instructions of the Dockerfile with the continued lines joined, the comments are skipped
+func dockerfileInstructions(dockerfile []byte) []string {
+	var instructions []string
+	var current strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(dockerfile))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if continued, ok := strings.CutSuffix(line, "\\"); ok {
+			current.WriteString(continued + " ")
+			continue
+		}
+		current.WriteString(line)
+		if instruction := strings.TrimSpace(current.String()); instruction != "" {
+			instructions = append(instructions, instruction)
+		}
+		current.Reset()
+	}
+	if instruction := strings.TrimSpace(current.String()); instruction != "" {
+		instructions = append(instructions, instruction)
+	}
+	return instructions
+}
+
+// expandDockerfileArgs replaces $NAME, ${NAME} and ${NAME:-default} with the arg values,
+// an unknown arg is kept as is, so the image isn't matched by any allowed prefix
+func expandDockerfileArgs(value string, args map[string]string) string {
+	return os.Expand(value, func(name string) string {
+		name, fallback, hasFallback := strings.Cut(name, ":-")
+		if arg, ok := args[name]; ok && (arg != "" || !hasFallback) {
+			return arg
+		}
+		if hasFallback {
+			return fallback
+		}
+		return "${" + name + "}"
+	})
+}
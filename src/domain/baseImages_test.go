@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func writeDockerfile(t *testing.T, th *testHandler, dockerfile string) {
+	require.NoError(t, os.WriteFile(filepath.Join(th.git.dir, "Dockerfile"), []byte(dockerfile), 0644))
+}
+
+func TestGithubWebhookAllowedBaseImage(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.baseImages = BaseImagePolicy{Allowed: []string{"docker.io/library/golang", "gcr.io/distroless/"}}
+	writeDockerfile(t, th, "FROM golang:1.23\nCMD [\"go\", \"run\", \".\"]\n")
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, "deployment-1").Status)
+	assert.Len(t, th.docker.builds, 1)
+}
+
+func TestGithubWebhookDisallowedBaseImage(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.baseImages = BaseImagePolicy{Allowed: []string{"gcr.io/distroless/"}}
+	writeDockerfile(t, th, "FROM ubuntu:24.04\n")
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "BASE_IMAGE_NOT_ALLOWED", rpcErr.Code)
+	assert.Contains(t, rpcErr.Message, "ubuntu:24.04")
+
+	require.Len(t, th.db.deployments, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.Empty(t, th.docker.builds)
+}
+
+func TestGithubWebhookMultiStageBaseImages(t *testing.T) {
+	dockerfile := `ARG GO_VERSION=1.23
+# the build stage
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS builder
+RUN go build -o /app .
+
+FROM builder AS tested
+RUN go test ./...
+
+FROM node:22 as assets
+RUN npm run build
+
+FROM gcr.io/distroless/static
+COPY --from=builder /app /app
+`
+
+	t.Run("allowed", func(t *testing.T) {
+		th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+		th.baseImages = BaseImagePolicy{Allowed: []string{"golang", "node", "gcr.io/distroless/"}}
+		writeDockerfile(t, th, dockerfile)
+
+		_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+		require.Nil(t, rpcErr)
+	})
+
+	t.Run("a stage base is not allowed", func(t *testing.T) {
+		th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+		th.baseImages = BaseImagePolicy{Allowed: []string{"golang", "gcr.io/distroless/"}}
+		writeDockerfile(t, th, dockerfile)
+
+		_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+		require.NotNil(t, rpcErr)
+		assert.Equal(t, "BASE_IMAGE_NOT_ALLOWED", rpcErr.Code)
+		assert.Contains(t, rpcErr.Message, "node:22")
+		assert.Empty(t, th.docker.builds)
+	})
+}
+
+func TestDockerfileBaseImages(t *testing.T) {
+	images := dockerfileBaseImages([]byte(`ARG BASE=alpine:3.20
+FROM ${BASE} AS base
+FROM base
+FROM scratch
+FROM \
+  ghcr.io/acme/runtime:1
+FROM ${UNKNOWN:-debian:12}
+`))
+	assert.Equal(t, []string{"alpine:3.20", "ghcr.io/acme/runtime:1", "debian:12"}, images)
+}
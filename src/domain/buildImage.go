@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"os"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+type BuildImageRequest struct {
+	AppID string `json:"appId"`
+	// Branch selects the space environment, the connected branch is used if empty
+	Branch string `json:"branch"`
+	// ForceRebuild builds the images without the build cache
+	ForceRebuild bool `json:"forceRebuild"`
+}
+
+type BuildImageResponse struct {
+	// Sha is the built branch tip, the images are tagged with it
+	Sha string `json:"sha"`
+	// Images are the pushed images by the service name
+	Images map[string]Image `json:"images"`
+}
+
+// BuildImage builds and pushes the images of the app branch tip without deploying them, e.g. to warm the build cache.
+// The images are tagged with the commit sha, so the tag of the running deployment is never moved.
+func (h *Handler) BuildImage(ctx context.Context, req BuildImageRequest) (BuildImageResponse, *vel.Error) {
+	repo, rpcErr := h.appRepo(ctx, req.AppID)
+	if rpcErr != nil {
+		return BuildImageResponse{}, rpcErr
+	}
+	branch, sha, rpcErr := h.branchTip(repo, req.Branch)
+	if rpcErr != nil {
+		return BuildImageResponse{}, rpcErr
+	}
+
+	repoDir, err := h.cloneRepo(ctx, repo.InstallationID, repo, repo)
+	if err != nil {
+		return BuildImageResponse{}, planError(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	config, err := h.extractSpace(ctx, req.AppID, repoDir, branch)
+	if err != nil {
+		return BuildImageResponse{}, planError(err)
+	}
+
+	ctx, cancel := withTimeout(ctx, h.timeouts.Deploy)
+	defer cancel()
+
+	images, _, err := h.buildServices(ctx, repoDir, config.Space, sha, req.ForceRebuild)
+	if err != nil {
+		return BuildImageResponse{}, deployError(err)
+	}
+
+	return BuildImageResponse{Sha: sha, Images: images}, nil
+}
+
+// branchTip returns the branch of the app repo and its tip sha,
+// the connected branch is used if the branch is empty and the repo default branch if none is connected
+func (h *Handler) branchTip(repo InstalledRepository, branch string) (string, string, *vel.Error) {
+	if branch == "" {
+		branch = repo.Branch
+	}
+	if branch == "" {
+		githubRepo, err := h.githubClient.GetRepository(repo.InstallationID, repo.FullName)
+		if err != nil {
+			return "", "", planError(err)
+		}
+		branch = githubRepo.DefaultBranch
+	}
+	sha, err := h.githubClient.GetBranchSha(repo.InstallationID, repo.FullName, branch)
+	if err != nil {
+		return "", "", &vel.Error{
+			Code:    "BRANCH_NOT_FOUND",
+			Message: err.Error(),
+		}
+	}
+	return branch, sha, nil
+}
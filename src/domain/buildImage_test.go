@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestBuildImageSkipsDeploy(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.github.defaultBranches = map[string]string{"treenq/treenq": "main"}
+	th.github.branchTips = map[string]string{"treenq/treenq:main": "64263a02d293b1d4ec638ed98d3f3a93f0f788cb"}
+
+	res, rpcErr := th.BuildImage(userCtx("testing"), BuildImageRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, "64263a02d293b1d4ec638ed98d3f3a93f0f788cb", res.Sha)
+	assert.Equal(t, map[string]Image{"api": {
+		Registry:   "registry",
+		Repository: "api",
+		Tag:        "64263a02d293b1d4ec638ed98d3f3a93f0f788cb",
+		Digest:     "sha256:api",
+	}}, res.Images)
+	assert.Len(t, th.docker.builds, 1)
+	assert.Len(t, th.docker.pushes, 1)
+	assert.Empty(t, th.kube.calls, "nothing is applied")
+	assert.Empty(t, th.db.deployments, "no deployment is stored")
+}
+
+func TestBuildImageOfUnknownApp(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.BuildImage(userCtx("testing"), BuildImageRequest{AppID: "unknown"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+	assert.Empty(t, th.docker.builds)
+}
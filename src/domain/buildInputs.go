@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// buildInputs returns a digest of everything the image of a service is built from by the service name:
+// the builder, the Dockerfile path or the buildpack flow, the build envs and secrets and the files of the build context.
+// The space config dir is left out, it configures treenq, so a changed runtime setting alone keeps the digest.
+func buildInputs(sourceDir, configPath string, space tqsdk.Space, buildpacks bool) (map[string]string, error) {
+	files, err := contextDigest(sourceDir, configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest build context: %w", err)
+	}
+
+	inputs := make(map[string]string)
+	for _, service := range space.AllServices() {
+		dockerfile, buildpack, err := resolveBuild(sourceDir, service, buildpacks)
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		fmt.Fprintf(h, "builder=%s\n", space.Builder)
+		if buildpack {
+			fmt.Fprintf(h, "buildpack\n")
+		} else {
+			dockerfile, err = filepath.Rel(sourceDir, dockerfile)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(h, "dockerfile=%s\n", dockerfile)
+		}
+		for _, key := range slices.Sorted(maps.Keys(service.BuildEnvs)) {
+			fmt.Fprintf(h, "env %s=%s\n", key, service.BuildEnvs[key])
+		}
+		for _, secret := range slices.Sorted(slices.Values(service.BuildSecrets)) {
+			fmt.Fprintf(h, "secret %s\n", secret)
+		}
+		fmt.Fprintf(h, "context=%s\n", files)
+		inputs[service.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return inputs, nil
+}
+
+// contextDigest hashes the paths and the contents of the source files but the git and the config dirs
+func contextDigest(sourceDir, configPath string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if rel == ".git" || (configPath != "" && rel == filepath.Clean(configPath)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "%s\x00", filepath.ToSlash(rel))
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// rebuildRequired compares the build inputs with the latest deployment which has built the app images,
+// the images tagged by it are reused if no service input has changed and it's deployed.
+// Any doubt, e.g. the latest build has failed or a service is added, rebuilds.
+func (h *Handler) rebuildRequired(ctx context.Context, def AppDefinition) (bool, AppDefinition, error) {
+	if def.ForceRebuild {
+		return true, AppDefinition{}, nil
+	}
+	history, err := h.db.GetDeploymentHistory(ctx, def.AppID)
+	if err != nil {
+		return true, AppDefinition{}, err
+	}
+	idx := slices.IndexFunc(history, func(previous AppDefinition) bool {
+		return len(previous.BuildInputs) > 0
+	})
+	if idx == -1 {
+		return true, AppDefinition{}, nil
+	}
+	previous := history[idx]
+	if previous.Status != DeploymentStatusDeployed || !maps.Equal(previous.BuildInputs, def.BuildInputs) {
+		return true, AppDefinition{}, nil
+	}
+	return false, previous, nil
+}
+
+// buildOrReuse builds the images of the deployment space unless its build inputs are unchanged since the previous build,
+// the decision is set on the deployment. A failure to tell the inputs builds the images.
+func (h *Handler) buildOrReuse(ctx context.Context, def *AppDefinition, sourceDir string) (map[string]Image, error) {
+	def.RebuildRequired = true
+	inputs, err := buildInputs(sourceDir, def.ConfigPath, def.App, h.docker.HasBuildpacks())
+	if err != nil {
+		h.l.WarnContext(ctx, "failed to resolve build inputs, the images are rebuilt", "appID", def.AppID, "err", err)
+	} else {
+		def.BuildInputs = inputs
+		rebuild, previous, err := h.rebuildRequired(ctx, *def)
+		if err != nil {
+			h.l.WarnContext(ctx, "failed to compare build inputs, the images are rebuilt", "appID", def.AppID, "err", err)
+		} else if !rebuild {
+			if images, err := h.reusedImages(def, previous); err != nil {
+				h.l.WarnContext(ctx, "failed to reuse the previous images, the images are rebuilt", "appID", def.AppID, "previousDeploymentID", previous.ID, "err", err)
+			} else {
+				h.l.InfoContext(ctx, "build inputs are unchanged, the images are reused", "appID", def.AppID, "previousDeploymentID", previous.ID)
+				return images, nil
+			}
+		}
+	}
+
+	images, buildMetrics, err := h.buildServices(ctx, sourceDir, def.App, def.Tag, def.ForceRebuild)
+	if err != nil {
+		return nil, err
+	}
+	def.BuildMetrics = buildMetrics
+	def.Signatures = imageSignatures(images)
+	def.Digests = imageDigests(images)
+	return images, nil
+}
+
+// reusedImages sets the images built for the previous deployment on the deployment and returns them,
+// the images are referred by their recorded digests as the previous tag may have moved since
+func (h *Handler) reusedImages(def *AppDefinition, previous AppDefinition) (map[string]Image, error) {
+	reused := *def
+	reused.Tag = previous.Tag
+	reused.Digests = previous.Digests
+	// the same images are applied again, so are their signatures
+	reused.Signatures = previous.Signatures
+	images, err := h.recordedImages(reused)
+	if err != nil {
+		return nil, err
+	}
+	reused.RebuildRequired = false
+	*def = reused
+	return images, nil
+}
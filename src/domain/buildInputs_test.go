@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestEnvOnlyChangePatchesWithoutBuild(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", RuntimeEnvs: map[string]string{"MODE": "a"}}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.builds, 1)
+	assert.True(t, th.db.deployment(t, "deployment-1").RebuildRequired)
+
+	changed := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", RuntimeEnvs: map[string]string{"MODE": "b"}, Replicas: 3}}
+	th.extractor.space = changed
+	push := pushRequest()
+	push.After = "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	assert.Len(t, th.docker.builds, 1, "the unchanged build inputs are not built again")
+	def := th.db.deployment(t, "deployment-2")
+	assert.False(t, def.RebuildRequired)
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, changed, th.kube.defined[def.ID], "the changed config is applied")
+	assert.Equal(t, map[string]string{"api": "sha256:api"}, def.Digests, "the reused digests are recorded")
+	assert.Equal(t, Image{Registry: "registry", Repository: "api", Tag: pushRequest().After, Digest: "sha256:api"}, th.kube.images[def.ID]["api"], "the previous build is applied by its digest")
+}
+
+func TestReuseWithoutRecordedDigestRebuilds(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}}
+	th := newTestHandler(t, space)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.builds, 1)
+	// a deployment recorded before the digests were
+	th.db.deployments[0].Digests = nil
+
+	_, rpcErr = th.GithubWebhook(context.Background(), pushOf("e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"))
+	require.Nil(t, rpcErr)
+
+	assert.Len(t, th.docker.builds, 2, "the images of an unknown digest are built again")
+	def := th.db.deployment(t, "deployment-2")
+	assert.True(t, def.RebuildRequired)
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+}
+
+func TestDockerfileChangeForcesRebuild(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.builds, 1)
+
+	require.NoError(t, os.WriteFile(filepath.Join(th.git.dir, "Dockerfile"), []byte("FROM alpine"), 0644))
+	push := pushRequest()
+	push.After = "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	assert.Len(t, th.docker.builds, 2)
+	assert.True(t, th.db.deployment(t, "deployment-2").RebuildRequired)
+}
+
+func TestBuildInputsIgnoreConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "tq"), 0755))
+	space := tqsdk.Space{Service: tqsdk.Service{Name: "api"}}
+
+	before, err := buildInputs(dir, "tq", space, false)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tq", "space.go"), []byte("package tq"), 0644))
+	after, err := buildInputs(dir, "tq", space, false)
+	require.NoError(t, err)
+	assert.Equal(t, before, after, "the config dir isn't built into the image")
+
+	space.Service.BuildEnvs = map[string]string{"GOFLAGS": "-mod=vendor"}
+	withEnv, err := buildInputs(dir, "tq", space, false)
+	require.NoError(t, err)
+	assert.NotEqual(t, after, withEnv, "a build env changes the image")
+}
@@ -0,0 +1,354 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrBuilderUnavailable is returned if the space selects a builder treenq doesn't provide
+var ErrBuilderUnavailable = errors.New("builder is not available")
+
+// ErrBuildpacksUnavailable is returned if a service is built with buildpacks but treenq doesn't enable them
+var ErrBuildpacksUnavailable = errors.New("buildpacks are not enabled")
+
+// errNoDockerfile is returned if the service context has no Dockerfile to detect
+var errNoDockerfile = errors.New("no Dockerfile found")
+
+// serviceLevels groups the services by their dependencies,
+// every service of a level depends only on the services of the previous levels.
+// The levels order the builds, the apply of the space objects is a single batch.
+func serviceLevels(services []tqsdk.Service) ([][]tqsdk.Service, error) {
+	pending := make(map[string]tqsdk.Service, len(services))
+	for _, service := range services {
+		if _, ok := pending[service.Name]; ok {
+			return nil, fmt.Errorf("service %q is defined more than once", service.Name)
+		}
+		pending[service.Name] = service
+	}
+	for _, service := range services {
+		for _, dep := range service.DependsOn {
+			if _, ok := pending[dep]; !ok {
+				return nil, fmt.Errorf("service %q depends on unknown service %q", service.Name, dep)
+			}
+		}
+	}
+
+	done := make(map[string]bool, len(services))
+	var levels [][]tqsdk.Service
+	for len(done) < len(services) {
+		var level []tqsdk.Service
+		// iterate over the given slice to keep the level order stable
+		for _, service := range services {
+			if done[service.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range service.DependsOn {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, service)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("services have circular dependencies")
+		}
+		for _, service := range level {
+			done[service.Name] = true
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// buildServices builds an image for every service of the space level by level,
+// the level services are built in parallel limited by the space ServiceConcurrency.
+// A noCache build ignores the build cache.
+func (h *Handler) buildServices(ctx context.Context, repoDir string, space tqsdk.Space, tag string, noCache bool) (map[string]Image, map[string]BuildMetrics, error) {
+	levels, err := serviceLevels(space.AllServices())
+	if err != nil {
+		return nil, nil, UserFailure(err)
+	}
+	if space.Builder != "" && !h.docker.HasBuilder(space.Builder) {
+		return nil, nil, UserFailure(fmt.Errorf("%w: %q", ErrBuilderUnavailable, space.Builder))
+	}
+
+	var mu sync.Mutex
+	images := make(map[string]Image)
+	metrics := make(map[string]BuildMetrics)
+	for _, level := range levels {
+		g, gCtx := errgroup.WithContext(ctx)
+		limit := space.ServiceConcurrency
+		if limit <= 0 {
+			limit = len(level)
+		}
+		g.SetLimit(limit)
+
+		for _, service := range level {
+			g.Go(func() error {
+				dockerfile, buildpack, err := resolveBuild(repoDir, service, h.docker.HasBuildpacks())
+				if err != nil {
+					return UserFailure(err)
+				}
+				// the buildpack builder is provided by treenq, so are its base images
+				if !buildpack {
+					if err := h.baseImages.check(service.Name, dockerfile); err != nil {
+						return err
+					}
+				}
+				image, buildMetrics, err := h.buildImage(gCtx, BuildArtifactRequest{
+					Name:       service.Name,
+					Path:       repoDir,
+					Dockerfile: dockerfile,
+					Tag:        tag,
+					Builder:    space.Builder,
+					NoCache:    noCache,
+					Buildpack:  buildpack,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to build service %q: %w", service.Name, err)
+				}
+				image, err = h.pushImage(gCtx, service.Name, image)
+				if err != nil {
+					return fmt.Errorf("failed to push service %q: %w", service.Name, err)
+				}
+				image, err = h.signImage(gCtx, service.Name, image)
+				if err != nil {
+					return fmt.Errorf("failed to sign service %q: %w", service.Name, err)
+				}
+
+				mu.Lock()
+				images[service.Name] = image
+				metrics[service.Name] = buildMetrics
+				mu.Unlock()
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return images, metrics, nil
+}
+
+// BuildTimeoutError is returned once an image build exceeds the build timeout
+type BuildTimeoutError struct {
+	Service string
+	Elapsed time.Duration
+}
+
+func (e *BuildTimeoutError) Error() string {
+	return fmt.Sprintf("build of service %q timed out after %s", e.Service, e.Elapsed.Round(time.Millisecond))
+}
+
+func (e *BuildTimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// BuildMetrics describes how an image has been built
+type BuildMetrics struct {
+	Duration time.Duration `json:"duration"`
+	// CachedLayers is how many of the TotalLayers build steps are served from the build cache
+	CachedLayers int `json:"cachedLayers"`
+	TotalLayers  int `json:"totalLayers"`
+}
+
+// BuildError is returned if an image failed to build
+type BuildError struct {
+	Service string
+	Err     error
+}
+
+func (e *BuildError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// PushError is returned if a built image failed to be pushed to the registry
+type PushError struct {
+	Service string
+	Err     error
+}
+
+func (e *PushError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PushError) Unwrap() error {
+	return e.Err
+}
+
+// ImageConcurrency limits the image builds and pushes made at the same time by all the deployments,
+// the builds are CPU bound while the pushes wait for the registry. Zero means no limit.
+type ImageConcurrency struct {
+	Builds int
+	Pushes int
+}
+
+// slots limit the concurrent calls and count the running and the waiting ones
+type slots struct {
+	// limit is the max of the concurrent calls, zero means no limit
+	limit    int
+	sem      *semaphore.Weighted
+	inFlight atomic.Int64
+	queued   atomic.Int64
+}
+
+func newSlots(n int) *slots {
+	s := &slots{}
+	if n > 0 {
+		s.limit = n
+		s.sem = semaphore.NewWeighted(int64(n))
+	}
+	return s
+}
+
+// acquire takes a slot waiting for one to free, the returned func releases it
+func (s *slots) acquire(ctx context.Context) (func(), error) {
+	if s.sem != nil {
+		s.queued.Add(1)
+		err := s.sem.Acquire(ctx, 1)
+		s.queued.Add(-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.inFlight.Add(1)
+	return func() {
+		s.inFlight.Add(-1)
+		if s.sem != nil {
+			s.sem.Release(1)
+		}
+	}, nil
+}
+
+// usage returns the slots taken and awaited at the moment
+func (s *slots) usage() SlotsUsage {
+	return SlotsUsage{
+		InFlight: int(s.inFlight.Load()),
+		Queued:   int(s.queued.Load()),
+		Limit:    s.limit,
+	}
+}
+
+// buildImage builds a single image limited by the build timeout
+func (h *Handler) buildImage(ctx context.Context, args BuildArtifactRequest) (Image, BuildMetrics, error) {
+	release, err := h.builds.acquire(ctx)
+	if err != nil {
+		return Image{}, BuildMetrics{}, err
+	}
+	defer release()
+
+	buildCtx, cancel := withTimeout(ctx, h.timeouts.Build)
+	defer cancel()
+
+	start := time.Now()
+	image, metrics, err := h.docker.Build(buildCtx, args)
+	if err != nil && ctx.Err() == nil && errors.Is(buildCtx.Err(), context.DeadlineExceeded) {
+		// a slow build is up to the app, retrying it doesn't help
+		return image, metrics, UserFailure(&BuildTimeoutError{Service: args.Name, Elapsed: time.Since(start)})
+	}
+	if err != nil {
+		return image, metrics, &BuildError{Service: args.Name, Err: err}
+	}
+	return image, metrics, nil
+}
+
+// pushImage pushes the built image, the image is ready to deploy only once the registry confirms its digest
+func (h *Handler) pushImage(ctx context.Context, service string, image Image) (Image, error) {
+	release, err := h.pushes.acquire(ctx)
+	if err != nil {
+		return image, err
+	}
+	defer release()
+
+	if err := h.checkTagImmutability(ctx, image); err != nil {
+		return image, &PushError{Service: service, Err: err}
+	}
+	pushed, err := h.docker.Push(ctx, image)
+	if err != nil {
+		return image, &PushError{Service: service, Err: err}
+	}
+	if pushed.Digest == "" {
+		return image, &PushError{Service: service, Err: SystemFailure(fmt.Errorf("registry returned no digest for image %s", image.FullPath()))}
+	}
+	return pushed, nil
+}
+
+// resolveBuild selects how the service image is built, the Dockerfile path is returned unless it's built with buildpacks.
+// A service without a builder is built with buildpacks only if they're enabled and it has no Dockerfile.
+func resolveBuild(contextDir string, service tqsdk.Service, buildpacks bool) (string, bool, error) {
+	switch service.Builder {
+	case tqsdk.BuilderBuildpack:
+		if !buildpacks {
+			return "", false, fmt.Errorf("%w: service %q", ErrBuildpacksUnavailable, service.Name)
+		}
+		return "", true, nil
+	case tqsdk.BuilderDocker:
+		dockerfile, err := resolveDockerfile(contextDir, service)
+		return dockerfile, false, err
+	case "":
+		dockerfile, err := resolveDockerfile(contextDir, service)
+		if buildpacks && errors.Is(err, errNoDockerfile) {
+			return "", true, nil
+		}
+		return dockerfile, false, err
+	default:
+		return "", false, fmt.Errorf("unknown builder %q of service %q, use %s or %s", service.Builder, service.Name, tqsdk.BuilderDocker, tqsdk.BuilderBuildpack)
+	}
+}
+
+// resolveDockerfile returns the service Dockerfile path,
+// if the service doesn't set DockerfilePath the only Dockerfile of the context root is used.
+func resolveDockerfile(contextDir string, service tqsdk.Service) (string, error) {
+	if service.DockerfilePath != "" {
+		return filepath.Join(contextDir, service.DockerfilePath), nil
+	}
+
+	entries, err := os.ReadDir(contextDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service %q context to detect Dockerfile: %w", service.Name, err)
+	}
+
+	var found []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isDockerfileName(entry.Name()) {
+			continue
+		}
+		found = append(found, entry.Name())
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%w for service %q, set DockerfilePath explicitly", errNoDockerfile, service.Name)
+	case 1:
+		return filepath.Join(contextDir, found[0]), nil
+	default:
+		return "", fmt.Errorf("multiple Dockerfiles found for service %q: %s, set DockerfilePath explicitly", service.Name, strings.Join(found, ", "))
+	}
+}
+
+// isDockerfileName matches the common Dockerfile names: Dockerfile, Dockerfile.dev, app.Dockerfile
+func isDockerfileName(name string) bool {
+	name = strings.ToLower(name)
+	return name == "dockerfile" || strings.HasPrefix(name, "dockerfile.") || strings.HasSuffix(name, ".dockerfile")
+}
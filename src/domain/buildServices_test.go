@@ -0,0 +1,375 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func multiServiceSpace(concurrency int) tqsdk.Space {
+	return tqsdk.Space{
+		Key:     "space",
+		Service: tqsdk.Service{Name: "api"},
+		Services: []tqsdk.Service{
+			{Name: "worker"},
+			{Name: "cron"},
+		},
+		ServiceConcurrency: concurrency,
+	}
+}
+
+// trackConcurrentBuilds makes every build last a bit and records the max amount of parallel builds
+func trackConcurrentBuilds(docker *fakeDocker) *atomic.Int32 {
+	var inFlight, maxInFlight atomic.Int32
+	docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+		current := inFlight.Add(1)
+		for {
+			max := maxInFlight.Load()
+			if current <= max || maxInFlight.CompareAndSwap(max, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		inFlight.Add(-1)
+		return docker.Image(args), nil
+	}
+	return &maxInFlight
+}
+
+func TestGithubWebhookBuildsServicesSequentially(t *testing.T) {
+	th := newTestHandler(t, multiServiceSpace(1))
+	maxInFlight := trackConcurrentBuilds(th.docker)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Len(t, th.docker.builds, 3)
+	assert.Equal(t, int32(1), maxInFlight.Load())
+}
+
+func TestGithubWebhookBuildsServicesInParallel(t *testing.T) {
+	th := newTestHandler(t, multiServiceSpace(0))
+	maxInFlight := trackConcurrentBuilds(th.docker)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Len(t, th.docker.builds, 3)
+	assert.Equal(t, int32(3), maxInFlight.Load())
+}
+
+func TestGithubWebhookBuildsDependencyFirst(t *testing.T) {
+	space := multiServiceSpace(0)
+	space.Service.DependsOn = []string{"worker"}
+	th := newTestHandler(t, space)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	built := make([]string, len(th.docker.builds))
+	for i, build := range th.docker.builds {
+		built[i] = build.Name
+	}
+	assert.Less(t, slices.Index(built, "worker"), slices.Index(built, "api"), "a service is built after its dependency")
+	assert.Len(t, th.kube.applied, 1, "the services are applied in a single batch once all of them are built")
+}
+
+func TestServiceLevels(t *testing.T) {
+	levels, err := serviceLevels([]tqsdk.Service{
+		{Name: "api", DependsOn: []string{"db"}},
+		{Name: "db"},
+		{Name: "worker", DependsOn: []string{"db"}},
+		{Name: "gateway", DependsOn: []string{"api", "worker"}},
+	})
+	require.NoError(t, err)
+
+	names := make([][]string, len(levels))
+	for i, level := range levels {
+		for _, service := range level {
+			names[i] = append(names[i], service.Name)
+		}
+	}
+	assert.Equal(t, [][]string{{"db"}, {"api", "worker"}, {"gateway"}}, names)
+
+	_, err = serviceLevels([]tqsdk.Service{
+		{Name: "api", DependsOn: []string{"worker"}},
+		{Name: "worker", DependsOn: []string{"api"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestResolveDockerfile(t *testing.T) {
+	t.Run("explicit path", func(t *testing.T) {
+		dir := t.TempDir()
+		path, err := resolveDockerfile(dir, tqsdk.Service{Name: "api", DockerfilePath: "build/Dockerfile"})
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "build/Dockerfile"), path)
+	})
+
+	t.Run("auto detect", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# readme"), 0644))
+
+		path, err := resolveDockerfile(dir, tqsdk.Service{Name: "api"})
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "Dockerfile"), path)
+	})
+
+	t.Run("no Dockerfile", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := resolveDockerfile(dir, tqsdk.Service{Name: "api"})
+		assert.ErrorContains(t, err, "no Dockerfile found")
+	})
+
+	t.Run("multiple Dockerfiles", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile.dev"), []byte("FROM scratch"), 0644))
+
+		_, err := resolveDockerfile(dir, tqsdk.Service{Name: "api"})
+		assert.ErrorContains(t, err, "multiple Dockerfiles found")
+	})
+}
+
+func TestResolveBuild(t *testing.T) {
+	withDockerfile := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(withDockerfile, "Dockerfile"), []byte("FROM scratch"), 0644))
+	withoutDockerfile := t.TempDir()
+
+	tests := []struct {
+		name       string
+		dir        string
+		builder    string
+		buildpacks bool
+		dockerfile string
+		buildpack  bool
+		err        string
+	}{
+		{name: "Dockerfile wins", dir: withDockerfile, buildpacks: true, dockerfile: filepath.Join(withDockerfile, "Dockerfile")},
+		{name: "buildpack without Dockerfile", dir: withoutDockerfile, buildpacks: true, buildpack: true},
+		{name: "buildpacks disabled", dir: withoutDockerfile, err: "no Dockerfile found"},
+		{name: "explicit buildpack", dir: withDockerfile, builder: tqsdk.BuilderBuildpack, buildpacks: true, buildpack: true},
+		{name: "explicit buildpack disabled", dir: withoutDockerfile, builder: tqsdk.BuilderBuildpack, err: "buildpacks are not enabled"},
+		{name: "explicit docker", dir: withoutDockerfile, builder: tqsdk.BuilderDocker, buildpacks: true, err: "no Dockerfile found"},
+		{name: "unknown builder", dir: withDockerfile, builder: "nix", err: `unknown builder "nix"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dockerfile, buildpack, err := resolveBuild(tt.dir, tqsdk.Service{Name: "api", Builder: tt.builder}, tt.buildpacks)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.dockerfile, dockerfile)
+			assert.Equal(t, tt.buildpack, buildpack)
+		})
+	}
+}
+
+func TestGithubWebhookBuildsWithBuildpacksWithoutDockerfile(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.docker.buildpacks = true
+	// the base image policy reads no Dockerfile of a buildpack build
+	th.baseImages = BaseImagePolicy{Allowed: []string{"docker.io/library/golang"}}
+	require.NoError(t, os.Remove(filepath.Join(th.git.dir, "Dockerfile")))
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.docker.builds, 1)
+	build := th.docker.builds[0]
+	assert.True(t, build.Buildpack)
+	assert.Empty(t, build.Dockerfile)
+	assert.Equal(t, th.git.dirs[0], build.Path)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+}
+
+func TestBuildServicesBuildTimeout(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.timeouts.Build = 20 * time.Millisecond
+	th.docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+		<-ctx.Done()
+		return Image{}, ctx.Err()
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "BUILD_TIMEOUT", rpcErr.Code)
+	assert.Contains(t, rpcErr.Message, `build of service "api" timed out after`)
+
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageBuild, def.Failure.Stage)
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestGithubWebhookBuildsWithSelectedBuilder(t *testing.T) {
+	space := multiServiceSpace(0)
+	space.Builder = "buildkit-v0.12"
+	th := newTestHandler(t, space)
+	th.docker.builders = []string{"buildkit-v0.12"}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.docker.builds, 3)
+	for _, build := range th.docker.builds {
+		assert.Equal(t, "buildkit-v0.12", build.Builder)
+	}
+}
+
+func TestGithubWebhookUnavailableBuilder(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Builder: "buildkit-nightly"}
+	th := newTestHandler(t, space)
+	th.docker.builders = []string{"buildkit-v0.12"}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Contains(t, rpcErr.Message, `builder is not available: "buildkit-nightly"`)
+
+	assert.Empty(t, th.docker.builds)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageBuild, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+}
+
+func TestGithubWebhookPushesConcurrentlyWithSerializedBuilds(t *testing.T) {
+	th := newTestHandler(t, multiServiceSpace(0))
+	th.builds = newSlots(1)
+	maxBuilds := trackConcurrentBuilds(th.docker)
+
+	var inFlight, maxPushes atomic.Int32
+	th.docker.push = func(ctx context.Context, image Image) (Image, error) {
+		current := inFlight.Add(1)
+		for {
+			max := maxPushes.Load()
+			if current <= max || maxPushes.CompareAndSwap(max, current) {
+				break
+			}
+		}
+		// a slow registry, the pushes overlap the next builds
+		time.Sleep(200 * time.Millisecond)
+		inFlight.Add(-1)
+		image.Digest = "sha256:" + image.Repository
+		return image, nil
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, int32(1), maxBuilds.Load())
+	assert.Greater(t, maxPushes.Load(), int32(1))
+	assert.Len(t, th.docker.pushes, 3)
+}
+
+func TestGithubWebhookDistinguishesPushFromBuildFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(docker *fakeDocker)
+		code  string
+		stage DeploymentStage
+	}{
+		{
+			name: "build",
+			setup: func(docker *fakeDocker) {
+				docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+					return Image{}, UserFailure(errors.New("dockerfile parse error"))
+				}
+			},
+			code:  "BUILD_FAILED",
+			stage: DeploymentStageBuild,
+		},
+		{
+			name: "push",
+			setup: func(docker *fakeDocker) {
+				docker.push = func(ctx context.Context, image Image) (Image, error) {
+					return image, SystemFailure(errors.New("registry is unavailable"))
+				}
+			},
+			code:  "PUSH_FAILED",
+			stage: DeploymentStagePush,
+		},
+		{
+			name: "push without digest",
+			setup: func(docker *fakeDocker) {
+				docker.push = func(ctx context.Context, image Image) (Image, error) {
+					return image, nil
+				}
+			},
+			code:  "PUSH_FAILED",
+			stage: DeploymentStagePush,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+			tt.setup(th.docker)
+
+			_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+			require.NotNil(t, rpcErr)
+			assert.Equal(t, tt.code, rpcErr.Code)
+
+			def := th.db.deployments[0]
+			assert.Equal(t, DeploymentStatusFailed, def.Status)
+			require.NotNil(t, def.Failure)
+			assert.Equal(t, tt.stage, def.Failure.Stage)
+			assert.Empty(t, th.kube.applied)
+		})
+	}
+}
+
+func TestBuildWaitsForFreeDaemonSlot(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	th.builds = newSlots(2)
+	started := make(chan string, 3)
+	finish := make(chan struct{})
+	th.docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+		started <- args.Name
+		<-finish
+		return th.docker.Image(args), nil
+	}
+
+	done := make(chan struct{}, 3)
+	for _, name := range []string{"api", "worker", "cron"} {
+		go func() {
+			_, _, err := th.buildImage(context.Background(), BuildArtifactRequest{Name: name})
+			assert.NoError(t, err)
+			done <- struct{}{}
+		}()
+	}
+	<-started
+	<-started
+	require.Eventually(t, func() bool {
+		status, _ := th.Status(context.Background(), struct{}{})
+		return status.Builds == SlotsUsage{InFlight: 2, Queued: 1, Limit: 2}
+	}, time.Second, time.Millisecond)
+	select {
+	case name := <-started:
+		t.Fatalf("build of %s started without a free slot", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	finish <- struct{}{}
+	<-done
+	<-started
+	close(finish)
+	<-done
+	<-done
+	status, _ := th.Status(context.Background(), struct{}{})
+	assert.Equal(t, SlotsUsage{Limit: 2}, status.Builds)
+}
@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+var ErrDeploymentCancelled = errors.New("deployment is cancelled")
+
+// deployRun is a running deployment, the deployment id is known once the deployment is saved
+type deployRun struct {
+	appID        string
+	deploymentID string
+	cancel       context.CancelCauseFunc
+	// stage is the deployment stage the run is in
+	stage DeploymentStage
+}
+
+type deployRunKey struct{}
+
+// deployRuns holds the running deployments to cancel them
+type deployRuns struct {
+	mu   sync.Mutex
+	runs map[*deployRun]struct{}
+}
+
+func newDeployRuns() *deployRuns {
+	return &deployRuns{runs: make(map[*deployRun]struct{})}
+}
+
+// start registers a deployment run of the app, the returned context is cancelled once the run is cancelled.
+// The stop function must be called once the run is over.
+func (r *deployRuns) start(ctx context.Context, appID, deploymentID string) (context.Context, *deployRun, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	run := &deployRun{appID: appID, deploymentID: deploymentID, cancel: cancel}
+	r.mu.Lock()
+	r.runs[run] = struct{}{}
+	r.mu.Unlock()
+	ctx = context.WithValue(ctx, deployRunKey{}, run)
+	return ctx, run, func() {
+		r.mu.Lock()
+		delete(r.runs, run)
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// saved binds the run to the saved deployment
+func (r *deployRuns) saved(run *deployRun, deploymentID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run.deploymentID = deploymentID
+}
+
+// enter sets the stage of the run started with the context, a context without a run is ignored
+func (r *deployRuns) enter(ctx context.Context, stage DeploymentStage) {
+	run, ok := ctx.Value(deployRunKey{}).(*deployRun)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run.stage = stage
+}
+
+// find returns the running deployment by its id, a queued deployment is found by its reserved id before it's saved
+func (r *deployRuns) find(deploymentID string) (AppDefinition, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for run := range r.runs {
+		if run.deploymentID == deploymentID {
+			return AppDefinition{ID: run.deploymentID, AppID: run.appID, Status: DeploymentStatusDeploying}, true
+		}
+	}
+	return AppDefinition{}, false
+}
+
+// running returns the number of the running deployments
+func (r *deployRuns) running() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.runs)
+}
+
+// state returns the deployment and the stage of the run
+func (r *deployRuns) state(run *deployRun) (string, DeploymentStage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return run.deploymentID, run.stage
+}
+
+// cancel cancels the runs of the app, only the run of the deployment if its id is given,
+// it returns the number of the cancelled runs
+func (r *deployRuns) cancel(appID, deploymentID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cancelled int
+	for run := range r.runs {
+		if run.appID != appID || (deploymentID != "" && run.deploymentID != deploymentID) {
+			continue
+		}
+		run.cancel(ErrDeploymentCancelled)
+		cancelled++
+	}
+	return cancelled
+}
+
+// deploymentCancelled reports whether the deployment context is cancelled by CancelDeployment
+func deploymentCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrDeploymentCancelled)
+}
+
+type CancelDeploymentRequest struct {
+	AppID string `json:"appId"`
+	// DeploymentID selects the deployment to cancel, every running deployment of the app is cancelled if it's empty,
+	// including the ones still building and not listed yet
+	DeploymentID string `json:"deploymentId"`
+}
+
+type CancelDeploymentResponse struct {
+	// Cancelled is the number of the cancelled deployments
+	Cancelled int `json:"cancelled"`
+}
+
+// CancelDeployment stops the running deployments of the app, a running build is aborted,
+// the objects changed by a cancelled apply are rolled back to the previous deployment of the environment
+func (h *Handler) CancelDeployment(ctx context.Context, req CancelDeploymentRequest) (CancelDeploymentResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return CancelDeploymentResponse{}, rpcErr
+	}
+
+	cancelled := h.runs.cancel(req.AppID, req.DeploymentID)
+	if cancelled == 0 {
+		return CancelDeploymentResponse{}, &vel.Error{
+			Code:    "DEPLOYMENT_NOT_RUNNING",
+			Message: "no running deployment to cancel",
+		}
+	}
+	return CancelDeploymentResponse{Cancelled: cancelled}, nil
+}
+
+// storeCancelled stores the cancelled deployment, a deployment cancelled before it's been saved is saved as cancelled
+func (h *Handler) storeCancelled(ctx context.Context, def AppDefinition) error {
+	h.l.InfoContext(ctx, "deployment cancelled", "deploymentID", def.ID, "appID", def.AppID)
+
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	if def.ID != "" {
+		err = h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusCancelled)
+	}
+	// a reserved id isn't saved until the deployment is built
+	if def.ID == "" || errors.Is(err, ErrDeploymentNotFound) {
+		def.Status = DeploymentStatusCancelled
+		_, err = h.db.SaveDeployment(ctx, def)
+	}
+	if err != nil {
+		h.l.ErrorContext(ctx, "failed to store cancelled deployment", "deploymentID", def.ID, "err", err)
+	}
+	return ErrDeploymentCancelled
+}
+
+// rollbackCancelled applies the previous deployment of the environment again, the cancelled apply may have changed some objects
+func (h *Handler) rollbackCancelled(ctx context.Context, def AppDefinition) {
+	if err := h.rollbackDeployment(context.WithoutCancel(ctx), def); err != nil {
+		h.l.ErrorContext(ctx, "failed to roll back cancelled deployment", "deploymentID", def.ID, "err", err)
+	}
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// deployInBackground runs the push deployment, the returned channel is closed once it's done
+func deployInBackground(th *testHandler) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		th.GithubWebhook(context.Background(), pushRequest())
+	}()
+	return done
+}
+
+func TestCancelDeploymentAbortsBuild(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	building := make(chan struct{})
+	th.docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+		close(building)
+		<-ctx.Done()
+		return Image{}, ctx.Err()
+	}
+
+	done := deployInBackground(th)
+	<-building
+	res, rpcErr := th.CancelDeployment(userCtx("testing"), CancelDeploymentRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, 1, res.Cancelled)
+	<-done
+
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, DeploymentStatusCancelled, th.db.deployments[0].Status)
+	assert.Nil(t, th.db.deployments[0].Failure)
+	assert.Empty(t, th.docker.pushes, "the aborted build isn't pushed")
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestCancelDeploymentRollsBackApply(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}}
+	th := newTestHandler(t, space)
+	th.db.deployments = []AppDefinition{{ID: "previous", AppID: testAppID, App: space, Status: DeploymentStatusDeployed, Digests: map[string]string{"api": "sha256:previous"}}}
+	applying := make(chan struct{})
+	th.kube.apply = func(ctx context.Context, data string) error {
+		if data == "previous" {
+			return nil
+		}
+		close(applying)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	done := deployInBackground(th)
+	<-applying
+	_, rpcErr := th.CancelDeployment(userCtx("testing"), CancelDeploymentRequest{AppID: testAppID, DeploymentID: "deployment-2"})
+	require.Nil(t, rpcErr)
+	<-done
+
+	def := th.db.deployment(t, "deployment-2")
+	assert.Equal(t, DeploymentStatusCancelled, def.Status)
+	assert.Equal(t, []string{"deployment-2", "previous"}, th.kube.applied, "the previous deployment is applied again")
+}
+
+func TestCancelDeploymentNothingRunning(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.CancelDeployment(userCtx("testing"), CancelDeploymentRequest{AppID: testAppID})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "DEPLOYMENT_NOT_RUNNING", rpcErr.Code)
+
+	_, rpcErr = th.CancelDeployment(userCtx("testing"), CancelDeploymentRequest{AppID: "unknown"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+}
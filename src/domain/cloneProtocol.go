@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrCloneConnection is returned by Git.Clone if the remote isn't reachable over the clone protocol,
+// e.g. the network blocks its port. An auth failure is never a connection failure.
+var ErrCloneConnection = errors.New("failed to connect to the git remote")
+
+// errNoCloneCredentials tells the repo has no deploy key to clone over SSH, so it's not tried
+var errNoCloneCredentials = errors.New("no clone credentials for the protocol")
+
+// CloneProtocol is the git transport a repo is cloned over
+type CloneProtocol string
+
+const (
+	// CloneProtocolHTTPS clones with an installation token, a public repo is cloned without any
+	CloneProtocolHTTPS CloneProtocol = "https"
+	// CloneProtocolSSH clones with the deploy key of the repo
+	CloneProtocolSSH CloneProtocol = "ssh"
+)
+
+// cloneProtocols are the protocols of the repo in the order they're tried,
+// a deploy key repo prefers SSH whatever the preferred protocol is
+func (h *Handler) cloneProtocols(connected InstalledRepository) []CloneProtocol {
+	if connected.AuthType == RepoAuthDeployKey || h.cloneProtocol == CloneProtocolSSH {
+		return []CloneProtocol{CloneProtocolSSH, CloneProtocolHTTPS}
+	}
+	return []CloneProtocol{CloneProtocolHTTPS, CloneProtocolSSH}
+}
+
+// cloneRepo clones the repo over the preferred protocol and falls back to the other one if the remote isn't reachable,
+// the fallback is cloned with the credentials of its own protocol. Any other clone failure is returned as is,
+// e.g. the credentials of the other protocol won't fix a rejected one.
+func (h *Handler) cloneRepo(ctx context.Context, installationID int, connected, repo InstalledRepository) (string, error) {
+	// the deployment id is assigned once it's saved, the clone gets its own id to not share the dir with a concurrent deploy
+	cloneID := uuid.NewString()
+	var cloneErr error
+	for _, protocol := range h.cloneProtocols(connected) {
+		creds, err := h.protocolCredentials(ctx, protocol, installationID, connected, repo)
+		if errors.Is(err, errNoCloneCredentials) {
+			continue
+		}
+		if err != nil {
+			if cloneErr != nil {
+				// the fallback is not possible, the connection failure tells more
+				h.l.WarnContext(ctx, "failed to get fallback clone credentials", "protocol", protocol, "repoID", repo.ID, "err", err)
+				return "", cloneErr
+			}
+			return "", err
+		}
+
+		cloneUrl := repo.CloneUrl()
+		if protocol == CloneProtocolSSH {
+			cloneUrl = repo.SSHCloneUrl()
+		}
+		repoDir, err := h.git.Clone(cloneUrl, installationID, repo.ID, cloneID, creds)
+		// the key must not outlive the clone
+		clear(creds.DeployKey)
+		if err == nil {
+			return repoDir, nil
+		}
+		if !errors.Is(err, ErrCloneConnection) {
+			return "", err
+		}
+		h.l.WarnContext(ctx, "failed to connect to the git remote", "protocol", protocol, "repoID", repo.ID, "err", err)
+		cloneErr = err
+	}
+	// the https protocol is always tried, so is the connection failure set
+	return "", cloneErr
+}
+
+// protocolCredentials returns the credentials the repo is cloned with over the protocol,
+// errNoCloneCredentials is returned if the repo can't be cloned over it
+func (h *Handler) protocolCredentials(ctx context.Context, protocol CloneProtocol, installationID int, connected, repo InstalledRepository) (CloneCredentials, error) {
+	if protocol == CloneProtocolSSH {
+		key, err := h.db.GetRepoDeployKey(ctx, connected.TreenqID)
+		if err != nil {
+			if !errors.Is(err, ErrDeployKeyNotFound) {
+				return CloneCredentials{}, SystemFailure(err)
+			}
+			if connected.AuthType == RepoAuthDeployKey {
+				return CloneCredentials{}, UserFailure(err)
+			}
+			return CloneCredentials{}, errNoCloneCredentials
+		}
+		return CloneCredentials{DeployKey: []byte(key)}, nil
+	}
+
+	if !repo.Private {
+		return CloneCredentials{}, nil
+	}
+	// TODO: cache an issued token
+	token, permissions, err := h.issueAccessToken(ctx, installationID)
+	if err != nil {
+		return CloneCredentials{}, err
+	}
+	// the clone would fail anyway, the git failure never tells why
+	if !permissions.CanClone() {
+		return CloneCredentials{}, UserFailure(&InsufficientPermissionsError{
+			InstallationID: installationID,
+			Granted:        permissions.Permissions["contents"],
+		})
+	}
+	return CloneCredentials{AccessToken: token.Token}, nil
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// newFallbackTestHandler connects a private repo cloned with an installation token which has a deploy key to fall back to
+func newFallbackTestHandler(t *testing.T) (*testHandler, string) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	key := newDeployKey(t)
+	require.NoError(t, th.db.SetRepoDeployKey(context.Background(), testAppID, key))
+	th.db.repos[0].AuthType = RepoAuthGithubApp
+	return th, key
+}
+
+func TestCloneConnectionFailureFallsBackToSSH(t *testing.T) {
+	th, key := newFallbackTestHandler(t)
+	th.git.clone = func(url string) error {
+		if strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("%w: dial tcp 140.82.121.4:443: connect: connection refused", ErrCloneConnection)
+		}
+		return nil
+	}
+	req := pushRequest()
+	req.Repository.Private = true
+
+	_, rpcErr := th.GithubWebhook(context.Background(), req)
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"https://github.com/treenq/treenq.git", "ssh://git@github.com/treenq/treenq.git"}, th.git.urls)
+	assert.Equal(t, []CloneCredentials{{AccessToken: "ghs_token"}, {DeployKey: []byte(key)}}, th.git.creds,
+		"every protocol is cloned with its own credentials")
+	assert.Equal(t, th.git.cloneIDs[0], th.git.cloneIDs[1])
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+}
+
+func TestCloneAuthFailureDoesNotFallBack(t *testing.T) {
+	th, _ := newFallbackTestHandler(t)
+	th.git.clone = func(url string) error {
+		return errors.New("error while cloning the repo: authentication required")
+	}
+	req := pushRequest()
+	req.Repository.Private = true
+
+	_, rpcErr := th.GithubWebhook(context.Background(), req)
+	require.NotNil(t, rpcErr)
+
+	assert.Equal(t, []string{"https://github.com/treenq/treenq.git"}, th.git.urls)
+	def := th.db.deployments[0]
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageClone, def.Failure.Stage)
+}
+
+func TestCloneConnectionFailureWithoutFallbackCredentials(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.git.clone = func(url string) error {
+		return fmt.Errorf("%w: dial tcp 140.82.121.4:443: i/o timeout", ErrCloneConnection)
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, 1, th.git.clones, "there is no deploy key to clone over SSH")
+	assert.Contains(t, rpcErr.Message, "i/o timeout")
+}
+
+func TestClonePrefersSSH(t *testing.T) {
+	th, key := newFallbackTestHandler(t)
+	th.cloneProtocol = CloneProtocolSSH
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"ssh://git@github.com/treenq/treenq.git"}, th.git.urls)
+	assert.Equal(t, []CloneCredentials{{DeployKey: []byte(key)}}, th.git.creds)
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// APIKind is a kind of the cluster objects served at the api version, e.g. networking.k8s.io/v1 Ingress
+type APIKind struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+}
+
+func (k APIKind) String() string {
+	return k.APIVersion + " " + k.Kind
+}
+
+// migrationJobKind is the kind of the migrations Job, it's run before the app objects are applied
+var migrationJobKind = APIKind{APIVersion: "batch/v1", Kind: "Job"}
+
+// ClusterCapabilityError is returned if the cluster doesn't serve a kind the deployment applies,
+// e.g. the CRD of a feature the space uses isn't installed
+type ClusterCapabilityError struct {
+	Missing []APIKind
+}
+
+func (e *ClusterCapabilityError) Error() string {
+	missing := make([]string, len(e.Missing))
+	for i, kind := range e.Missing {
+		missing[i] = kind.String()
+	}
+	return "cluster doesn't serve the apis the deployment requires: " + strings.Join(missing, ", ")
+}
+
+// checkCapabilities makes sure the cluster serves every kind the deployment applies before anything is applied,
+// so a missing CRD fails the deployment early instead of the apply failing midway
+func (h *Handler) checkCapabilities(ctx context.Context, def AppDefinition, images map[string]Image) error {
+	_, appKubeDef, err := h.defineApp(ctx, def, images)
+	if err != nil {
+		return err
+	}
+	kinds, err := h.requiredKinds(def, appKubeDef)
+	if err != nil {
+		return err
+	}
+	missing, err := h.kube.MissingAPIs(ctx, h.kubeConfig, kinds)
+	if err != nil {
+		return fmt.Errorf("failed to discover cluster apis: %w", err)
+	}
+	if len(missing) > 0 {
+		// the space uses a feature the cluster doesn't provide, a retry won't fix it
+		return UserFailure(&ClusterCapabilityError{Missing: missing})
+	}
+	return nil
+}
+
+// requiredKinds returns the distinct kinds of the defined objects and the migrations Job the space runs
+func (h *Handler) requiredKinds(def AppDefinition, appKubeDef string) ([]APIKind, error) {
+	refs, err := h.kube.DefinedObjects(appKubeDef)
+	if err != nil {
+		return nil, err
+	}
+	var kinds []APIKind
+	if def.App.Migrations != nil && !def.SkipMigrations {
+		kinds = append(kinds, migrationJobKind)
+	}
+	for _, ref := range refs {
+		kind := APIKind{APIVersion: ref.APIVersion, Kind: ref.Kind}
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds, nil
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookFailsEarlyOnMissingCRD(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{
+		Key:        "space",
+		Service:    tqsdk.Service{Name: "api"},
+		Migrations: &tqsdk.Migrations{Command: []string{"migrate"}},
+	})
+	certificate := APIKind{APIVersion: "cert-manager.io/v1", Kind: "Certificate"}
+	th.kube.objects = []ObjectRef{{APIVersion: certificate.APIVersion, Kind: certificate.Kind, Name: "api-tls"}}
+	th.kube.missingAPIs = []APIKind{certificate}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "CLUSTER_CAPABILITY_MISSING", rpcErr.Code)
+	assert.Contains(t, rpcErr.Message, "cert-manager.io/v1 Certificate")
+
+	assert.Empty(t, th.kube.jobs, "the migrations don't run")
+	assert.Empty(t, th.kube.applied)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageApply, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+}
+
+func TestRequiredKinds(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.kube.objects = []ObjectRef{
+		{APIVersion: "apps/v1", Kind: "Deployment", Name: "worker"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Name: "api"},
+	}
+	def := AppDefinition{App: tqsdk.Space{Migrations: &tqsdk.Migrations{}}}
+
+	kinds, err := th.requiredKinds(def, "deployment-1")
+	require.NoError(t, err)
+	assert.Equal(t, []APIKind{
+		migrationJobKind,
+		{APIVersion: "apps/v1", Kind: "Deployment"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+	}, kinds)
+
+	def.SkipMigrations = true
+	kinds, err = th.requiredKinds(def, "deployment-1")
+	require.NoError(t, err)
+	assert.NotContains(t, kinds, migrationJobKind, "the skipped migrations run no Job")
+}
@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"context"
+	"os"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+type ConnectRepositoryRequest struct {
+	AppID string `json:"appId"`
+	// Branch is the branch to deploy on push, the repo default branch is used if empty
+	Branch string `json:"branch"`
+	// Deploy starts the initial deployment of the branch tip once its config is valid
+	Deploy bool `json:"deploy"`
+}
+
+// RepositorySetup is the setup status of a connected repo
+type RepositorySetup struct {
+	Branch string `json:"branch"`
+	// BranchValid reports the branch exists, the repo isn't connected to a missing branch
+	BranchValid bool `json:"branchValid"`
+	Connected   bool `json:"connected"`
+	// Sha is the branch tip the config is checked on
+	Sha         string `json:"sha"`
+	ConfigFound bool   `json:"configFound"`
+	ConfigPath  string `json:"configPath"`
+	// DockerfileFound reports every service of the config has a Dockerfile
+	DockerfileFound bool `json:"dockerfileFound"`
+	// ConfigError tells why the branch tip can't be deployed
+	ConfigError string `json:"configError"`
+	// DeploymentID is the id of the initial deployment, empty if it's not requested or the config is invalid
+	DeploymentID string `json:"deploymentId"`
+}
+
+type ConnectRepositoryResponse struct {
+	Setup RepositorySetup `json:"setup"`
+}
+
+// ConnectRepository connects the app repo branch and checks the branch tip is deployable:
+// the config is extracted and every service Dockerfile is resolved.
+// A repo with an invalid config stays connected, the next push deploys the fixed config.
+func (h *Handler) ConnectRepository(ctx context.Context, req ConnectRepositoryRequest) (ConnectRepositoryResponse, *vel.Error) {
+	repo, rpcErr := h.appRepo(ctx, req.AppID)
+	if rpcErr != nil {
+		return ConnectRepositoryResponse{}, rpcErr
+	}
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return ConnectRepositoryResponse{}, rpcErr
+	}
+
+	branch := req.Branch
+	if branch == "" {
+		githubRepo, err := h.githubClient.GetRepository(repo.InstallationID, repo.FullName)
+		if err != nil {
+			return ConnectRepositoryResponse{}, &vel.Error{
+				Code:    "UNKNOWN",
+				Message: err.Error(),
+			}
+		}
+		branch = githubRepo.DefaultBranch
+	}
+
+	setup := RepositorySetup{Branch: branch}
+	sha, err := h.githubClient.GetBranchSha(repo.InstallationID, repo.FullName, branch)
+	if err != nil {
+		h.l.InfoContext(ctx, "connected branch is not found", "repo", repo.FullName, "branch", branch, "err", err)
+		return ConnectRepositoryResponse{Setup: setup}, nil
+	}
+	setup.BranchValid = true
+	setup.Sha = sha
+
+	change, err := h.branchChange(ctx, repo, branch)
+	if err != nil {
+		return ConnectRepositoryResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if err := h.db.ConnectRepoBranch(ctx, repo.ID, branch); err != nil {
+		return ConnectRepositoryResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	setup.Connected = true
+	if change != "" {
+		if _, err := h.recordAppChange(ctx, req.AppID, change, 0); err != nil {
+			return ConnectRepositoryResponse{}, &vel.Error{
+				Code:    "UNKNOWN",
+				Message: err.Error(),
+			}
+		}
+	}
+
+	repoDir, err := h.cloneRepo(ctx, repo.InstallationID, repo, repo)
+	if err != nil {
+		return ConnectRepositoryResponse{}, planError(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	valid, err := h.checkRepoConfig(ctx, &setup, req.AppID, repoDir)
+	if err != nil {
+		return ConnectRepositoryResponse{}, planError(err)
+	}
+	if !valid || !req.Deploy {
+		return ConnectRepositoryResponse{Setup: setup}, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, h.timeouts.Deploy)
+	defer cancel()
+
+	def, err := h.deploySource(ctx, AppDefinition{
+		AppID:    req.AppID,
+		Tag:      shaTag(sha, false),
+		Sha:      sha,
+		User:     profile.UserInfo.DisplayName,
+		Status:   DeploymentStatusDeploying,
+		Timeline: []TimelineEvent{{Milestone: MilestoneQueued, At: now()}},
+	}, repoDir, sourcePush{Branch: branch})
+	setup.DeploymentID = def.ID
+	if err != nil {
+		return ConnectRepositoryResponse{Setup: setup}, deployError(err)
+	}
+
+	return ConnectRepositoryResponse{Setup: setup}, nil
+}
+
+// checkRepoConfig fills the config part of the setup and reports whether the config is deployable,
+// the extraction and config failures are reported by the setup, the system failures are returned
+func (h *Handler) checkRepoConfig(ctx context.Context, setup *RepositorySetup, appID, repoDir string) (bool, error) {
+	config, err := h.extractSpace(ctx, appID, repoDir, setup.Branch)
+	if err != nil {
+		if classifyFailure(err) == FailureClassSystem {
+			return false, err
+		}
+		setup.ConfigError = err.Error()
+		return false, nil
+	}
+	setup.ConfigFound = true
+	setup.ConfigPath = config.Path
+
+	if err := validateReadinessCommands(config.Space); err != nil {
+		setup.ConfigError = err.Error()
+		return false, nil
+	}
+	if err := validateMigrations(config.Space); err != nil {
+		setup.ConfigError = err.Error()
+		return false, nil
+	}
+	if err := h.resources.validate(config.Space); err != nil {
+		setup.ConfigError = err.Error()
+		return false, nil
+	}
+	for _, service := range config.Space.AllServices() {
+		if _, err := resolveDockerfile(repoDir, service); err != nil {
+			setup.ConfigError = err.Error()
+			return false, nil
+		}
+	}
+	setup.DockerfileFound = true
+	return true, nil
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestConnectRepositoryQueuesInitialDeploy(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.github.branchTips = map[string]string{"treenq/treenq:main": "64263a02d293b1d4ec638ed98d3f3a93f0f788cb"}
+
+	res, rpcErr := th.ConnectRepository(userCtx("testing"), ConnectRepositoryRequest{AppID: testAppID, Branch: "main", Deploy: true})
+	require.Nil(t, rpcErr)
+
+	setup := res.Setup
+	assert.True(t, setup.BranchValid)
+	assert.True(t, setup.Connected)
+	assert.True(t, setup.ConfigFound)
+	assert.True(t, setup.DockerfileFound)
+	assert.Empty(t, setup.ConfigError)
+	require.NotEmpty(t, setup.DeploymentID)
+	assert.Equal(t, "main", th.db.repos[0].Branch)
+
+	def := th.db.deployment(t, setup.DeploymentID)
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, "64263a02d293b1d4ec638ed98d3f3a93f0f788cb", def.Sha)
+}
+
+func TestConnectRepositoryMissingConfig(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.github.defaultBranches = map[string]string{"treenq/treenq": "main"}
+	th.github.branchTips = map[string]string{"treenq/treenq:main": "64263a02d293b1d4ec638ed98d3f3a93f0f788cb"}
+	th.extractor.err = errors.New("tq config is not found")
+
+	res, rpcErr := th.ConnectRepository(userCtx("testing"), ConnectRepositoryRequest{AppID: testAppID, Deploy: true})
+	require.Nil(t, rpcErr)
+
+	setup := res.Setup
+	assert.Equal(t, "main", setup.Branch)
+	assert.True(t, setup.Connected, "the repo stays connected, the next push deploys the fixed config")
+	assert.False(t, setup.ConfigFound)
+	assert.Equal(t, "tq config is not found", setup.ConfigError)
+	assert.Empty(t, setup.DeploymentID)
+	assert.Empty(t, th.db.deployments)
+	assert.Equal(t, "main", th.db.repos[0].Branch)
+}
+
+func TestConnectRepositoryMissingBranch(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	res, rpcErr := th.ConnectRepository(userCtx("testing"), ConnectRepositoryRequest{AppID: testAppID, Branch: "missing"})
+	require.Nil(t, rpcErr)
+	assert.False(t, res.Setup.BranchValid)
+	assert.False(t, res.Setup.Connected)
+	assert.Equal(t, "main", th.db.repos[0].Branch, "the connected branch is kept")
+	assert.Zero(t, th.git.clones)
+}
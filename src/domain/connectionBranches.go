@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+)
+
+// MigrateConnectionBranches connects the repos connected without a branch to their github default branch,
+// such a repo used to deploy both main and master. It's a no-op in the legacy branches mode, which keeps deploying both.
+// A repo failed to migrate is logged and left for the next run, the rest of the repos are migrated anyway.
+func (h *Handler) MigrateConnectionBranches(ctx context.Context) error {
+	if h.legacyBranches {
+		return nil
+	}
+	repos, err := h.db.GetReposWithoutBranch(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range repos {
+		githubRepo, err := h.githubClient.GetRepository(repo.InstallationID, repo.FullName)
+		if err != nil {
+			h.l.WarnContext(ctx, "failed to get repo default branch", "repoID", repo.ID, "fullName", repo.FullName, "err", err)
+			continue
+		}
+		if githubRepo.DefaultBranch == "" {
+			continue
+		}
+		if err := h.db.ConnectRepoBranch(ctx, repo.ID, githubRepo.DefaultBranch); err != nil {
+			h.l.WarnContext(ctx, "failed to connect repo default branch", "repoID", repo.ID, "fullName", repo.FullName, "err", err)
+			continue
+		}
+		h.l.InfoContext(ctx, "repo connected to its default branch", "repoID", repo.ID, "fullName", repo.FullName, "branch", githubRepo.DefaultBranch)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func masterPush() GithubWebhookRequest {
+	push := pushRequest()
+	push.Ref = "refs/heads/master"
+	return push
+}
+
+func TestRepoWithoutBranchIsNotDeployedImplicitly(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos[0].Branch = ""
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.GithubWebhook(context.Background(), masterPush())
+	require.Nil(t, rpcErr)
+	assert.Empty(t, th.db.deployments, "neither main nor master is deployed without a configured branch")
+}
+
+func TestLegacyBranchesDeployMainAndMaster(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos[0].Branch = ""
+	th.legacyBranches = true
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.GithubWebhook(context.Background(), masterPush())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.db.deployments, 2)
+	assert.Equal(t, "refs/heads/main", th.db.deployments[0].Ref)
+	assert.Equal(t, "refs/heads/master", th.db.deployments[1].Ref)
+
+	require.NoError(t, th.MigrateConnectionBranches(context.Background()))
+	assert.Empty(t, th.db.repos[0].Branch, "the legacy mode keeps the connections without a branch")
+}
+
+func TestMigrateConnectionBranchesSetsDefaultBranch(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos[0].Branch = ""
+	th.github.defaultBranches = map[string]string{"treenq/treenq": "master"}
+
+	require.NoError(t, th.MigrateConnectionBranches(context.Background()))
+	assert.Equal(t, "master", th.db.repos[0].Branch)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	assert.Empty(t, th.db.deployments, "main is not the default branch")
+	_, rpcErr = th.GithubWebhook(context.Background(), masterPush())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+}
+
+func TestMigrateConnectionBranchesSkipsUnknownRepo(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos[0].Branch = ""
+
+	require.NoError(t, th.MigrateConnectionBranches(context.Background()), "a repo failed to migrate is left for the next run")
+	assert.Empty(t, th.db.repos[0].Branch)
+}
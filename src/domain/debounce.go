@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// debouncer holds the pushes of a branch for the environment debounce window,
+// only the latest push held by the window is deployed once it elapses
+type debouncer struct {
+	mu sync.Mutex
+	// pending holds the latest push by the app and branch
+	pending map[string]heldPush
+	// afterFunc schedules the window end and returns the function stopping it,
+	// it's time.AfterFunc unless it's replaced by the tests
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+	// inFlight tracks the opened windows until their push is deployed
+	inFlight sync.WaitGroup
+}
+
+// heldPush is the latest push held by a window and the deployment id reserved once the window is opened,
+// every push held by the window ends up in that deployment
+type heldPush struct {
+	req          GithubWebhookRequest
+	deploymentID string
+	deploy       func(GithubWebhookRequest, string)
+	// stop stops the window timer, the push is deployed by flush then
+	stop func() bool
+}
+
+func newDebouncer() *debouncer {
+	return &debouncer{
+		pending: make(map[string]heldPush),
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+	}
+}
+
+// hold keeps the push until the window of the key elapses, the first push of the key opens the window
+// and the later ones replace the held push, deploy is called once with the latest push.
+// It returns the deployment id reserved by the window and whether the push is coalesced into an open window.
+func (d *debouncer) hold(key string, window time.Duration, req GithubWebhookRequest, deploy func(GithubWebhookRequest, string)) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if held, ok := d.pending[key]; ok {
+		held.req = coalescePushes(held.req, req)
+		d.pending[key] = held
+		return held.deploymentID, true
+	}
+	deploymentID := uuid.NewString()
+	d.inFlight.Add(1)
+	stop := d.afterFunc(window, func() {
+		d.mu.Lock()
+		latest, ok := d.pending[key]
+		// the window is flushed already, its push is deployed by flush
+		if !ok || latest.deploymentID != deploymentID {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.pending, key)
+		d.mu.Unlock()
+		defer d.inFlight.Done()
+		latest.deploy(latest.req, latest.deploymentID)
+	})
+	d.pending[key] = heldPush{req: req, deploymentID: deploymentID, deploy: deploy, stop: stop}
+	return deploymentID, false
+}
+
+// flush ends the open windows early and deploys their pushes in background, e.g. on shutdown,
+// so a held push isn't lost once the instance stops. It returns how many pushes are deployed.
+func (d *debouncer) flush() int {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string]heldPush)
+	d.mu.Unlock()
+
+	for _, held := range pending {
+		held.stop()
+		go func() {
+			defer d.inFlight.Done()
+			held.deploy(held.req, held.deploymentID)
+		}()
+	}
+	return len(pending)
+}
+
+// coalescePushes returns the latest push with the commits of both pushes,
+// so the path filters match the paths changed by the held push too
+func coalescePushes(held, latest GithubWebhookRequest) GithubWebhookRequest {
+	if len(held.Commits) == 0 || len(latest.Commits) == 0 {
+		// the changed paths of one of the pushes are unknown
+		latest.Commits = nil
+		return latest
+	}
+	latest.Commits = append(slices.Clone(held.Commits), latest.Commits...)
+	return latest
+}
+
+// debounceWindow returns the debounce of the environment the branch is deployed to,
+// the environment is taken from the latest deployed space, the pushed config is unknown until it's cloned
+func (h *Handler) debounceWindow(ctx context.Context, appID, branch string) time.Duration {
+	if appID == "" {
+		return 0
+	}
+	space, ok, err := h.latestSpace(ctx, appID)
+	if err != nil {
+		h.l.WarnContext(ctx, "failed to get latest space to debounce push", "appID", appID, "err", err)
+		return 0
+	}
+	if !ok {
+		return 0
+	}
+	env, _ := space.Environment(branch)
+	return env.Debounce
+}
+
+// debounce holds the push for the window, the latest held push is deployed in background once the window elapses
+func (h *Handler) debounce(ctx context.Context, window time.Duration, req GithubWebhookRequest, connected, repo InstalledRepository) {
+	// the held push outlives the webhook request and its delivery ack
+	deployCtx := withoutDeliveryAck(context.WithoutCancel(ctx))
+	deploymentID, coalesced := h.debouncer.hold(connected.TreenqID+":"+req.Branch(), window, req, func(latest GithubWebhookRequest, deploymentID string) {
+		if _, err := h.deployPush(deployCtx, latest, connected, repo, deploymentID); err != nil {
+			h.l.ErrorContext(deployCtx, "failed to deploy debounced push", "appID", connected.TreenqID, "deploymentID", deploymentID, "sha", latest.After, "err", err)
+		}
+	})
+
+	outcome := DeployOutcomeQueued
+	if coalesced {
+		outcome = DeployOutcomeCoalesced
+	}
+	h.l.InfoContext(ctx, "push is debounced", "appID", connected.TreenqID, "branch", req.Branch(), "sha", req.After, "window", window, "deploymentID", deploymentID, "outcome", outcome)
+	deliveryAckFrom(ctx).report(WebhookDeployment{RepoID: repo.ID, Outcome: outcome, DeploymentID: deploymentID, Sha: req.After})
+}
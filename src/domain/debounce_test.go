@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// debouncedHandler is a handler of an app deployed before to the environment of the main branch,
+// the window ends are collected instead of being scheduled
+func debouncedHandler(t *testing.T, env tqsdk.Environment) (*testHandler, *[]func()) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Environments: []tqsdk.Environment{env}}
+	th := newTestHandler(t, space)
+	th.db.deployments = []AppDefinition{{ID: "previous", AppID: testAppID, App: space, Status: DeploymentStatusDeployed}}
+
+	var windows []func()
+	th.debouncer.afterFunc = func(d time.Duration, f func()) func() bool {
+		assert.Equal(t, env.Debounce, d)
+		windows = append(windows, f)
+		return func() bool { return true }
+	}
+	return th, &windows
+}
+
+func pushOf(sha string) GithubWebhookRequest {
+	req := pushRequest()
+	req.After = sha
+	return req
+}
+
+func TestGithubWebhookDeploysImmediatelyWithoutDebounce(t *testing.T) {
+	th, windows := debouncedHandler(t, tqsdk.Environment{Name: "staging", Branch: "main"})
+
+	for _, sha := range []string{"sha-1", "sha-2"} {
+		_, rpcErr := th.GithubWebhook(context.Background(), pushOf(sha))
+		require.Nil(t, rpcErr)
+	}
+
+	assert.Empty(t, *windows)
+	assert.Equal(t, 2, th.git.clones)
+	history, _ := th.db.GetDeploymentHistory(context.Background(), testAppID)
+	require.Len(t, history, 3)
+	assert.Equal(t, "sha-2", history[0].Sha)
+	assert.Equal(t, "sha-1", history[1].Sha)
+}
+
+func TestGithubWebhookCoalescesDebouncedPushes(t *testing.T) {
+	th, windows := debouncedHandler(t, tqsdk.Environment{Name: "production", Branch: "main", Debounce: time.Minute})
+
+	for _, sha := range []string{"sha-1", "sha-2", "sha-3"} {
+		_, rpcErr := th.GithubWebhook(context.Background(), pushOf(sha))
+		require.Nil(t, rpcErr)
+	}
+	assert.Zero(t, th.git.clones, "the pushes are held until the window elapses")
+	assert.Len(t, th.db.deployments, 1)
+	require.Len(t, *windows, 1, "the pushes share the window opened by the first one")
+
+	(*windows)[0]()
+
+	assert.Equal(t, 1, th.git.clones)
+	history, _ := th.db.GetDeploymentHistory(context.Background(), testAppID)
+	require.Len(t, history, 2)
+	assert.Equal(t, "sha-3", history[0].Sha)
+	assert.Equal(t, DeploymentStatusDeployed, history[0].Status)
+
+	// the push after the window opens a new one
+	_, rpcErr := th.GithubWebhook(context.Background(), pushOf("sha-4"))
+	require.Nil(t, rpcErr)
+	assert.Len(t, *windows, 2)
+}
+
+func TestGithubWebhookReportsCoalescedPush(t *testing.T) {
+	th, windows := debouncedHandler(t, tqsdk.Environment{Name: "production", Branch: "main", Debounce: time.Minute})
+
+	first, rpcErr := th.GithubWebhook(context.Background(), pushOf("sha-1"))
+	require.Nil(t, rpcErr)
+	require.Len(t, first.Deployments, 1)
+	assert.Equal(t, DeployOutcomeQueued, first.Deployments[0].Outcome, "the first push opens the window")
+	deploymentID := first.Deployments[0].DeploymentID
+	require.NotEmpty(t, deploymentID)
+
+	second, rpcErr := th.GithubWebhook(context.Background(), pushOf("sha-2"))
+	require.Nil(t, rpcErr)
+	assert.Equal(t, []WebhookDeployment{{
+		RepoID:       pushRequest().Repository.ID,
+		Outcome:      DeployOutcomeCoalesced,
+		DeploymentID: deploymentID,
+		Sha:          "sha-2",
+	}}, second.Deployments, "the coalesced push reports the deployment of the window and the sha it deploys")
+
+	(*windows)[0]()
+
+	deployed := th.db.deployment(t, deploymentID)
+	assert.Equal(t, "sha-2", deployed.Sha)
+	assert.Equal(t, DeploymentStatusDeployed, deployed.Status)
+}
+
+func TestCoalescePushesKeepsChangedPaths(t *testing.T) {
+	held := GithubWebhookRequest{After: "sha-1", Commits: []Commit{{Modified: []string{"api/main.go"}}}}
+	latest := GithubWebhookRequest{After: "sha-2", Commits: []Commit{{Modified: []string{"docs/README.md"}}}}
+
+	push := coalescePushes(held, latest)
+	assert.Equal(t, "sha-2", push.After)
+	assert.Equal(t, []string{"api/main.go", "docs/README.md"}, push.ChangedPaths())
+
+	// the paths of a push without commits are unknown
+	assert.Nil(t, coalescePushes(GithubWebhookRequest{}, latest).ChangedPaths())
+}
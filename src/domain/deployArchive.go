@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+type DeployArchiveRequest struct {
+	AppID string `json:"appId"`
+	// Archive is a gzipped tarball of the app source, the same content a clone of the repo gives
+	Archive []byte `json:"archive"`
+	// Sha is a commit the archive is made from
+	Sha string `json:"sha"`
+	// Branch selects the space environment
+	Branch string `json:"branch"`
+	// ForceRebuild builds the images without the build cache
+	ForceRebuild bool `json:"forceRebuild"`
+}
+
+type DeployArchiveResponse struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+// DeployArchive deploys the app from the uploaded source archive instead of cloning its repo
+func (h *Handler) DeployArchive(ctx context.Context, req DeployArchiveRequest) (DeployArchiveResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return DeployArchiveResponse{}, rpcErr
+	}
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return DeployArchiveResponse{}, rpcErr
+	}
+
+	if len(req.Archive) == 0 {
+		return DeployArchiveResponse{}, &vel.Error{
+			Code:    "INVALID_ARCHIVE",
+			Message: "archive must not be empty",
+		}
+	}
+	if h.archiveMaxSize > 0 && int64(len(req.Archive)) > h.archiveMaxSize {
+		return DeployArchiveResponse{}, &vel.Error{
+			Code:    "ARCHIVE_TOO_LARGE",
+			Message: fmt.Sprintf("archive exceeds %d bytes", h.archiveMaxSize),
+		}
+	}
+
+	sourceDir, err := h.git.ExtractArchive(bytes.NewReader(req.Archive), h.archiveMaxSize)
+	if err != nil {
+		if errors.Is(err, ErrInvalidArchive) {
+			return DeployArchiveResponse{}, &vel.Error{
+				Code:    "INVALID_ARCHIVE",
+				Message: err.Error(),
+			}
+		}
+		return DeployArchiveResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	defer os.RemoveAll(sourceDir)
+
+	ctx, cancel := withTimeout(ctx, h.timeouts.Deploy)
+	defer cancel()
+
+	def, err := h.deploySource(ctx, AppDefinition{
+		AppID:        req.AppID,
+		Tag:          shaTag(req.Sha, req.ForceRebuild),
+		Sha:          req.Sha,
+		User:         profile.UserInfo.DisplayName,
+		Status:       DeploymentStatusDeploying,
+		Timeline:     []TimelineEvent{{Milestone: MilestoneQueued, At: now()}},
+		ForceRebuild: req.ForceRebuild,
+	}, sourceDir, sourcePush{Branch: req.Branch})
+	if err != nil {
+		return DeployArchiveResponse{DeploymentID: def.ID}, deployError(err)
+	}
+
+	return DeployArchiveResponse{DeploymentID: def.ID}, nil
+}
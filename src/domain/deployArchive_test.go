@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestDeployArchive(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	res, rpcErr := th.DeployArchive(userCtx("testing"), DeployArchiveRequest{
+		AppID:   testAppID,
+		Archive: []byte("archive"),
+		Sha:     "64263a02d293b1d4ec638ed98d3f3a93f0f788cb",
+		Branch:  "main",
+	})
+	require.Nil(t, rpcErr)
+
+	def := th.db.deployment(t, res.DeploymentID)
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, testAppID, def.AppID)
+	assert.Equal(t, "testing", def.User)
+	assert.Equal(t, "64263a02d293b1d4ec638ed98d3f3a93f0f788cb", def.Sha)
+	assert.Equal(t, [][]byte{[]byte("archive")}, th.git.archives)
+	assert.Len(t, th.docker.builds, 1)
+	assert.Equal(t, []string{def.ID}, th.kube.applied)
+}
+
+func TestDeployArchiveInvalidArchive(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.git.archiveErr = fmt.Errorf("%w: entry %q escapes the archive dir", ErrInvalidArchive, "../../etc/passwd")
+
+	_, rpcErr := th.DeployArchive(userCtx("testing"), DeployArchiveRequest{
+		AppID:   testAppID,
+		Archive: []byte("archive"),
+	})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "INVALID_ARCHIVE", rpcErr.Code)
+	assert.Empty(t, th.db.deployments)
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestDeployArchiveTooLarge(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.archiveMaxSize = 4
+
+	_, rpcErr := th.DeployArchive(userCtx("testing"), DeployArchiveRequest{
+		AppID:   testAppID,
+		Archive: []byte("archive"),
+	})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "ARCHIVE_TOO_LARGE", rpcErr.Code)
+	assert.Empty(t, th.git.archives)
+}
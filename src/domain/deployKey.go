@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/treenq/treenq/pkg/vel"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrDeployKeyNotFound = errors.New("deploy key not found")
+
+// RepoAuthType selects the credentials a repo is cloned with
+type RepoAuthType string
+
+const (
+	// RepoAuthGithubApp clones over HTTPS with an installation token issued for the private repos
+	RepoAuthGithubApp RepoAuthType = ""
+	// RepoAuthDeployKey clones over SSH with the deploy key set for the repo
+	RepoAuthDeployKey RepoAuthType = "deploy_key"
+)
+
+// CloneCredentials authenticate a clone, at most one of them is set
+type CloneCredentials struct {
+	AccessToken string
+	// DeployKey is a PEM encoded SSH private key, it's wiped once the repo is cloned
+	DeployKey []byte
+}
+
+type SetDeployKeyRequest struct {
+	AppID string `json:"appId"`
+	// PrivateKey is a PEM encoded SSH private key without a passphrase
+	PrivateKey string `json:"privateKey"`
+}
+
+type SetDeployKeyResponse struct {
+	// PublicKey is the authorized key to add to the repo deploy keys
+	PublicKey string `json:"publicKey"`
+}
+
+// SetDeployKey stores the repo deploy key, the repo is cloned with it over SSH from now on
+func (h *Handler) SetDeployKey(ctx context.Context, req SetDeployKeyRequest) (SetDeployKeyResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return SetDeployKeyResponse{}, rpcErr
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(req.PrivateKey))
+	if err != nil {
+		// the parse error never includes the key
+		return SetDeployKeyResponse{}, &vel.Error{
+			Code:    "INVALID_DEPLOY_KEY",
+			Message: fmt.Sprintf("deploy key must be a PEM encoded private key without a passphrase: %s", err),
+		}
+	}
+
+	if err := h.db.SetRepoDeployKey(ctx, req.AppID, req.PrivateKey); err != nil {
+		return SetDeployKeyResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	return SetDeployKeyResponse{PublicKey: string(ssh.MarshalAuthorizedKey(signer.PublicKey()))}, nil
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "context"
+
+// ObjectRef refers a cluster object applied by a deployment
+type ObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+}
+
+// recordObjects stores the generated names of the applied objects, the deployment goes on if it fails
+func (h *Handler) recordObjects(ctx context.Context, def AppDefinition, appKubeDef string) {
+	objects, err := h.kube.DefinedObjects(appKubeDef)
+	if err == nil {
+		err = h.db.SetDeploymentObjects(context.WithoutCancel(ctx), def.ID, objects)
+	}
+	if err != nil {
+		h.l.WarnContext(ctx, "failed to record deployment objects", "deploymentID", def.ID, "err", err)
+	}
+}
@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestDeploymentRecordsAppliedObjects(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []ObjectRef{{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "deployment-1-space", Name: "deployment-1"}},
+		th.db.deployment(t, "deployment-1").Objects)
+}
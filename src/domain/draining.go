@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// drainingRetryAfter is how many seconds a rejected delivery is hinted to wait, another instance takes it meanwhile
+const drainingRetryAfter = "10"
+
+var ErrDraining = &vel.Error{
+	Code:    "DRAINING",
+	Message: "the instance is draining, try another one",
+}
+
+// Admins are the github logins allowed to operate the treenq instance, nobody is allowed if it's empty
+type Admins []string
+
+func (a Admins) allows(login string) bool {
+	return login != "" && slices.Contains(a, login)
+}
+
+type SetDrainingRequest struct {
+	Draining bool `json:"draining"`
+}
+
+type SetDrainingResponse struct {
+	Draining bool `json:"draining"`
+	// Deployments are the running deployments the draining instance completes
+	Deployments int `json:"deployments"`
+}
+
+// SetDraining toggles the draining of the treenq instance: it stops taking the webhook deliveries,
+// so the load balancer hands them to the other instances, while the running deployments complete.
+// The pushes already held by a debounce window or acked as queued are still deployed by the instance.
+func (h *Handler) SetDraining(ctx context.Context, req SetDrainingRequest) (SetDrainingResponse, *vel.Error) {
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return SetDrainingResponse{}, rpcErr
+	}
+	if !h.admins.allows(profile.UserInfo.DisplayName) {
+		return SetDrainingResponse{}, &vel.Error{
+			Code:    "NOT_ADMIN",
+			Message: "user is not allowed to operate the instance",
+		}
+	}
+
+	h.draining.Store(req.Draining)
+	running := h.runs.running()
+	h.l.InfoContext(ctx, "instance draining is set", "draining", req.Draining, "deployments", running, "user", profile.UserInfo.DisplayName)
+	return SetDrainingResponse{Draining: req.Draining, Deployments: running}, nil
+}
+
+// DrainingMiddleware rejects the requests with 503 while the instance is draining,
+// neither the deliveries nor their deployments are started by the instance then
+func (h *Handler) DrainingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.draining.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.l.InfoContext(r.Context(), "request is rejected by the draining instance", "path", r.URL.Path)
+		w.Header().Set("Retry-After", drainingRetryAfter)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := json.NewEncoder(w).Encode(ErrDraining); err != nil {
+			h.l.ErrorContext(r.Context(), "failed to encode error", "err", err)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+func TestDrainingInstanceCompletesRunningDeployment(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.admins = Admins{"operator"}
+	webhook := th.DrainingMiddleware(vel.NewHandler(th.GithubWebhook))
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	th.extractor.extract = func() {
+		close(started)
+		<-unblock
+	}
+
+	running := make(chan *httptest.ResponseRecorder)
+	go func() {
+		running <- deliver(t, webhook, pushRequest())
+	}()
+	<-started
+
+	res, rpcErr := th.SetDraining(userCtx("operator"), SetDrainingRequest{Draining: true})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, SetDrainingResponse{Draining: true, Deployments: 1}, res)
+
+	rejected := deliver(t, webhook, pushOf("sha-2"))
+	assert.Equal(t, http.StatusServiceUnavailable, rejected.Code)
+	assert.Equal(t, drainingRetryAfter, rejected.Header().Get("Retry-After"))
+	var rejectErr vel.Error
+	require.NoError(t, json.NewDecoder(rejected.Body).Decode(&rejectErr))
+	assert.Equal(t, "DRAINING", rejectErr.Code)
+
+	status, _ := th.Status(context.Background(), struct{}{})
+	assert.True(t, status.Draining)
+	assert.Equal(t, 1, status.Deployments)
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, (<-running).Code)
+	assert.Equal(t, 1, th.extractor.extractions, "the rejected delivery isn't deployed by the draining instance")
+	history, _ := th.db.GetDeploymentHistory(context.Background(), testAppID)
+	require.Len(t, history, 1)
+	assert.Equal(t, pushRequest().After, history[0].Sha)
+	assert.Equal(t, DeploymentStatusDeployed, history[0].Status)
+
+	status, _ = th.Status(context.Background(), struct{}{})
+	assert.Zero(t, status.Deployments, "the instance is drained")
+
+	th.extractor.extract = nil
+	_, rpcErr = th.SetDraining(userCtx("operator"), SetDrainingRequest{Draining: false})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, http.StatusOK, deliver(t, webhook, pushOf("sha-3")).Code)
+}
+
+func TestSetDrainingRequiresAdmin(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.admins = Admins{"operator"}
+
+	_, rpcErr := th.SetDraining(userCtx("testing"), SetDrainingRequest{Draining: true})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "NOT_ADMIN", rpcErr.Code)
+	assert.False(t, th.draining.Load())
+}
+
+// deliver posts the webhook delivery to the handler
+func deliver(t *testing.T, handler http.Handler, req GithubWebhookRequest) *httptest.ResponseRecorder {
+	body, err := json.Marshal(req)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/githubWebhook", bytes.NewReader(body)))
+	return w
+}
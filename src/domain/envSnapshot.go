@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// secretDigestLength is the length of the hex digest kept for a snapshot secret
+const secretDigestLength = 16
+
+// EnvVar is a runtime env variable a service is deployed with.
+// A secret value is masked, its digest tells whether the secret has changed between the deployments.
+type EnvVar struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Secret bool   `json:"secret"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// envSnapshot returns the runtime envs of the space services by the service name merged with the app envs,
+// the values of the secret app envs are never returned
+func envSnapshot(space tqsdk.Space, appEnvs []AppEnv) map[string][]EnvVar {
+	secrets := make(map[string]bool)
+	for _, env := range appEnvs {
+		if env.Secret {
+			secrets[env.Key] = true
+		}
+	}
+
+	merged := mergeAppEnvs(space, appEnvs)
+	snapshot := make(map[string][]EnvVar)
+	for _, service := range merged.AllServices() {
+		vars := make([]EnvVar, 0, len(service.RuntimeEnvs))
+		for _, key := range slices.Sorted(maps.Keys(service.RuntimeEnvs)) {
+			value := service.RuntimeEnvs[key]
+			if !secrets[key] {
+				vars = append(vars, EnvVar{Key: key, Value: value})
+				continue
+			}
+			sum := sha256.Sum256([]byte(value))
+			vars = append(vars, EnvVar{
+				Key:    key,
+				Value:  maskedEnvValue,
+				Secret: true,
+				Digest: "sha256:" + hex.EncodeToString(sum[:])[:secretDigestLength],
+			})
+		}
+		snapshot[service.Name] = vars
+	}
+	return snapshot
+}
+
+// recordEnv stores the env the deployment is applied with, the deployment goes on if it fails
+func (h *Handler) recordEnv(ctx context.Context, def AppDefinition) {
+	appEnvs, err := h.appEnvs(ctx, def.AppID, def.Environment)
+	if err == nil {
+		err = h.db.SetDeploymentEnv(context.WithoutCancel(ctx), def.ID, envSnapshot(def.App, appEnvs))
+	}
+	if err != nil {
+		h.l.WarnContext(ctx, "failed to record deployment env", "deploymentID", def.ID, "err", err)
+	}
+}
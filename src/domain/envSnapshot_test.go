@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestDeploymentEnvSnapshotKeepsDeployTimeValues(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", RuntimeEnvs: map[string]string{"PORT": "8000"}}})
+	ctx := userCtx("testing")
+
+	_, rpcErr := th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID: testAppID,
+		Envs: []AppEnv{
+			{Key: "LOG_LEVEL", Value: "info"},
+			{Key: "DB_PASSWORD", Value: "s3cr3t", Secret: true},
+		},
+	})
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.SetAppEnv(ctx, SetAppEnvRequest{
+		AppID: testAppID,
+		Envs: []AppEnv{
+			{Key: "LOG_LEVEL", Value: "debug"},
+			{Key: "DB_PASSWORD", Value: "rotated", Secret: true},
+		},
+	})
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.GetDeployment(ctx, GetDeploymentRequest{DeploymentID: "deployment-1"})
+	require.Nil(t, rpcErr)
+	env := res.Deployment.Env["api"]
+	require.Len(t, env, 3)
+	assert.Equal(t, EnvVar{Key: "LOG_LEVEL", Value: "info"}, env[1], "the env is the one of the deploy time")
+	assert.Equal(t, EnvVar{Key: "PORT", Value: "8000"}, env[2])
+	assert.Equal(t, "DB_PASSWORD", env[0].Key)
+	assert.True(t, env[0].Secret)
+	assert.Equal(t, maskedEnvValue, env[0].Value)
+	assert.NotEmpty(t, env[0].Digest)
+
+	payload, err := json.Marshal(res.Deployment)
+	require.NoError(t, err)
+	assert.NotContains(t, string(payload), "s3cr3t", "the secret plaintext is never stored")
+}
+
+func TestEnvSnapshotDigestTellsChangedSecret(t *testing.T) {
+	space := tqsdk.Space{Service: tqsdk.Service{Name: "api"}}
+
+	first := envSnapshot(space, []AppEnv{{Key: "TOKEN", Value: "one", Secret: true}})
+	same := envSnapshot(space, []AppEnv{{Key: "TOKEN", Value: "one", Secret: true}})
+	rotated := envSnapshot(space, []AppEnv{{Key: "TOKEN", Value: "two", Secret: true}})
+
+	assert.Equal(t, first["api"][0].Digest, same["api"][0].Digest)
+	assert.NotEqual(t, first["api"][0].Digest, rotated["api"][0].Digest)
+}
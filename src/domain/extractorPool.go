@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// extractorPool reuses a capped set of the opened extractors across the deployments,
+// an extractor is opened once no idle one is left and the cap isn't reached yet.
+// Zero size opens an extractor for every extraction and closes it once it's done.
+type extractorPool struct {
+	extractor Extractor
+	// sem caps the opened extractors, nil means no cap
+	sem *semaphore.Weighted
+
+	mu   sync.Mutex
+	idle []string
+}
+
+func newExtractorPool(extractor Extractor, size int) *extractorPool {
+	p := &extractorPool{extractor: extractor}
+	if size > 0 {
+		p.sem = semaphore.NewWeighted(int64(size))
+	}
+	return p
+}
+
+// acquire returns an idle extractor or opens a new one, it waits for a released one while the pool is full
+// until the context is done
+func (p *extractorPool) acquire(ctx context.Context) (string, error) {
+	if p.sem == nil {
+		return p.extractor.Open()
+	}
+	if err := p.sem.Acquire(ctx, 1); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		id := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return id, nil
+	}
+	p.mu.Unlock()
+
+	id, err := p.extractor.Open()
+	if err != nil {
+		p.sem.Release(1)
+		return "", err
+	}
+	return id, nil
+}
+
+// release returns the extractor to the pool, a poisoned extractor is closed instead,
+// so the next acquire opens a new one
+func (p *extractorPool) release(id string, poisoned bool) {
+	if p.sem == nil {
+		p.extractor.Close(id)
+		return
+	}
+	defer p.sem.Release(1)
+	if poisoned {
+		p.extractor.Close(id)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = append(p.idle, id)
+}
+
+// extract runs the extraction with a pooled extractor, the extractor is poisoned by any failure but the user's config one,
+// e.g. a failed copy may leave the config of the previous repo in it
+func (p *extractorPool) extract(ctx context.Context, extract func(extractorID string) (ExtractedConfig, error)) (ExtractedConfig, error) {
+	extractorID, err := p.acquire(ctx)
+	if err != nil {
+		return ExtractedConfig{}, SystemFailure(fmt.Errorf("failed to acquire extractor: %w", err))
+	}
+
+	config, err := extract(extractorID)
+	p.release(extractorID, err != nil && classifyFailure(err) != FailureClassUser)
+	return config, err
+}
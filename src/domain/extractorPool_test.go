@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookDeploysSerializeOnExtractorPool(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.extractors = newExtractorPool(th.extractor, 1)
+	started := make(chan struct{}, 2)
+	unblock := make(chan struct{})
+	th.extractor.extract = func() {
+		started <- struct{}{}
+		<-unblock
+	}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+			assert.Nil(t, rpcErr)
+		}()
+	}
+
+	<-started
+	select {
+	case <-started:
+		t.Fatal("the second deploy must wait for the only extractor")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	<-started
+	wg.Wait()
+
+	assert.Equal(t, 2, th.extractor.extractions)
+	assert.Equal(t, []string{"extractor-1"}, th.extractor.opened, "the released extractor is reused")
+	assert.Empty(t, th.extractor.closed)
+}
+
+func TestExtractorPoolDiscardsPoisonedExtractor(t *testing.T) {
+	extractor := &fakeExtractor{}
+	pool := newExtractorPool(extractor, 1)
+
+	_, err := pool.extract(context.Background(), func(extractorID string) (ExtractedConfig, error) {
+		return ExtractedConfig{}, UserFailure(errors.New("invalid config"))
+	})
+	require.Error(t, err)
+	assert.Empty(t, extractor.closed, "a config failure doesn't poison the extractor")
+
+	_, err = pool.extract(context.Background(), func(extractorID string) (ExtractedConfig, error) {
+		return ExtractedConfig{}, errors.New("failed to copy build config")
+	})
+	require.Error(t, err)
+	assert.Equal(t, []string{"extractor-1"}, extractor.closed)
+
+	_, err = pool.extract(context.Background(), func(extractorID string) (ExtractedConfig, error) {
+		assert.Equal(t, "extractor-2", extractorID, "the poisoned extractor is replaced")
+		return ExtractedConfig{}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extractor-1", "extractor-2"}, extractor.opened)
+}
+
+func TestExtractorPoolAcquireRespectsContext(t *testing.T) {
+	pool := newExtractorPool(&fakeExtractor{}, 1)
+	id, err := pool.acquire(context.Background())
+	require.NoError(t, err)
+	defer pool.release(id, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = pool.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestExtractorPoolWithoutSizeOpensEveryExtractor(t *testing.T) {
+	extractor := &fakeExtractor{}
+	pool := newExtractorPool(extractor, 0)
+
+	for range 2 {
+		_, err := pool.extract(context.Background(), func(extractorID string) (ExtractedConfig, error) {
+			return ExtractedConfig{}, nil
+		})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"extractor-1", "extractor-2"}, extractor.opened)
+	assert.Equal(t, []string{"extractor-1", "extractor-2"}, extractor.closed)
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// FailureClass tells whose fault a deployment failure is
+type FailureClass string
+
+const (
+	// FailureClassUser is caused by the app code or config, e.g. a broken Dockerfile
+	FailureClassUser FailureClass = "user"
+	// FailureClassSystem is caused by treenq or its infrastructure, e.g. the cluster is unreachable
+	FailureClassSystem  FailureClass = "system"
+	FailureClassUnknown FailureClass = "unknown"
+)
+
+type DeploymentStage string
+
+const (
+	DeploymentStageClone   DeploymentStage = "clone"
+	DeploymentStageExtract DeploymentStage = "extract"
+	DeploymentStageBuild   DeploymentStage = "build"
+	// DeploymentStagePush uploads the built images to the registry
+	DeploymentStagePush DeploymentStage = "push"
+	// DeploymentStageSign signs the pushed images
+	DeploymentStageSign DeploymentStage = "sign"
+	// DeploymentStageMigrations runs the space migrations before the rollout
+	DeploymentStageMigrations DeploymentStage = "migrations"
+	DeploymentStageApply      DeploymentStage = "apply"
+	// DeploymentStageSmokeTest checks the applied services
+	DeploymentStageSmokeTest DeploymentStage = "smoke_test"
+)
+
+type DeploymentFailure struct {
+	Stage DeploymentStage `json:"stage"`
+	Class FailureClass    `json:"class"`
+	// Message is a failure description to show to the user
+	Message string `json:"message"`
+	// Retryable reports whether the deployment can be retried without any change made by the user
+	Retryable bool `json:"retryable"`
+}
+
+// systemFailureMessage hides the internal error details from the user
+const systemFailureMessage = "treenq failed to deploy the app due to an internal error, the deployment can be retried"
+
+func newDeploymentFailure(stage DeploymentStage, err error) DeploymentFailure {
+	class := classifyFailure(err)
+	failure := DeploymentFailure{
+		Stage:     stage,
+		Class:     class,
+		Message:   err.Error(),
+		Retryable: class == FailureClassSystem,
+	}
+	if class == FailureClassSystem {
+		failure.Message = systemFailureMessage
+	}
+	return failure
+}
+
+// FailureError marks an error with the failure class,
+// the components wrap their errors with it once they know the failure cause
+type FailureError struct {
+	Class FailureClass
+	Err   error
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+func UserFailure(err error) error {
+	return &FailureError{Class: FailureClassUser, Err: err}
+}
+
+func SystemFailure(err error) error {
+	return &FailureError{Class: FailureClassSystem, Err: err}
+}
+
+func classifyFailure(err error) FailureClass {
+	var failureErr *FailureError
+	if errors.As(err, &failureErr) {
+		return failureErr.Class
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return FailureClassSystem
+	}
+
+	return FailureClassUnknown
+}
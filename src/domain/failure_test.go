@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	netErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	assert.Equal(t, FailureClassUser, classifyFailure(UserFailure(errors.New("broken Dockerfile"))))
+	assert.Equal(t, FailureClassSystem, classifyFailure(SystemFailure(errors.New("kube is down"))))
+	assert.Equal(t, FailureClassSystem, classifyFailure(netErr))
+	assert.Equal(t, FailureClassSystem, classifyFailure(context.DeadlineExceeded))
+	assert.Equal(t, FailureClassUnknown, classifyFailure(errors.New("something happened")))
+}
+
+func TestGithubWebhookBuildErrorIsUserFailure(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+		return Image{}, UserFailure(errors.New("dockerfile parse error on line 3: unknown instruction: RUNN"))
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageBuild, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.False(t, def.Failure.Retryable)
+	assert.Contains(t, def.Failure.Message, "unknown instruction")
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestGithubWebhookMissingDockerfileIsUserFailure(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	require.NoError(t, os.Remove(filepath.Join(th.git.dir, "Dockerfile")))
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageBuild, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.Empty(t, th.docker.builds)
+}
+
+func TestGithubWebhookKubeConnectionErrorIsSystemFailure(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.kube.apply = func(ctx context.Context, data string) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageApply, def.Failure.Stage)
+	assert.Equal(t, FailureClassSystem, def.Failure.Class)
+	assert.True(t, def.Failure.Retryable)
+	assert.Equal(t, systemFailureMessage, def.Failure.Message)
+}
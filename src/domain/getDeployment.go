@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+type GetDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+type GetDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+// GetDeployment returns the deployment of an app connected by the current user, including its build metrics
+func (h *Handler) GetDeployment(ctx context.Context, req GetDeploymentRequest) (GetDeploymentResponse, *vel.Error) {
+	def, err := h.db.GetDeployment(ctx, req.DeploymentID)
+	if errors.Is(err, ErrDeploymentNotFound) {
+		// a deployment queued by a webhook is saved once it's built
+		if running, ok := h.runs.find(req.DeploymentID); ok {
+			def, err = running, nil
+		}
+	}
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return GetDeploymentResponse{}, &vel.Error{
+				Code:    "DEPLOYMENT_NOT_FOUND",
+				Message: err.Error(),
+			}
+		}
+		return GetDeploymentResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if rpcErr := h.authorizeApp(ctx, def.AppID); rpcErr != nil {
+		return GetDeploymentResponse{}, rpcErr
+	}
+
+	return GetDeploymentResponse{Deployment: def}, nil
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// defaultStatsRange is a time range of the stats requested without a start
+const defaultStatsRange = 30 * 24 * time.Hour
+
+type GetDeploymentStatsRequest struct {
+	AppID string `json:"appId"`
+	// From is the range start, the last 30 days before To are used if it's empty
+	From time.Time `json:"from"`
+	// To is the range end, now is used if it's empty
+	To time.Time `json:"to"`
+}
+
+type DeploymentStats struct {
+	Total    int                      `json:"total"`
+	Statuses map[DeploymentStatus]int `json:"statuses"`
+	// SuccessRate is a share of the deployed ones among the deployed and failed deployments
+	SuccessRate float64 `json:"successRate"`
+	// BuildDuration is the time spent building all the images of a deployment
+	MeanBuildDuration   time.Duration `json:"meanBuildDuration"`
+	MedianBuildDuration time.Duration `json:"medianBuildDuration"`
+	// DeployDuration is the time from the built deployment to its successful rollout
+	MeanDeployDuration   time.Duration `json:"meanDeployDuration"`
+	MedianDeployDuration time.Duration `json:"medianDeployDuration"`
+	// DeploysPerDay is the frequency of the successful deployments over the range
+	DeploysPerDay float64 `json:"deploysPerDay"`
+}
+
+type GetDeploymentStatsResponse struct {
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+	Stats DeploymentStats `json:"stats"`
+}
+
+// GetDeploymentStats computes the app deployment stats from the deployments created in the time range
+func (h *Handler) GetDeploymentStats(ctx context.Context, req GetDeploymentStatsRequest) (GetDeploymentStatsResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return GetDeploymentStatsResponse{}, rpcErr
+	}
+
+	to := req.To
+	if to.IsZero() {
+		to = now()
+	}
+	from := req.From
+	if from.IsZero() {
+		from = to.Add(-defaultStatsRange)
+	}
+	if !from.Before(to) {
+		return GetDeploymentStatsResponse{}, &vel.Error{
+			Code:    "INVALID_TIME_RANGE",
+			Message: "from must be before to",
+		}
+	}
+
+	deployments, err := h.db.ListDeployments(ctx, req.AppID)
+	if err != nil {
+		return GetDeploymentStatsResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	deployments = slices.DeleteFunc(deployments, func(def AppDefinition) bool {
+		return def.CreatedAt.Before(from) || !def.CreatedAt.Before(to)
+	})
+
+	return GetDeploymentStatsResponse{
+		From:  from,
+		To:    to,
+		Stats: deploymentStats(deployments, to.Sub(from)),
+	}, nil
+}
+
+func deploymentStats(deployments []AppDefinition, period time.Duration) DeploymentStats {
+	stats := DeploymentStats{
+		Total:    len(deployments),
+		Statuses: make(map[DeploymentStatus]int),
+	}
+
+	var buildDurations, deployDurations []time.Duration
+	for _, def := range deployments {
+		stats.Statuses[def.Status]++
+
+		if len(def.BuildMetrics) > 0 {
+			var build time.Duration
+			for _, metrics := range def.BuildMetrics {
+				build += metrics.Duration
+			}
+			buildDurations = append(buildDurations, build)
+		}
+		if def.Status == DeploymentStatusDeployed && !def.FinishedAt.IsZero() {
+			deployDurations = append(deployDurations, def.FinishedAt.Sub(def.CreatedAt))
+		}
+	}
+
+	deployed := stats.Statuses[DeploymentStatusDeployed]
+	if finished := deployed + stats.Statuses[DeploymentStatusFailed]; finished > 0 {
+		stats.SuccessRate = float64(deployed) / float64(finished)
+	}
+	stats.MeanBuildDuration, stats.MedianBuildDuration = meanMedian(buildDurations)
+	stats.MeanDeployDuration, stats.MedianDeployDuration = meanMedian(deployDurations)
+	stats.DeploysPerDay = float64(deployed) / (period.Hours() / 24)
+
+	return stats
+}
+
+func meanMedian(durations []time.Duration) (time.Duration, time.Duration) {
+	if len(durations) == 0 {
+		return 0, 0
+	}
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	mean := total / time.Duration(len(durations))
+
+	sorted := slices.Sorted(slices.Values(durations))
+	mid := len(sorted) / 2
+	median := sorted[mid]
+	if len(sorted)%2 == 0 {
+		median = (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	return mean, median
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGetDeploymentStats(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	from := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return from.Add(time.Duration(n) * 24 * time.Hour) }
+	build := func(d time.Duration) map[string]BuildMetrics {
+		return map[string]BuildMetrics{"api": {Duration: d}}
+	}
+	th.db.deployments = []AppDefinition{
+		{ID: "1", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: day(-1), BuildMetrics: build(time.Hour)},
+		{ID: "2", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: day(1), FinishedAt: day(1).Add(time.Minute), BuildMetrics: map[string]BuildMetrics{
+			"api":    {Duration: time.Minute},
+			"worker": {Duration: time.Minute},
+		}},
+		{ID: "3", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: day(2), FinishedAt: day(2).Add(3 * time.Minute), BuildMetrics: build(4 * time.Minute)},
+		{ID: "4", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: day(3), FinishedAt: day(3).Add(2 * time.Minute), BuildMetrics: build(10 * time.Minute)},
+		{ID: "5", AppID: testAppID, Status: DeploymentStatusFailed, CreatedAt: day(4), FinishedAt: day(4), BuildMetrics: build(time.Minute)},
+		{ID: "6", AppID: testAppID, Status: DeploymentStatusSkipped, CreatedAt: day(5), FinishedAt: day(5)},
+		{ID: "7", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: day(10), BuildMetrics: build(time.Hour)},
+	}
+
+	res, rpcErr := th.GetDeploymentStats(userCtx("testing"), GetDeploymentStatsRequest{AppID: testAppID, From: from, To: day(10)})
+	require.Nil(t, rpcErr)
+
+	stats := res.Stats
+	assert.Equal(t, 5, stats.Total)
+	assert.Equal(t, map[DeploymentStatus]int{
+		DeploymentStatusDeployed: 3,
+		DeploymentStatusFailed:   1,
+		DeploymentStatusSkipped:  1,
+	}, stats.Statuses)
+	assert.Equal(t, 0.75, stats.SuccessRate)
+	// the build durations are 1m, 2m, 4m and 10m
+	assert.Equal(t, 3*time.Minute, stats.MedianBuildDuration)
+	assert.Equal(t, 4*time.Minute+15*time.Second, stats.MeanBuildDuration)
+	assert.Equal(t, 2*time.Minute, stats.MedianDeployDuration)
+	assert.Equal(t, 2*time.Minute, stats.MeanDeployDuration)
+	assert.InDelta(t, 0.3, stats.DeploysPerDay, 1e-9)
+}
+
+func TestGetDeploymentStatsInvalidRange(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	at := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	_, rpcErr := th.GetDeploymentStats(userCtx("testing"), GetDeploymentStatsRequest{AppID: testAppID, From: at, To: at})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "INVALID_TIME_RANGE", rpcErr.Code)
+}
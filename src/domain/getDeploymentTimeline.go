@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// Milestone is a step the deployment has reached
+type Milestone string
+
+const (
+	MilestoneQueued             Milestone = "queued"
+	MilestoneCloneStarted       Milestone = "clone_started"
+	MilestoneCloneFinished      Milestone = "clone_finished"
+	MilestoneBuildStarted       Milestone = "build_started"
+	MilestoneBuildFinished      Milestone = "build_finished"
+	MilestoneMigrationsStarted  Milestone = "migrations_started"
+	MilestoneMigrationsFinished Milestone = "migrations_finished"
+	MilestoneApplied            Milestone = "applied"
+	// MilestoneReady is reached once the applied objects have passed the smoke tests
+	MilestoneReady Milestone = "ready"
+)
+
+// TimelineEvent is a milestone of the deployment timeline
+type TimelineEvent struct {
+	Milestone Milestone `json:"milestone"`
+	At        time.Time `json:"at"`
+}
+
+// reach adds the milestone to the timeline of the deployment which isn't saved yet
+func (d *AppDefinition) reach(milestone Milestone) {
+	d.Timeline = append(d.Timeline, TimelineEvent{Milestone: milestone, At: now()})
+}
+
+// recordMilestone adds the milestone to the timeline of the saved deployment,
+// the timeline is informational, a failure to store it never fails the deployment
+func (h *Handler) recordMilestone(ctx context.Context, def AppDefinition, milestone Milestone) {
+	event := TimelineEvent{Milestone: milestone, At: now()}
+	if err := h.db.AddTimelineEvent(context.WithoutCancel(ctx), def.ID, event); err != nil {
+		h.l.WarnContext(ctx, "failed to record deployment milestone", "deploymentID", def.ID, "milestone", milestone, "err", err)
+	}
+}
+
+type GetDeploymentTimelineRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+type GetDeploymentTimelineResponse struct {
+	Timeline []TimelineEvent `json:"timeline"`
+}
+
+// GetDeploymentTimeline returns the deployment milestones ordered by their time
+func (h *Handler) GetDeploymentTimeline(ctx context.Context, req GetDeploymentTimelineRequest) (GetDeploymentTimelineResponse, *vel.Error) {
+	def, err := h.db.GetDeployment(ctx, req.DeploymentID)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return GetDeploymentTimelineResponse{}, &vel.Error{
+				Code:    "DEPLOYMENT_NOT_FOUND",
+				Message: err.Error(),
+			}
+		}
+		return GetDeploymentTimelineResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if rpcErr := h.authorizeApp(ctx, def.AppID); rpcErr != nil {
+		return GetDeploymentTimelineResponse{}, rpcErr
+	}
+
+	timeline := slices.Clone(def.Timeline)
+	slices.SortStableFunc(timeline, func(a, b TimelineEvent) int {
+		return a.At.Compare(b.At)
+	})
+	return GetDeploymentTimelineResponse{Timeline: timeline}, nil
+}
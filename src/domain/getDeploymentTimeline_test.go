@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDeploymentTimeline(t *testing.T) {
+	th := newTestHandler(t, migrationsSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.db.deployments, 1)
+
+	res, rpcErr := th.GetDeploymentTimeline(userCtx("testing"), GetDeploymentTimelineRequest{DeploymentID: th.db.deployments[0].ID})
+	require.Nil(t, rpcErr)
+
+	var milestones []Milestone
+	for i, event := range res.Timeline {
+		milestones = append(milestones, event.Milestone)
+		assert.False(t, event.At.IsZero(), "milestone %s has no time", event.Milestone)
+		if i > 0 {
+			assert.False(t, event.At.Before(res.Timeline[i-1].At), "milestone %s is out of order", event.Milestone)
+		}
+	}
+	assert.Equal(t, []Milestone{
+		MilestoneQueued,
+		MilestoneCloneStarted,
+		MilestoneCloneFinished,
+		MilestoneBuildStarted,
+		MilestoneBuildFinished,
+		MilestoneMigrationsStarted,
+		MilestoneMigrationsFinished,
+		MilestoneApplied,
+		MilestoneReady,
+	}, milestones)
+}
+
+func TestGetDeploymentTimelineNotFound(t *testing.T) {
+	th := newTestHandler(t, migrationsSpace())
+
+	_, rpcErr := th.GetDeploymentTimeline(userCtx("testing"), GetDeploymentTimelineRequest{DeploymentID: "missing"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "DEPLOYMENT_NOT_FOUND", rpcErr.Code)
+}
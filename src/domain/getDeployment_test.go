@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+func TestGetDeploymentReturnsBuildMetrics(t *testing.T) {
+	th := newTestHandler(t, multiServiceSpace(0))
+	th.docker.metrics = BuildMetrics{Duration: 42 * time.Second, CachedLayers: 3, TotalLayers: 5}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.GetDeployment(userCtx("testing"), GetDeploymentRequest{DeploymentID: th.db.deployments[0].ID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, map[string]BuildMetrics{
+		"api":    th.docker.metrics,
+		"worker": th.docker.metrics,
+		"cron":   th.docker.metrics,
+	}, res.Deployment.BuildMetrics)
+}
+
+func TestGetDeploymentReturnsTrigger(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	r := httptest.NewRequest("POST", "/githubWebhook", nil)
+	r.Header.Set("X-GitHub-Event", "push")
+
+	_, rpcErr := th.GithubWebhook(vel.RequestWithContext(context.Background(), r), pushRequest())
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.GetDeployment(userCtx("testing"), GetDeploymentRequest{DeploymentID: th.db.deployments[0].ID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, "push", res.Deployment.Event)
+	assert.Empty(t, res.Deployment.Action, "a push has no action")
+	assert.Equal(t, "refs/heads/main", res.Deployment.Ref)
+}
+
+func TestGetDeploymentOfAnotherApp(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	def, err := th.db.SaveDeployment(context.Background(), AppDefinition{AppID: "another-app"})
+	require.NoError(t, err)
+
+	_, rpcErr := th.GetDeployment(userCtx("testing"), GetDeploymentRequest{DeploymentID: def.ID})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+
+	_, rpcErr = th.GetDeployment(userCtx("testing"), GetDeploymentRequest{DeploymentID: "unknown"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "DEPLOYMENT_NOT_FOUND", rpcErr.Code)
+}
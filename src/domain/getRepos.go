@@ -2,10 +2,13 @@ package domain
 
 import (
 	"context"
+	"errors"
 
 	"github.com/treenq/treenq/pkg/vel"
 )
 
+var ErrRepoNotFound = errors.New("repo not found")
+
 type GetReposRequest struct{}
 
 type GetReposResponse struct {
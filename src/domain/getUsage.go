@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// PlanLimits are the hosted plan limits of a user, a zero limit is unlimited
+type PlanLimits struct {
+	Apps int `json:"apps"`
+	// Deployments limits the deployments made in a billing period
+	Deployments int `json:"deployments"`
+	// BuildMinutes limits the image build time of a billing period
+	BuildMinutes int `json:"buildMinutes"`
+}
+
+type Usage struct {
+	Apps         int `json:"apps"`
+	Deployments  int `json:"deployments"`
+	BuildMinutes int `json:"buildMinutes"`
+}
+
+type GetUsageResponse struct {
+	Usage  Usage      `json:"usage"`
+	Limits PlanLimits `json:"limits"`
+	// PeriodStart is the start of the current billing period, a calendar month in UTC
+	PeriodStart time.Time `json:"periodStart"`
+}
+
+// GetUsage returns the current user usage against the plan limits.
+// The usage is counted over the apps connected by the user,
+// the skipped deployments make no builds and aren't counted.
+func (h *Handler) GetUsage(ctx context.Context, _ struct{}) (GetUsageResponse, *vel.Error) {
+	repos, rpcErr := h.GetRepos(ctx, GetReposRequest{})
+	if rpcErr != nil {
+		return GetUsageResponse{}, rpcErr
+	}
+
+	periodStart := billingPeriodStart(now())
+	usage := Usage{Apps: len(repos.Repos)}
+	var buildDuration time.Duration
+	for _, repo := range repos.Repos {
+		deployments, err := h.db.ListDeployments(ctx, repo.TreenqID)
+		if err != nil {
+			return GetUsageResponse{}, &vel.Error{
+				Code:    "UNKNOWN",
+				Message: err.Error(),
+			}
+		}
+		for _, def := range deployments {
+			if def.CreatedAt.Before(periodStart) || def.Status == DeploymentStatusSkipped {
+				continue
+			}
+			usage.Deployments++
+			for _, metrics := range def.BuildMetrics {
+				buildDuration += metrics.Duration
+			}
+		}
+	}
+	// a started minute is consumed
+	usage.BuildMinutes = int(math.Ceil(buildDuration.Minutes()))
+
+	return GetUsageResponse{
+		Usage:       usage,
+		Limits:      h.plan,
+		PeriodStart: periodStart,
+	}, nil
+}
+
+func billingPeriodStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
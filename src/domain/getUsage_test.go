@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGetUsageCountsUserDeployments(t *testing.T) {
+	originalNow := now
+	defer func() { now = originalNow }()
+	now = func() time.Time { return time.Date(2024, time.May, 20, 12, 0, 0, 0, time.UTC) }
+
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.plan = PlanLimits{Apps: 3, Deployments: 100, BuildMinutes: 500}
+	th.db.repos = append(th.db.repos, InstalledRepository{TreenqID: "docs-app", ID: 805585116, FullName: "treenq/docs"})
+
+	thisMonth := time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC)
+	lastMonth := time.Date(2024, time.April, 30, 23, 59, 0, 0, time.UTC)
+	th.db.deployments = []AppDefinition{
+		{ID: "1", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: lastMonth, BuildMetrics: map[string]BuildMetrics{
+			"api": {Duration: time.Hour},
+		}},
+		{ID: "2", AppID: testAppID, Status: DeploymentStatusDeployed, CreatedAt: thisMonth, BuildMetrics: map[string]BuildMetrics{
+			"api":    {Duration: 90 * time.Second},
+			"worker": {Duration: 2 * time.Minute},
+		}},
+		{ID: "3", AppID: testAppID, Status: DeploymentStatusFailed, CreatedAt: thisMonth, BuildMetrics: map[string]BuildMetrics{
+			"api": {Duration: 30 * time.Second},
+		}},
+		{ID: "4", AppID: testAppID, Status: DeploymentStatusSkipped, CreatedAt: thisMonth},
+		{ID: "5", AppID: "docs-app", Status: DeploymentStatusDeployed, CreatedAt: thisMonth, BuildMetrics: map[string]BuildMetrics{
+			"docs": {Duration: 10 * time.Second},
+		}},
+		{ID: "6", AppID: "another-user-app", Status: DeploymentStatusDeployed, CreatedAt: thisMonth, BuildMetrics: map[string]BuildMetrics{
+			"api": {Duration: time.Hour},
+		}},
+	}
+
+	res, rpcErr := th.GetUsage(userCtx("testing"), struct{}{})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, Usage{Apps: 2, Deployments: 3, BuildMinutes: 5}, res.Usage)
+	assert.Equal(t, th.plan, res.Limits)
+	assert.Equal(t, time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC), res.PeriodStart)
+}
@@ -2,9 +2,11 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
@@ -26,6 +28,44 @@ type GithubWebhookRequest struct {
 	// commits only
 	Ref        string     `json:"ref"`
 	Repository Repository `json:"repository"`
+	HeadCommit Commit     `json:"head_commit"`
+	Commits    []Commit   `json:"commits"`
+
+	// organization and team membership only fields
+	Membership *OrgMembership `json:"membership"`
+	Member     *Sender        `json:"member"`
+	Scope      string         `json:"scope"`
+
+	// Event is the X-GitHub-Event header of the delivery, it isn't a payload field
+	Event string `json:"-"`
+}
+
+// skipDeployDirectives are the commit message markers to push a commit without deploying it
+var skipDeployDirectives = []string{"[skip deploy]", "[skip ci]"}
+
+// SkipDeploy reports whether the head commit message asks to skip the deployment
+func (g GithubWebhookRequest) SkipDeploy() bool {
+	message := strings.ToLower(g.HeadCommit.Message)
+	for _, directive := range skipDeployDirectives {
+		if strings.Contains(message, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipMigrationsDirective is the commit message marker to deploy a commit without running the space migrations,
+// e.g. a hotfix deployed while a migration is broken
+const skipMigrationsDirective = "[skip migrations]"
+
+// SkipMigrations reports whether the head commit message asks to skip the space migrations
+func (g GithubWebhookRequest) SkipMigrations() bool {
+	return strings.Contains(strings.ToLower(g.HeadCommit.Message), skipMigrationsDirective)
+}
+
+// Branch returns the pushed branch name
+func (g GithubWebhookRequest) Branch() string {
+	return strings.TrimPrefix(g.Ref, "refs/heads/")
 }
 
 func (g GithubWebhookRequest) ReposToProcess() []InstalledRepository {
@@ -37,9 +77,9 @@ func (g GithubWebhookRequest) ReposToProcess() []InstalledRepository {
 	if g.Action == "added" {
 		return g.RepositoriesAdded
 	}
-	// branch
+	// branch, whether the pushed branch is deployed is decided by the connected repo branch
 	if g.Action == "" {
-		if g.Ref != "refs/heads/master" && g.Ref != "refs/heads/main" {
+		if !strings.HasPrefix(g.Ref, "refs/heads/") {
 			return nil
 		}
 		return []InstalledRepository{
@@ -47,6 +87,7 @@ func (g GithubWebhookRequest) ReposToProcess() []InstalledRepository {
 				ID:       g.Repository.ID,
 				FullName: g.Repository.FullName,
 				Private:  g.Repository.Private,
+				Branch:   g.Repository.DefaultBranch,
 			},
 		}
 	}
@@ -54,6 +95,32 @@ func (g GithubWebhookRequest) ReposToProcess() []InstalledRepository {
 	return nil
 }
 
+// maxPushCommits is how many commits github embeds in a push payload at most
+const maxPushCommits = 20
+
+// ChangedPaths returns the paths changed by the pushed commits,
+// nil means the paths are unknown, e.g. github has truncated the commits of a large push
+func (g GithubWebhookRequest) ChangedPaths() []string {
+	if len(g.Commits) == 0 || len(g.Commits) >= maxPushCommits {
+		return nil
+	}
+	paths := make([]string, 0)
+	for _, commit := range g.Commits {
+		paths = append(paths, commit.Added...)
+		paths = append(paths, commit.Modified...)
+		paths = append(paths, commit.Removed...)
+	}
+	return paths
+}
+
+type Commit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
 type Sender struct {
 	Login string `json:"login"`
 }
@@ -70,10 +137,11 @@ type InstallationAccount struct {
 }
 
 type Repository struct {
-	ID       int    `json:"id"`
-	CloneUrl string `json:"clone_url"`
-	FullName string `json:"full_name"`
-	Private  bool   `json:"private"`
+	ID            int    `json:"id"`
+	CloneUrl      string `json:"clone_url"`
+	FullName      string `json:"full_name"`
+	Private       bool   `json:"private"`
+	DefaultBranch string `json:"default_branch"`
 }
 
 type InstalledRepository struct {
@@ -85,18 +153,34 @@ type InstalledRepository struct {
 
 	// fields managed by treenq
 
-	Branch string `json:"branch"`
+	// TreenqID identifies the connected repo as a treenq app
+	TreenqID string       `json:"treenqID"`
+	Branch   string       `json:"branch"`
+	AuthType RepoAuthType `json:"authType"`
+	// InstallationID is the github app installation id the repo is cloned with, it's set for the connected repos
+	InstallationID int `json:"installationID"`
 }
 
 func (r InstalledRepository) CloneUrl() string {
 	return fmt.Sprintf("https://github.com/%s.git", r.FullName)
 }
 
+// SSHCloneUrl is cloned with a deploy key
+func (r InstalledRepository) SSHCloneUrl() string {
+	return fmt.Sprintf("ssh://git@github.com/%s.git", r.FullName)
+}
+
 type BuildArtifactRequest struct {
 	Name       string
 	Path       string
 	Dockerfile string
 	Tag        string
+	// Builder is a docker buildx builder name, empty means the system builder
+	Builder string
+	// NoCache builds every layer again ignoring the build cache, e.g. to get rid of a stale cached layer
+	NoCache bool
+	// Buildpack builds the source at Path with the buildpack builder, Dockerfile is empty then
+	Buildpack bool
 }
 
 type Image struct {
@@ -106,6 +190,15 @@ type Image struct {
 	Repository string
 	// Tag is a version of the image
 	Tag string
+	// Digest is a content digest confirmed by the registry once the image is pushed
+	Digest string
+	// Signature is a reference of the image digest signature, empty if the image isn't signed
+	Signature string
+}
+
+// DigestPath refers the image by its pushed digest, the signed content is referred this way
+func (i Image) DigestPath() string {
+	return fmt.Sprintf("%s/%s@%s", i.Registry, i.Repository, i.Digest)
 }
 
 func (i Image) Image() string {
@@ -116,7 +209,52 @@ func (i Image) FullPath() string {
 	return fmt.Sprintf("%s/%s:%s", i.Registry, i.Repository, i.Tag)
 }
 
-type GithubWebhookResponse struct{}
+// PullPath refers the image the cluster pulls, by its digest once it's pushed, by its tag otherwise,
+// so a tag moved to another build since doesn't change the deployed content
+func (i Image) PullPath() string {
+	if i.Digest != "" {
+		return i.DigestPath()
+	}
+	return i.FullPath()
+}
+
+// A throttled delivery never reaches the handler, it's rejected by the webhook rate limit
+// with TOO_MANY_REQUESTS or SERVER_BUSY and a Retry-After header, so github redelivers it.
+type GithubWebhookResponse struct {
+	// Deployments tell how every pushed repo is deployed, GetDeployment reports them by id
+	Deployments []WebhookDeployment `json:"deployments,omitempty"`
+	// Queued tells the deployments go on after the delivery is acked
+	Queued bool `json:"queued,omitempty"`
+	// RetryAfter is how many seconds to wait before polling the queued deployments, it's set once the build queue is deep
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
+
+// DeployOutcome tells when the push of a repo is deployed
+type DeployOutcome string
+
+const (
+	// DeployOutcomeImmediate is deployed before the delivery is acked
+	DeployOutcomeImmediate DeployOutcome = "immediate"
+	// DeployOutcomeQueued goes on after the delivery is acked,
+	// it's either waiting for a build slot or held by the debounce window it has opened
+	DeployOutcomeQueued DeployOutcome = "queued"
+	// DeployOutcomeCoalesced is held by the debounce window of an earlier push,
+	// the latest push held by the window is deployed instead
+	DeployOutcomeCoalesced DeployOutcome = "coalesced"
+	// DeployOutcomeSkipped isn't deployed, the skip reason tells why
+	DeployOutcomeSkipped DeployOutcome = "skipped"
+)
+
+// WebhookDeployment is the deployment of a pushed repo
+type WebhookDeployment struct {
+	RepoID  int           `json:"repoId"`
+	Outcome DeployOutcome `json:"outcome"`
+	// DeploymentID is the deployment the push ends up in, it's empty for the pushed branch that isn't deployed
+	DeploymentID string `json:"deploymentId,omitempty"`
+	// Sha is the commit the deployment deploys, a coalesced push is deployed with the latest held commit
+	Sha        string     `json:"sha,omitempty"`
+	SkipReason SkipReason `json:"skipReason,omitempty"`
+}
 
 type Resource struct {
 	Key     string
@@ -137,102 +275,741 @@ type RepoConnection struct {
 }
 
 type AppDefinition struct {
-	ID        string
-	AppID     string
-	App       tqsdk.Space
-	Tag       string
-	Sha       string
-	User      string
-	CreatedAt time.Time
+	ID          string
+	AppID       string
+	App         tqsdk.Space
+	Tag         string
+	Sha         string
+	User        string
+	Environment string
+	Status      DeploymentStatus
+	// ApprovalExpiresAt is a deadline to approve the deployment awaiting approval, zero never expires
+	ApprovalExpiresAt time.Time
+	// PromotionExpiresAt is a deadline to promote the deployment awaiting promotion
+	PromotionExpiresAt time.Time
+	// Failure is set for the failed deployments
+	Failure *DeploymentFailure
+	// ConfigPath is the repo config dir the space is extracted from
+	ConfigPath string
+	// SkipReason tells why a skipped deployment isn't deployed
+	SkipReason SkipReason
+	// BuildMetrics are the image build metrics by the service name
+	BuildMetrics map[string]BuildMetrics
+	// Signatures are the signature references of the signed images by the service name
+	Signatures map[string]string
+	// Digests are the pushed image digests by the service name, the deployment is applied again with exactly these images
+	Digests map[string]string
+	// SkipMigrations deploys the app without running the space migrations
+	SkipMigrations bool
+	// MigrationLogs are the logs of the migrations Job
+	MigrationLogs string
+	CreatedAt     time.Time
+	// FinishedAt is set once the deployment has reached a terminal status
+	FinishedAt time.Time
+	// Timeline holds the deployment milestones in the order they are reached
+	Timeline []TimelineEvent
+	// ImportedFrom is the namespace/name of the live Deployment adopted by an imported deployment
+	ImportedFrom string
+	// Message is the message of the deployed commit, it's empty for the deployments not made by a push
+	Message string
+	// Event, Action and Ref tell the github webhook delivery which has triggered the deployment,
+	// e.g. push and refs/heads/main, they're empty for the deployments not made by a webhook
+	Event  string
+	Action string
+	Ref    string
+	// Objects are the cluster objects the deployment has applied, they're deleted by these names
+	Objects []ObjectRef
+	// ForceRebuild tells the images are built without the build cache
+	ForceRebuild bool
+	// BuildInputs are the digests of the image build inputs by the service name, see buildInputs
+	BuildInputs map[string]string
+	// Env is the runtime env of the services by the service name the deployment is applied with, see envSnapshot
+	Env map[string][]EnvVar
+	// RebuildRequired tells the images are built, it's false once the build inputs are unchanged since the previous build,
+	// such a deployment patches the cluster objects with the previous images, e.g. to apply a changed env or replicas
+	RebuildRequired bool
 }
 
+type SkipReason string
+
+const (
+	SkipReasonDirective        SkipReason = "skip directive"
+	SkipReasonVisibilityPolicy SkipReason = "visibility policy"
+	// SkipReasonPathFilter is set when the push changes no path of the space Paths
+	SkipReasonPathFilter SkipReason = "path filter"
+	// SkipReasonBranch is a push to a branch which isn't deployed, such a push is not stored as a deployment
+	SkipReasonBranch SkipReason = "branch"
+)
+
+type DeploymentStatus string
+
+const (
+	DeploymentStatusDeploying        DeploymentStatus = "deploying"
+	DeploymentStatusDeployed         DeploymentStatus = "deployed"
+	DeploymentStatusFailed           DeploymentStatus = "failed"
+	DeploymentStatusAwaitingApproval DeploymentStatus = "awaiting_approval"
+	DeploymentStatusRejected         DeploymentStatus = "rejected"
+	DeploymentStatusApprovalExpired  DeploymentStatus = "approval_expired"
+	DeploymentStatusSkipped          DeploymentStatus = "skipped"
+	// DeploymentStatusSuperseded is set when the branch has advanced past the deployed commit before the apply
+	DeploymentStatusSuperseded DeploymentStatus = "superseded"
+	// DeploymentStatusCancelled is set when the running deployment is cancelled by CancelDeployment
+	DeploymentStatusCancelled DeploymentStatus = "cancelled"
+	// DeploymentStatusAwaitingPromotion is set when the paused deployment runs without the traffic until it's promoted
+	DeploymentStatusAwaitingPromotion DeploymentStatus = "awaiting_promotion"
+	// DeploymentStatusPromotionExpired is set when the paused deployment isn't promoted in time and is rolled back
+	DeploymentStatusPromotionExpired DeploymentStatus = "promotion_expired"
+)
+
 func (h *Handler) GithubWebhook(ctx context.Context, req GithubWebhookRequest) (GithubWebhookResponse, *vel.Error) {
-	// Save installation id link to a profile
-	if req.Action == "created" {
-		err := h.db.LinkGithub(ctx, req.Installation.ID, req.Sender.Login, req.Repositories)
-		if err != nil {
+	if r := vel.RequestFromContext(ctx); r != nil {
+		req.Event = r.Header.Get("X-GitHub-Event")
+	}
+	if !h.webhookEvents.allows(req.Event) {
+		h.l.InfoContext(ctx, "webhook event is not allowed, the delivery is ignored", "event", req.Event, "action", req.Action)
+		return GithubWebhookResponse{}, nil
+	}
+	// a renamed repo keeps its id, only the stored name is updated
+	if req.Action == "renamed" {
+		if err := h.renameRepo(ctx, req.Repository.ID, req.Repository.FullName); err != nil {
 			return GithubWebhookResponse{}, &vel.Error{
 				Code:    "UNKNOWN",
 				Message: err.Error(),
 			}
 		}
+		return GithubWebhookResponse{}, nil
 	}
-	for _, repo := range req.ReposToProcess() {
-		token := ""
-		if repo.Private {
-			var err error
-			// TODO: cache an issued token
-			token, err = h.githubClient.IssueAccessToken(req.Installation.ID)
-			if err != nil {
-				return GithubWebhookResponse{}, &vel.Error{
-					Code:    "UNKNOWN",
-					Message: err.Error(),
-				}
-			}
-		}
-
-		repoDir, err := h.git.Clone(repo.CloneUrl(), req.Installation.ID, repo.ID, token)
-		if err != nil {
+	if change, ok := req.MemberChange(); ok {
+		if err := h.syncMember(ctx, req.Installation.ID, change); err != nil {
 			return GithubWebhookResponse{}, &vel.Error{
 				Code:    "UNKNOWN",
 				Message: err.Error(),
 			}
 		}
-		defer os.RemoveAll(repoDir)
-
-		extractorID, err := h.extractor.Open()
+		return GithubWebhookResponse{}, nil
+	}
+	// Save installation id link to a profile
+	if req.Action == "created" {
+		repos, err := h.installationRepos(req.Installation.ID)
+		if err == nil {
+			repos, err = h.withDefaultBranches(req.Installation.ID, repos)
+		}
 		if err != nil {
 			return GithubWebhookResponse{}, &vel.Error{
 				Code:    "UNKNOWN",
 				Message: err.Error(),
 			}
 		}
-		defer h.extractor.Close(extractorID)
-
-		appSpace, err := h.extractor.ExtractConfig(extractorID, repoDir)
+		req.Repositories = repos
+		err = h.db.LinkGithub(ctx, req.Installation.ID, req.Sender.Login, req.Repositories)
 		if err != nil {
 			return GithubWebhookResponse{}, &vel.Error{
 				Code:    "UNKNOWN",
 				Message: err.Error(),
 			}
 		}
+	}
+	return h.deployRepos(ctx, req)
+}
 
-		dockerFilePath := filepath.Join(repoDir, appSpace.Service.DockerfilePath)
-		image, err := h.docker.Build(ctx, BuildArtifactRequest{
-			Name:       appSpace.Service.Name,
-			Path:       repoDir,
-			Dockerfile: dockerFilePath,
-			Tag:        "latest",
-		})
-		if err != nil {
-			return GithubWebhookResponse{}, &vel.Error{
-				Code:    "UNKNOWN",
-				Message: err.Error(),
+// deployError converts a deployment error to an api error
+func deployError(err error) *vel.Error {
+	var timeoutErr *BuildTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return &vel.Error{
+			Code:    "BUILD_TIMEOUT",
+			Message: timeoutErr.Error(),
+		}
+	}
+	var tagConflictErr *TagConflictError
+	if errors.As(err, &tagConflictErr) {
+		return &vel.Error{
+			Code:    "TAG_IMMUTABLE_CONFLICT",
+			Message: err.Error(),
+		}
+	}
+	var pushErr *PushError
+	if errors.As(err, &pushErr) {
+		return &vel.Error{
+			Code:    "PUSH_FAILED",
+			Message: err.Error(),
+		}
+	}
+	var signErr *SignError
+	if errors.As(err, &signErr) {
+		return &vel.Error{
+			Code:    "SIGN_FAILED",
+			Message: err.Error(),
+		}
+	}
+	var imageNotFoundErr *ImageNotFoundError
+	if errors.As(err, &imageNotFoundErr) {
+		return &vel.Error{
+			Code:    "IMAGE_NOT_FOUND",
+			Message: err.Error(),
+		}
+	}
+	var notRecordedErr *ImageNotRecordedError
+	if errors.As(err, &notRecordedErr) {
+		return &vel.Error{
+			Code:    "IMAGE_NOT_RECORDED",
+			Message: err.Error(),
+		}
+	}
+	var baseImageErr *BaseImageNotAllowedError
+	if errors.As(err, &baseImageErr) {
+		return &vel.Error{
+			Code:    "BASE_IMAGE_NOT_ALLOWED",
+			Message: err.Error(),
+		}
+	}
+	var capabilityErr *ClusterCapabilityError
+	if errors.As(err, &capabilityErr) {
+		return &vel.Error{
+			Code:    "CLUSTER_CAPABILITY_MISSING",
+			Message: err.Error(),
+		}
+	}
+	var insufficientErr *InsufficientPermissionsError
+	if errors.As(err, &insufficientErr) {
+		return &vel.Error{
+			Code:    "INSUFFICIENT_PERMISSIONS",
+			Message: err.Error(),
+		}
+	}
+	var buildErr *BuildError
+	if errors.As(err, &buildErr) {
+		return &vel.Error{
+			Code:    "BUILD_FAILED",
+			Message: err.Error(),
+		}
+	}
+	return &vel.Error{
+		Code:    "UNKNOWN",
+		Message: err.Error(),
+	}
+}
+
+// deployTag is the mutable alias tagging the images built for an unknown sha or rebuilt on demand
+const deployTag = "latest"
+
+// shaTag returns the tag of the images built for the sha, the sha tag is immutable once it's pushed.
+// A forced rebuild may produce another digest of the same sha, so it's tagged with deployTag.
+func shaTag(sha string, forceRebuild bool) string {
+	if sha == "" || forceRebuild {
+		return deployTag
+	}
+	return sha
+}
+
+// installationRepos lists all the installation repos,
+// the webhook embeds only the first page of them for the installations with many repos
+func (h *Handler) installationRepos(installationID int) ([]InstalledRepository, error) {
+	githubRepos, err := h.githubClient.ListInstallationRepos(installationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list installation repos: %w", err)
+	}
+
+	repos := make([]InstalledRepository, len(githubRepos))
+	for i, repo := range githubRepos {
+		repos[i] = InstalledRepository{
+			ID:       repo.ID,
+			FullName: repo.FullName,
+			Private:  repo.Private,
+			Branch:   repo.DefaultBranch,
+		}
+	}
+	return repos, nil
+}
+
+// withDefaultBranches sets the github default branch of the repos connected without a branch
+func (h *Handler) withDefaultBranches(installationID int, repos []InstalledRepository) ([]InstalledRepository, error) {
+	result := make([]InstalledRepository, len(repos))
+	for i, repo := range repos {
+		if repo.Branch == "" {
+			githubRepo, err := h.githubClient.GetRepository(installationID, repo.FullName)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get repository %s: %w", repo.FullName, err)
 			}
+			repo.Branch = githubRepo.DefaultBranch
 		}
+		result[i] = repo
+	}
+	return result, nil
+}
 
-		appDef, err := h.db.SaveDeployment(ctx, AppDefinition{
-			App:  appSpace,
-			Tag:  image.Tag,
-			User: req.Sender.Login,
-			Sha:  req.After,
-		})
+// legacyDefaultBranches are deployed for the repos without a known branch in the legacy branches mode
+var legacyDefaultBranches = []string{"main", "master"}
+
+// deployedBranch reports whether a push to the branch is deployed,
+// the branch of the connected repo wins over the default branch reported by the push.
+// A repo without a known branch is not deployed, unless the legacy mode deploys both its main and master.
+func deployedBranch(connected, pushed InstalledRepository, branch string, legacy bool) bool {
+	if connected.Branch != "" {
+		return branch == connected.Branch
+	}
+	if pushed.Branch != "" {
+		return branch == pushed.Branch
+	}
+	return legacy && slices.Contains(legacyDefaultBranches, branch)
+}
+
+// admitRepo decides how the push of the repo is deployed and reports it to the delivery,
+// the returned function builds and applies a push deployed right away, it's nil if the push is skipped or debounced.
+// Nothing is cloned, so every repo of the delivery is reported before the first one is built.
+func (h *Handler) admitRepo(ctx context.Context, req GithubWebhookRequest, repo InstalledRepository) (func() error, error) {
+	connected, err := h.connectedRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if connected.TreenqID != "" && connected.FullName != repo.FullName {
+		// the rename event has been missed, the pushed name is the current one
+		if err := h.renameRepo(ctx, repo.ID, repo.FullName); err != nil {
+			h.l.WarnContext(ctx, "failed to rename repo", "repoID", repo.ID, "fullName", repo.FullName, "err", err)
+		}
+	}
+	ack := deliveryAckFrom(ctx)
+	skipReason := h.skipReason(req, connected, repo)
+	if skipReason == SkipReasonBranch {
+		h.l.DebugContext(ctx, "pushed branch is not deployed", "repoID", repo.ID, "branch", req.Branch())
+		ack.report(WebhookDeployment{RepoID: repo.ID, Outcome: DeployOutcomeSkipped, SkipReason: skipReason})
+		return nil, nil
+	}
+
+	if skipReason != "" {
+		def := pushDefinition(req, connected.TreenqID)
+		def.Status = DeploymentStatusSkipped
+		def.SkipReason = skipReason
+		saved, err := h.db.SaveDeployment(ctx, def)
 		if err != nil {
-			return GithubWebhookResponse{}, &vel.Error{
-				Code:    "UNKNOWN",
-				Message: err.Error(),
+			return nil, err
+		}
+		ack.report(WebhookDeployment{RepoID: repo.ID, Outcome: DeployOutcomeSkipped, DeploymentID: saved.ID, Sha: saved.Sha, SkipReason: skipReason})
+		return nil, nil
+	}
+
+	if window := h.debounceWindow(ctx, connected.TreenqID, req.Branch()); window > 0 {
+		h.debounce(ctx, window, req, connected, repo)
+		return nil, nil
+	}
+	deploymentID, reported := ack.queue(repo.ID, req.After)
+	return func() error {
+		deployed, err := h.deployPush(ctx, req, connected, repo, deploymentID)
+		if err != nil {
+			return err
+		}
+		ack.deployed(reported, deployed.ID)
+		return nil
+	}, nil
+}
+
+// pushDefinition is the deployment of the pushed commit
+func pushDefinition(req GithubWebhookRequest, appID string) AppDefinition {
+	def := AppDefinition{
+		AppID:          appID,
+		Tag:            shaTag(req.After, false),
+		User:           req.Sender.Login,
+		Sha:            req.After,
+		Message:        req.HeadCommit.Message,
+		Event:          req.Event,
+		Action:         req.Action,
+		Ref:            req.Ref,
+		SkipMigrations: req.SkipMigrations(),
+		Status:         DeploymentStatusDeploying,
+	}
+	def.reach(MilestoneQueued)
+	return def
+}
+
+// deployPush clones the pushed repo, builds and applies it.
+// The deployment is saved with the given id if it's reserved, e.g. by the debounce window or the delivery ack.
+func (h *Handler) deployPush(ctx context.Context, req GithubWebhookRequest, connected, repo InstalledRepository, deploymentID string) (AppDefinition, error) {
+	ctx, cancel := withTimeout(ctx, h.timeouts.Deploy)
+	defer cancel()
+
+	def := pushDefinition(req, connected.TreenqID)
+	def.ID = deploymentID
+	def.reach(MilestoneCloneStarted)
+	repoDir, err := h.cloneRepo(ctx, req.Installation.ID, connected, repo)
+	if err != nil {
+		return def, h.failDeployment(ctx, def, DeploymentStageClone, err)
+	}
+	defer os.RemoveAll(repoDir)
+	def.reach(MilestoneCloneFinished)
+
+	return h.deploySource(ctx, def, repoDir, sourcePush{
+		Branch:       req.Branch(),
+		ChangedPaths: req.ChangedPaths(),
+		BranchTip: func() (string, error) {
+			return h.githubClient.GetBranchSha(req.Installation.ID, repo.FullName, req.Branch())
+		},
+	})
+}
+
+// skipReason tells why the push of the repo isn't deployed, it's decided before the repo is cloned.
+// An empty reason means the push is deployed.
+func (h *Handler) skipReason(req GithubWebhookRequest, connected, repo InstalledRepository) SkipReason {
+	if req.Action == "" && !deployedBranch(connected, repo, req.Branch(), h.legacyBranches) {
+		return SkipReasonBranch
+	}
+	if !h.visibility.allows(repo) {
+		return SkipReasonVisibilityPolicy
+	}
+	if req.SkipDeploy() {
+		return SkipReasonDirective
+	}
+	return ""
+}
+
+// sourcePush describes the push of the deployed source
+type sourcePush struct {
+	// Branch selects the space environment
+	Branch string
+	// ChangedPaths are matched against the space Paths, nil means they're unknown and the source is deployed
+	ChangedPaths []string
+	// BranchTip returns the current branch tip if set, the apply is aborted once the branch has advanced past the deployed sha
+	BranchTip func() (string, error)
+}
+
+// deploySource extracts the space config from the source dir, builds and applies it
+func (h *Handler) deploySource(ctx context.Context, def AppDefinition, sourceDir string, push sourcePush) (AppDefinition, error) {
+	// the secrets seen by the deployment are redacted from its records
+	ctx = withRedaction(ctx)
+	ctx, run, stop := h.runs.start(ctx, def.AppID, def.ID)
+	defer stop()
+	defer h.watchSlow(ctx, def.AppID, run)()
+
+	h.runs.enter(ctx, DeploymentStageExtract)
+	config, err := h.extractSpace(ctx, def.AppID, sourceDir, push.Branch)
+	if err != nil {
+		return def, h.failDeployment(ctx, def, DeploymentStageExtract, err)
+	}
+	appSpace := config.Space
+	def.App = appSpace
+	def.ConfigPath = config.Path
+	if err := validateReadinessCommands(appSpace); err != nil {
+		return def, h.failDeployment(ctx, def, DeploymentStageExtract, err)
+	}
+	if err := validateMigrations(appSpace); err != nil {
+		return def, h.failDeployment(ctx, def, DeploymentStageExtract, err)
+	}
+	if err := h.resources.validate(appSpace); err != nil {
+		return def, h.failDeployment(ctx, def, DeploymentStageExtract, err)
+	}
+	if !pathsChanged(appSpace.Paths, push.ChangedPaths) {
+		def.Status = DeploymentStatusSkipped
+		def.SkipReason = SkipReasonPathFilter
+		def, err := h.db.SaveDeployment(ctx, def)
+		return def, err
+	}
+
+	def.reach(MilestoneBuildStarted)
+	h.runs.enter(ctx, DeploymentStageBuild)
+	images, err := h.buildOrReuse(ctx, &def, sourceDir)
+	if err != nil {
+		stage := DeploymentStageBuild
+		var pushErr *PushError
+		var signErr *SignError
+		if errors.As(err, &pushErr) {
+			stage = DeploymentStagePush
+		} else if errors.As(err, &signErr) {
+			stage = DeploymentStageSign
+		}
+		return def, h.failDeployment(ctx, def, stage, err)
+	}
+	def.reach(MilestoneBuildFinished)
+
+	env, hasEnv := appSpace.Environment(push.Branch)
+	if hasEnv {
+		def.Environment = env.Name
+		if env.RequireApproval {
+			def.Status = DeploymentStatusAwaitingApproval
+			if h.approvalTtl > 0 {
+				def.ApprovalExpiresAt = now().Add(h.approvalTtl)
 			}
 		}
+	}
 
-		appKubeDef := h.kube.DefineApp(ctx, appDef.ID, appSpace, image)
-		if err := h.kube.Apply(ctx, h.kubeConfig, appKubeDef); err != nil {
-			return GithubWebhookResponse{}, &vel.Error{
-				Code:    "UNKNOWN",
-				Message: err.Error(),
+	def, err = h.db.SaveDeployment(ctx, def)
+	if err != nil {
+		return def, err
+	}
+	h.runs.saved(run, def.ID)
+	if def.Status == DeploymentStatusAwaitingApproval {
+		return def, nil
+	}
+	if h.superseded(ctx, def, push.BranchTip) {
+		def.Status = DeploymentStatusSuperseded
+		return def, h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusSuperseded)
+	}
+
+	return def, h.applyDeployment(ctx, def, images)
+}
+
+// superseded reports whether the branch tip is no longer the deployed commit, e.g. a newer push came during the build.
+// The deployment goes on if the tip is unknown, the newer push is deployed anyway.
+func (h *Handler) superseded(ctx context.Context, def AppDefinition, branchTip func() (string, error)) bool {
+	if branchTip == nil {
+		return false
+	}
+	tip, err := branchTip()
+	if err != nil {
+		h.l.WarnContext(ctx, "failed to get branch tip", "deploymentID", def.ID, "err", err)
+		return false
+	}
+	if tip == "" || tip == def.Sha {
+		return false
+	}
+	h.l.InfoContext(ctx, "deployment is superseded by the branch tip", "deploymentID", def.ID, "sha", def.Sha, "tip", tip)
+	return true
+}
+
+// extractSpace extracts the space config of the branch environment with a pooled extractor.
+// The environment is guessed from the latest app deployment of the branch and checked against the extracted space,
+// the config is extracted again if the guess is wrong, e.g. for the first deployment.
+func (h *Handler) extractSpace(ctx context.Context, appID, sourceDir, branch string) (ExtractedConfig, error) {
+	environment := h.lastEnvironment(ctx, appID, branch)
+	return h.extractors.extract(ctx, func(extractorID string) (ExtractedConfig, error) {
+		config, err := h.extractors.extractor.ExtractConfig(extractorID, sourceDir, environment)
+		if err != nil {
+			return config, err
+		}
+
+		env, _ := config.Space.Environment(branch)
+		if env.Name == environment {
+			return config, nil
+		}
+		return h.extractors.extractor.ExtractConfig(extractorID, sourceDir, env.Name)
+	})
+}
+
+// lastEnvironment returns the environment the branch has been deployed to by the latest app deployment
+func (h *Handler) lastEnvironment(ctx context.Context, appID, branch string) string {
+	if appID == "" {
+		return ""
+	}
+	history, err := h.db.GetDeploymentHistory(ctx, appID)
+	if err != nil || len(history) == 0 {
+		return ""
+	}
+	env, _ := history[0].App.Environment(branch)
+	return env.Name
+}
+
+// applyDeployment applies the deployment objects to the cluster, smoke tests them and stores the deployment result.
+// The images are checked to be pullable from the registry before anything is applied.
+// The objects are applied only once the migrations Job has succeeded, so no new pod serves the unmigrated schema.
+func (h *Handler) applyDeployment(ctx context.Context, def AppDefinition, images map[string]Image) error {
+	h.recordEnv(ctx, def)
+	// the pods of a missing image never start, nothing is applied
+	h.runs.enter(ctx, DeploymentStageApply)
+	if err := h.verifyImages(ctx, images); err != nil {
+		return h.failDeployment(ctx, def, DeploymentStageApply, err)
+	}
+	if err := h.checkCapabilities(ctx, def, images); err != nil {
+		return h.failDeployment(ctx, def, DeploymentStageApply, err)
+	}
+	h.runs.enter(ctx, DeploymentStageMigrations)
+	if err := h.runMigrations(ctx, def, images); err != nil {
+		return h.failDeployment(ctx, def, DeploymentStageMigrations, err)
+	}
+
+	h.runs.enter(ctx, DeploymentStageApply)
+	if def.App.PauseAfterDeploy {
+		return h.pauseDeployment(ctx, def, images)
+	}
+
+	appKubeDef, err := h.apply(ctx, def, images, &KubeEvent{
+		Reason:  KubeEventDeployStarted,
+		Message: fmt.Sprintf("treenq deployment %s of %s started", def.ID, def.Sha),
+	})
+	if err != nil {
+		if deploymentCancelled(ctx) {
+			// the apply is stopped midway, some of the objects may be changed already
+			h.rollbackCancelled(ctx, def)
+			return h.storeCancelled(ctx, def)
+		}
+		h.recordFailedEvent(ctx, appKubeDef, DeploymentStageApply, err)
+		return h.failDeployment(ctx, def, DeploymentStageApply, err)
+	}
+	h.recordMilestone(ctx, def, MilestoneApplied)
+	h.recordObjects(ctx, def, appKubeDef)
+	return h.finishDeployment(ctx, def, appKubeDef)
+}
+
+// finishDeployment smoke tests the deployment receiving the traffic and stores it as deployed,
+// the previous deployment is applied again if the smoke test asks to roll back
+func (h *Handler) finishDeployment(ctx context.Context, def AppDefinition, appKubeDef string) error {
+	h.runs.enter(ctx, DeploymentStageSmokeTest)
+	if rollback, err := h.smokeTest(ctx, def.App); err != nil {
+		if deploymentCancelled(ctx) {
+			h.rollbackCancelled(ctx, def)
+			return h.storeCancelled(ctx, def)
+		}
+		h.recordFailedEvent(ctx, appKubeDef, DeploymentStageSmokeTest, err)
+		err = h.failDeployment(ctx, def, DeploymentStageSmokeTest, err)
+		if rollback {
+			if rollbackErr := h.rollbackDeployment(ctx, def); rollbackErr != nil {
+				h.l.ErrorContext(ctx, "failed to roll back deployment", "deploymentID", def.ID, "err", rollbackErr)
 			}
 		}
+		return err
+	}
+
+	h.recordMilestone(ctx, def, MilestoneReady)
+	h.recordEvent(ctx, appKubeDef, KubeEvent{
+		Reason:  KubeEventDeploySucceeded,
+		Message: fmt.Sprintf("treenq deployment %s of %s succeeded", def.ID, def.Sha),
+	})
+	if err := h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusDeployed); err != nil {
+		return err
+	}
+
+	// the history is pruned once a new deployment is running, it's never needed to succeed
+	if err := h.pruneDeployments(ctx, def.AppID); err != nil {
+		h.l.WarnContext(ctx, "failed to prune deployments", "appID", def.AppID, "err", err)
+	}
+	return nil
+}
+
+// failDeployment stores the classified deployment failure and returns the original error,
+// a deployment failed before it's been saved is saved as failed. A cancelled deployment is stored as cancelled instead.
+func (h *Handler) failDeployment(ctx context.Context, def AppDefinition, stage DeploymentStage, err error) error {
+	if deploymentCancelled(ctx) {
+		return h.storeCancelled(ctx, def)
+	}
+	failure := newDeploymentFailure(stage, err)
+	h.l.ErrorContext(ctx, "deployment failed",
+		"deploymentID", def.ID,
+		"appID", def.AppID,
+		"stage", failure.Stage,
+		"class", failure.Class,
+		"err", err,
+	)
+
+	// the failure must be stored even if the deployment deadline is exceeded
+	ctx = context.WithoutCancel(ctx)
+	var storeErr error
+	if def.ID != "" {
+		storeErr = h.db.FailDeployment(ctx, def.ID, failure)
+	}
+	// a reserved id isn't saved until the deployment is built
+	if def.ID == "" || errors.Is(storeErr, ErrDeploymentNotFound) {
+		def.Status = DeploymentStatusFailed
+		def.Failure = &failure
+		_, storeErr = h.db.SaveDeployment(ctx, def)
+	}
+	if storeErr != nil {
+		h.l.ErrorContext(ctx, "failed to store deployment failure", "deploymentID", def.ID, "err", storeErr)
+	}
+
+	return err
+}
+
+// apply defines the app objects and applies them, the objects are returned to refer them later.
+// The started event is recorded on the defined objects before they're applied, so a failed apply has it too.
+func (h *Handler) apply(ctx context.Context, def AppDefinition, images map[string]Image, started *KubeEvent) (string, error) {
+	applyCtx, cancel := withTimeout(ctx, h.timeouts.Apply)
+	defer cancel()
+
+	space, appKubeDef, err := h.defineApp(applyCtx, def, images)
+	if err != nil {
+		return "", err
+	}
+	if started != nil {
+		h.recordEvent(ctx, appKubeDef, *started)
+	}
+	if hasMaintenanceMode(space) {
+		return appKubeDef, h.applyInMaintenance(applyCtx, appKubeDef)
+	}
+	if err := h.kube.Apply(applyCtx, h.kubeConfig, appKubeDef); err != nil {
+		return appKubeDef, err
+	}
+	// the readiness command is the only way to tell the service is ready, the rollout waits for it,
+	// a smoke test must reach the new pods rather than the old ones still serving until the rollout is done
+	if hasReadinessCommand(space) || hasSmokeTest(space) {
+		return appKubeDef, h.kube.WaitReady(applyCtx, h.kubeConfig, appKubeDef)
+	}
+	return appKubeDef, nil
+}
+
+// defineApp renders the deployment objects with the app envs and the resource limits applied
+func (h *Handler) defineApp(ctx context.Context, def AppDefinition, images map[string]Image) (tqsdk.Space, string, error) {
+	space, err := h.withAppEnv(ctx, def.AppID, def.Environment, def.App)
+	if err != nil {
+		return tqsdk.Space{}, "", err
+	}
+
+	space = h.resources.apply(space)
+	return space, h.kube.DefineApp(ctx, def.ID, def.AppID, space, images), nil
+}
+
+// renameRepo updates the stored name of the connected repo, the clone url is built from it
+func (h *Handler) renameRepo(ctx context.Context, repoID int, fullName string) error {
+	connected, err := h.db.GetRepoByGithub(ctx, repoID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			return nil
+		}
+		return err
+	}
+	if connected.FullName == fullName {
+		return nil
+	}
+	h.l.InfoContext(ctx, "repo is renamed", "repoID", repoID, "from", connected.FullName, "to", fullName)
+	return h.db.RenameGithubRepo(ctx, repoID, fullName)
+}
+
+// connectedRepo returns the repo connected to treenq,
+// the repos unknown to treenq are deployed without an app id
+func (h *Handler) connectedRepo(ctx context.Context, repo InstalledRepository) (InstalledRepository, error) {
+	app, err := h.db.GetRepoByGithub(ctx, repo.ID)
+	if err != nil {
+		if errors.Is(err, ErrRepoNotFound) {
+			h.l.WarnContext(ctx, "repo is not connected", "repoID", repo.ID, "fullName", repo.FullName)
+			return InstalledRepository{}, nil
+		}
+		return InstalledRepository{}, err
+	}
+	return app, nil
+}
+
+// ImageNotRecordedError is returned if a deployment applied again has no pushed digest of a service image,
+// e.g. it was deployed before the digests were recorded, such a deployment must be built again
+type ImageNotRecordedError struct {
+	DeploymentID string
+	Service      string
+}
+
+func (e *ImageNotRecordedError) Error() string {
+	return fmt.Sprintf("deployment %s has no recorded image of service %s, build it again", e.DeploymentID, e.Service)
+}
 
+// recordedImages returns the images the deployment has pushed pinned to their digests,
+// so applying it again deploys exactly them even once the tag has moved to a newer image
+func (h *Handler) recordedImages(def AppDefinition) (map[string]Image, error) {
+	images := make(map[string]Image)
+	for _, service := range def.App.AllServices() {
+		digest, ok := def.Digests[service.Name]
+		if !ok {
+			return nil, UserFailure(&ImageNotRecordedError{DeploymentID: def.ID, Service: service.Name})
+		}
+		image := h.docker.Image(BuildArtifactRequest{
+			Name: service.Name,
+			Tag:  def.Tag,
+		})
+		image.Digest = digest
+		image.Signature = def.Signatures[service.Name]
+		images[service.Name] = image
 	}
+	return images, nil
+}
 
-	return GithubWebhookResponse{}, nil
+// imageDigests returns the pushed digests of the images by the service name
+func imageDigests(images map[string]Image) map[string]string {
+	digests := make(map[string]string, len(images))
+	for service, image := range images {
+		digests[service] = image.Digest
+	}
+	return digests
 }
@@ -0,0 +1,301 @@
+package domain
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+//go:embed testdata/branchPushMain.json
+var branchPushMainBody []byte
+
+func branchPushMainRequest(t *testing.T) GithubWebhookRequest {
+	var req GithubWebhookRequest
+	require.NoError(t, json.Unmarshal(branchPushMainBody, &req))
+	return req
+}
+
+func TestGithubWebhookSkipDeployDirective(t *testing.T) {
+	for _, message := range []string{"bump version [skip deploy]", "docs: typo [Skip CI]"} {
+		t.Run(message, func(t *testing.T) {
+			th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+			req := branchPushMainRequest(t)
+			req.HeadCommit.Message = message
+
+			_, rpcErr := th.GithubWebhook(context.Background(), req)
+			require.Nil(t, rpcErr)
+
+			require.Len(t, th.db.deployments, 1)
+			assert.Equal(t, DeploymentStatusSkipped, th.db.deployments[0].Status)
+			assert.Equal(t, SkipReasonDirective, th.db.deployments[0].SkipReason)
+			assert.Equal(t, req.After, th.db.deployments[0].Sha)
+			assert.Empty(t, th.docker.builds)
+			assert.Empty(t, th.kube.applied)
+		})
+	}
+}
+
+func TestGithubWebhookDeploysRegularCommit(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	req := branchPushMainRequest(t)
+	require.Equal(t, "Useless commit", req.HeadCommit.Message)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), req)
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+	assert.Len(t, th.docker.builds, 1)
+	assert.Len(t, th.kube.applied, 1)
+}
+
+//go:embed testdata/appInstall.json
+var appInstallBody []byte
+
+func TestGithubWebhookStoresDefaultBranch(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos = nil
+	th.github.defaultBranches = map[string]string{"treenq/treenq": "develop"}
+	th.github.installationRepos = []Repository{{ID: 805585115, FullName: "treenq/treenq"}}
+
+	var install GithubWebhookRequest
+	require.NoError(t, json.Unmarshal(appInstallBody, &install))
+	_, rpcErr := th.GithubWebhook(context.Background(), install)
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.repos, 1)
+	assert.Equal(t, "develop", th.db.repos[0].Branch)
+	deployments := len(th.db.deployments)
+
+	push := branchPushMainRequest(t)
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	assert.Len(t, th.db.deployments, deployments, "main is not the default branch of the repo")
+
+	push.Ref = "refs/heads/develop"
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	require.Len(t, th.db.deployments, deployments+1)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[deployments].Status)
+}
+
+func TestDeployedBranch(t *testing.T) {
+	assert.True(t, deployedBranch(InstalledRepository{Branch: "develop"}, InstalledRepository{Branch: "main"}, "develop", false))
+	assert.False(t, deployedBranch(InstalledRepository{Branch: "develop"}, InstalledRepository{Branch: "main"}, "main", false))
+	assert.True(t, deployedBranch(InstalledRepository{}, InstalledRepository{Branch: "trunk"}, "trunk", false))
+	assert.False(t, deployedBranch(InstalledRepository{}, InstalledRepository{}, "master", false), "no branch is deployed implicitly")
+	assert.False(t, deployedBranch(InstalledRepository{}, InstalledRepository{}, "main", false))
+	assert.False(t, deployedBranch(InstalledRepository{}, InstalledRepository{}, "feature", false))
+}
+
+func TestDeployedBranchLegacy(t *testing.T) {
+	assert.True(t, deployedBranch(InstalledRepository{}, InstalledRepository{}, "master", true))
+	assert.True(t, deployedBranch(InstalledRepository{}, InstalledRepository{}, "main", true))
+	assert.False(t, deployedBranch(InstalledRepository{}, InstalledRepository{}, "feature", true))
+	assert.False(t, deployedBranch(InstalledRepository{Branch: "master"}, InstalledRepository{}, "main", true), "the connected branch wins in the legacy mode too")
+}
+
+func TestGithubWebhookLinksAllInstallationRepos(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos = nil
+	th.github.installationRepos = []Repository{
+		{ID: 805585115, FullName: "treenq/treenq", DefaultBranch: "main"},
+		{ID: 805585116, FullName: "treenq/docs", DefaultBranch: "gh-pages"},
+		{ID: 805585117, FullName: "treenq/private", Private: true, DefaultBranch: "master"},
+	}
+
+	var install GithubWebhookRequest
+	require.NoError(t, json.Unmarshal(appInstallBody, &install))
+	require.Len(t, install.Repositories, 1, "the webhook embeds a partial list")
+	_, rpcErr := th.GithubWebhook(context.Background(), install)
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.repos, 3)
+	assert.Len(t, th.db.deployments, 3, "every installation repo must be processed")
+	assert.Equal(t, InstalledRepository{TreenqID: "app-805585116", ID: 805585116, FullName: "treenq/docs", Branch: "gh-pages"}, th.db.repos[1])
+}
+
+func TestGithubWebhookExtractsEnvironmentConfig(t *testing.T) {
+	environments := []tqsdk.Environment{{Name: "staging", Branch: "staging"}}
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Environments: environments})
+	th.extractor.environmentSpaces = map[string]tqsdk.Space{
+		"staging": {Key: "staging-space", Service: tqsdk.Service{Name: "api", Replicas: 1}, Environments: environments},
+	}
+	th.db.repos[0].Branch = "staging"
+	push := pushRequest()
+	push.Ref = "refs/heads/staging"
+
+	_, rpcErr := th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	assert.Equal(t, "tq.staging", def.ConfigPath)
+	assert.Equal(t, "staging-space", def.App.Key)
+	assert.Equal(t, "staging", def.Environment)
+
+	// the environment is known from the previous deployment, the config is extracted once
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, []string{"", "staging", "staging"}, th.extractor.environments)
+	assert.Equal(t, "tq.staging", th.db.deployments[1].ConfigPath)
+}
+
+func TestGithubWebhookExtractsBaseConfigWithoutEnvironmentConfig(t *testing.T) {
+	environments := []tqsdk.Environment{{Name: "production", Branch: "main"}}
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Environments: environments})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	assert.Equal(t, "tq", def.ConfigPath)
+	assert.Equal(t, "space", def.App.Key)
+	assert.Equal(t, "production", def.Environment)
+}
+
+func TestGithubWebhookVisibilityPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   VisibilityPolicy
+		deployed bool
+	}{
+		{name: "public only", policy: VisibilityPolicy{Default: RepoVisibilityPublic}, deployed: false},
+		{name: "private only", policy: VisibilityPolicy{Default: RepoVisibilityPrivate}, deployed: true},
+		{name: "no policy", policy: VisibilityPolicy{}, deployed: true},
+		{
+			name:     "org overrides default",
+			policy:   VisibilityPolicy{Default: RepoVisibilityPublic, Orgs: map[string]RepoVisibility{"treenq": RepoVisibilityAll}},
+			deployed: true,
+		},
+		{
+			name:     "another org policy",
+			policy:   VisibilityPolicy{Default: RepoVisibilityPublic, Orgs: map[string]RepoVisibility{"acme": RepoVisibilityAll}},
+			deployed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+			th.visibility = tt.policy
+			req := pushRequest()
+			req.Repository.Private = true
+
+			_, rpcErr := th.GithubWebhook(context.Background(), req)
+			require.Nil(t, rpcErr)
+
+			require.Len(t, th.db.deployments, 1)
+			def := th.db.deployments[0]
+			if tt.deployed {
+				assert.Equal(t, DeploymentStatusDeployed, def.Status)
+				assert.Empty(t, def.SkipReason)
+				return
+			}
+			assert.Equal(t, DeploymentStatusSkipped, def.Status)
+			assert.Equal(t, SkipReasonVisibilityPolicy, def.SkipReason)
+			assert.Zero(t, th.git.clones)
+			assert.Empty(t, th.docker.builds)
+		})
+	}
+}
+
+func TestVisibilityPolicyValidate(t *testing.T) {
+	assert.NoError(t, VisibilityPolicy{Default: RepoVisibilityAll, Orgs: map[string]RepoVisibility{"treenq": RepoVisibilityPrivate}}.Validate())
+	assert.Error(t, VisibilityPolicy{Default: "internal"}.Validate())
+	assert.Error(t, VisibilityPolicy{Orgs: map[string]RepoVisibility{"treenq": "secret"}}.Validate())
+}
+
+func TestGithubWebhookRenamedRepo(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	rename := GithubWebhookRequest{
+		Action:     "renamed",
+		Repository: Repository{ID: 805585115, FullName: "treenq/platform"},
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), rename)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, "treenq/platform", th.db.repos[0].FullName)
+	assert.Equal(t, testAppID, th.db.repos[0].TreenqID, "the connection is kept")
+	assert.Empty(t, th.db.deployments)
+
+	// the stored name is cloned
+	th.github.branchTips = map[string]string{"treenq/platform:main": pushRequest().After}
+	_, rpcErr = th.PlanDeployment(userCtx("testing"), PlanDeploymentRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, []string{"https://github.com/treenq/platform.git"}, th.git.urls)
+}
+
+func TestGithubWebhookPushOfRenamedRepo(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	push := pushRequest()
+	push.Repository.FullName = "treenq/platform"
+
+	_, rpcErr := th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, "treenq/platform", th.db.repos[0].FullName, "a missed rename is caught up by the push")
+	assert.Equal(t, []string{"https://github.com/treenq/platform.git"}, th.git.urls)
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, testAppID, th.db.deployments[0].AppID)
+}
+
+func TestGithubWebhookRenamedUnknownRepo(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	rename := GithubWebhookRequest{
+		Action:     "renamed",
+		Repository: Repository{ID: 1, FullName: "acme/api"},
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), rename)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, "treenq/treenq", th.db.repos[0].FullName)
+}
+
+func TestGithubWebhookSupersededByBranchTip(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	push := pushRequest()
+	th.github.branchTips = map[string]string{"treenq/treenq:" + push.Branch(): "a-newer-commit"}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, DeploymentStatusSuperseded, th.db.deployments[0].Status)
+	assert.Len(t, th.docker.builds, 1)
+	assert.Empty(t, th.kube.applied, "the outdated commit must not be applied")
+
+	// the tip is the pushed commit
+	th.github.branchTips["treenq/treenq:"+push.Branch()] = push.After
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[1].Status)
+	assert.Len(t, th.kube.applied, 1)
+}
+
+func TestGithubWebhookConcurrentDeploysCloneToDistinctDirs(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, rpcErr := th.GithubWebhook(context.Background(), branchPushMainRequest(t))
+			assert.Nil(t, rpcErr)
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, th.git.cloneIDs, 2)
+	assert.NotEqual(t, th.git.cloneIDs[0], th.git.cloneIDs[1])
+	assert.NotEqual(t, th.git.dirs[0], th.git.dirs[1])
+	for _, dir := range th.git.dirs {
+		assert.NoDirExists(t, dir, "every deploy removes its own clone")
+	}
+}
@@ -2,7 +2,12 @@ package domain
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
 )
@@ -11,16 +16,65 @@ type Handler struct {
 	db           Database
 	githubClient GithubCleint
 	git          Git
-	extractor    Extractor
-	docker       DockerArtifactory
-	kube         Kube
+	// extractors are the pooled extractors shared by the deployments
+	extractors *extractorPool
+	docker     DockerArtifactory
+	// registry checks the images exist before they are applied, the check is skipped if it's nil
+	registry ImageRegistry
+	kube     Kube
+	// notifier sends the deployment notifications, nothing is sent if it's nil
+	notifier Notifier
 
 	kubeConfig string
+	// httpClient makes the smoke test requests
+	httpClient *http.Client
+
+	// approvalTtl is how long a deployment can await approval, zero never expires the approval
+	approvalTtl time.Duration
+	// promotionTtl is how long a paused deployment can await promotion before it's rolled back
+	promotionTtl time.Duration
+	timeouts     DeployTimeouts
+	// archiveMaxSize limits the deployed archive size in bytes
+	archiveMaxSize int64
+	// retention limits the stored deployments of an app
+	retention DeploymentRetention
+	// builds and pushes limit the concurrent image builds and pushes of all the deployments sharing the docker daemon
+	builds *slots
+	pushes *slots
+	// visibility selects the deployed repos by their visibility
+	visibility VisibilityPolicy
+	signing    ImageSigning
+	// tagImmutability protects the immutable tags from being moved by a push
+	tagImmutability TagImmutability
+	// plan limits the usage of every user
+	plan PlanLimits
+	// resources sizes the services of the shared cluster
+	resources ResourceProfile
+	// baseImages restricts the base images the services are built on
+	baseImages BaseImagePolicy
+	// cloneProtocol is the protocol a repo is cloned over first, the other one is tried if it can't connect
+	cloneProtocol CloneProtocol
+	// legacyBranches deploys both main and master of a repo connected without a branch,
+	// the connections are not migrated to their default branch then
+	legacyBranches bool
+	// webhookEvents are the github webhook events processed, the rest are acknowledged only
+	webhookEvents WebhookEvents
+	// admins are allowed to operate the instance, e.g. to drain it
+	admins Admins
+	// draining stops the instance taking the webhook deliveries
+	draining atomic.Bool
+	// debouncer holds the pushes of the environments with a debounce window
+	debouncer *debouncer
+	// runs are the running deployments to cancel
+	runs *deployRuns
+	// background tracks the deployments outliving the ack of their delivery, the shutdown waits for them
+	background sync.WaitGroup
 
 	oauthProvider    OauthProvider
 	jwtIssuer        JwtIssuer
 	githubWebhookURL string
 
+	// l masks the secrets it writes
 	l *slog.Logger
 }
 
@@ -30,8 +84,27 @@ func NewHandler(
 	git Git,
 	extractor Extractor,
 	docker DockerArtifactory,
+	registry ImageRegistry,
 	kube Kube,
+	notifier Notifier,
 	kubeConfig string,
+	approvalTtl time.Duration,
+	promotionTtl time.Duration,
+	timeouts DeployTimeouts,
+	archiveMaxSize int64,
+	retention DeploymentRetention,
+	concurrency ImageConcurrency,
+	extractorPoolSize int,
+	visibility VisibilityPolicy,
+	signing ImageSigning,
+	tagImmutability TagImmutability,
+	plan PlanLimits,
+	resources ResourceProfile,
+	baseImages BaseImagePolicy,
+	cloneProtocol CloneProtocol,
+	legacyBranches bool,
+	webhookEvents WebhookEvents,
+	admins Admins,
 
 	oauthProvider OauthProvider,
 	jwtIssuer JwtIssuer,
@@ -42,19 +115,70 @@ func NewHandler(
 		db:           db,
 		githubClient: githubClient,
 		git:          git,
-		extractor:    extractor,
+		extractors:   newExtractorPool(extractor, extractorPoolSize),
 		docker:       docker,
+		registry:     registry,
 		kube:         kube,
+		notifier:     notifier,
+
+		kubeConfig:   kubeConfig,
+		httpClient:   &http.Client{},
+		approvalTtl:  approvalTtl,
+		promotionTtl: promotionTtl,
+		timeouts:     timeouts,
+
+		archiveMaxSize: archiveMaxSize,
+		retention:      retention,
+		builds:         newSlots(concurrency.Builds),
+		pushes:         newSlots(concurrency.Pushes),
+		visibility:     visibility,
+		signing:        signing,
+		plan:           plan,
+		resources:      resources,
+		baseImages:     baseImages,
+		cloneProtocol:  cloneProtocol,
+		legacyBranches: legacyBranches,
+		webhookEvents:  webhookEvents,
+		admins:         admins,
 
-		kubeConfig: kubeConfig,
+		tagImmutability: tagImmutability,
+		debouncer:       newDebouncer(),
+		runs:            newDeployRuns(),
 
 		oauthProvider:    oauthProvider,
 		jwtIssuer:        jwtIssuer,
 		githubWebhookURL: githubWebhookURL,
-		l:                l,
+		l:                NewRedactingLogger(l),
 	}
 }
 
+// DeployTimeouts limits the deployment stages, a zero timeout is not applied
+type DeployTimeouts struct {
+	// Deploy is a deadline of the whole deployment of a repo
+	Deploy time.Duration
+	// Build limits a single image build
+	Build time.Duration
+	// Apply limits applying the app objects to the cluster
+	Apply time.Duration
+	// Slow is how long a deployment runs before it's notified as slow, it isn't aborted
+	Slow time.Duration
+	// Ack is how long a webhook delivery waits for its deployments before it's acked with them queued,
+	// zero waits until they're done
+	Ack time.Duration
+}
+
+// withTimeout returns a sub-context limited by the given timeout if it's set
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+var now = func() time.Time {
+	return time.Now().UTC()
+}
+
 type Database interface {
 	// User domain
 	////////////////////////
@@ -63,7 +187,27 @@ type Database interface {
 	// Deployment domain
 	// ////////////////
 	SaveDeployment(ctx context.Context, def AppDefinition) (AppDefinition, error)
+	GetDeployment(ctx context.Context, id string) (AppDefinition, error)
+	UpdateDeploymentStatus(ctx context.Context, id string, status DeploymentStatus) error
+	// UpdateDeploymentStatuses sets the intermediate statuses by the deployment id at once,
+	// a deployment in a terminal status is left as is
+	UpdateDeploymentStatuses(ctx context.Context, statuses map[string]DeploymentStatus) error
+	FailDeployment(ctx context.Context, id string, failure DeploymentFailure) error
+	SaveMigrationLogs(ctx context.Context, id string, logs string) error
+	// SetDeploymentObjects stores the cluster objects applied by the deployment
+	SetDeploymentObjects(ctx context.Context, id string, objects []ObjectRef) error
+	// SetDeploymentEnv stores the env snapshot of the deployment, it holds no secret value
+	SetDeploymentEnv(ctx context.Context, id string, env map[string][]EnvVar) error
+	// SetPromotionExpiresAt sets when the paused deployment is rolled back unless promoted
+	SetPromotionExpiresAt(ctx context.Context, id string, expiresAt time.Time) error
+	// AddTimelineEvent appends the event to the deployment timeline
+	AddTimelineEvent(ctx context.Context, id string, event TimelineEvent) error
 	GetDeploymentHistory(ctx context.Context, appID string) ([]AppDefinition, error)
+	// ListDeployments returns all the app deployments ordered from the newest
+	ListDeployments(ctx context.Context, appID string) ([]AppDefinition, error)
+	// ListRecentDeployments returns up to limit latest app deployments ordered from the newest
+	ListRecentDeployments(ctx context.Context, appID string, limit int) ([]AppDefinition, error)
+	DeleteDeployments(ctx context.Context, ids []string) error
 
 	// Github repos domain
 	// //////////////////////
@@ -72,30 +216,130 @@ type Database interface {
 	RemoveGithubRepos(ctx context.Context, installationID int, repos []InstalledRepository) error
 	GetGithubRepos(ctx context.Context, email string) ([]InstalledRepository, error)
 	ConnectRepoBranch(ctx context.Context, repoID int, branch string) error
+	// GetReposWithoutBranch returns the repos connected without a branch with their installation id
+	GetReposWithoutBranch(ctx context.Context) ([]InstalledRepository, error)
+	// RenameGithubRepo sets the current name of the repo found by its github id
+	RenameGithubRepo(ctx context.Context, repoID int, fullName string) error
+	GetRepoByGithub(ctx context.Context, githubRepoID int) (InstalledRepository, error)
+	// AddInstallationMember grants the github user access to the repos of the organization installation,
+	// RemoveInstallationMember revokes it
+	AddInstallationMember(ctx context.Context, installationID int, login string) error
+	RemoveInstallationMember(ctx context.Context, installationID int, login string) error
+	// SaveInstallationPermissions stores the summary of the latest token issued for the installation
+	SaveInstallationPermissions(ctx context.Context, installationID int, permissions InstallationPermissions) error
+	// SetRepoDeployKey stores the repo deploy key and switches the repo to the deploy key auth
+	SetRepoDeployKey(ctx context.Context, appID, privateKey string) error
+	// GetRepoDeployKey returns ErrDeployKeyNotFound if the repo has no deploy key
+	GetRepoDeployKey(ctx context.Context, appID string) (string, error)
+	// SetAppFeedToken replaces the feed token hash of the app,
+	// GetAppFeedToken returns ErrFeedTokenNotFound if the app has no feed token
+	SetAppFeedToken(ctx context.Context, appID, tokenHash string) error
+	GetAppFeedToken(ctx context.Context, appID string) (string, error)
+
+	// App env domain
+	// //////////////////////
+	// GetAppEnvs returns the app envs of all the environments
+	GetAppEnvs(ctx context.Context, appID string) ([]AppEnv, error)
+	// SetAppEnvs upserts the envs and removes the keys of the given environment
+	SetAppEnvs(ctx context.Context, appID, environment string, envs []AppEnv, remove []string) error
+
+	// App history domain
+	// //////////////////////
+	// AppendAppEvent stores the event as the next version of the app history
+	AppendAppEvent(ctx context.Context, event AppEvent) (AppEvent, error)
+	// GetAppEvents returns the app history ordered by the version
+	GetAppEvents(ctx context.Context, appID string) ([]AppEvent, error)
 }
 
 type GithubCleint interface {
-	IssueAccessToken(installationID int) (string, error)
+	// IssueAccessToken issues an installation access token, the permissions it's granted are returned with it
+	IssueAccessToken(installationID int) (InstallationToken, error)
+	GetRepository(installationID int, fullName string) (Repository, error)
+	// ListInstallationRepos returns all the installation repos, pages are collected
+	ListInstallationRepos(installationID int) ([]Repository, error)
+	// GetBranchSha returns the current tip commit of the repo branch
+	GetBranchSha(installationID int, fullName, branch string) (string, error)
 }
 
 type Git interface {
-	Clone(url string, installationID, repoID int, accesstoken string) (string, error)
+	// Clone clones the repo or pulls its latest changes, the credentials are never stored in the repo dir.
+	// The repo dir is unique to the clone id, the caller removes it once it's done.
+	Clone(url string, installationID, repoID int, cloneID string, creds CloneCredentials) (string, error)
+	// ExtractArchive unpacks a gzipped tarball into a new source dir,
+	// it returns ErrInvalidArchive for a malformed archive or an archive exceeding maxSize once unpacked
+	ExtractArchive(archive io.Reader, maxSize int64) (string, error)
 }
 
 type Extractor interface {
 	Open() (string, error)
-	ExtractConfig(id, repoDir string) (tqsdk.Space, error)
+	// ExtractConfig extracts the space from the config of the environment,
+	// the base config is used if the repo has no config for the environment
+	ExtractConfig(id, repoDir, environment string) (ExtractedConfig, error)
 	Close(string) error
 }
 
+type ExtractedConfig struct {
+	Space tqsdk.Space
+	// Path is the repo relative config dir the space is extracted from
+	Path string
+}
+
 type DockerArtifactory interface {
 	Image(args BuildArtifactRequest) Image
-	Build(ctx context.Context, args BuildArtifactRequest) (Image, error)
+	// Build builds the image locally, it's not available to the cluster until it's pushed
+	Build(ctx context.Context, args BuildArtifactRequest) (Image, BuildMetrics, error)
+	// Push uploads the built image and returns it with the digest confirmed by the registry
+	Push(ctx context.Context, image Image) (Image, error)
+	// Remove deletes the image, it's called once no deployment uses the image
+	Remove(ctx context.Context, image Image) error
+	// Exists reports whether the image is built already, its layers are reused by the next build
+	Exists(ctx context.Context, image Image) (bool, error)
+	// RegistryDigest returns the digest the registry holds for the image tag, empty if the tag isn't pushed
+	RegistryDigest(ctx context.Context, image Image) (string, error)
+	// RepoDigests returns the registry digests the local image is known by
+	RepoDigests(ctx context.Context, image Image) ([]string, error)
+	// HasBuilder reports whether the named builder is available to build the images
+	HasBuilder(name string) bool
+	// HasBuildpacks reports whether the images can be built with buildpacks
+	HasBuildpacks() bool
+}
+
+// ImageRegistry is queried for the pushed images the cluster pulls
+type ImageRegistry interface {
+	// ManifestExists reports whether the image manifest is pullable with the cluster pull credentials
+	ManifestExists(ctx context.Context, image Image) (bool, error)
 }
 
 type Kube interface {
-	DefineApp(ctx context.Context, id string, app tqsdk.Space, image Image) string
+	// DefineApp renders the space objects, images are keyed by the service name
+	// the objects are labeled as owned by treenq for the given app
+	DefineApp(ctx context.Context, id, appID string, app tqsdk.Space, images map[string]Image) string
 	Apply(ctx context.Context, rawConig, data string) error
+	// DefinedObjects returns the references of the defined objects with the names they are generated
+	DefinedObjects(data string) ([]ObjectRef, error)
+	// MissingAPIs returns the given kinds the cluster doesn't serve, e.g. the kind of a CRD which isn't installed
+	MissingAPIs(ctx context.Context, rawConig string, kinds []APIKind) ([]APIKind, error)
+	// ApplyPaused applies the app objects but the Ingresses, the new version rolls out without receiving the traffic
+	ApplyPaused(ctx context.Context, rawConig, data string) error
+	// RouteTraffic applies the Ingresses of the app objects, the traffic is switched to the new version
+	RouteTraffic(ctx context.Context, rawConig, data string) error
+	// RecordEvent records the event on the app Deployments of the defined objects
+	RecordEvent(ctx context.Context, rawConig, data string, event KubeEvent) error
+	// SetMaintenance routes the maintenance mode services of the app objects to the maintenance page if enabled,
+	// otherwise their traffic is restored
+	SetMaintenance(ctx context.Context, rawConig, data string, enabled bool) error
+	// WaitReady waits until the app Deployments roll out
+	WaitReady(ctx context.Context, rawConig, data string) error
+	// RunMigrations runs the migrations Job in the app namespace and waits for it to complete,
+	// the Job logs are returned even if it fails
+	RunMigrations(ctx context.Context, rawConig string, job MigrationJob) (string, error)
+	// PlanApp compares the defined objects with the live ones without changing the cluster
+	PlanApp(ctx context.Context, rawConig, data string) ([]ObjectPlan, error)
+	// GetResources returns the live cluster objects treenq owns for the app
+	GetResources(ctx context.Context, rawConig, appID string) ([]KubeResource, error)
+	// ImportWorkload reads the live Deployment and labels its objects as owned by treenq for the app,
+	// it returns ErrWorkloadNotFound if there is no such Deployment
+	ImportWorkload(ctx context.Context, rawConig, namespace, name, appID string) (Workload, error)
 }
 
 type OauthProvider interface {
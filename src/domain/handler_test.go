@@ -0,0 +1,897 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel/auth"
+)
+
+type fakeDB struct {
+	Database
+
+	mu          sync.Mutex
+	deployments []AppDefinition
+	repos       []InstalledRepository
+	envs        map[string][]AppEnv
+	deployKeys  map[string]string
+	// orgRepos are the repos of the organization installations, they are listed for the installation members only
+	orgRepos []InstalledRepository
+	// members holds the member logins by the installation id
+	members map[int][]string
+	// statusWrites counts the status update calls
+	statusWrites int
+	// feedTokens holds the feed token hashes by the app id
+	feedTokens map[string]string
+	// appEvents are the app history events in the append order
+	appEvents []AppEvent
+	// installationPermissions holds the latest token permissions by the installation id
+	installationPermissions map[int]InstallationPermissions
+}
+
+func (d *fakeDB) AppendAppEvent(ctx context.Context, event AppEvent) (AppEvent, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	event.Version = 1
+	for _, stored := range d.appEvents {
+		if stored.AppID == event.AppID {
+			event.Version = stored.Version + 1
+		}
+	}
+	event.Config.Envs = slices.Clone(event.Config.Envs)
+	event.CreatedAt = now()
+	d.appEvents = append(d.appEvents, event)
+	return event, nil
+}
+
+func (d *fakeDB) GetAppEvents(ctx context.Context, appID string) ([]AppEvent, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var events []AppEvent
+	for _, event := range d.appEvents {
+		if event.AppID == appID {
+			event.Config.Envs = slices.Clone(event.Config.Envs)
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (d *fakeDB) SetAppFeedToken(ctx context.Context, appID, tokenHash string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.feedTokens == nil {
+		d.feedTokens = make(map[string]string)
+	}
+	d.feedTokens[appID] = tokenHash
+	return nil
+}
+
+func (d *fakeDB) GetAppFeedToken(ctx context.Context, appID string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tokenHash, ok := d.feedTokens[appID]
+	if !ok {
+		return "", ErrFeedTokenNotFound
+	}
+	return tokenHash, nil
+}
+
+func (d *fakeDB) GetDeploymentHistory(ctx context.Context, appID string) ([]AppDefinition, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var history []AppDefinition
+	for i := len(d.deployments) - 1; i >= 0; i-- {
+		if d.deployments[i].AppID == appID {
+			history = append(history, d.deployments[i])
+		}
+	}
+	return history, nil
+}
+
+func (d *fakeDB) ListDeployments(ctx context.Context, appID string) ([]AppDefinition, error) {
+	return d.GetDeploymentHistory(ctx, appID)
+}
+
+func (d *fakeDB) ListRecentDeployments(ctx context.Context, appID string, limit int) ([]AppDefinition, error) {
+	history, err := d.GetDeploymentHistory(ctx, appID)
+	return history[:min(len(history), limit)], err
+}
+
+func (d *fakeDB) DeleteDeployments(ctx context.Context, ids []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deployments = slices.DeleteFunc(d.deployments, func(def AppDefinition) bool {
+		return slices.Contains(ids, def.ID)
+	})
+	return nil
+}
+
+func (d *fakeDB) GetGithubRepos(ctx context.Context, email string) ([]InstalledRepository, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	login := strings.TrimSuffix(email, "@treenq.com")
+	repos := slices.Clone(d.repos)
+	for _, repo := range d.orgRepos {
+		if slices.Contains(d.members[repo.InstallationID], login) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+func (d *fakeDB) AddInstallationMember(ctx context.Context, installationID int, login string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.members == nil {
+		d.members = make(map[int][]string)
+	}
+	if !slices.Contains(d.members[installationID], login) {
+		d.members[installationID] = append(d.members[installationID], login)
+	}
+	return nil
+}
+
+func (d *fakeDB) RemoveInstallationMember(ctx context.Context, installationID int, login string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.members[installationID] = slices.DeleteFunc(d.members[installationID], func(member string) bool {
+		return member == login
+	})
+	return nil
+}
+
+func (d *fakeDB) SaveInstallationPermissions(ctx context.Context, installationID int, permissions InstallationPermissions) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.installationPermissions == nil {
+		d.installationPermissions = make(map[int]InstallationPermissions)
+	}
+	d.installationPermissions[installationID] = permissions
+	return nil
+}
+
+func (d *fakeDB) GetRepoByGithub(ctx context.Context, githubRepoID int) (InstalledRepository, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, repo := range d.repos {
+		if repo.ID == githubRepoID {
+			return repo, nil
+		}
+	}
+	return InstalledRepository{}, ErrRepoNotFound
+}
+
+func (d *fakeDB) GetReposWithoutBranch(ctx context.Context) ([]InstalledRepository, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var repos []InstalledRepository
+	for _, repo := range d.repos {
+		if repo.Branch == "" {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+func (d *fakeDB) ConnectRepoBranch(ctx context.Context, repoID int, branch string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.repos {
+		if d.repos[i].ID == repoID {
+			d.repos[i].Branch = branch
+			return nil
+		}
+	}
+	return ErrRepoNotFound
+}
+
+func (d *fakeDB) GetAppEnvs(ctx context.Context, appID string) ([]AppEnv, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.envs[appID]), nil
+}
+
+func (d *fakeDB) SetAppEnvs(ctx context.Context, appID, environment string, envs []AppEnv, remove []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.envs == nil {
+		d.envs = make(map[string][]AppEnv)
+	}
+	current := slices.DeleteFunc(d.envs[appID], func(env AppEnv) bool {
+		if env.Environment != environment {
+			return false
+		}
+		return slices.Contains(remove, env.Key) || slices.ContainsFunc(envs, func(e AppEnv) bool { return e.Key == env.Key })
+	})
+	for _, env := range envs {
+		env.Environment = environment
+		current = append(current, env)
+	}
+	d.envs[appID] = current
+	return nil
+}
+
+func (d *fakeDB) SaveDeployment(ctx context.Context, def AppDefinition) (AppDefinition, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if def.ID == "" {
+		def.ID = fmt.Sprintf("deployment-%d", len(d.deployments)+1)
+	}
+	if def.CreatedAt.IsZero() {
+		def.CreatedAt = now()
+	}
+	if def.Status.Terminal() {
+		def.FinishedAt = def.CreatedAt
+	}
+	d.deployments = append(d.deployments, def)
+	return def, nil
+}
+
+func (d *fakeDB) GetDeployment(ctx context.Context, id string) (AppDefinition, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, def := range d.deployments {
+		if def.ID == id {
+			return def, nil
+		}
+	}
+	return AppDefinition{}, ErrDeploymentNotFound
+}
+
+func (d *fakeDB) UpdateDeploymentStatus(ctx context.Context, id string, status DeploymentStatus) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statusWrites++
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].Status = status
+			if status.Terminal() {
+				d.deployments[i].FinishedAt = now()
+			}
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) UpdateDeploymentStatuses(ctx context.Context, statuses map[string]DeploymentStatus) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statusWrites++
+	for i := range d.deployments {
+		if status, ok := statuses[d.deployments[i].ID]; ok && !d.deployments[i].Status.Terminal() {
+			d.deployments[i].Status = status
+		}
+	}
+	return nil
+}
+
+func (d *fakeDB) FailDeployment(ctx context.Context, id string, failure DeploymentFailure) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].Status = DeploymentStatusFailed
+			d.deployments[i].Failure = &failure
+			d.deployments[i].FinishedAt = now()
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) SaveMigrationLogs(ctx context.Context, id string, logs string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].MigrationLogs = logs
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) SetDeploymentEnv(ctx context.Context, id string, env map[string][]EnvVar) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].Env = env
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) SetDeploymentObjects(ctx context.Context, id string, objects []ObjectRef) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].Objects = objects
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) SetPromotionExpiresAt(ctx context.Context, id string, expiresAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].PromotionExpiresAt = expiresAt
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) AddTimelineEvent(ctx context.Context, id string, event TimelineEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.deployments {
+		if d.deployments[i].ID == id {
+			d.deployments[i].Timeline = append(d.deployments[i].Timeline, event)
+			return nil
+		}
+	}
+	return ErrDeploymentNotFound
+}
+
+func (d *fakeDB) RenameGithubRepo(ctx context.Context, repoID int, fullName string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.repos {
+		if d.repos[i].ID == repoID {
+			d.repos[i].FullName = fullName
+			return nil
+		}
+	}
+	return ErrRepoNotFound
+}
+
+func (d *fakeDB) SetRepoDeployKey(ctx context.Context, appID, privateKey string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.deployKeys == nil {
+		d.deployKeys = make(map[string]string)
+	}
+	d.deployKeys[appID] = privateKey
+	for i := range d.repos {
+		if d.repos[i].TreenqID == appID {
+			d.repos[i].AuthType = RepoAuthDeployKey
+		}
+	}
+	return nil
+}
+
+func (d *fakeDB) GetRepoDeployKey(ctx context.Context, appID string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key, ok := d.deployKeys[appID]
+	if !ok {
+		return "", ErrDeployKeyNotFound
+	}
+	return key, nil
+}
+
+func (d *fakeDB) deployment(t *testing.T, id string) AppDefinition {
+	def, err := d.GetDeployment(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get deployment %s: %v", id, err)
+	}
+	return def
+}
+
+func (d *fakeDB) LinkGithub(ctx context.Context, installationID int, senderLogin string, repos []InstalledRepository) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, repo := range repos {
+		repo.TreenqID = fmt.Sprintf("app-%d", repo.ID)
+		d.repos = append(d.repos, repo)
+	}
+	return nil
+}
+
+type fakeGithubClient struct {
+	GithubCleint
+
+	// defaultBranches holds the repos default branch by the full name
+	defaultBranches map[string]string
+	// installationRepos are all the repos of the installation
+	installationRepos []Repository
+	// branchTips holds the current branch tips by the repo full name and branch, e.g. treenq/treenq:main
+	branchTips map[string]string
+	// tokenPermissions are granted to the issued tokens, the contents are readable if it's nil
+	tokenPermissions map[string]string
+}
+
+func (c *fakeGithubClient) IssueAccessToken(installationID int) (InstallationToken, error) {
+	permissions := c.tokenPermissions
+	if permissions == nil {
+		permissions = map[string]string{"contents": "read", "metadata": "read"}
+	}
+	return InstallationToken{Token: "ghs_token", Permissions: permissions, RepositorySelection: "selected"}, nil
+}
+
+func (c *fakeGithubClient) ListInstallationRepos(installationID int) ([]Repository, error) {
+	return c.installationRepos, nil
+}
+
+func (c *fakeGithubClient) GetRepository(installationID int, fullName string) (Repository, error) {
+	branch, ok := c.defaultBranches[fullName]
+	if !ok {
+		return Repository{}, fmt.Errorf("repository %s not found", fullName)
+	}
+	return Repository{FullName: fullName, DefaultBranch: branch}, nil
+}
+
+func (c *fakeGithubClient) GetBranchSha(installationID int, fullName, branch string) (string, error) {
+	sha, ok := c.branchTips[fullName+":"+branch]
+	if !ok {
+		return "", fmt.Errorf("branch %s of %s not found", branch, fullName)
+	}
+	return sha, nil
+}
+
+type fakeGit struct {
+	mu         sync.Mutex
+	dir        string
+	archiveErr error
+	archives   [][]byte
+	clones     int
+	// cloneIDs and dirs are the passed clone ids and the returned repo dirs
+	cloneIDs []string
+	dirs     []string
+	// urls and creds are the cloned urls and the credentials as they are passed
+	urls  []string
+	creds []CloneCredentials
+	// deployKeys holds the passed deploy keys to check they are wiped after the clone
+	deployKeys [][]byte
+	// clone fails the clone of the url if it returns an error
+	clone func(url string) error
+}
+
+func (g *fakeGit) Clone(url string, installationID, repoID int, cloneID string, creds CloneCredentials) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clones++
+	g.urls = append(g.urls, url)
+	g.cloneIDs = append(g.cloneIDs, cloneID)
+	g.deployKeys = append(g.deployKeys, creds.DeployKey)
+	creds.DeployKey = slices.Clone(creds.DeployKey)
+	g.creds = append(g.creds, creds)
+	if g.clone != nil {
+		if err := g.clone(url); err != nil {
+			return "", err
+		}
+	}
+	dir, err := g.sourceDir()
+	g.dirs = append(g.dirs, dir)
+	return dir, err
+}
+
+func (g *fakeGit) ExtractArchive(archive io.Reader, maxSize int64) (string, error) {
+	data, err := io.ReadAll(archive)
+	if err != nil {
+		return "", err
+	}
+	g.archives = append(g.archives, data)
+	if g.archiveErr != nil {
+		return "", g.archiveErr
+	}
+	return g.sourceDir()
+}
+
+// sourceDir copies the repo files into a new dir, the callers remove the returned dir once deployed
+func (g *fakeGit) sourceDir() (string, error) {
+	dir, err := os.MkdirTemp("", "source-")
+	if err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(g.dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(g.dir, entry.Name()))
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, entry.Name()), data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+type fakeExtractor struct {
+	mu    sync.Mutex
+	space tqsdk.Space
+	// environmentSpaces are the spaces of the environment configs by the environment name
+	environmentSpaces map[string]tqsdk.Space
+	extractions       int
+	environments      []string
+	// err fails every extraction, e.g. the repo has no config
+	err error
+	// extract is called on every extraction before it's done, e.g. to block it
+	extract func()
+	// opened and closed are the extractor ids
+	opened []string
+	closed []string
+}
+
+func (e *fakeExtractor) Open() (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := fmt.Sprintf("extractor-%d", len(e.opened)+1)
+	e.opened = append(e.opened, id)
+	return id, nil
+}
+
+func (e *fakeExtractor) ExtractConfig(id, repoDir, environment string) (ExtractedConfig, error) {
+	if e.extract != nil {
+		e.extract()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.extractions++
+	e.environments = append(e.environments, environment)
+	if e.err != nil {
+		return ExtractedConfig{}, e.err
+	}
+	if space, ok := e.environmentSpaces[environment]; ok {
+		return ExtractedConfig{Space: space, Path: "tq." + environment}, nil
+	}
+	return ExtractedConfig{Space: e.space, Path: "tq"}, nil
+}
+
+func (e *fakeExtractor) Close(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = append(e.closed, id)
+	return nil
+}
+
+type fakeDocker struct {
+	build func(ctx context.Context, args BuildArtifactRequest) (Image, error)
+	push  func(ctx context.Context, image Image) (Image, error)
+	// builders are the available builder names
+	builders []string
+	// buildpacks enables the buildpack builds
+	buildpacks bool
+	// metrics are returned by every build
+	metrics BuildMetrics
+	// existing are the repositories of the images built already
+	existing []string
+	// registryDigests are the digests of the pushed tags and repoDigests are the local image digests,
+	// both by the image full path
+	registryDigests map[string]string
+	repoDigests     map[string][]string
+
+	mu      sync.Mutex
+	builds  []BuildArtifactRequest
+	pushes  []Image
+	removed []Image
+}
+
+func (d *fakeDocker) Image(args BuildArtifactRequest) Image {
+	return Image{Registry: "registry", Repository: args.Name, Tag: args.Tag}
+}
+
+func (d *fakeDocker) Push(ctx context.Context, image Image) (Image, error) {
+	d.mu.Lock()
+	d.pushes = append(d.pushes, image)
+	d.mu.Unlock()
+	if d.push != nil {
+		return d.push(ctx, image)
+	}
+	image.Digest = "sha256:" + image.Repository
+	return image, nil
+}
+
+func (d *fakeDocker) Remove(ctx context.Context, image Image) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removed = append(d.removed, image)
+	return nil
+}
+
+func (d *fakeDocker) Exists(ctx context.Context, image Image) (bool, error) {
+	return slices.Contains(d.existing, image.Repository), nil
+}
+
+func (d *fakeDocker) RegistryDigest(ctx context.Context, image Image) (string, error) {
+	return d.registryDigests[image.FullPath()], nil
+}
+
+func (d *fakeDocker) RepoDigests(ctx context.Context, image Image) ([]string, error) {
+	return d.repoDigests[image.FullPath()], nil
+}
+
+func (d *fakeDocker) HasBuilder(name string) bool {
+	return slices.Contains(d.builders, name)
+}
+
+func (d *fakeDocker) HasBuildpacks() bool {
+	return d.buildpacks
+}
+
+func (d *fakeDocker) Build(ctx context.Context, args BuildArtifactRequest) (Image, BuildMetrics, error) {
+	d.mu.Lock()
+	d.builds = append(d.builds, args)
+	d.mu.Unlock()
+	if d.build != nil {
+		image, err := d.build(ctx, args)
+		return image, d.metrics, err
+	}
+	return d.Image(args), d.metrics, nil
+}
+
+type fakeRegistry struct {
+	// missing holds the paths of the images the registry doesn't hold, a pushed image is referred by its digest
+	missing []string
+
+	mu      sync.Mutex
+	checked []Image
+}
+
+func (r *fakeRegistry) ManifestExists(ctx context.Context, image Image) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checked = append(r.checked, image)
+	return !slices.Contains(r.missing, image.PullPath()), nil
+}
+
+type fakeSigner struct {
+	err error
+
+	mu     sync.Mutex
+	signed []Image
+}
+
+func (s *fakeSigner) Sign(ctx context.Context, image Image) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return "", s.err
+	}
+	s.signed = append(s.signed, image)
+	return image.DigestPath() + ".sig", nil
+}
+
+type fakeKube struct {
+	apply      func(ctx context.Context, data string) error
+	migrations func(ctx context.Context, job MigrationJob) (string, error)
+	waitReady  func(ctx context.Context, data string) error
+	plan       func(data string) []ObjectPlan
+
+	// objects are defined along with the Deployment of every app, missingAPIs are the kinds the cluster doesn't serve
+	objects     []ObjectRef
+	missingAPIs []APIKind
+
+	mu      sync.Mutex
+	applied []string
+	// defined holds the last defined space by the deployment id, images hold the images it's defined with
+	defined map[string]tqsdk.Space
+	images  map[string]map[string]Image
+	// events holds the recorded events by the deployment id
+	events map[string][]KubeEvent
+	// resources are the live objects by the app id
+	resources map[string][]KubeResource
+	// workloads are the live Deployments by the namespace/name, an imported workload is labeled with the app id
+	workloads map[string]Workload
+	imported  map[string]string
+	// calls logs the cluster changing calls in order
+	calls []string
+	jobs  []MigrationJob
+}
+
+func (k *fakeKube) DefineApp(ctx context.Context, id, appID string, app tqsdk.Space, images map[string]Image) string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.defined == nil {
+		k.defined = make(map[string]tqsdk.Space)
+		k.images = make(map[string]map[string]Image)
+	}
+	k.defined[id] = app
+	k.images[id] = images
+	return id
+}
+
+func (k *fakeKube) Apply(ctx context.Context, rawConig, data string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.applied = append(k.applied, data)
+	k.calls = append(k.calls, "apply")
+	if k.apply != nil {
+		return k.apply(ctx, data)
+	}
+	return nil
+}
+
+// DefinedObjects refers a Deployment named after the defined deployment id followed by the objects
+func (k *fakeKube) DefinedObjects(data string) ([]ObjectRef, error) {
+	return append([]ObjectRef{{APIVersion: "apps/v1", Kind: "Deployment", Namespace: data + "-space", Name: data}}, k.objects...), nil
+}
+
+func (k *fakeKube) MissingAPIs(ctx context.Context, rawConig string, kinds []APIKind) ([]APIKind, error) {
+	var missing []APIKind
+	for _, kind := range kinds {
+		if slices.Contains(k.missingAPIs, kind) {
+			missing = append(missing, kind)
+		}
+	}
+	return missing, nil
+}
+
+func (k *fakeKube) ApplyPaused(ctx context.Context, rawConig, data string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.applied = append(k.applied, data)
+	k.calls = append(k.calls, "apply paused")
+	return nil
+}
+
+func (k *fakeKube) RouteTraffic(ctx context.Context, rawConig, data string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.calls = append(k.calls, "route traffic")
+	return nil
+}
+
+func (k *fakeKube) RecordEvent(ctx context.Context, rawConig, data string, event KubeEvent) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.events == nil {
+		k.events = make(map[string][]KubeEvent)
+	}
+	k.events[data] = append(k.events[data], event)
+	return nil
+}
+
+func (k *fakeKube) SetMaintenance(ctx context.Context, rawConig, data string, enabled bool) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if enabled {
+		k.calls = append(k.calls, "maintenance on")
+	} else {
+		k.calls = append(k.calls, "maintenance off")
+	}
+	return nil
+}
+
+func (k *fakeKube) WaitReady(ctx context.Context, rawConig, data string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.calls = append(k.calls, "wait ready")
+	if k.waitReady != nil {
+		return k.waitReady(ctx, data)
+	}
+	return nil
+}
+
+func (k *fakeKube) RunMigrations(ctx context.Context, rawConig string, job MigrationJob) (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.jobs = append(k.jobs, job)
+	k.calls = append(k.calls, "migrations")
+	if k.migrations != nil {
+		return k.migrations(ctx, job)
+	}
+	return "migrated", nil
+}
+
+func (k *fakeKube) PlanApp(ctx context.Context, rawConig, data string) ([]ObjectPlan, error) {
+	if k.plan != nil {
+		return k.plan(data), nil
+	}
+	return nil, nil
+}
+
+func (k *fakeKube) GetResources(ctx context.Context, rawConig, appID string) ([]KubeResource, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.resources[appID], nil
+}
+
+func (k *fakeKube) ImportWorkload(ctx context.Context, rawConig, namespace, name, appID string) (Workload, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	workload, ok := k.workloads[namespace+"/"+name]
+	if !ok {
+		return Workload{}, ErrWorkloadNotFound
+	}
+	if k.imported == nil {
+		k.imported = make(map[string]string)
+	}
+	k.imported[namespace+"/"+name] = appID
+	return workload, nil
+}
+
+const testAppID = "9b1f7c2e-3d4a-4b8e-9f6a-1c2d3e4f5a6b"
+
+type testHandler struct {
+	*Handler
+
+	db        *fakeDB
+	github    *fakeGithubClient
+	git       *fakeGit
+	extractor *fakeExtractor
+	docker    *fakeDocker
+	kube      *fakeKube
+}
+
+func newTestHandler(t *testing.T, space tqsdk.Space) *testHandler {
+	repoDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repoDir, "Dockerfile"), []byte("FROM scratch"), 0644); err != nil {
+		t.Fatalf("failed to write Dockerfile: %v", err)
+	}
+
+	th := &testHandler{
+		db: &fakeDB{
+			repos: []InstalledRepository{{
+				TreenqID: testAppID,
+				ID:       805585115,
+				FullName: "treenq/treenq",
+				Branch:   "main",
+			}},
+		},
+		github:    &fakeGithubClient{},
+		git:       &fakeGit{dir: repoDir},
+		extractor: &fakeExtractor{space: space},
+		docker:    &fakeDocker{},
+		kube:      &fakeKube{},
+	}
+	th.Handler = &Handler{
+		db:           th.db,
+		githubClient: th.github,
+		git:          th.git,
+		extractors:   newExtractorPool(th.extractor, 0),
+		docker:       th.docker,
+		kube:         th.kube,
+		approvalTtl:  time.Hour,
+		promotionTtl: time.Hour,
+		debouncer:    newDebouncer(),
+		runs:         newDeployRuns(),
+		builds:       newSlots(0),
+		pushes:       newSlots(0),
+		l:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	return th
+}
+
+// pushRequest is a push to the default branch of a public repo
+func pushRequest() GithubWebhookRequest {
+	return GithubWebhookRequest{
+		After:        "64263a02d293b1d4ec638ed98d3f3a93f0f788cb",
+		Installation: Installation{ID: 1},
+		Sender:       Sender{Login: "testing"},
+		Ref:          "refs/heads/main",
+		Repository: Repository{
+			ID:       805585115,
+			FullName: "treenq/treenq",
+		},
+	}
+}
+
+func userCtx(login string) context.Context {
+	return auth.ClaimsToCtx(context.Background(), map[string]interface{}{
+		"id":          "user-" + login,
+		"email":       login + "@treenq.com",
+		"displayName": login,
+	})
+}
@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ImageNotFoundError is returned if the registry doesn't hold a deployed image,
+// e.g. the push has silently failed or the digest is wrong
+type ImageNotFoundError struct {
+	Service string
+	Image   Image
+}
+
+func (e *ImageNotFoundError) Error() string {
+	return fmt.Sprintf("image %s of service %s is not found in the registry", e.Image.PullPath(), e.Service)
+}
+
+// verifyImages checks the registry holds every image the cluster is going to pull
+func (h *Handler) verifyImages(ctx context.Context, images map[string]Image) error {
+	if h.registry == nil {
+		return nil
+	}
+	for _, service := range slices.Sorted(maps.Keys(images)) {
+		image := images[service]
+		exists, err := h.registry.ManifestExists(ctx, image)
+		if err != nil {
+			return SystemFailure(fmt.Errorf("failed to check image of service %s: %w", service, err))
+		}
+		if !exists {
+			return SystemFailure(&ImageNotFoundError{Service: service, Image: image})
+		}
+	}
+	return nil
+}
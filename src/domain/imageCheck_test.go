@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookChecksImagesBeforeApply(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	registry := &fakeRegistry{}
+	th.registry = registry
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, registry.checked, 1)
+	assert.Equal(t, "sha256:api", registry.checked[0].Digest, "the pushed digest is checked")
+	assert.Len(t, th.kube.applied, 1)
+}
+
+func TestGithubWebhookMissingImageIsNotApplied(t *testing.T) {
+	th := newTestHandler(t, migrationsSpace())
+	th.registry = &fakeRegistry{missing: []string{"registry/api@sha256:api"}}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "IMAGE_NOT_FOUND", rpcErr.Code)
+
+	assert.Empty(t, th.kube.calls, "neither the migrations nor the objects are applied")
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageApply, def.Failure.Stage)
+	assert.Equal(t, FailureClassSystem, def.Failure.Class)
+}
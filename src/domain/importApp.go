@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+var ErrWorkloadNotFound = errors.New("workload not found")
+
+// Workload is a live Deployment created apart from treenq
+type Workload struct {
+	Namespace string
+	Name      string
+	// Image, HttpPort and Envs are taken from the first container of the pod template
+	Image    string
+	HttpPort int
+	Replicas int
+	// Envs are the plain env values, the envs referring secrets or fields aren't imported
+	Envs map[string]string
+}
+
+type ImportAppRequest struct {
+	AppID string `json:"appId"`
+	// Namespace and Name refer the live Deployment to import
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type ImportAppResponse struct {
+	DeploymentID string      `json:"deploymentId"`
+	Space        tqsdk.Space `json:"space"`
+}
+
+// ImportApp adopts a live Deployment as the running app deployment: the space is derived from the Deployment
+// and its objects are labeled as owned by treenq, the running pods are kept as is.
+// The next push deploys the repo config as usual.
+func (h *Handler) ImportApp(ctx context.Context, req ImportAppRequest) (ImportAppResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return ImportAppResponse{}, rpcErr
+	}
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return ImportAppResponse{}, rpcErr
+	}
+
+	workload, err := h.kube.ImportWorkload(ctx, h.kubeConfig, req.Namespace, req.Name, req.AppID)
+	if err != nil {
+		if errors.Is(err, ErrWorkloadNotFound) {
+			return ImportAppResponse{}, &vel.Error{
+				Code:    "WORKLOAD_NOT_FOUND",
+				Message: err.Error(),
+			}
+		}
+		return ImportAppResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	space := workloadSpace(workload)
+	def, err := h.db.SaveDeployment(ctx, AppDefinition{
+		AppID:        req.AppID,
+		App:          space,
+		Tag:          imageTag(workload.Image),
+		User:         profile.UserInfo.DisplayName,
+		Status:       DeploymentStatusDeployed,
+		ImportedFrom: workload.Namespace + "/" + workload.Name,
+	})
+	if err != nil {
+		return ImportAppResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	return ImportAppResponse{DeploymentID: def.ID, Space: space}, nil
+}
+
+// workloadSpace is the space running the workload, the namespace stands for the space key
+func workloadSpace(workload Workload) tqsdk.Space {
+	return tqsdk.Space{
+		Key: workload.Namespace,
+		Service: tqsdk.Service{
+			Name:        workload.Name,
+			HttpPort:    workload.HttpPort,
+			Replicas:    workload.Replicas,
+			RuntimeEnvs: workload.Envs,
+		},
+	}
+}
+
+// imageTag returns the tag of the image reference, latest is implied if it's not set
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return "latest"
+	}
+	return image[i+1:]
+}
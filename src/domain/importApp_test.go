@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestImportAppAdoptsLiveDeployment(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	th.kube.workloads = map[string]Workload{"legacy/api": {
+		Namespace: "legacy",
+		Name:      "api",
+		Image:     "registry.local:5000/api:v1.2.0",
+		HttpPort:  8000,
+		Replicas:  3,
+		Envs:      map[string]string{"LOG_LEVEL": "debug"},
+	}}
+
+	res, rpcErr := th.ImportApp(userCtx("testing"), ImportAppRequest{AppID: testAppID, Namespace: "legacy", Name: "api"})
+	require.Nil(t, rpcErr)
+
+	want := tqsdk.Space{Key: "legacy", Service: tqsdk.Service{
+		Name:        "api",
+		HttpPort:    8000,
+		Replicas:    3,
+		RuntimeEnvs: map[string]string{"LOG_LEVEL": "debug"},
+	}}
+	assert.Equal(t, want, res.Space)
+	assert.Equal(t, testAppID, th.kube.imported["legacy/api"], "the live objects are labeled with the app")
+	assert.Empty(t, th.kube.applied, "the running pods are kept")
+
+	def := th.db.deployment(t, res.DeploymentID)
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, want, def.App)
+	assert.Equal(t, "v1.2.0", def.Tag)
+	assert.Equal(t, "legacy/api", def.ImportedFrom)
+}
+
+func TestImportAppWorkloadNotFound(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+
+	_, rpcErr := th.ImportApp(userCtx("testing"), ImportAppRequest{AppID: testAppID, Namespace: "legacy", Name: "api"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "WORKLOAD_NOT_FOUND", rpcErr.Code)
+	assert.Empty(t, th.db.deployments)
+}
+
+func TestImageTag(t *testing.T) {
+	assert.Equal(t, "v1", imageTag("api:v1"))
+	assert.Equal(t, "latest", imageTag("registry.local:5000/api"))
+	assert.Equal(t, "v1", imageTag("registry.local:5000/api:v1@sha256:abc"))
+}
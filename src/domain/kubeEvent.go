@@ -0,0 +1,40 @@
+package domain
+
+import "context"
+
+type KubeEventReason string
+
+const (
+	KubeEventDeployStarted   KubeEventReason = "DeployStarted"
+	KubeEventDeploySucceeded KubeEventReason = "DeploySucceeded"
+	KubeEventDeployFailed    KubeEventReason = "DeployFailed"
+)
+
+// KubeEvent is a kubernetes Event treenq records on the app objects,
+// so the deployment progress is visible with kubectl describe
+type KubeEvent struct {
+	Reason  KubeEventReason
+	Message string
+	// Warning sets the Warning event type instead of Normal
+	Warning bool
+}
+
+// recordEvent records the event on the applied app objects,
+// the events are informational, a failed record doesn't fail the deployment
+func (h *Handler) recordEvent(ctx context.Context, appKubeDef string, event KubeEvent) {
+	if appKubeDef == "" {
+		return
+	}
+	if err := h.kube.RecordEvent(ctx, h.kubeConfig, appKubeDef, event); err != nil {
+		h.l.WarnContext(ctx, "failed to record kube event", "reason", event.Reason, "err", err)
+	}
+}
+
+func (h *Handler) recordFailedEvent(ctx context.Context, appKubeDef string, stage DeploymentStage, err error) {
+	failure := newDeploymentFailure(stage, err)
+	h.recordEvent(ctx, appKubeDef, KubeEvent{
+		Reason:  KubeEventDeployFailed,
+		Message: string(stage) + ": " + failure.Message,
+		Warning: true,
+	})
+}
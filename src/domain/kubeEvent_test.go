@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func eventReasons(events []KubeEvent) []KubeEventReason {
+	reasons := make([]KubeEventReason, len(events))
+	for i := range events {
+		reasons[i] = events[i].Reason
+	}
+	return reasons
+}
+
+func TestDeploySucceededEventRecorded(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	events := th.kube.events[def.ID]
+	assert.Equal(t, []KubeEventReason{KubeEventDeployStarted, KubeEventDeploySucceeded}, eventReasons(events))
+	assert.False(t, events[1].Warning)
+	assert.Contains(t, events[1].Message, def.ID)
+}
+
+func TestDeployFailedEventRecorded(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.kube.apply = func(ctx context.Context, data string) error {
+		return UserFailure(errors.New("Deployment.apps is invalid: spec.replicas: Invalid value: -1"))
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	events := th.kube.events[def.ID]
+	require.Equal(t, []KubeEventReason{KubeEventDeployStarted, KubeEventDeployFailed}, eventReasons(events), "the started event precedes the failed apply")
+	assert.True(t, events[1].Warning)
+	assert.Contains(t, events[1].Message, "spec.replicas")
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func hasMaintenanceMode(space tqsdk.Space) bool {
+	for _, service := range space.AllServices() {
+		if service.MaintenanceMode {
+			return true
+		}
+	}
+	return false
+}
+
+// applyInMaintenance routes the maintenance mode services to the maintenance page,
+// applies the objects and restores the traffic once the new version is ready.
+// The traffic is restored even if the deployment fails, the app must not stay on the maintenance page.
+func (h *Handler) applyInMaintenance(ctx context.Context, appKubeDef string) (err error) {
+	if err := h.kube.SetMaintenance(ctx, h.kubeConfig, appKubeDef, true); err != nil {
+		return err
+	}
+	defer func() {
+		if restoreErr := h.kube.SetMaintenance(context.WithoutCancel(ctx), h.kubeConfig, appKubeDef, false); restoreErr != nil {
+			err = errors.Join(err, restoreErr)
+		}
+	}()
+
+	if err := h.kube.Apply(ctx, h.kubeConfig, appKubeDef); err != nil {
+		return err
+	}
+	return h.kube.WaitReady(ctx, h.kubeConfig, appKubeDef)
+}
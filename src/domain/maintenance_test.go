@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookDeploysInMaintenanceMode(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", MaintenanceMode: true}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"maintenance on", "apply", "wait ready", "maintenance off"}, th.kube.calls)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+}
+
+func TestGithubWebhookRestoresMaintenanceOnFailure(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", MaintenanceMode: true}})
+	th.kube.apply = func(ctx context.Context, data string) error {
+		return UserFailure(errors.New("invalid object"))
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	assert.Equal(t, []string{"maintenance on", "apply", "maintenance off"}, th.kube.calls)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageApply, def.Failure.Stage)
+}
+
+func TestGithubWebhookSkipsMaintenanceByDefault(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"apply"}, th.kube.calls)
+}
@@ -0,0 +1,44 @@
+package domain
+
+import "context"
+
+// OrgMembership is the membership of the organization event
+type OrgMembership struct {
+	User Sender `json:"user"`
+}
+
+// MemberChange is a change of the github user access to the organization installation
+type MemberChange struct {
+	Login   string
+	Granted bool
+}
+
+// MemberChange returns the access change of the organization or team membership event.
+// A member removed from a team stays in the organization, so only the organization event revokes the access.
+func (g GithubWebhookRequest) MemberChange() (MemberChange, bool) {
+	if g.Membership != nil {
+		switch g.Action {
+		case "member_added":
+			return MemberChange{Login: g.Membership.User.Login, Granted: true}, true
+		case "member_removed":
+			return MemberChange{Login: g.Membership.User.Login}, true
+		}
+		return MemberChange{}, false
+	}
+	if g.Scope == "team" && g.Member != nil && g.Action == "added" {
+		return MemberChange{Login: g.Member.Login, Granted: true}, true
+	}
+	return MemberChange{}, false
+}
+
+// syncMember grants or revokes the access of the member to the apps of the installation
+func (h *Handler) syncMember(ctx context.Context, installationID int, change MemberChange) error {
+	if change.Login == "" {
+		return nil
+	}
+	h.l.InfoContext(ctx, "installation member changed", "installationID", installationID, "login", change.Login, "granted", change.Granted)
+	if change.Granted {
+		return h.db.AddInstallationMember(ctx, installationID, change.Login)
+	}
+	return h.db.RemoveInstallationMember(ctx, installationID, change.Login)
+}
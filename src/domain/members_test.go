@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// orgHandler is a handler with an app of the organization installation 7
+func orgHandler(t *testing.T) *testHandler {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.orgRepos = []InstalledRepository{{TreenqID: "org-app", ID: 42, FullName: "acme/api", InstallationID: 7}}
+	return th
+}
+
+func organizationEvent(action, login string) GithubWebhookRequest {
+	return GithubWebhookRequest{
+		Action:       action,
+		Installation: Installation{ID: 7, Account: InstallationAccount{Type: "Organization", Login: "acme"}},
+		Sender:       Sender{Login: "owner"},
+		Membership:   &OrgMembership{User: Sender{Login: login}},
+	}
+}
+
+func TestGithubWebhookMemberAddedGrantsAccess(t *testing.T) {
+	th := orgHandler(t)
+	_, rpcErr := th.GetAppResources(userCtx("alice"), GetAppResourcesRequest{AppID: "org-app"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+
+	_, rpcErr = th.GithubWebhook(context.Background(), organizationEvent("member_added", "alice"))
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.GetAppResources(userCtx("alice"), GetAppResourcesRequest{AppID: "org-app"})
+	assert.Nil(t, rpcErr)
+	assert.Zero(t, th.git.clones, "a membership event deploys nothing")
+}
+
+func TestGithubWebhookMemberRemovedRevokesAccess(t *testing.T) {
+	th := orgHandler(t)
+	th.db.members = map[int][]string{7: {"alice", "bob"}}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), organizationEvent("member_removed", "alice"))
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.GetAppResources(userCtx("alice"), GetAppResourcesRequest{AppID: "org-app"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+	_, rpcErr = th.GetAppResources(userCtx("bob"), GetAppResourcesRequest{AppID: "org-app"})
+	assert.Nil(t, rpcErr)
+}
+
+func TestTeamMembershipChange(t *testing.T) {
+	added := GithubWebhookRequest{Action: "added", Scope: "team", Member: &Sender{Login: "alice"}}
+	change, ok := added.MemberChange()
+	require.True(t, ok)
+	assert.Equal(t, MemberChange{Login: "alice", Granted: true}, change)
+
+	// the member removed from a team is still in the organization
+	removed := GithubWebhookRequest{Action: "removed", Scope: "team", Member: &Sender{Login: "alice"}}
+	_, ok = removed.MemberChange()
+	assert.False(t, ok)
+
+	// a repo added to the installation is not a membership change
+	_, ok = GithubWebhookRequest{Action: "added"}.MemberChange()
+	assert.False(t, ok)
+}
@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// defaultMigrationsTimeout limits the migrations Job without a timeout set by the space
+const defaultMigrationsTimeout = 10 * time.Minute
+
+// migrationLogsMaxSize limits the stored migration logs, the tail of longer logs is kept
+const migrationLogsMaxSize = 64 << 10
+
+// MigrationJob is a one-off Job run in the app namespace before the rollout
+type MigrationJob struct {
+	// ID is the deployment id, the Job is named after it so a deployment runs the migrations once
+	ID       string
+	AppID    string
+	SpaceKey string
+	Image    string
+	Command  []string
+	Envs     map[string]string
+	// RestartPolicy is the Job pod restart policy, Never if empty
+	RestartPolicy string
+	BackoffLimit  int
+}
+
+// runMigrations runs the space migrations Job and stores its logs on the deployment,
+// the deployment must not be rolled out if it fails
+func (h *Handler) runMigrations(ctx context.Context, def AppDefinition, images map[string]Image) error {
+	migrations := def.App.Migrations
+	if migrations == nil {
+		return nil
+	}
+	if def.SkipMigrations {
+		h.l.InfoContext(ctx, "migrations are skipped by the commit directive", "deploymentID", def.ID)
+		return nil
+	}
+
+	space, err := h.withAppEnv(ctx, def.AppID, def.Environment, def.App)
+	if err != nil {
+		return err
+	}
+	job, err := migrationJob(def.ID, def.AppID, space, images)
+	if err != nil {
+		return err
+	}
+
+	timeout := migrations.Timeout
+	if timeout <= 0 {
+		timeout = defaultMigrationsTimeout
+	}
+	jobCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	h.recordMilestone(ctx, def, MilestoneMigrationsStarted)
+	logs, err := h.kube.RunMigrations(jobCtx, h.kubeConfig, job)
+	if len(logs) > migrationLogsMaxSize {
+		logs = logs[len(logs)-migrationLogsMaxSize:]
+	}
+	if logs != "" {
+		if saveErr := h.db.SaveMigrationLogs(context.WithoutCancel(ctx), def.ID, logs); saveErr != nil {
+			h.l.ErrorContext(ctx, "failed to save migration logs", "deploymentID", def.ID, "err", saveErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("migrations failed: %w", err)
+	}
+	h.recordMilestone(ctx, def, MilestoneMigrationsFinished)
+	return nil
+}
+
+// migrationJob selects the image and envs of the service the migrations run with
+func migrationJob(id, appID string, space tqsdk.Space, images map[string]Image) (MigrationJob, error) {
+	migrations := space.Migrations
+	services := space.AllServices()
+	var service tqsdk.Service
+	for i := range services {
+		if migrations.Service == "" || services[i].Name == migrations.Service {
+			service = services[i]
+			break
+		}
+	}
+	if service.Name == "" {
+		return MigrationJob{}, UserFailure(fmt.Errorf("migrations service %q is not found", migrations.Service))
+	}
+
+	image := migrations.Image
+	if image == "" {
+		image = images[service.Name].PullPath()
+	}
+
+	return MigrationJob{
+		ID:       id,
+		AppID:    appID,
+		SpaceKey: space.Key,
+		Image:    image,
+		Command:  migrations.Command,
+		Envs:     service.RuntimeEnvs,
+
+		RestartPolicy: migrations.RestartPolicy,
+		BackoffLimit:  migrations.BackoffLimit,
+	}, nil
+}
+
+// jobRestartPolicies are the restart policies a Job pod may have
+var jobRestartPolicies = []string{"", "Never", "OnFailure"}
+
+// validateMigrations checks the migrations Job can be created, the cluster rejects a Job pod restarted always
+func validateMigrations(space tqsdk.Space) error {
+	migrations := space.Migrations
+	if migrations == nil {
+		return nil
+	}
+	if !slices.Contains(jobRestartPolicies, migrations.RestartPolicy) {
+		return UserFailure(fmt.Errorf("migrations restart policy %q is invalid, it must be Never or OnFailure", migrations.RestartPolicy))
+	}
+	if migrations.BackoffLimit < 0 {
+		return UserFailure(fmt.Errorf("migrations backoff limit %d must not be negative", migrations.BackoffLimit))
+	}
+	return nil
+}
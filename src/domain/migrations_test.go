@@ -0,0 +1,131 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func migrationsSpace() tqsdk.Space {
+	space := multiServiceSpace(0)
+	space.Services[0].RuntimeEnvs = map[string]string{"DB_DSN": "postgres://db"}
+	space.Migrations = &tqsdk.Migrations{Service: "worker", Command: []string{"./migrate", "up"}}
+	return space
+}
+
+func TestGithubWebhookRunsMigrationsBeforeRollout(t *testing.T) {
+	th := newTestHandler(t, migrationsSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"migrations", "apply"}, th.kube.calls)
+	require.Len(t, th.kube.jobs, 1)
+	job := th.kube.jobs[0]
+	def := th.db.deployments[0]
+	assert.Equal(t, MigrationJob{
+		ID:       def.ID,
+		AppID:    testAppID,
+		SpaceKey: "space",
+		Image:    "registry/worker@sha256:worker",
+		Command:  []string{"./migrate", "up"},
+		Envs:     map[string]string{"DB_DSN": "postgres://db"},
+	}, job)
+
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, "migrated", def.MigrationLogs)
+}
+
+func TestGithubWebhookRolloutAwaitsMigrationsSuccess(t *testing.T) {
+	space := migrationsSpace()
+	space.Service.Replicas = 3
+	th := newTestHandler(t, space)
+	th.kube.migrations = func(ctx context.Context, job MigrationJob) (string, error) {
+		// the Job is running, no new pod may start serving
+		assert.Empty(t, th.kube.applied)
+		return "migrated", nil
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"migrations", "apply"}, th.kube.calls)
+	assert.Len(t, th.kube.applied, 1)
+}
+
+func TestGithubWebhookFailedMigrationsBlockRollout(t *testing.T) {
+	th := newTestHandler(t, migrationsSpace())
+	th.kube.migrations = func(ctx context.Context, job MigrationJob) (string, error) {
+		return "relation users already exists", UserFailure(errors.New("migrations job failed"))
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	assert.Empty(t, th.kube.applied)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageMigrations, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.Equal(t, "relation users already exists", def.MigrationLogs)
+}
+
+func TestGithubWebhookSkipMigrationsDirective(t *testing.T) {
+	th := newTestHandler(t, migrationsSpace())
+	req := pushRequest()
+	req.HeadCommit.Message = "hotfix: nil pointer [skip migrations]"
+
+	_, rpcErr := th.GithubWebhook(context.Background(), req)
+	require.Nil(t, rpcErr)
+
+	assert.Empty(t, th.kube.jobs)
+	assert.Len(t, th.kube.applied, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.True(t, def.SkipMigrations)
+}
+
+func TestMigrationJobUnknownService(t *testing.T) {
+	space := migrationsSpace()
+	space.Migrations.Service = "billing"
+
+	_, err := migrationJob("id", testAppID, space, nil)
+	require.Error(t, err)
+	assert.Equal(t, FailureClassUser, classifyFailure(err))
+}
+
+func TestGithubWebhookRejectsAlwaysRestartedMigrations(t *testing.T) {
+	space := migrationsSpace()
+	space.Migrations.RestartPolicy = "Always"
+	th := newTestHandler(t, space)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	assert.Empty(t, th.kube.calls)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageExtract, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+}
+
+func TestMigrationJobRestartPolicyAndBackoff(t *testing.T) {
+	space := migrationsSpace()
+	space.Migrations.RestartPolicy = "OnFailure"
+	space.Migrations.BackoffLimit = 3
+	require.NoError(t, validateMigrations(space))
+
+	job, err := migrationJob("id", testAppID, space, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "OnFailure", job.RestartPolicy)
+	assert.Equal(t, 3, job.BackoffLimit)
+
+	space.Migrations.BackoffLimit = -1
+	assert.Equal(t, FailureClassUser, classifyFailure(validateMigrations(space)))
+}
@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"path"
+	"strings"
+)
+
+// pathsChanged reports whether a changed path matches the space path patterns,
+// no patterns or unknown changed paths deploy the push
+func pathsChanged(patterns, changed []string) bool {
+	if len(patterns) == 0 || changed == nil {
+		return true
+	}
+	for _, file := range changed {
+		for _, pattern := range patterns {
+			if matchPath(pattern, file) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchPath(pattern, file string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return strings.HasPrefix(file, dir+"/")
+	}
+	matched, err := path.Match(pattern, file)
+	return err == nil && matched
+}
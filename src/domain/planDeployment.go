@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// PlanAction tells what a deployment does with a cluster object
+type PlanAction string
+
+const (
+	PlanActionCreate    PlanAction = "create"
+	PlanActionUpdate    PlanAction = "update"
+	PlanActionUnchanged PlanAction = "unchanged"
+)
+
+// ObjectPlan is a change of a cluster object made by the deployment
+type ObjectPlan struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Namespace  string     `json:"namespace"`
+	Name       string     `json:"name"`
+	Action     PlanAction `json:"action"`
+}
+
+// ServicePlan is an image build of a service
+type ServicePlan struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// Cached reports the image is built already, its layers are reused by the build
+	Cached bool `json:"cached"`
+}
+
+type DeploymentPlan struct {
+	Environment     string        `json:"environment"`
+	RequireApproval bool          `json:"requireApproval"`
+	ConfigPath      string        `json:"configPath"`
+	Services        []ServicePlan `json:"services"`
+	Objects         []ObjectPlan  `json:"objects"`
+}
+
+type PlanDeploymentRequest struct {
+	AppID string `json:"appId"`
+	// Branch selects the space environment, the connected branch is used if empty
+	Branch string `json:"branch"`
+}
+
+type PlanDeploymentResponse struct {
+	Plan DeploymentPlan `json:"plan"`
+}
+
+// PlanDeployment is a preflight of the app deployment: it clones and extracts the repo,
+// nothing is built or applied. Every deployment creates its objects in a new namespace,
+// so the objects are compared with the objects of the running deployment the new one replaces.
+func (h *Handler) PlanDeployment(ctx context.Context, req PlanDeploymentRequest) (PlanDeploymentResponse, *vel.Error) {
+	ctx = withRedaction(ctx)
+	repo, rpcErr := h.appRepo(ctx, req.AppID)
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+	branch := req.Branch
+	if branch == "" {
+		branch = repo.Branch
+	}
+	// the images of the branch tip are tagged with its sha
+	_, sha, rpcErr := h.branchTip(repo, branch)
+	if rpcErr != nil {
+		return PlanDeploymentResponse{}, rpcErr
+	}
+
+	repoDir, err := h.cloneRepo(ctx, repo.InstallationID, repo, repo)
+	if err != nil {
+		return PlanDeploymentResponse{}, planError(err)
+	}
+	defer os.RemoveAll(repoDir)
+
+	config, err := h.extractSpace(ctx, req.AppID, repoDir, branch)
+	if err != nil {
+		return PlanDeploymentResponse{}, planError(err)
+	}
+	plan := DeploymentPlan{ConfigPath: config.Path}
+	env, _ := config.Space.Environment(branch)
+	plan.Environment = env.Name
+	plan.RequireApproval = env.RequireApproval
+
+	images := make(map[string]Image)
+	for _, service := range config.Space.AllServices() {
+		image := h.docker.Image(BuildArtifactRequest{Name: service.Name, Tag: shaTag(sha, false)})
+		cached, err := h.docker.Exists(ctx, image)
+		if err != nil {
+			return PlanDeploymentResponse{}, planError(err)
+		}
+		images[service.Name] = image
+		plan.Services = append(plan.Services, ServicePlan{Name: service.Name, Image: image.FullPath(), Cached: cached})
+	}
+
+	space, err := h.withAppEnv(ctx, req.AppID, env.Name, config.Space)
+	if err != nil {
+		return PlanDeploymentResponse{}, planError(err)
+	}
+	running, err := h.runningDeployment(ctx, req.AppID, env.Name)
+	if err != nil {
+		return PlanDeploymentResponse{}, planError(err)
+	}
+	id := running.ID
+	if id == "" {
+		// nothing is live, every object is created
+		id = "plan"
+	}
+	if err := h.resources.validate(space); err != nil {
+		return PlanDeploymentResponse{}, planError(err)
+	}
+	appKubeDef := h.kube.DefineApp(ctx, id, req.AppID, h.resources.apply(space), images)
+	plan.Objects, err = h.kube.PlanApp(ctx, h.kubeConfig, appKubeDef)
+	if err != nil {
+		return PlanDeploymentResponse{}, planError(err)
+	}
+
+	return PlanDeploymentResponse{Plan: plan}, nil
+}
+
+// runningDeployment returns the latest successful deployment of the environment,
+// a zero deployment is returned if the environment has never been deployed
+func (h *Handler) runningDeployment(ctx context.Context, appID, environment string) (AppDefinition, error) {
+	history, err := h.db.GetDeploymentHistory(ctx, appID)
+	if err != nil {
+		return AppDefinition{}, err
+	}
+	for _, def := range history {
+		if def.Status == DeploymentStatusDeployed && def.Environment == environment {
+			return def, nil
+		}
+	}
+	return AppDefinition{}, nil
+}
+
+// planError reports the failures caused by the app code or config apart from the rest
+func planError(err error) *vel.Error {
+	var insufficientErr *InsufficientPermissionsError
+	if errors.As(err, &insufficientErr) {
+		return &vel.Error{
+			Code:    "INSUFFICIENT_PERMISSIONS",
+			Message: err.Error(),
+		}
+	}
+	if classifyFailure(err) == FailureClassUser {
+		return &vel.Error{
+			Code:    "INVALID_APP_CONFIG",
+			Message: err.Error(),
+		}
+	}
+	return &vel.Error{
+		Code:    "UNKNOWN",
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestPlanDeployment(t *testing.T) {
+	space := multiServiceSpace(0)
+	space.Environments = []tqsdk.Environment{{Name: "production", Branch: "main", RequireApproval: true}}
+	th := newTestHandler(t, space)
+	th.db.repos[0].Branch = "main"
+	th.db.deployments = []AppDefinition{
+		{ID: "running", AppID: testAppID, Environment: "production", Status: DeploymentStatusDeployed},
+		{ID: "failed", AppID: testAppID, Environment: "production", Status: DeploymentStatusFailed},
+	}
+	th.github.branchTips = map[string]string{"treenq/treenq:main": "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"}
+	th.docker.existing = []string{"api", "cron"}
+	th.kube.plan = func(data string) []ObjectPlan {
+		return []ObjectPlan{
+			{Kind: "Deployment", Name: data + "-api-deployment", Action: PlanActionUnchanged},
+			{Kind: "Deployment", Name: data + "-worker-deployment", Action: PlanActionCreate},
+		}
+	}
+
+	res, rpcErr := th.PlanDeployment(userCtx("testing"), PlanDeploymentRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, DeploymentPlan{
+		Environment:     "production",
+		RequireApproval: true,
+		ConfigPath:      "tq",
+		Services: []ServicePlan{
+			{Name: "api", Image: "registry/api:e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4", Cached: true},
+			{Name: "worker", Image: "registry/worker:e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4", Cached: false},
+			{Name: "cron", Image: "registry/cron:e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4", Cached: true},
+		},
+		Objects: []ObjectPlan{
+			{Kind: "Deployment", Name: "running-api-deployment", Action: PlanActionUnchanged},
+			{Kind: "Deployment", Name: "running-worker-deployment", Action: PlanActionCreate},
+		},
+	}, res.Plan, "the objects are compared with the running deployment ones")
+
+	assert.Empty(t, th.docker.builds)
+	assert.Empty(t, th.kube.applied)
+	assert.Len(t, th.db.deployments, 2, "a plan is not a deployment")
+}
+
+func TestPlanDeploymentUnknownApp(t *testing.T) {
+	th := newTestHandler(t, multiServiceSpace(0))
+
+	_, rpcErr := th.PlanDeployment(userCtx("testing"), PlanDeploymentRequest{AppID: "unknown"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "APP_NOT_FOUND", rpcErr.Code)
+	assert.Zero(t, th.git.clones)
+}
@@ -0,0 +1,169 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// appliedStatus is the status of a successfully applied deployment,
+// a paused deployment awaits the promotion to receive the traffic
+func appliedStatus(app tqsdk.Space) DeploymentStatus {
+	if app.PauseAfterDeploy {
+		return DeploymentStatusAwaitingPromotion
+	}
+	return DeploymentStatusDeployed
+}
+
+// pauseDeployment rolls out the deployment objects but the Ingresses, so the traffic stays on the previous version
+// until the deployment is promoted. A deployment not promoted within the promotion ttl is rolled back.
+func (h *Handler) pauseDeployment(ctx context.Context, def AppDefinition, images map[string]Image) error {
+	appKubeDef, err := h.applyPaused(ctx, def, images)
+	if err != nil {
+		if deploymentCancelled(ctx) {
+			h.rollbackCancelled(ctx, def)
+			return h.storeCancelled(ctx, def)
+		}
+		h.recordFailedEvent(ctx, appKubeDef, DeploymentStageApply, err)
+		return h.failDeployment(ctx, def, DeploymentStageApply, err)
+	}
+	h.recordMilestone(ctx, def, MilestoneApplied)
+	h.recordObjects(ctx, def, appKubeDef)
+	h.recordEvent(ctx, appKubeDef, KubeEvent{
+		Reason:  KubeEventDeployStarted,
+		Message: fmt.Sprintf("treenq deployment %s of %s is paused until promoted", def.ID, def.Sha),
+	})
+
+	if err := h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusAwaitingPromotion); err != nil {
+		return err
+	}
+	if h.promotionTtl <= 0 {
+		return nil
+	}
+	if err := h.db.SetPromotionExpiresAt(ctx, def.ID, now().Add(h.promotionTtl)); err != nil {
+		return err
+	}
+	expireCtx := context.WithoutCancel(ctx)
+	time.AfterFunc(h.promotionTtl, func() {
+		if err := h.expirePromotion(expireCtx, def.ID); err != nil {
+			h.l.ErrorContext(expireCtx, "failed to expire deployment promotion", "deploymentID", def.ID, "err", err)
+		}
+	})
+	return nil
+}
+
+// applyPaused applies the deployment objects without routing the traffic to them and waits until they roll out
+func (h *Handler) applyPaused(ctx context.Context, def AppDefinition, images map[string]Image) (string, error) {
+	applyCtx, cancel := withTimeout(ctx, h.timeouts.Apply)
+	defer cancel()
+
+	_, appKubeDef, err := h.defineApp(applyCtx, def, images)
+	if err != nil {
+		return "", err
+	}
+	if err := h.kube.ApplyPaused(applyCtx, h.kubeConfig, appKubeDef); err != nil {
+		return appKubeDef, err
+	}
+	return appKubeDef, h.kube.WaitReady(applyCtx, h.kubeConfig, appKubeDef)
+}
+
+// expirePromotion rolls back the deployment if it's still awaiting the promotion
+func (h *Handler) expirePromotion(ctx context.Context, deploymentID string) error {
+	def, err := h.db.GetDeployment(ctx, deploymentID)
+	if err != nil {
+		return err
+	}
+	if def.Status != DeploymentStatusAwaitingPromotion {
+		return nil
+	}
+	if err := h.db.UpdateDeploymentStatus(ctx, def.ID, DeploymentStatusPromotionExpired); err != nil {
+		return err
+	}
+	h.l.InfoContext(ctx, "deployment promotion expired", "deploymentID", def.ID, "appID", def.AppID)
+	return h.rollbackDeployment(ctx, def)
+}
+
+type PromoteDeploymentRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+type PromoteDeploymentResponse struct {
+	Deployment AppDefinition
+}
+
+// PromoteDeployment switches the traffic to a paused deployment
+func (h *Handler) PromoteDeployment(ctx context.Context, req PromoteDeploymentRequest) (PromoteDeploymentResponse, *vel.Error) {
+	def, err := h.db.GetDeployment(ctx, req.DeploymentID)
+	if err != nil {
+		if errors.Is(err, ErrDeploymentNotFound) {
+			return PromoteDeploymentResponse{}, &vel.Error{
+				Code:    "DEPLOYMENT_NOT_FOUND",
+				Message: err.Error(),
+			}
+		}
+		return PromoteDeploymentResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if rpcErr := h.authorizeApp(ctx, def.AppID); rpcErr != nil {
+		return PromoteDeploymentResponse{}, rpcErr
+	}
+
+	if def.Status != DeploymentStatusAwaitingPromotion {
+		return PromoteDeploymentResponse{}, &vel.Error{
+			Code:    "DEPLOYMENT_NOT_AWAITING_PROMOTION",
+			Message: "deployment status is " + string(def.Status),
+		}
+	}
+	if !def.PromotionExpiresAt.IsZero() && now().After(def.PromotionExpiresAt) {
+		if err := h.expirePromotion(ctx, def.ID); err != nil {
+			return PromoteDeploymentResponse{}, &vel.Error{
+				Code:    "UNKNOWN",
+				Message: err.Error(),
+			}
+		}
+		return PromoteDeploymentResponse{}, &vel.Error{
+			Code:    "PROMOTION_EXPIRED",
+			Message: "deployment promotion has expired at " + def.PromotionExpiresAt.String(),
+		}
+	}
+
+	ctx = withRedaction(ctx)
+	ctx, run, stop := h.runs.start(ctx, def.AppID, def.ID)
+	defer stop()
+	defer h.watchSlow(ctx, def.AppID, run)()
+	if err := h.promote(ctx, def); err != nil {
+		return PromoteDeploymentResponse{}, deployError(err)
+	}
+
+	def.Status = DeploymentStatusDeployed
+	return PromoteDeploymentResponse{Deployment: def}, nil
+}
+
+// promote routes the traffic to the paused deployment objects and finishes the deployment
+func (h *Handler) promote(ctx context.Context, def AppDefinition) error {
+	h.runs.enter(ctx, DeploymentStageApply)
+	applyCtx, cancel := withTimeout(ctx, h.timeouts.Apply)
+	defer cancel()
+
+	// the paused objects are defined with the images they were applied with
+	images, err := h.recordedImages(def)
+	if err != nil {
+		return h.failDeployment(ctx, def, DeploymentStageApply, err)
+	}
+	_, appKubeDef, err := h.defineApp(applyCtx, def, images)
+	if err == nil {
+		err = h.kube.RouteTraffic(applyCtx, h.kubeConfig, appKubeDef)
+	}
+	if err != nil {
+		h.recordFailedEvent(ctx, appKubeDef, DeploymentStageApply, err)
+		return h.failDeployment(ctx, def, DeploymentStageApply, err)
+	}
+	h.l.InfoContext(ctx, "deployment promoted", "deploymentID", def.ID, "appID", def.AppID)
+	return h.finishDeployment(ctx, def, appKubeDef)
+}
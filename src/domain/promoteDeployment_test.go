@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func pausedSpace() tqsdk.Space {
+	return tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, PauseAfterDeploy: true}
+}
+
+func TestPausedDeploymentKeepsTraffic(t *testing.T) {
+	th := newTestHandler(t, pausedSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	def := th.db.deployment(t, "deployment-1")
+	assert.Equal(t, DeploymentStatusAwaitingPromotion, def.Status)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), def.PromotionExpiresAt, time.Minute)
+	assert.Equal(t, []string{"apply paused", "wait ready"}, th.kube.calls, "the traffic isn't routed to the paused deployment")
+}
+
+func TestPromoteDeploymentRoutesTraffic(t *testing.T) {
+	th := newTestHandler(t, pausedSpace())
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.PromoteDeployment(userCtx("testing"), PromoteDeploymentRequest{DeploymentID: "deployment-1"})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusDeployed, res.Deployment.Status)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, "deployment-1").Status)
+	assert.Equal(t, []string{"apply paused", "wait ready", "route traffic"}, th.kube.calls)
+
+	_, rpcErr = th.PromoteDeployment(userCtx("testing"), PromoteDeploymentRequest{DeploymentID: "deployment-1"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "DEPLOYMENT_NOT_AWAITING_PROMOTION", rpcErr.Code)
+}
+
+func TestExpiredPromotionRollsBack(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	previous := th.db.deployments[0]
+
+	th.extractor.space = pausedSpace()
+	push := pushRequest()
+	push.After = "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	paused := th.db.deployment(t, "deployment-2")
+	require.Equal(t, DeploymentStatusAwaitingPromotion, paused.Status)
+	require.NoError(t, th.db.SetPromotionExpiresAt(context.Background(), paused.ID, time.Now().Add(-time.Minute)))
+
+	_, rpcErr = th.PromoteDeployment(userCtx("testing"), PromoteDeploymentRequest{DeploymentID: paused.ID})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "PROMOTION_EXPIRED", rpcErr.Code)
+	assert.Equal(t, DeploymentStatusPromotionExpired, th.db.deployment(t, paused.ID).Status)
+	assert.NotContains(t, th.kube.calls, "route traffic")
+	assert.Equal(t, previous.ID, th.kube.applied[len(th.kube.applied)-1], "the previous deployment is applied again")
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// validateReadinessCommands checks the set readiness commands have a program to run
+func validateReadinessCommands(space tqsdk.Space) error {
+	for _, service := range space.AllServices() {
+		if service.ReadinessCommand == nil {
+			continue
+		}
+		if len(service.ReadinessCommand) == 0 || strings.TrimSpace(service.ReadinessCommand[0]) == "" {
+			return UserFailure(fmt.Errorf("service %q readiness command must not be empty", service.Name))
+		}
+	}
+	return nil
+}
+
+// hasReadinessCommand reports whether the rollout is gated by a readiness command of a space service
+func hasReadinessCommand(space tqsdk.Space) bool {
+	for _, service := range space.AllServices() {
+		if len(service.ReadinessCommand) > 0 {
+			return true
+		}
+	}
+	return false
+}
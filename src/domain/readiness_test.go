@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookReadinessCommandGatesRollout(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "consumer", ReadinessCommand: []string{"test", "-f", "/tmp/connected"}}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"apply", "wait ready"}, th.kube.calls)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+}
+
+func TestGithubWebhookWithoutReadinessCommandIsNotAwaited(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"apply"}, th.kube.calls)
+}
+
+func TestGithubWebhookEmptyReadinessCommand(t *testing.T) {
+	for _, command := range [][]string{{}, {" "}} {
+		th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "consumer", ReadinessCommand: command}})
+
+		_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+		require.NotNil(t, rpcErr)
+
+		def := th.db.deployments[0]
+		assert.Equal(t, DeploymentStatusFailed, def.Status)
+		require.NotNil(t, def.Failure)
+		assert.Equal(t, DeploymentStageExtract, def.Failure.Stage)
+		assert.Equal(t, FailureClassUser, def.Failure.Class)
+		assert.Empty(t, th.docker.builds)
+		assert.Empty(t, th.kube.applied)
+	}
+}
@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"fmt"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+// ResourceCeilingPolicy tells what happens to a service size above the ceiling
+type ResourceCeilingPolicy string
+
+const (
+	// ResourceCeilingClamp lowers every resource above the ceiling to it
+	ResourceCeilingClamp ResourceCeilingPolicy = "clamp"
+	// ResourceCeilingReject fails the deployment of a service above the ceiling
+	ResourceCeilingReject ResourceCeilingPolicy = "reject"
+)
+
+// ResourceProfile is the cluster wide sizing of the services, the requests and limits are both set from a size
+type ResourceProfile struct {
+	// Default is the size of a service declaring none
+	Default tqsdk.SizeSlug
+	// Max caps every resource of the declared sizes, there is no ceiling if it's empty
+	Max tqsdk.SizeSlug
+	// Ceiling is the policy of a size above Max, clamp if empty
+	Ceiling ResourceCeilingPolicy
+}
+
+func (p ResourceProfile) Validate() error {
+	if _, err := tqsdk.ParseSizeSlug(p.Default); err != nil {
+		return fmt.Errorf("invalid default size: %w", err)
+	}
+	if p.Max != "" {
+		if _, err := tqsdk.ParseSizeSlug(p.Max); err != nil {
+			return fmt.Errorf("invalid max size: %w", err)
+		}
+	}
+	switch p.Ceiling {
+	case "", ResourceCeilingClamp, ResourceCeilingReject:
+		return nil
+	}
+	return fmt.Errorf("unknown resource ceiling policy %q, expected clamp or reject", p.Ceiling)
+}
+
+// validate checks the declared sizes of the space services,
+// a size above the ceiling is a user failure once the ceiling policy rejects it
+func (p ResourceProfile) validate(space tqsdk.Space) error {
+	for _, service := range space.AllServices() {
+		if service.SizeSlug == "" {
+			continue
+		}
+		res, err := tqsdk.ParseSizeSlug(service.SizeSlug)
+		if err != nil {
+			return UserFailure(fmt.Errorf("service %q: %w", service.Name, err))
+		}
+		if p.Ceiling != ResourceCeilingReject || p.Max == "" {
+			continue
+		}
+		if clamped := clampResources(res, p.Max.ToComputationResource()); clamped != res {
+			return UserFailure(fmt.Errorf("service %q size %s exceeds the cluster max size %s", service.Name, service.SizeSlug, p.Max))
+		}
+	}
+	return nil
+}
+
+// apply returns the space with the sizes the cluster runs,
+// a service declaring no size gets the default one and a declared size is clamped to the ceiling
+func (p ResourceProfile) apply(space tqsdk.Space) tqsdk.Space {
+	size := func(service tqsdk.Service) tqsdk.Service {
+		if service.SizeSlug == "" {
+			service.SizeSlug = p.Default
+		}
+		if p.Max != "" {
+			res := clampResources(service.SizeSlug.ToComputationResource(), p.Max.ToComputationResource())
+			service.SizeSlug = res.SizeSlug()
+		}
+		return service
+	}
+
+	if space.Service.Name != "" {
+		space.Service = size(space.Service)
+	}
+	if space.Services != nil {
+		services := make([]tqsdk.Service, len(space.Services))
+		for i := range space.Services {
+			services[i] = size(space.Services[i])
+		}
+		space.Services = services
+	}
+	return space
+}
+
+// clampResources lowers every resource above the max to it
+func clampResources(res, max tqsdk.ComputationResource) tqsdk.ComputationResource {
+	return tqsdk.ComputationResource{
+		CpuUnits:   min(res.CpuUnits, max.CpuUnits),
+		MemoryMibs: min(res.MemoryMibs, max.MemoryMibs),
+		DiskGibs:   min(res.DiskGibs, max.DiskGibs),
+	}
+}
@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookAppliesDefaultSize(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Services: []tqsdk.Service{
+		{Name: "worker", SizeSlug: "250-512-1"},
+	}})
+	th.resources = ResourceProfile{Default: tqsdk.SizeSlugS}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	defined := th.kube.defined["deployment-1"]
+	assert.Equal(t, tqsdk.SizeSlugS, defined.Service.SizeSlug)
+	assert.Equal(t, tqsdk.SizeSlug("250-512-1"), defined.Services[0].SizeSlug, "the declared size is kept")
+	assert.Empty(t, th.db.deployment(t, "deployment-1").App.Service.SizeSlug, "the stored config is as declared")
+}
+
+func TestGithubWebhookClampsSizeToCeiling(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", SizeSlug: "4000-512-20"}})
+	th.resources = ResourceProfile{Default: tqsdk.SizeSlugS, Max: "2000-4096-10", Ceiling: ResourceCeilingClamp}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, tqsdk.SizeSlug("2000-512-10"), th.kube.defined["deployment-1"].Service.SizeSlug)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, "deployment-1").Status)
+}
+
+func TestGithubWebhookRejectsSizeAboveCeiling(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", SizeSlug: "4000-512-2"}})
+	th.resources = ResourceProfile{Default: tqsdk.SizeSlugS, Max: "2000-4096-10", Ceiling: ResourceCeilingReject}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.Contains(t, def.Failure.Message, "exceeds the cluster max size")
+	assert.Empty(t, th.docker.builds)
+	assert.Empty(t, th.kube.applied)
+}
+
+func TestResourceProfileValidate(t *testing.T) {
+	assert.NoError(t, ResourceProfile{Default: tqsdk.SizeSlugS}.Validate())
+	assert.NoError(t, ResourceProfile{Default: tqsdk.SizeSlugS, Max: "2000-4096-10", Ceiling: ResourceCeilingReject}.Validate())
+	assert.Error(t, ResourceProfile{}.Validate())
+	assert.Error(t, ResourceProfile{Default: tqsdk.SizeSlugS, Max: "2000"}.Validate())
+	assert.Error(t, ResourceProfile{Default: tqsdk.SizeSlugS, Ceiling: "ignore"}.Validate())
+}
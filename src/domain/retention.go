@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeploymentRetention limits the stored deployment history of an app.
+// A deployment is pruned once it's out of both the last Count deployments and the Age,
+// a zero field doesn't keep anything, both zero fields disable pruning.
+type DeploymentRetention struct {
+	// Count is how many latest deployments are kept
+	Count int
+	// Age keeps the deployments younger than it
+	Age time.Duration
+}
+
+func (r DeploymentRetention) enabled() bool {
+	return r.Count > 0 || r.Age > 0
+}
+
+// pruneDeployments deletes the app deployments out of the retention
+// and removes their images unless a kept deployment still uses them.
+// The migration logs and the timeline are stored in the deployment row, so they're deleted with it.
+func (h *Handler) pruneDeployments(ctx context.Context, appID string) error {
+	if !h.retention.enabled() {
+		return nil
+	}
+
+	deployments, err := h.db.ListDeployments(ctx, appID)
+	if err != nil {
+		return fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	pruned, kept := splitRetained(deployments, h.retention, now())
+	if len(pruned) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(pruned))
+	for i := range pruned {
+		ids[i] = pruned[i].ID
+	}
+	if err := h.db.DeleteDeployments(ctx, ids); err != nil {
+		return fmt.Errorf("failed to delete deployments: %w", err)
+	}
+
+	used := make(map[string]bool)
+	for _, def := range kept {
+		for _, image := range h.digestImages(def) {
+			used[image.DigestPath()] = true
+		}
+	}
+	for _, def := range pruned {
+		for _, image := range h.digestImages(def) {
+			if used[image.DigestPath()] {
+				continue
+			}
+			// the same image can be referenced by several pruned deployments
+			used[image.DigestPath()] = true
+			if err := h.docker.Remove(ctx, image); err != nil {
+				h.l.WarnContext(ctx, "failed to remove pruned deployment image", "image", image.DigestPath(), "err", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// digestImages returns the images of the deployment by their recorded digests.
+// A service without a recorded digest is left out, its tag may be moved to the image of another deployment.
+func (h *Handler) digestImages(def AppDefinition) []Image {
+	var images []Image
+	for _, service := range def.App.AllServices() {
+		digest, ok := def.Digests[service.Name]
+		if !ok || digest == "" {
+			continue
+		}
+		image := h.docker.Image(BuildArtifactRequest{
+			Name: service.Name,
+			Tag:  def.Tag,
+		})
+		image.Digest = digest
+		images = append(images, image)
+	}
+	return images
+}
+
+// splitRetained splits the deployments ordered from the newest into the pruned and the kept ones.
+// The running deployment of every environment, the deployments in progress
+// and the deployments they replay (a rollback or a redeploy of the same sha to the same environment) are always kept.
+func splitRetained(deployments []AppDefinition, retention DeploymentRetention, now time.Time) (pruned, kept []AppDefinition) {
+	type replayed struct{ environment, sha string }
+	running := make(map[string]bool)
+	inProgress := make(map[replayed]bool)
+	for _, def := range deployments {
+		switch def.Status {
+		case DeploymentStatusDeploying, DeploymentStatusAwaitingApproval:
+			inProgress[replayed{def.Environment, def.Sha}] = true
+		}
+	}
+
+	for i, def := range deployments {
+		keep := (retention.Count > 0 && i < retention.Count) ||
+			(retention.Age > 0 && now.Sub(def.CreatedAt) < retention.Age)
+
+		if def.Status == DeploymentStatusDeployed && !running[def.Environment] {
+			running[def.Environment] = true
+			keep = true
+		}
+		if inProgress[replayed{def.Environment, def.Sha}] {
+			keep = true
+		}
+
+		if keep {
+			kept = append(kept, def)
+		} else {
+			pruned = append(pruned, def)
+		}
+	}
+	return pruned, kept
+}
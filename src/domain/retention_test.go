@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookPrunesDeploymentsBeyondRetention(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}}
+	th := newTestHandler(t, space)
+	th.retention = DeploymentRetention{Count: 2}
+
+	createdAt := now().Add(-time.Hour)
+	seed := []AppDefinition{
+		{ID: "production", Environment: "production", Tag: "v1", Status: DeploymentStatusDeployed, Digests: map[string]string{"api": "sha256:v1"}},
+		{ID: "old-1", Tag: "v1", Status: DeploymentStatusDeployed, Digests: map[string]string{"api": "sha256:v1"}},
+		{ID: "old-2", Tag: deployTag, Status: DeploymentStatusFailed, Digests: map[string]string{"api": "sha256:v2"}},
+		{ID: "old-3", Tag: deployTag, Status: DeploymentStatusDeployed, Digests: map[string]string{"api": "sha256:v3"}},
+		// no digest is recorded, the tag is moved to the running image since
+		{ID: "legacy", Tag: deployTag, Status: DeploymentStatusDeployed},
+		{ID: "previous", Tag: deployTag, Status: DeploymentStatusDeployed, Digests: map[string]string{"api": "sha256:previous"}},
+	}
+	for i, def := range seed {
+		def.AppID = testAppID
+		def.App = space
+		def.CreatedAt = createdAt.Add(time.Duration(i) * time.Minute)
+		th.db.deployments = append(th.db.deployments, def)
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, []string{"production", "previous", "deployment-7"}, deploymentIDs(th.db.deployments), "the running production deployment must be kept")
+
+	// v1 is still running in production, the images are removed by their digests
+	assert.ElementsMatch(t, []Image{
+		{Registry: "registry", Repository: "api", Tag: deployTag, Digest: "sha256:v2"},
+		{Registry: "registry", Repository: "api", Tag: deployTag, Digest: "sha256:v3"},
+	}, th.docker.removed)
+}
+
+func TestSplitRetained(t *testing.T) {
+	current := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// ordered from the newest
+	deployments := []AppDefinition{
+		{ID: "rollback", Sha: "a", Status: DeploymentStatusDeploying, CreatedAt: current.Add(-time.Hour)},
+		{ID: "broken", Sha: "c", Status: DeploymentStatusFailed, CreatedAt: current.Add(-2 * day)},
+		{ID: "running", Sha: "b", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-5 * day)},
+		{ID: "replayed", Sha: "a", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-8 * day)},
+		{ID: "stale", Sha: "d", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-9 * day)},
+	}
+
+	pruned, kept := splitRetained(deployments, DeploymentRetention{Age: 3 * day}, current)
+	assert.Equal(t, []string{"rollback", "broken", "running", "replayed"}, deploymentIDs(kept))
+	assert.Equal(t, []string{"stale"}, deploymentIDs(pruned))
+
+	pruned, kept = splitRetained(deployments, DeploymentRetention{Count: 1}, current)
+	assert.Equal(t, []string{"rollback", "running", "replayed"}, deploymentIDs(kept))
+	assert.Equal(t, []string{"broken", "stale"}, deploymentIDs(pruned))
+}
+
+func TestSplitRetainedScopesReplayToEnvironment(t *testing.T) {
+	current := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	// ordered from the newest
+	deployments := []AppDefinition{
+		{ID: "rollback", Sha: "a", Environment: "production", Status: DeploymentStatusDeploying, CreatedAt: current.Add(-time.Hour)},
+		{ID: "running", Sha: "b", Environment: "production", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-2 * time.Hour)},
+		{ID: "staging", Sha: "c", Environment: "staging", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-3 * time.Hour)},
+		{ID: "replayed", Sha: "a", Environment: "production", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-4 * time.Hour)},
+		{ID: "other", Sha: "a", Environment: "staging", Status: DeploymentStatusDeployed, CreatedAt: current.Add(-5 * time.Hour)},
+	}
+
+	pruned, kept := splitRetained(deployments, DeploymentRetention{Count: 1}, current)
+	assert.Equal(t, []string{"rollback", "running", "staging", "replayed"}, deploymentIDs(kept))
+	assert.Equal(t, []string{"other"}, deploymentIDs(pruned), "the same sha of another environment isn't rolled back to")
+}
+
+func deploymentIDs(defs []AppDefinition) []string {
+	ids := make([]string, len(defs))
+	for i := range defs {
+		ids[i] = defs[i].ID
+	}
+	return ids
+}
@@ -2,21 +2,39 @@ package domain
 
 import (
 	"context"
+	"os"
+	"slices"
 
 	"github.com/treenq/treenq/pkg/vel"
 )
 
 type RollbackRequest struct {
 	AppID string `json:"appId"`
-	Tag   string `json:"tag"`
-	Sha   string `json:"sha"`
+	// Tag selects the deployment by its image tag if no Sha is given, a pushed commit is tagged with its sha,
+	// the latest alias is moved by every rebuild, so it selects none
+	Tag string `json:"tag"`
+	Sha string `json:"sha"`
 }
 
 type RollbackResponse struct {
-	History []AppDefinition
+	// Deployment is a new deployment of the rolled back version
+	Deployment AppDefinition
+	History    []AppDefinition
 }
 
+// Rollback deploys a previous successful deployment found by sha or tag again,
+// the stored space and the recorded image digests are used, the repo is not cloned.
 func (h *Handler) Rollback(ctx context.Context, req RollbackRequest) (RollbackResponse, *vel.Error) {
+	if rpcErr := h.authorizeApp(ctx, req.AppID); rpcErr != nil {
+		return RollbackResponse{}, rpcErr
+	}
+	if req.Sha == "" && req.Tag == deployTag {
+		return RollbackResponse{}, &vel.Error{
+			Code:    "INVALID_ROLLBACK_TARGET",
+			Message: "tag " + deployTag + " is moved by every rebuild, roll back by sha",
+		}
+	}
+
 	history, err := h.db.GetDeploymentHistory(ctx, req.AppID)
 	if err != nil {
 		return RollbackResponse{}, &vel.Error{
@@ -25,34 +43,180 @@ func (h *Handler) Rollback(ctx context.Context, req RollbackRequest) (RollbackRe
 		}
 	}
 
-	for i := range history {
-		if history[i].Tag == req.Tag {
-			if err := h.deployDefinition(history[i]); err != nil {
-				return RollbackResponse{}, &vel.Error{
-					Code:    "UNKNOWN",
-					Message: err.Error(),
-				}
-			}
+	idx := slices.IndexFunc(history, func(def AppDefinition) bool {
+		if def.Status != DeploymentStatusDeployed {
+			return false
 		}
-
-		if history[i].Sha == req.Sha {
-			if err := h.deployDefinition(history[i]); err != nil {
-				return RollbackResponse{}, &vel.Error{
-					Code:    "UNKNOWN",
-					Message: err.Error(),
-				}
-			}
+		if req.Sha != "" {
+			return def.Sha == req.Sha
+		}
+		return def.Tag == req.Tag
+	})
+	if idx == -1 {
+		return RollbackResponse{}, &vel.Error{
+			Code:    "DEPLOYMENT_NOT_FOUND",
+			Message: "no successful deployment to roll back to",
 		}
 	}
 
+	def, rpcErr := h.replayDeployment(ctx, history[idx])
+	if rpcErr != nil {
+		return RollbackResponse{}, rpcErr
+	}
+
 	return RollbackResponse{
-		History: history,
+		Deployment: def,
+		History:    history,
 	}, nil
 }
 
-func (h *Handler) deployDefinition(def AppDefinition) error {
-	panic("NOT IMPLEMENTED")
-	return nil
-	// apply
-	// update
+type RedeployRequest struct {
+	AppID string `json:"appId"`
+	// Sha is a deployed commit to deploy again, the latest successful deployment if empty
+	Sha string `json:"sha"`
+	// ForceRebuild clones and builds the connected branch tip again without the build cache instead of replaying
+	// the built images, e.g. once a stale cached layer has produced a bad image. The Sha must be the tip if set.
+	ForceRebuild bool `json:"forceRebuild"`
+}
+
+type RedeployResponse struct {
+	Deployment AppDefinition
+}
+
+// Redeploy deploys the already built commit again replaying its stored space,
+// a commit which has never been deployed requires a fresh build by a push, an archive or a forced rebuild.
+func (h *Handler) Redeploy(ctx context.Context, req RedeployRequest) (RedeployResponse, *vel.Error) {
+	repo, rpcErr := h.appRepo(ctx, req.AppID)
+	if rpcErr != nil {
+		return RedeployResponse{}, rpcErr
+	}
+	if req.ForceRebuild {
+		def, rpcErr := h.rebuildBranch(ctx, repo, req.Sha)
+		if rpcErr != nil {
+			return RedeployResponse{Deployment: def}, rpcErr
+		}
+		return RedeployResponse{Deployment: def}, nil
+	}
+
+	if req.Sha == "" {
+		def, rpcErr := h.redeployLatest(ctx, req.AppID)
+		if rpcErr != nil {
+			return RedeployResponse{}, rpcErr
+		}
+		return RedeployResponse{Deployment: def}, nil
+	}
+
+	history, err := h.db.GetDeploymentHistory(ctx, req.AppID)
+	if err != nil {
+		return RedeployResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	idx := slices.IndexFunc(history, func(def AppDefinition) bool {
+		return def.Status == DeploymentStatusDeployed && def.Sha == req.Sha
+	})
+	if idx == -1 {
+		return RedeployResponse{}, &vel.Error{
+			Code:    "BUILD_REQUIRED",
+			Message: "sha " + req.Sha + " has no successful deployment, push it or deploy an archive to build it",
+		}
+	}
+
+	def, rpcErr := h.replayDeployment(ctx, history[idx])
+	if rpcErr != nil {
+		return RedeployResponse{}, rpcErr
+	}
+	return RedeployResponse{Deployment: def}, nil
+}
+
+// replayDeployment saves a new deployment of the stored source deployment space and applies it
+// with the image digests recorded by the source, neither clone nor extract nor build is done.
+// The tag may have moved to another build since, a digest the registry no longer holds fails the replay.
+func (h *Handler) replayDeployment(ctx context.Context, source AppDefinition) (AppDefinition, *vel.Error) {
+	ctx = withRedaction(ctx)
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return AppDefinition{}, rpcErr
+	}
+
+	def, err := h.db.SaveDeployment(ctx, AppDefinition{
+		AppID:       source.AppID,
+		App:         source.App,
+		Tag:         source.Tag,
+		Sha:         source.Sha,
+		User:        profile.UserInfo.DisplayName,
+		Environment: source.Environment,
+		ConfigPath:  source.ConfigPath,
+		// the same images are applied again, so are their signatures
+		Signatures: source.Signatures,
+		Digests:    source.Digests,
+		Status:     DeploymentStatusDeploying,
+	})
+	if err != nil {
+		return AppDefinition{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+
+	images, err := h.recordedImages(def)
+	if err != nil {
+		return def, deployError(h.failDeployment(ctx, def, DeploymentStageApply, err))
+	}
+	if err := h.applyDeployment(ctx, def, images); err != nil {
+		return def, deployError(err)
+	}
+
+	def.Status = appliedStatus(def.App)
+	return def, nil
+}
+
+// rebuildBranch clones the connected branch tip and deploys it building the images without the build cache,
+// the clone is the tip, so a sha other than the tip can't be rebuilt
+func (h *Handler) rebuildBranch(ctx context.Context, repo InstalledRepository, sha string) (AppDefinition, *vel.Error) {
+	branch, tip, rpcErr := h.branchTip(repo, "")
+	if rpcErr != nil {
+		return AppDefinition{}, rpcErr
+	}
+	if sha != "" && sha != tip {
+		return AppDefinition{}, &vel.Error{
+			Code:    "SHA_NOT_BRANCH_TIP",
+			Message: "only the " + branch + " tip " + tip + " is rebuilt, sha " + sha + " is not the tip",
+		}
+	}
+	profile, rpcErr := h.GetProfile(ctx, struct{}{})
+	if rpcErr != nil {
+		return AppDefinition{}, rpcErr
+	}
+
+	ctx, cancel := withTimeout(ctx, h.timeouts.Deploy)
+	defer cancel()
+
+	def := AppDefinition{
+		AppID:        repo.TreenqID,
+		Tag:          shaTag(tip, true),
+		Sha:          tip,
+		User:         profile.UserInfo.DisplayName,
+		Ref:          "refs/heads/" + branch,
+		Status:       DeploymentStatusDeploying,
+		ForceRebuild: true,
+	}
+	def.reach(MilestoneQueued)
+	def.reach(MilestoneCloneStarted)
+	repoDir, err := h.cloneRepo(ctx, repo.InstallationID, repo, repo)
+	if err != nil {
+		return def, deployError(h.failDeployment(ctx, def, DeploymentStageClone, err))
+	}
+	defer os.RemoveAll(repoDir)
+	def.reach(MilestoneCloneFinished)
+
+	def, err = h.deploySource(ctx, def, repoDir, sourcePush{Branch: branch})
+	if err != nil {
+		return def, deployError(err)
+	}
+	if def.Status == DeploymentStatusDeploying {
+		def.Status = appliedStatus(def.App)
+	}
+	return def, nil
 }
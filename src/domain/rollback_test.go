@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestRedeployCurrentShaReplaysStoredSpace(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", Replicas: 2}}
+	th := newTestHandler(t, space)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Equal(t, 1, th.git.clones)
+	require.Equal(t, 1, th.extractor.extractions)
+	// the repo config changed since, the stored space must be used anyway
+	th.extractor.space = tqsdk.Space{}
+
+	res, rpcErr := th.Redeploy(userCtx("testing"), RedeployRequest{AppID: testAppID, Sha: pushRequest().After})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, 1, th.git.clones, "redeploy of the deployed sha must not clone")
+	assert.Equal(t, 1, th.extractor.extractions, "redeploy of the deployed sha must not extract")
+	assert.Len(t, th.docker.builds, 1, "redeploy of the deployed sha must not build")
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, res.Deployment.ID).Status)
+	assert.Equal(t, space, th.kube.defined[res.Deployment.ID])
+}
+
+func TestRedeployUnknownShaRequiresBuild(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.Redeploy(userCtx("testing"), RedeployRequest{AppID: testAppID, Sha: "0000000000000000000000000000000000000000"})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "BUILD_REQUIRED", rpcErr.Code)
+	assert.Len(t, th.kube.applied, 1)
+}
+
+func TestRedeployForceRebuildBuildsWithoutCache(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.github.defaultBranches = map[string]string{"treenq/treenq": "main"}
+	th.github.branchTips = map[string]string{"treenq/treenq:main": pushRequest().After}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.builds, 1)
+	assert.False(t, th.docker.builds[0].NoCache, "a push build uses the cache")
+
+	_, rpcErr = th.Redeploy(userCtx("testing"), RedeployRequest{AppID: testAppID})
+	require.Nil(t, rpcErr)
+	assert.Len(t, th.docker.builds, 1, "a plain redeploy replays the built images")
+
+	res, rpcErr := th.Redeploy(userCtx("testing"), RedeployRequest{AppID: testAppID, ForceRebuild: true})
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.builds, 2)
+	assert.True(t, th.docker.builds[1].NoCache)
+	assert.Equal(t, 2, th.git.clones)
+	def := th.db.deployment(t, res.Deployment.ID)
+	assert.True(t, def.ForceRebuild, "the deployment records the clean build")
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, pushRequest().After, def.Sha)
+}
+
+func TestRedeployForceRebuildOfNotTipSha(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.github.defaultBranches = map[string]string{"treenq/treenq": "main"}
+	th.github.branchTips = map[string]string{"treenq/treenq:main": pushRequest().After}
+
+	_, rpcErr := th.Redeploy(userCtx("testing"), RedeployRequest{AppID: testAppID, Sha: "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4", ForceRebuild: true})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "SHA_NOT_BRANCH_TIP", rpcErr.Code)
+	assert.Empty(t, th.docker.builds)
+}
+
+func TestRollbackReplaysStoredSpace(t *testing.T) {
+	previousSpace := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", Replicas: 1}}
+	th := newTestHandler(t, previousSpace)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	previous := th.db.deployments[0]
+
+	th.extractor.space = tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", Replicas: 3}}
+	push := pushRequest()
+	push.After = "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.Rollback(userCtx("testing"), RollbackRequest{AppID: testAppID, Sha: previous.Sha})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, 2, th.git.clones, "rollback must not clone")
+	assert.Equal(t, previous.Sha, res.Deployment.Sha)
+	assert.Equal(t, previousSpace, th.kube.defined[res.Deployment.ID])
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, res.Deployment.ID).Status)
+}
+
+func TestRollbackAppliesRecordedDigest(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	builds := 0
+	th.docker.push = func(ctx context.Context, image Image) (Image, error) {
+		builds++
+		image.Digest = fmt.Sprintf("sha256:build%d", builds)
+		return image, nil
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	previous := th.db.deployments[0]
+	push := pushRequest()
+	push.After = "e4c2a1b0f9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4"
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+
+	res, rpcErr := th.Rollback(userCtx("testing"), RollbackRequest{AppID: testAppID, Sha: previous.Sha})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, "sha256:build1", th.kube.images[res.Deployment.ID]["api"].Digest, "the digest built for the sha is applied, not the moved tag")
+	assert.Equal(t, map[string]string{"api": "sha256:build1"}, th.db.deployment(t, res.Deployment.ID).Digests)
+}
+
+func TestRollbackOfRemovedDigestFails(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	previous := th.db.deployments[0]
+	th.registry = &fakeRegistry{missing: []string{"registry/api@sha256:api"}}
+
+	_, rpcErr = th.Rollback(userCtx("testing"), RollbackRequest{AppID: testAppID, Sha: previous.Sha})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "IMAGE_NOT_FOUND", rpcErr.Code)
+	assert.Len(t, th.kube.applied, 1, "an image the registry doesn't hold is not applied")
+	require.Len(t, th.db.deployments, 2)
+	assert.Equal(t, DeploymentStatusFailed, th.db.deployments[1].Status)
+}
+
+func TestRollbackByLatestTag(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	_, rpcErr = th.Rollback(userCtx("testing"), RollbackRequest{AppID: testAppID, Tag: deployTag})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "INVALID_ROLLBACK_TARGET", rpcErr.Code)
+	assert.Len(t, th.kube.applied, 1)
+}
@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Shutdown waits for the deployments running in background to complete, i.e. the ones outlasting the ack of their delivery
+// and the pushes held by the debounce windows, the open windows are ended to deploy their pushes right away.
+// It's called once the server has drained the requests, so no new one is started,
+// the deployments still running once ctx is done go on until the process exits.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	if flushed := h.debouncer.flush(); flushed > 0 {
+		h.l.InfoContext(ctx, "debounced pushes are deployed before shutdown", "pushes", flushed)
+	}
+	if err := waitFor(ctx, &h.debouncer.inFlight); err != nil {
+		return fmt.Errorf("failed to wait for debounced pushes: %w", err)
+	}
+	if err := waitFor(ctx, &h.background); err != nil {
+		return fmt.Errorf("failed to wait for background deployments: %w", err)
+	}
+	return nil
+}
+
+// waitFor waits for the group until ctx is done
+func waitFor(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
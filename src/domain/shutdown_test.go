@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestShutdownWaitsForBackgroundDeployment(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.timeouts = DeployTimeouts{Ack: 10 * time.Millisecond}
+	th.builds = newSlots(1)
+	// the only build slot is taken, so the pushed build outlasts the ack
+	release, err := th.builds.acquire(context.Background())
+	require.NoError(t, err)
+
+	res, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.True(t, res.Queued)
+	require.Len(t, res.Deployments, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, th.Shutdown(ctx), context.DeadlineExceeded, "the queued deployment is still running")
+
+	release()
+	require.NoError(t, th.Shutdown(context.Background()))
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, res.Deployments[0].DeploymentID).Status, "the shutdown returns once the deployment is done")
+}
+
+func TestShutdownDeploysOpenDebounceWindow(t *testing.T) {
+	th, windows := debouncedHandler(t, tqsdk.Environment{Name: "production", Branch: "main", Debounce: time.Hour})
+
+	res, rpcErr := th.GithubWebhook(context.Background(), pushOf("sha-1"))
+	require.Nil(t, rpcErr)
+	_, rpcErr = th.GithubWebhook(context.Background(), pushOf("sha-2"))
+	require.Nil(t, rpcErr)
+	require.Len(t, *windows, 1)
+	require.Zero(t, th.git.clones)
+
+	require.NoError(t, th.Shutdown(context.Background()), "the window is ended instead of waiting for it")
+	deployed := th.db.deployment(t, res.Deployments[0].DeploymentID)
+	assert.Equal(t, "sha-2", deployed.Sha, "the latest held push is deployed")
+	assert.Equal(t, DeploymentStatusDeployed, deployed.Status)
+
+	// the window timer is late
+	(*windows)[0]()
+	assert.Equal(t, 1, th.git.clones, "the flushed push is deployed once")
+}
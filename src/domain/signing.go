@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Signer signs the pushed images so the cluster can verify their origin
+type Signer interface {
+	// Sign signs the image digest and returns the signature reference
+	Sign(ctx context.Context, image Image) (string, error)
+}
+
+// ImageSigning configures the signing step made after an image is pushed,
+// a nil Signer disables the signing
+type ImageSigning struct {
+	Signer Signer
+	// Required fails the deployment if an image can't be signed,
+	// otherwise the image is deployed unsigned
+	Required bool
+}
+
+func (s ImageSigning) Validate() error {
+	if s.Required && s.Signer == nil {
+		return errors.New("image signing is required but no signing key is configured")
+	}
+	return nil
+}
+
+// SignError is returned if a pushed image failed to be signed and the signing is required
+type SignError struct {
+	Service string
+	Err     error
+}
+
+func (e *SignError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SignError) Unwrap() error {
+	return e.Err
+}
+
+// signImage signs the pushed image digest and sets the image signature reference
+func (h *Handler) signImage(ctx context.Context, service string, image Image) (Image, error) {
+	if h.signing.Signer == nil {
+		return image, nil
+	}
+
+	signature, err := h.signing.Signer.Sign(ctx, image)
+	if err == nil && signature == "" {
+		err = fmt.Errorf("signer returned no signature for image %s", image.FullPath())
+	}
+	if err != nil {
+		if h.signing.Required {
+			return image, &SignError{Service: service, Err: SystemFailure(err)}
+		}
+		h.l.WarnContext(ctx, "failed to sign image, it's deployed unsigned", "service", service, "err", err)
+		return image, nil
+	}
+
+	image.Signature = signature
+	return image, nil
+}
+
+// imageSignatures returns the signature references of the signed images by the service name
+func imageSignatures(images map[string]Image) map[string]string {
+	var signatures map[string]string
+	for service, image := range images {
+		if image.Signature == "" {
+			continue
+		}
+		if signatures == nil {
+			signatures = make(map[string]string)
+		}
+		signatures[service] = image.Signature
+	}
+	return signatures
+}
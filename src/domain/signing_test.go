@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestGithubWebhookSignsPushedImages(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	signer := &fakeSigner{}
+	th.signing = ImageSigning{Signer: signer, Required: true}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, signer.signed, 1)
+	assert.Equal(t, "sha256:api", signer.signed[0].Digest, "the pushed digest is signed")
+
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Equal(t, map[string]string{"api": "registry/api@sha256:api.sig"}, def.Signatures)
+}
+
+func TestGithubWebhookRequiredSigningFailureBlocksDeploy(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.signing = ImageSigning{Signer: &fakeSigner{err: errors.New("key is not found")}, Required: true}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "SIGN_FAILED", rpcErr.Code)
+
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageSign, def.Failure.Stage)
+	assert.Empty(t, th.kube.applied, "unsigned images must not be deployed")
+}
+
+func TestGithubWebhookOptionalSigningFailureDeploysUnsigned(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.signing = ImageSigning{Signer: &fakeSigner{err: errors.New("registry is unavailable")}}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusDeployed, def.Status)
+	assert.Nil(t, def.Signatures)
+	assert.Len(t, th.kube.applied, 1)
+}
+
+func TestImageSigningValidate(t *testing.T) {
+	assert.NoError(t, ImageSigning{}.Validate())
+	assert.NoError(t, ImageSigning{Signer: &fakeSigner{}, Required: true}.Validate())
+	assert.Error(t, ImageSigning{Required: true}.Validate())
+}
@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"context"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// SimulateWebhookRequest is a synthetic push to the app repo
+type SimulateWebhookRequest struct {
+	AppID string `json:"appId"`
+	// Ref is the pushed ref, e.g. refs/heads/main
+	Ref string `json:"ref"`
+	// ChangedPaths are the repo paths changed by the push, empty means they're unknown
+	ChangedPaths []string `json:"changedPaths"`
+	Message      string   `json:"message"`
+}
+
+type SimulateWebhookResponse struct {
+	Deploy bool `json:"deploy"`
+	// SkipReason tells why the push isn't deployed
+	SkipReason SkipReason `json:"skipReason"`
+	// ConfigKnown reports whether the space config is evaluated,
+	// the config of the latest deployed space is used, an app never deployed has no known config
+	ConfigKnown     bool     `json:"configKnown"`
+	Environment     string   `json:"environment"`
+	RequireApproval bool     `json:"requireApproval"`
+	Services        []string `json:"services"`
+}
+
+// SimulateWebhook returns the routing decision of the push without deploying it,
+// the repo isn't cloned, so the space config of the latest deployment stands for the pushed one
+func (h *Handler) SimulateWebhook(ctx context.Context, req SimulateWebhookRequest) (SimulateWebhookResponse, *vel.Error) {
+	repo, rpcErr := h.appRepo(ctx, req.AppID)
+	if rpcErr != nil {
+		return SimulateWebhookResponse{}, rpcErr
+	}
+
+	push := GithubWebhookRequest{
+		Ref:        req.Ref,
+		HeadCommit: Commit{Message: req.Message},
+		Repository: Repository{ID: repo.ID, FullName: repo.FullName, Private: repo.Private},
+	}
+	if len(req.ChangedPaths) > 0 {
+		push.Commits = []Commit{{Modified: req.ChangedPaths}}
+	}
+
+	repos := push.ReposToProcess()
+	if len(repos) == 0 {
+		return SimulateWebhookResponse{SkipReason: SkipReasonBranch}, nil
+	}
+	if reason := h.skipReason(push, repo, repos[0]); reason != "" {
+		return SimulateWebhookResponse{SkipReason: reason}, nil
+	}
+
+	space, ok, err := h.latestSpace(ctx, req.AppID)
+	if err != nil {
+		return SimulateWebhookResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	if !ok {
+		return SimulateWebhookResponse{Deploy: true}, nil
+	}
+
+	res := SimulateWebhookResponse{ConfigKnown: true}
+	if !pathsChanged(space.Paths, push.ChangedPaths()) {
+		res.SkipReason = SkipReasonPathFilter
+		return res, nil
+	}
+	res.Deploy = true
+	if env, hasEnv := space.Environment(push.Branch()); hasEnv {
+		res.Environment = env.Name
+		res.RequireApproval = env.RequireApproval
+	}
+	for _, service := range space.AllServices() {
+		res.Services = append(res.Services, service.Name)
+	}
+	return res, nil
+}
+
+// latestSpace returns the space of the latest app deployment made from an extracted config,
+// the skipped deployments are never extracted
+func (h *Handler) latestSpace(ctx context.Context, appID string) (tqsdk.Space, bool, error) {
+	history, err := h.db.GetDeploymentHistory(ctx, appID)
+	if err != nil {
+		return tqsdk.Space{}, false, err
+	}
+	for _, def := range history {
+		if len(def.App.AllServices()) > 0 {
+			return def.App, true, nil
+		}
+	}
+	return tqsdk.Space{}, false, nil
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func simulationSpace() tqsdk.Space {
+	return tqsdk.Space{
+		Key:          "space",
+		Service:      tqsdk.Service{Name: "api"},
+		Services:     []tqsdk.Service{{Name: "worker"}},
+		Environments: []tqsdk.Environment{{Name: "production", Branch: "main", RequireApproval: true}},
+		Paths:        []string{"src/**", "Dockerfile"},
+	}
+}
+
+func TestSimulateWebhookDeployingPush(t *testing.T) {
+	th := newTestHandler(t, simulationSpace())
+	th.db.deployments = []AppDefinition{{ID: "1", AppID: testAppID, App: simulationSpace(), Status: DeploymentStatusDeployed}}
+
+	res, rpcErr := th.SimulateWebhook(userCtx("testing"), SimulateWebhookRequest{
+		AppID:        testAppID,
+		Ref:          "refs/heads/main",
+		ChangedPaths: []string{"README.md", "src/api/api.go"},
+		Message:      "feat: new endpoint",
+	})
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, SimulateWebhookResponse{
+		Deploy:          true,
+		ConfigKnown:     true,
+		Environment:     "production",
+		RequireApproval: true,
+		Services:        []string{"api", "worker"},
+	}, res)
+	assert.Zero(t, th.git.clones)
+	assert.Empty(t, th.docker.builds)
+	assert.Empty(t, th.kube.applied)
+	assert.Len(t, th.db.deployments, 1, "the simulation must not be stored")
+}
+
+func TestSimulateWebhookBranchFilteredSkip(t *testing.T) {
+	th := newTestHandler(t, simulationSpace())
+	th.db.repos[0].Branch = "main"
+
+	for _, ref := range []string{"refs/heads/feature", "refs/tags/v1.0.0"} {
+		res, rpcErr := th.SimulateWebhook(userCtx("testing"), SimulateWebhookRequest{AppID: testAppID, Ref: ref})
+		require.Nil(t, rpcErr)
+		assert.False(t, res.Deploy)
+		assert.Equal(t, SkipReasonBranch, res.SkipReason)
+	}
+}
+
+func TestSimulateWebhookPathFilteredSkip(t *testing.T) {
+	th := newTestHandler(t, simulationSpace())
+	th.db.deployments = []AppDefinition{
+		{ID: "1", AppID: testAppID, App: simulationSpace(), Status: DeploymentStatusDeployed},
+		{ID: "2", AppID: testAppID, Status: DeploymentStatusSkipped, SkipReason: SkipReasonDirective},
+	}
+
+	res, rpcErr := th.SimulateWebhook(userCtx("testing"), SimulateWebhookRequest{
+		AppID:        testAppID,
+		Ref:          "refs/heads/main",
+		ChangedPaths: []string{"docs/index.md", "README.md"},
+	})
+	require.Nil(t, rpcErr)
+	assert.False(t, res.Deploy)
+	assert.True(t, res.ConfigKnown)
+	assert.Equal(t, SkipReasonPathFilter, res.SkipReason)
+}
+
+func TestGithubWebhookPathFilteredSkip(t *testing.T) {
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}, Paths: []string{"src/**"}}
+	th := newTestHandler(t, space)
+	push := pushRequest()
+	push.Commits = []Commit{{Added: []string{"docs/index.md"}, Modified: []string{"README.md"}}}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusSkipped, th.db.deployments[0].Status)
+	assert.Equal(t, SkipReasonPathFilter, th.db.deployments[0].SkipReason)
+	assert.Empty(t, th.docker.builds)
+
+	push.Commits = append(push.Commits, Commit{Removed: []string{"src/legacy.go"}})
+	_, rpcErr = th.GithubWebhook(context.Background(), push)
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[1].Status)
+}
+
+func TestPathsChanged(t *testing.T) {
+	assert.True(t, pathsChanged(nil, []string{"README.md"}))
+	assert.True(t, pathsChanged([]string{"src/**"}, nil), "unknown paths are deployed")
+	assert.True(t, pathsChanged([]string{"*.go"}, []string{"main.go"}))
+	assert.False(t, pathsChanged([]string{"*.go"}, []string{"src/main.go"}))
+	assert.False(t, pathsChanged([]string{"src/**"}, []string{"srcs/main.go"}))
+	assert.False(t, pathsChanged([]string{"src/**"}, []string{}))
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Notifier delivers the deployment notifications to the outside, e.g. to an outbound webhook
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+type NotificationEvent string
+
+// NotificationDeploymentSlow is sent once a deployment runs longer than the slow threshold, the deployment goes on
+const NotificationDeploymentSlow NotificationEvent = "deployment.slow"
+
+type Notification struct {
+	Event NotificationEvent `json:"event"`
+	AppID string            `json:"appId"`
+	// DeploymentID is empty if the deployment is still building, it's saved once the images are built
+	DeploymentID string          `json:"deploymentId"`
+	Stage        DeploymentStage `json:"stage"`
+	// Elapsed is how long the deployment has been running
+	Elapsed time.Duration `json:"elapsed"`
+	Message string        `json:"message"`
+}
+
+// watchSlow notifies the deployment run is slow once it exceeds the slow threshold,
+// the returned function stops watching and must be called once the run is over
+func (h *Handler) watchSlow(ctx context.Context, appID string, run *deployRun) func() {
+	if h.notifier == nil || h.timeouts.Slow <= 0 {
+		return func() {}
+	}
+	started := now()
+	timer := time.AfterFunc(h.timeouts.Slow, func() {
+		deploymentID, stage := h.runs.state(run)
+		elapsed := now().Sub(started)
+		notification := Notification{
+			Event:        NotificationDeploymentSlow,
+			AppID:        appID,
+			DeploymentID: deploymentID,
+			Stage:        stage,
+			Elapsed:      elapsed,
+			Message:      fmt.Sprintf("deployment of app %s is running for %s, it's in the %s stage", appID, elapsed.Round(time.Second), stage),
+		}
+		if err := h.notifier.Notify(context.WithoutCancel(ctx), notification); err != nil {
+			h.l.WarnContext(ctx, "failed to notify slow deployment", "appID", appID, "deploymentID", deploymentID, "err", err)
+		}
+	})
+	return func() {
+		timer.Stop()
+	}
+}
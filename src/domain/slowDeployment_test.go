@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+type fakeNotifier struct {
+	mu            sync.Mutex
+	notifications []Notification
+	// notified is closed on the first notification
+	notified chan struct{}
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{notified: make(chan struct{})}
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, notification)
+	if len(n.notifications) == 1 {
+		close(n.notified)
+	}
+	return nil
+}
+
+func TestSlowDeploymentNotifiedOnce(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	notifier := newFakeNotifier()
+	th.notifier = notifier
+	th.timeouts = DeployTimeouts{Deploy: time.Minute, Slow: 10 * time.Millisecond}
+	th.docker.build = func(ctx context.Context, args BuildArtifactRequest) (Image, error) {
+		<-notifier.notified
+		// the build goes on well beyond the threshold
+		time.Sleep(30 * time.Millisecond)
+		return Image{Registry: "registry", Repository: args.Name, Tag: args.Tag}, nil
+	}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, "deployment-1").Status, "the slow deployment isn't aborted")
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	require.Len(t, notifier.notifications, 1)
+	notification := notifier.notifications[0]
+	assert.Equal(t, NotificationDeploymentSlow, notification.Event)
+	assert.Equal(t, testAppID, notification.AppID)
+	assert.Equal(t, DeploymentStageBuild, notification.Stage)
+	assert.Empty(t, notification.DeploymentID, "the building deployment isn't saved yet")
+	assert.GreaterOrEqual(t, notification.Elapsed, 10*time.Millisecond)
+}
+
+func TestFastDeploymentNotNotified(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	notifier := newFakeNotifier()
+	th.notifier = notifier
+	th.timeouts = DeployTimeouts{Slow: time.Hour}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Empty(t, notifier.notifications)
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+const (
+	defaultSmokeTestStatus  = http.StatusOK
+	defaultSmokeTestTimeout = 10 * time.Second
+)
+
+// smokeTestRetryDelay is a pause between the smoke test attempts
+var smokeTestRetryDelay = 2 * time.Second
+
+func hasSmokeTest(space tqsdk.Space) bool {
+	for _, service := range space.AllServices() {
+		if service.SmokeTest != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// smokeTest checks every deployed service having a smoke test,
+// rollback reports whether a failed smoke test asks to roll the deployment back.
+func (h *Handler) smokeTest(ctx context.Context, space tqsdk.Space) (rollback bool, err error) {
+	for _, service := range space.AllServices() {
+		if service.SmokeTest == nil {
+			continue
+		}
+		if err := h.smokeTestService(ctx, service); err != nil {
+			return service.SmokeTest.RollbackOnFailure, err
+		}
+	}
+	return false, nil
+}
+
+func (h *Handler) smokeTestService(ctx context.Context, service tqsdk.Service) error {
+	test := *service.SmokeTest
+	if service.Host == "" {
+		return UserFailure(fmt.Errorf("service %q smoke test requires the service host", service.Name))
+	}
+	if test.ExpectedStatus == 0 {
+		test.ExpectedStatus = defaultSmokeTestStatus
+	}
+	if test.Timeout <= 0 {
+		test.Timeout = defaultSmokeTestTimeout
+	}
+	url := "https://" + service.Host + test.Path
+
+	var err error
+	for attempt := 0; attempt <= test.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(smokeTestRetryDelay):
+			}
+		}
+
+		err = h.checkSmokeTest(ctx, url, test)
+		if err == nil {
+			return nil
+		}
+		h.l.WarnContext(ctx, "smoke test attempt failed", "service", service.Name, "attempt", attempt+1, "err", err)
+	}
+
+	return UserFailure(fmt.Errorf("service %q smoke test failed after %d attempts: %w", service.Name, test.Retries+1, err))
+}
+
+func (h *Handler) checkSmokeTest(ctx context.Context, url string, test tqsdk.SmokeTest) error {
+	ctx, cancel := context.WithTimeout(ctx, test.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create smoke test request: %w", err)
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != test.ExpectedStatus {
+		return fmt.Errorf("GET %s returned %d, expected %d", url, resp.StatusCode, test.ExpectedStatus)
+	}
+	return nil
+}
+
+// rollbackDeployment applies the previous successful deployment of the environment again
+func (h *Handler) rollbackDeployment(ctx context.Context, failed AppDefinition) error {
+	history, err := h.db.GetDeploymentHistory(ctx, failed.AppID)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment history: %w", err)
+	}
+
+	for _, def := range history {
+		if def.ID == failed.ID || def.Status != DeploymentStatusDeployed || def.Environment != failed.Environment {
+			continue
+		}
+		images, err := h.recordedImages(def)
+		if err != nil {
+			return fmt.Errorf("failed to roll back to deployment %s: %w", def.ID, err)
+		}
+		if _, err := h.apply(ctx, def, images, nil); err != nil {
+			return fmt.Errorf("failed to apply deployment %s: %w", def.ID, err)
+		}
+		h.l.InfoContext(ctx, "deployment rolled back", "deploymentID", failed.ID, "rolledBackTo", def.ID)
+		return nil
+	}
+
+	h.l.WarnContext(ctx, "no deployment to roll back to", "deploymentID", failed.ID, "appID", failed.AppID)
+	return nil
+}
@@ -0,0 +1,128 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func newSmokeTestServer(t *testing.T, th *testHandler, status int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	th.httpClient = server.Client()
+
+	originalDelay := smokeTestRetryDelay
+	smokeTestRetryDelay = time.Millisecond
+	t.Cleanup(func() { smokeTestRetryDelay = originalDelay })
+
+	return server, &calls
+}
+
+func smokeTestSpace(host string, rollback bool) tqsdk.Space {
+	return tqsdk.Space{
+		Key: "space",
+		Service: tqsdk.Service{
+			Name: "api",
+			Host: host,
+			SmokeTest: &tqsdk.SmokeTest{
+				Path:              "/healthz",
+				Timeout:           time.Second,
+				Retries:           2,
+				RollbackOnFailure: rollback,
+			},
+		},
+	}
+}
+
+func TestSmokeTestPasses(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	server, calls := newSmokeTestServer(t, th, http.StatusOK)
+	th.extractor.space = smokeTestSpace(server.Listener.Addr().String(), false)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestSmokeTestFailureRollsBack(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	previous := th.db.deployments[0]
+	require.Equal(t, DeploymentStatusDeployed, previous.Status)
+
+	server, calls := newSmokeTestServer(t, th, http.StatusInternalServerError)
+	th.extractor.space = smokeTestSpace(server.Listener.Addr().String(), true)
+
+	_, rpcErr = th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Contains(t, rpcErr.Message, "returned 500, expected 200")
+
+	failed := th.db.deployments[1]
+	assert.Equal(t, DeploymentStatusFailed, failed.Status)
+	require.NotNil(t, failed.Failure)
+	assert.Equal(t, DeploymentStageSmokeTest, failed.Failure.Stage)
+	assert.Equal(t, FailureClassUser, failed.Failure.Class)
+	assert.Equal(t, int32(3), calls.Load(), "the check must be retried")
+	assert.Equal(t, []string{previous.ID, failed.ID, previous.ID}, th.kube.applied, "previous deployment must be applied again")
+}
+
+func TestSmokeTestFailureWithoutRollback(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	server, _ := newSmokeTestServer(t, th, http.StatusServiceUnavailable)
+	th.extractor.space = smokeTestSpace(server.Listener.Addr().String(), false)
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+
+	def := th.db.deployments[0]
+	assert.Equal(t, DeploymentStatusFailed, def.Status)
+	assert.Equal(t, DeploymentStageSmokeTest, def.Failure.Stage)
+	assert.Equal(t, []string{def.ID}, th.kube.applied)
+}
+
+func TestSmokeTestWaitsForRollout(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{})
+	// the old pods answer 503 until the rollout of the new ones is done
+	var ready atomic.Bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	th.httpClient = server.Client()
+	th.kube.waitReady = func(ctx context.Context, data string) error {
+		ready.Store(true)
+		return nil
+	}
+	space := smokeTestSpace(server.Listener.Addr().String(), false)
+	space.Service.SmokeTest.Retries = 0
+	th.extractor.space = space
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployments[0].Status, "the smoke test checks the rolled out pods")
+	assert.Equal(t, []string{"apply", "wait ready"}, th.kube.calls)
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// SlotsUsage is a snapshot of the limited concurrent calls
+type SlotsUsage struct {
+	// InFlight are the running calls
+	InFlight int `json:"inFlight"`
+	// Queued are the calls waiting for a free slot
+	Queued int `json:"queued"`
+	// Limit is the max of the concurrent calls, zero is unlimited
+	Limit int `json:"limit"`
+}
+
+type StatusResponse struct {
+	// Builds are the image builds of all the deployments sharing the docker daemon
+	Builds SlotsUsage `json:"builds"`
+	Pushes SlotsUsage `json:"pushes"`
+	// Draining tells the instance takes no webhook deliveries, it's done once its running deployments are zero
+	Draining    bool `json:"draining"`
+	Deployments int  `json:"deployments"`
+}
+
+// Status reports the load of the treenq instance, e.g. to tell the builds wait for the docker daemon
+func (h *Handler) Status(ctx context.Context, _ struct{}) (StatusResponse, *vel.Error) {
+	return StatusResponse{
+		Builds:      h.builds.usage(),
+		Pushes:      h.pushes.usage(),
+		Draining:    h.draining.Load(),
+		Deployments: h.runs.running(),
+	}, nil
+}
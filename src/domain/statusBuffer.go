@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TerminalDeploymentStatuses are set once a deployment is done, its status never changes again
+var TerminalDeploymentStatuses = []DeploymentStatus{
+	DeploymentStatusDeployed,
+	DeploymentStatusFailed,
+	DeploymentStatusRejected,
+	DeploymentStatusApprovalExpired,
+	DeploymentStatusSkipped,
+	DeploymentStatusSuperseded,
+	DeploymentStatusCancelled,
+	DeploymentStatusPromotionExpired,
+}
+
+func (s DeploymentStatus) Terminal() bool {
+	return slices.Contains(TerminalDeploymentStatuses, s)
+}
+
+// StatusBuffer is a write-behind buffer of the deployment status updates.
+// The intermediate statuses are coalesced per deployment and written in a batch once a window,
+// the terminal statuses are written immediately, the rest of the Database calls pass through.
+// Once it's closed every status is written immediately.
+type StatusBuffer struct {
+	Database
+
+	window time.Duration
+	l      *slog.Logger
+
+	mu sync.Mutex
+	// pending are the latest unwritten statuses by the deployment id
+	pending map[string]DeploymentStatus
+	// closed is set once nothing flushes the pending statuses anymore
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewStatusBuffer starts flushing the buffered statuses every window until it's closed
+func NewStatusBuffer(db Database, window time.Duration, l *slog.Logger) *StatusBuffer {
+	b := &StatusBuffer{
+		Database: db,
+		window:   window,
+		l:        l,
+		pending:  make(map[string]DeploymentStatus),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *StatusBuffer) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if err := b.Flush(context.Background()); err != nil {
+				b.l.Error("failed to flush deployment statuses", "err", err)
+			}
+		}
+	}
+}
+
+func (b *StatusBuffer) UpdateDeploymentStatus(ctx context.Context, id string, status DeploymentStatus) error {
+	b.mu.Lock()
+	if !status.Terminal() && !b.closed {
+		b.pending[id] = status
+		b.mu.Unlock()
+		return nil
+	}
+	// a pending intermediate status is outdated, the batch never overwrites a terminal one anyway
+	delete(b.pending, id)
+	b.mu.Unlock()
+
+	return b.Database.UpdateDeploymentStatus(ctx, id, status)
+}
+
+func (b *StatusBuffer) GetDeployment(ctx context.Context, id string) (AppDefinition, error) {
+	def, err := b.Database.GetDeployment(ctx, id)
+	if err != nil {
+		return def, err
+	}
+	return b.withPending(def), nil
+}
+
+func (b *StatusBuffer) GetDeploymentHistory(ctx context.Context, appID string) ([]AppDefinition, error) {
+	history, err := b.Database.GetDeploymentHistory(ctx, appID)
+	for i := range history {
+		history[i] = b.withPending(history[i])
+	}
+	return history, err
+}
+
+// withPending sets the unwritten status of the deployment, the callers read their own writes
+func (b *StatusBuffer) withPending(def AppDefinition) AppDefinition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if status, ok := b.pending[def.ID]; ok && !def.Status.Terminal() {
+		def.Status = status
+	}
+	return def
+}
+
+// Flush writes the pending statuses in a single batch, they are kept to retry on failure
+func (b *StatusBuffer) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	if len(b.pending) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	pending := b.pending
+	b.pending = make(map[string]DeploymentStatus)
+	b.mu.Unlock()
+
+	if err := b.Database.UpdateDeploymentStatuses(ctx, pending); err != nil {
+		b.mu.Lock()
+		for id, status := range pending {
+			// a newer status has been set meanwhile
+			if _, ok := b.pending[id]; !ok {
+				b.pending[id] = status
+			}
+		}
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops the periodic flush and writes the pending statuses,
+// it's called once the server has drained the requests and the background deployments are done,
+// a deployment outlasting the shutdown writes its statuses to the Database directly
+func (b *StatusBuffer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	close(b.stop)
+	<-b.done
+	return b.Flush(ctx)
+}
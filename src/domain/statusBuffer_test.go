@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStatusBuffer(t *testing.T, window time.Duration, ids ...string) (*StatusBuffer, *fakeDB) {
+	db := &fakeDB{}
+	for _, id := range ids {
+		db.deployments = append(db.deployments, AppDefinition{ID: id, AppID: testAppID, Status: DeploymentStatusAwaitingApproval})
+	}
+	return NewStatusBuffer(db, window, slog.New(slog.NewTextHandler(io.Discard, nil))), db
+}
+
+func TestStatusBufferCoalescesIntermediateStatuses(t *testing.T) {
+	buffer, db := newTestStatusBuffer(t, time.Hour, "1", "2")
+	ctx := context.Background()
+
+	for range 10 {
+		require.NoError(t, buffer.UpdateDeploymentStatus(ctx, "1", DeploymentStatusDeploying))
+		require.NoError(t, buffer.UpdateDeploymentStatus(ctx, "2", DeploymentStatusDeploying))
+	}
+	assert.Zero(t, db.statusWrites)
+	def, err := buffer.GetDeployment(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, DeploymentStatusDeploying, def.Status, "the buffered status is read back")
+
+	require.NoError(t, buffer.UpdateDeploymentStatus(ctx, "1", DeploymentStatusDeployed))
+	assert.Equal(t, 1, db.statusWrites, "a terminal status is written immediately")
+	assert.Equal(t, DeploymentStatusDeployed, db.deployment(t, "1").Status)
+
+	require.NoError(t, buffer.Close(ctx))
+	assert.Equal(t, 2, db.statusWrites, "the pending statuses are written in a single batch")
+	assert.Equal(t, DeploymentStatusDeployed, db.deployment(t, "1").Status)
+	assert.Equal(t, DeploymentStatusDeploying, db.deployment(t, "2").Status)
+}
+
+func TestStatusBufferNeverOverwritesTerminalStatus(t *testing.T) {
+	buffer, db := newTestStatusBuffer(t, time.Hour, "1")
+	ctx := context.Background()
+
+	require.NoError(t, buffer.UpdateDeploymentStatus(ctx, "1", DeploymentStatusRejected))
+	// a late intermediate update of a done deployment
+	require.NoError(t, buffer.UpdateDeploymentStatus(ctx, "1", DeploymentStatusDeploying))
+	def, err := buffer.GetDeployment(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, DeploymentStatusRejected, def.Status)
+
+	require.NoError(t, buffer.Close(ctx))
+	assert.Equal(t, DeploymentStatusRejected, db.deployment(t, "1").Status)
+}
+
+func TestStatusBufferFlushesEveryWindow(t *testing.T) {
+	buffer, db := newTestStatusBuffer(t, 10*time.Millisecond, "1")
+	defer buffer.Close(context.Background())
+
+	require.NoError(t, buffer.UpdateDeploymentStatus(context.Background(), "1", DeploymentStatusDeploying))
+	assert.Eventually(t, func() bool {
+		def, err := db.GetDeployment(context.Background(), "1")
+		return err == nil && def.Status == DeploymentStatusDeploying
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestStatusBufferWritesThroughOnceClosed(t *testing.T) {
+	buffer, db := newTestStatusBuffer(t, time.Hour, "1")
+	ctx := context.Background()
+	require.NoError(t, buffer.Close(ctx))
+
+	// a deployment outlasting the shutdown
+	require.NoError(t, buffer.UpdateDeploymentStatus(ctx, "1", DeploymentStatusDeploying))
+	assert.Equal(t, 1, db.statusWrites, "nothing flushes a buffered status anymore")
+	assert.Equal(t, DeploymentStatusDeploying, db.deployment(t, "1").Status)
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// TagImmutability refuses to overwrite the immutable image tags in the registry,
+// a nil Immutable disables the check
+type TagImmutability struct {
+	// Immutable matches the immutable tags, the rest of the tags are the mutable aliases, e.g. latest
+	Immutable *regexp.Regexp
+}
+
+func (t TagImmutability) immutable(tag string) bool {
+	return t.Immutable != nil && t.Immutable.MatchString(tag)
+}
+
+// TagConflictError is returned if an immutable tag is pushed already with another digest,
+// it's a sign of a broken registry or a replayed build
+type TagConflictError struct {
+	Image Image
+	// Digest is the digest the registry holds for the tag
+	Digest string
+}
+
+func (e *TagConflictError) Error() string {
+	return fmt.Sprintf("immutable tag %s already exists in the registry with digest %s", e.Image.FullPath(), e.Digest)
+}
+
+// checkTagImmutability checks the pushed image doesn't move an immutable tag,
+// pushing the same image again is allowed
+func (h *Handler) checkTagImmutability(ctx context.Context, image Image) error {
+	if !h.tagImmutability.immutable(image.Tag) {
+		return nil
+	}
+
+	pushed, err := h.docker.RegistryDigest(ctx, image)
+	if err != nil {
+		return SystemFailure(fmt.Errorf("failed to get registry digest of %s: %w", image.FullPath(), err))
+	}
+	if pushed == "" {
+		return nil
+	}
+
+	local, err := h.docker.RepoDigests(ctx, image)
+	if err != nil {
+		return SystemFailure(fmt.Errorf("failed to get repo digests of %s: %w", image.FullPath(), err))
+	}
+	if slices.Contains(local, pushed) {
+		return nil
+	}
+	return &TagConflictError{Image: image, Digest: pushed}
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestPushImageRejectsConflictingImmutableTag(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.tagImmutability = TagImmutability{Immutable: regexp.MustCompile(`^[0-9a-f]{7,40}$`)}
+	image := Image{Registry: "registry", Repository: "api", Tag: "64263a02d293b1d4ec638ed98d3f3a93f0f788cb"}
+	th.docker.registryDigests = map[string]string{image.FullPath(): "sha256:pushed"}
+	th.docker.repoDigests = map[string][]string{image.FullPath(): {"sha256:rebuilt"}}
+
+	_, err := th.pushImage(context.Background(), "api", image)
+	var conflictErr *TagConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	assert.Equal(t, "sha256:pushed", conflictErr.Digest)
+	assert.Equal(t, "TAG_IMMUTABLE_CONFLICT", deployError(err).Code)
+	assert.Empty(t, th.docker.pushes, "the immutable tag must not be overwritten")
+
+	// the image pushed before is pushed again
+	th.docker.repoDigests[image.FullPath()] = []string{"sha256:pushed"}
+	_, err = th.pushImage(context.Background(), "api", image)
+	require.NoError(t, err)
+	assert.Len(t, th.docker.pushes, 1)
+}
+
+func TestPushImageMovesMutableTag(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.tagImmutability = TagImmutability{Immutable: regexp.MustCompile(`^[0-9a-f]{7,40}$`)}
+	image := Image{Registry: "registry", Repository: "api", Tag: "latest"}
+	th.docker.registryDigests = map[string]string{image.FullPath(): "sha256:previous"}
+
+	pushed, err := th.pushImage(context.Background(), "api", image)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256:api", pushed.Digest)
+	assert.Len(t, th.docker.pushes, 1)
+}
+
+func TestGithubWebhookPushesShaTag(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.tagImmutability = TagImmutability{Immutable: regexp.MustCompile(`^[0-9a-f]{7,40}$`)}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.docker.pushes, 1)
+	assert.Equal(t, pushRequest().After, th.docker.pushes[0].Tag, "a pushed commit is tagged with its sha")
+	assert.Equal(t, pushRequest().After, th.db.deployments[0].Tag)
+}
+
+func TestGithubWebhookRejectsMovedShaTag(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.tagImmutability = TagImmutability{Immutable: regexp.MustCompile(`^[0-9a-f]{7,40}$`)}
+	// the sha is pushed already with another build
+	tagged := "registry/api:" + pushRequest().After
+	th.docker.registryDigests = map[string]string{tagged: "sha256:pushed"}
+	th.docker.repoDigests = map[string][]string{tagged: {"sha256:rebuilt"}}
+
+	_, rpcErr := th.GithubWebhook(context.Background(), pushRequest())
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "TAG_IMMUTABLE_CONFLICT", rpcErr.Code)
+	assert.Empty(t, th.docker.pushes, "the sha tag must not be overwritten")
+	assert.Empty(t, th.kube.applied)
+	assert.Equal(t, DeploymentStatusFailed, th.db.deployments[0].Status)
+}
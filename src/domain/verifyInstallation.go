@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// InstallationToken is an installation access token with the permissions github has granted it
+type InstallationToken struct {
+	Token string
+	// Permissions are the granted access levels by the permission name, e.g. contents: read
+	Permissions map[string]string
+	// RepositorySelection is all or selected, the token of a selected installation accesses the selected repos only
+	RepositorySelection string
+}
+
+// InstallationPermissions summarizes the latest token issued for the installation
+type InstallationPermissions struct {
+	Permissions         map[string]string `json:"permissions"`
+	RepositorySelection string            `json:"repositorySelection"`
+	CheckedAt           time.Time         `json:"checkedAt"`
+}
+
+// CanClone reports whether the token reads the repo contents
+func (p InstallationPermissions) CanClone() bool {
+	level := p.Permissions["contents"]
+	return level == "read" || level == "write"
+}
+
+// InsufficientPermissionsError tells the installation token can't clone the repos
+type InsufficientPermissionsError struct {
+	InstallationID int
+	// Granted is the contents access level of the token, empty if it has none
+	Granted string
+}
+
+func (e *InsufficientPermissionsError) Error() string {
+	granted := e.Granted
+	if granted == "" {
+		granted = "none"
+	}
+	return fmt.Sprintf("installation %d token lacks the contents: read permission, it's granted %s", e.InstallationID, granted)
+}
+
+// issueAccessToken issues the installation token and stores the summary of its permissions,
+// a failed store is logged only as the summary is kept for the diagnostics
+func (h *Handler) issueAccessToken(ctx context.Context, installationID int) (InstallationToken, InstallationPermissions, error) {
+	token, err := h.githubClient.IssueAccessToken(installationID)
+	if err != nil {
+		return InstallationToken{}, InstallationPermissions{}, err
+	}
+	permissions := InstallationPermissions{
+		Permissions:         token.Permissions,
+		RepositorySelection: token.RepositorySelection,
+		CheckedAt:           now(),
+	}
+	if err := h.db.SaveInstallationPermissions(ctx, installationID, permissions); err != nil {
+		h.l.WarnContext(ctx, "failed to save installation permissions", "installationID", installationID, "err", err)
+	}
+	return token, permissions, nil
+}
+
+type VerifyInstallationRequest struct {
+	InstallationID int `json:"installationId"`
+}
+
+type VerifyInstallationResponse struct {
+	Permissions InstallationPermissions `json:"permissions"`
+	// CanClone tells the token of the installation clones the private repos
+	CanClone bool `json:"canClone"`
+}
+
+// VerifyInstallation issues a token for the installation of the user repos and returns the permissions it's granted
+func (h *Handler) VerifyInstallation(ctx context.Context, req VerifyInstallationRequest) (VerifyInstallationResponse, *vel.Error) {
+	repos, rpcErr := h.GetRepos(ctx, GetReposRequest{})
+	if rpcErr != nil {
+		return VerifyInstallationResponse{}, rpcErr
+	}
+	installed := false
+	for _, repo := range repos.Repos {
+		if repo.InstallationID == req.InstallationID {
+			installed = true
+			break
+		}
+	}
+	if !installed {
+		return VerifyInstallationResponse{}, &vel.Error{
+			Code:    "INSTALLATION_NOT_FOUND",
+			Message: fmt.Sprintf("installation %d not found", req.InstallationID),
+		}
+	}
+
+	_, permissions, err := h.issueAccessToken(ctx, req.InstallationID)
+	if err != nil {
+		return VerifyInstallationResponse{}, &vel.Error{
+			Code:    "UNKNOWN",
+			Message: err.Error(),
+		}
+	}
+	return VerifyInstallationResponse{Permissions: permissions, CanClone: permissions.CanClone()}, nil
+}
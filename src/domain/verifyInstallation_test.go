@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func TestCloneWithoutContentsPermissionFailsEarly(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.github.tokenPermissions = map[string]string{"metadata": "read"}
+	req := pushRequest()
+	req.Repository.Private = true
+
+	_, rpcErr := th.GithubWebhook(context.Background(), req)
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "INSUFFICIENT_PERMISSIONS", rpcErr.Code)
+	assert.Contains(t, rpcErr.Message, "contents: read")
+
+	assert.Zero(t, th.git.clones, "the repo isn't cloned with the token")
+	def := th.db.deployments[0]
+	require.NotNil(t, def.Failure)
+	assert.Equal(t, DeploymentStageClone, def.Failure.Stage)
+	assert.Equal(t, FailureClassUser, def.Failure.Class)
+	assert.Equal(t, map[string]string{"metadata": "read"}, th.db.installationPermissions[1].Permissions, "the permissions are stored")
+}
+
+func TestVerifyInstallation(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos[0].InstallationID = 1
+
+	res, rpcErr := th.VerifyInstallation(userCtx("testing"), VerifyInstallationRequest{InstallationID: 1})
+	require.Nil(t, rpcErr)
+	assert.True(t, res.CanClone)
+	assert.Equal(t, map[string]string{"contents": "read", "metadata": "read"}, res.Permissions.Permissions)
+	assert.Equal(t, "selected", res.Permissions.RepositorySelection)
+	assert.Equal(t, res.Permissions, th.db.installationPermissions[1])
+
+	th.github.tokenPermissions = map[string]string{"metadata": "read"}
+	res, rpcErr = th.VerifyInstallation(userCtx("testing"), VerifyInstallationRequest{InstallationID: 1})
+	require.Nil(t, rpcErr)
+	assert.False(t, res.CanClone)
+
+	_, rpcErr = th.VerifyInstallation(userCtx("testing"), VerifyInstallationRequest{InstallationID: 2})
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, "INSTALLATION_NOT_FOUND", rpcErr.Code)
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RepoVisibility selects the repos deployed by their github visibility
+type RepoVisibility string
+
+const (
+	RepoVisibilityAll     RepoVisibility = "all"
+	RepoVisibilityPublic  RepoVisibility = "public"
+	RepoVisibilityPrivate RepoVisibility = "private"
+)
+
+func (v RepoVisibility) allows(private bool) bool {
+	switch v {
+	case RepoVisibilityPublic:
+		return !private
+	case RepoVisibilityPrivate:
+		return private
+	default:
+		return true
+	}
+}
+
+// VisibilityPolicy tells which repos are deployed by their visibility,
+// an org policy overrides the default one for the repos owned by the org
+type VisibilityPolicy struct {
+	Default RepoVisibility
+	// Orgs holds the policies by the github org or user login
+	Orgs map[string]RepoVisibility
+}
+
+func (p VisibilityPolicy) Validate() error {
+	visibilities := []RepoVisibility{p.Default}
+	for _, visibility := range p.Orgs {
+		visibilities = append(visibilities, visibility)
+	}
+	for _, visibility := range visibilities {
+		switch visibility {
+		case "", RepoVisibilityAll, RepoVisibilityPublic, RepoVisibilityPrivate:
+		default:
+			return fmt.Errorf("unknown repo visibility %q, expected one of all, public, private", visibility)
+		}
+	}
+	return nil
+}
+
+// allows reports whether the repo visibility is allowed by the policy of the repo owner
+func (p VisibilityPolicy) allows(repo InstalledRepository) bool {
+	owner, _, _ := strings.Cut(repo.FullName, "/")
+	if visibility, ok := p.Orgs[owner]; ok {
+		return visibility.allows(repo.Private)
+	}
+	return p.Default.allows(repo.Private)
+}
@@ -0,0 +1,171 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+// webhookRetryInterval is the polling interval hinted per a round of the build slots a queued deployment waits for
+const webhookRetryInterval = 10 * time.Second
+
+// deliveryAck collects the deployments of the pushed repos, the delivery is acked with them.
+// A nil ack collects nothing, e.g. a debounced push is deployed after its delivery is acked.
+type deliveryAck struct {
+	// reserve assigns the ids before the deployments are saved, the delivery may be acked before they're done
+	reserve bool
+
+	mu          sync.Mutex
+	deployments []WebhookDeployment
+}
+
+type deliveryAckKey struct{}
+
+func withDeliveryAck(ctx context.Context, reserve bool) (context.Context, *deliveryAck) {
+	ack := &deliveryAck{reserve: reserve}
+	return context.WithValue(ctx, deliveryAckKey{}, ack), ack
+}
+
+// withoutDeliveryAck detaches the context from the delivery, the later deployments aren't reported to it
+func withoutDeliveryAck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deliveryAckKey{}, (*deliveryAck)(nil))
+}
+
+func deliveryAckFrom(ctx context.Context) *deliveryAck {
+	ack, _ := ctx.Value(deliveryAckKey{}).(*deliveryAck)
+	return ack
+}
+
+// queue reports the push of the repo as queued, it returns the deployment id and the index of the report.
+// The id is reserved if the delivery may be acked before the deployment is done,
+// otherwise it's empty and assigned once the deployment is saved.
+func (a *deliveryAck) queue(repoID int, sha string) (string, int) {
+	if a == nil {
+		return "", -1
+	}
+	var deploymentID string
+	if a.reserve {
+		deploymentID = uuid.NewString()
+	}
+	return deploymentID, a.report(WebhookDeployment{RepoID: repoID, Outcome: DeployOutcomeQueued, DeploymentID: deploymentID, Sha: sha})
+}
+
+// report adds the deployment to the delivery and returns its index, so the outcome is updated once it's deployed
+func (a *deliveryAck) report(deployment WebhookDeployment) int {
+	if a == nil {
+		return -1
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deployments = append(a.deployments, deployment)
+	return len(a.deployments) - 1
+}
+
+// deployed marks the reported deployment as done before the delivery is acked
+func (a *deliveryAck) deployed(i int, deploymentID string) {
+	if a == nil || i < 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deployments[i].Outcome = DeployOutcomeImmediate
+	a.deployments[i].DeploymentID = deploymentID
+}
+
+func (a *deliveryAck) reported() []WebhookDeployment {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]WebhookDeployment(nil), a.deployments...)
+}
+
+// deployRepos deploys the pushed repos waiting for them up to the ack timeout.
+// The deployments outlasting it go on in the background and the delivery is acked as accepted with their ids,
+// so github never times out a delivery while its builds wait in the queue.
+func (h *Handler) deployRepos(ctx context.Context, req GithubWebhookRequest) (GithubWebhookResponse, *vel.Error) {
+	if h.timeouts.Ack <= 0 {
+		ctx, ack := withDeliveryAck(ctx, false)
+		if err := h.deployAll(ctx, req); err != nil {
+			return GithubWebhookResponse{}, deployError(err)
+		}
+		return h.ackDelivery(ctx, ack.reported()), nil
+	}
+
+	// the deployments must outlive the delivery request
+	deployCtx, ack := withDeliveryAck(context.WithoutCancel(ctx), true)
+	done := make(chan error, 1)
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		done <- h.deployAll(deployCtx, req)
+	}()
+
+	timer := time.NewTimer(h.timeouts.Ack)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return GithubWebhookResponse{}, deployError(err)
+		}
+		return h.ackDelivery(ctx, ack.reported()), nil
+	case <-timer.C:
+	}
+
+	go func() {
+		if err := <-done; err != nil {
+			h.l.ErrorContext(deployCtx, "failed to deploy queued webhook delivery", "repoID", req.Repository.ID, "err", err)
+		}
+	}()
+	deployments := ack.reported()
+	retryAfter := h.retryAfter()
+	h.l.InfoContext(ctx, "webhook delivery is acked before its deployments are done", "deployments", deployments, "retryAfter", retryAfter)
+	vel.WriteStatus(ctx, http.StatusAccepted)
+	return GithubWebhookResponse{
+		Deployments: deployments,
+		Queued:      true,
+		RetryAfter:  retryAfter,
+	}, nil
+}
+
+// ackDelivery acks the delivery with the deployments reported by its repos
+func (h *Handler) ackDelivery(ctx context.Context, deployments []WebhookDeployment) GithubWebhookResponse {
+	h.l.InfoContext(ctx, "webhook delivery is handled", "deployments", deployments)
+	return GithubWebhookResponse{Deployments: deployments}
+}
+
+// deployAll admits every repo of the delivery first, so each of them is reported before the delivery is acked
+// even if the builds of the earlier ones outlast the ack timeout. The admitted pushes are deployed one by one,
+// every reported push is deployed and the first failure is returned.
+func (h *Handler) deployAll(ctx context.Context, req GithubWebhookRequest) error {
+	var pushes []func() error
+	for _, repo := range req.ReposToProcess() {
+		push, err := h.admitRepo(ctx, req, repo)
+		if err != nil {
+			return err
+		}
+		if push != nil {
+			pushes = append(pushes, push)
+		}
+	}
+	var firstErr error
+	for _, push := range pushes {
+		if err := push(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// retryAfter hints how many seconds to wait before polling the queued deployments, it's zero unless the build queue is deep,
+// i.e. the waiting builds take all the build slots at least once more
+func (h *Handler) retryAfter() int {
+	usage := h.builds.usage()
+	if usage.Limit == 0 || usage.Queued < usage.Limit {
+		return 0
+	}
+	rounds := usage.Queued/usage.Limit + 1
+	return rounds * int(webhookRetryInterval.Seconds())
+}
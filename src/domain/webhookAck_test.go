@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+func TestGithubWebhookAcksQueuedDeployment(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.timeouts = DeployTimeouts{Ack: 50 * time.Millisecond}
+	th.builds = newSlots(1)
+	// the only build slot is taken and another build waits for it, so the pushed build is queued deep
+	release, err := th.builds.acquire(context.Background())
+	require.NoError(t, err)
+	waiting := make(chan struct{})
+	go func() {
+		if release, err := th.builds.acquire(context.Background()); err == nil {
+			<-waiting
+			release()
+		}
+	}()
+	require.Eventually(t, func() bool { return th.builds.usage().Queued == 1 }, time.Second, time.Millisecond)
+	t.Cleanup(func() {
+		close(waiting)
+		release()
+	})
+
+	w := httptest.NewRecorder()
+	started := time.Now()
+	res, rpcErr := th.GithubWebhook(vel.WriterWithContext(context.Background(), w), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Less(t, time.Since(started), time.Second, "the delivery is acked without waiting for the build")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.True(t, res.Queued)
+	assert.Equal(t, 30, res.RetryAfter, "two builds wait for a single slot")
+	require.Len(t, res.Deployments, 1)
+
+	polled, rpcErr := th.GetDeployment(userCtx("testing"), GetDeploymentRequest{DeploymentID: res.Deployments[0].DeploymentID})
+	require.Nil(t, rpcErr)
+	assert.Equal(t, DeploymentStatusDeploying, polled.Deployment.Status, "the queued deployment is found before it's saved")
+	assert.Equal(t, testAppID, polled.Deployment.AppID)
+}
+
+func TestGithubWebhookAcksDoneDeployment(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.timeouts = DeployTimeouts{Ack: time.Minute}
+
+	w := httptest.NewRecorder()
+	res, rpcErr := th.GithubWebhook(vel.WriterWithContext(context.Background(), w), pushRequest())
+	require.Nil(t, rpcErr)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, res.Queued)
+	assert.Zero(t, res.RetryAfter)
+	require.Len(t, res.Deployments, 1)
+	assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, res.Deployments[0].DeploymentID).Status, "the deployment is saved with the reserved id")
+}
+
+func TestRetryAfterOnlyForDeepQueue(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.builds = newSlots(2)
+	assert.Zero(t, th.retryAfter(), "nothing is queued")
+
+	th.builds.queued.Store(1)
+	assert.Zero(t, th.retryAfter(), "the queued build takes the next free slot")
+
+	th.builds.queued.Store(5)
+	assert.Equal(t, 30, th.retryAfter())
+
+	th.builds = newSlots(0)
+	th.builds.queued.Store(5)
+	assert.Zero(t, th.retryAfter(), "unlimited builds are never queued")
+}
+
+func TestGithubWebhookAcksEveryRepoOfQueuedDelivery(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.db.repos = nil
+	th.github.installationRepos = []Repository{
+		{ID: 805585115, FullName: "treenq/treenq", DefaultBranch: "main"},
+		{ID: 805585116, FullName: "treenq/docs", DefaultBranch: "gh-pages"},
+		{ID: 805585117, FullName: "treenq/private", Private: true, DefaultBranch: "master"},
+	}
+	th.timeouts = DeployTimeouts{Ack: 10 * time.Millisecond}
+	th.builds = newSlots(1)
+	// the only build slot is taken, so the first repo build outlasts the ack
+	release, err := th.builds.acquire(context.Background())
+	require.NoError(t, err)
+
+	var install GithubWebhookRequest
+	require.NoError(t, json.Unmarshal(appInstallBody, &install))
+	res, rpcErr := th.GithubWebhook(context.Background(), install)
+	require.Nil(t, rpcErr)
+	require.True(t, res.Queued)
+
+	require.Len(t, res.Deployments, 3, "the repos waiting for the first one are acked too")
+	for _, deployment := range res.Deployments {
+		assert.Equal(t, DeployOutcomeQueued, deployment.Outcome)
+		assert.NotEmpty(t, deployment.DeploymentID)
+	}
+
+	release()
+	require.NoError(t, th.Shutdown(context.Background()))
+	for _, deployment := range res.Deployments {
+		assert.Equal(t, DeploymentStatusDeployed, th.db.deployment(t, deployment.DeploymentID).Status, "the deployment is saved with the acked id")
+	}
+}
@@ -0,0 +1,12 @@
+package domain
+
+import "slices"
+
+// WebhookEvents is the allow-list of the X-GitHub-Event types the webhook processes,
+// the other deliveries are acknowledged and ignored. An empty list allows every event.
+type WebhookEvents []string
+
+// allows reports whether the event is processed, a call without the event header isn't a github delivery and is processed
+func (e WebhookEvents) allows(event string) bool {
+	return len(e) == 0 || event == "" || slices.Contains(e, event)
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+func webhookCtx(event string) context.Context {
+	r := httptest.NewRequest("POST", "/githubWebhook", nil)
+	r.Header.Set("X-GitHub-Event", event)
+	return vel.RequestWithContext(context.Background(), r)
+}
+
+func TestDisallowedWebhookEventIsAcknowledgedOnly(t *testing.T) {
+	th := newTestHandler(t, tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api"}})
+	th.webhookEvents = WebhookEvents{"push", "installation"}
+
+	// a push shaped payload of another event must not deploy anything
+	_, rpcErr := th.GithubWebhook(webhookCtx("workflow_run"), pushRequest())
+	require.Nil(t, rpcErr, "the delivery is acknowledged")
+	assert.Empty(t, th.db.deployments)
+	assert.Zero(t, th.git.clones)
+
+	_, rpcErr = th.GithubWebhook(webhookCtx("push"), pushRequest())
+	require.Nil(t, rpcErr)
+	require.Len(t, th.db.deployments, 1)
+	assert.Equal(t, "push", th.db.deployments[0].Event)
+}
+
+func TestWebhookEventsAllows(t *testing.T) {
+	events := WebhookEvents{"push"}
+	assert.True(t, events.allows("push"))
+	assert.False(t, events.allows("issues"))
+	assert.True(t, events.allows(""), "a call without the event header isn't a delivery")
+	assert.True(t, WebhookEvents(nil).allows("issues"), "an empty list allows every event")
+}
@@ -0,0 +1,38 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/treenq/treenq/src/domain"
+)
+
+// CosignSigner signs the pushed images with a cosign key,
+// the signature is pushed next to the image as cosign does by default
+type CosignSigner struct {
+	// key is a cosign private key path or a KMS uri
+	key string
+}
+
+func NewCosignSigner(key string) *CosignSigner {
+	return &CosignSigner{key: key}
+}
+
+func (s *CosignSigner) Sign(ctx context.Context, image domain.Image) (string, error) {
+	if image.Digest == "" {
+		return "", fmt.Errorf("image %s has no digest to sign", image.FullPath())
+	}
+
+	out, err := exec.CommandContext(ctx, "cosign", "sign", "--yes", "--key", s.key, image.DigestPath()).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to sign image: %s: %w", string(out), err)
+	}
+	return signatureRef(image), nil
+}
+
+// signatureRef returns the tag cosign pushes the signature of the image digest to: sha256-<hex>.sig
+func signatureRef(image domain.Image) string {
+	return fmt.Sprintf("%s/%s:%s.sig", image.Registry, image.Repository, strings.Replace(image.Digest, ":", "-", 1))
+}
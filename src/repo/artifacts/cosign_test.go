@@ -0,0 +1,13 @@
+package artifacts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func TestSignatureRef(t *testing.T) {
+	image := domain.Image{Registry: "registry.treenq.com", Repository: "api", Tag: "latest", Digest: "sha256:3f0e99"}
+	assert.Equal(t, "registry.treenq.com/api:sha256-3f0e99.sig", signatureRef(image))
+}
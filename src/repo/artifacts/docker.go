@@ -3,21 +3,40 @@ package artifacts
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/treenq/treenq/src/domain"
 )
 
 type DockerArtifact struct {
 	registry string
+	// builders are the docker buildx builders available besides the system one
+	builders []string
+	// buildpackBuilder is the builder image the pack cli builds the buildpack images with, empty disables buildpacks
+	buildpackBuilder string
 }
 
-func NewDockerArtifactory(registry string) *DockerArtifact {
+func NewDockerArtifactory(registry string, builders []string, buildpackBuilder string) *DockerArtifact {
 	return &DockerArtifact{
-		registry: registry,
+		registry:         registry,
+		builders:         builders,
+		buildpackBuilder: buildpackBuilder,
 	}
 }
 
+func (a *DockerArtifact) HasBuilder(name string) bool {
+	return slices.Contains(a.builders, name)
+}
+
+func (a *DockerArtifact) HasBuildpacks() bool {
+	return a.buildpackBuilder != ""
+}
+
 func (a *DockerArtifact) Image(args domain.BuildArtifactRequest) domain.Image {
 	return domain.Image{
 		Registry:   a.registry,
@@ -26,22 +45,181 @@ func (a *DockerArtifact) Image(args domain.BuildArtifactRequest) domain.Image {
 	}
 }
 
-func (a *DockerArtifact) Build(ctx context.Context, args domain.BuildArtifactRequest) (domain.Image, error) {
+// buildCancelDelay is how long a cancelled build may take to stop
+const buildCancelDelay = 10 * time.Second
+
+func (a *DockerArtifact) Build(ctx context.Context, args domain.BuildArtifactRequest) (domain.Image, domain.BuildMetrics, error) {
 	image := a.Image(args)
 
-	buildCmd := exec.Command("docker", "build", "-t", image.Image(), "-f", args.Dockerfile, args.Path)
+	if args.Buildpack {
+		if !a.HasBuildpacks() {
+			return image, domain.BuildMetrics{}, domain.UserFailure(fmt.Errorf("%w: service %q", domain.ErrBuildpacksUnavailable, args.Name))
+		}
+	} else if args.Builder != "" && !a.HasBuilder(args.Builder) {
+		return image, domain.BuildMetrics{}, domain.UserFailure(fmt.Errorf("%w: %q", domain.ErrBuilderUnavailable, args.Builder))
+	}
+
+	start := time.Now()
+	buildCmd := exec.CommandContext(ctx, "docker", buildArgs(image, args)...)
+	if args.Buildpack {
+		buildCmd = exec.CommandContext(ctx, "pack", packArgs(image, args, a.buildpackBuilder)...)
+	}
+	// an interrupted docker cli asks BuildKit to abort the build, it's killed if it doesn't exit in time
+	buildCmd.Cancel = func() error {
+		return buildCmd.Process.Signal(os.Interrupt)
+	}
+	buildCmd.WaitDelay = buildCancelDelay
 	buildOut, err := buildCmd.CombinedOutput()
+	metrics := buildMetrics(string(buildOut), time.Since(start))
 	if err != nil {
-		return image, fmt.Errorf("failed to build docker image: %s: %w", string(buildOut), err)
+		return image, metrics, classifyBuildError(string(buildOut), fmt.Errorf("failed to build docker image: %s: %w", string(buildOut), err))
 	}
 
-	if buildOut, err := exec.Command("docker", "tag", image.Image(), image.FullPath()).CombinedOutput(); err != nil {
-		return image, fmt.Errorf("failed to tag docker image: %s: %w", string(buildOut), err)
+	if buildOut, err := exec.CommandContext(ctx, "docker", "tag", image.Image(), image.FullPath()).CombinedOutput(); err != nil {
+		return image, metrics, domain.SystemFailure(fmt.Errorf("failed to tag docker image: %s: %w", string(buildOut), err))
 	}
 
-	if buildOut, err := exec.Command("docker", "push", image.FullPath()).CombinedOutput(); err != nil {
-		return image, fmt.Errorf("failed to push docker image: %s: %w", string(buildOut), err)
+	return image, metrics, nil
+}
+
+func (a *DockerArtifact) Push(ctx context.Context, image domain.Image) (domain.Image, error) {
+	pushOut, err := exec.CommandContext(ctx, "docker", "push", image.FullPath()).CombinedOutput()
+	if err != nil {
+		return image, domain.SystemFailure(fmt.Errorf("failed to push docker image: %s: %w", string(pushOut), err))
 	}
 
+	image.Digest = pushedDigest(string(pushOut))
 	return image, nil
 }
+
+// pushDigestPattern matches the docker push summary line: "latest: digest: sha256:... size: 1234"
+var pushDigestPattern = regexp.MustCompile(`digest: (sha256:[a-f0-9]{64})`)
+
+// pushedDigest returns the pushed image digest from the docker push output, empty if it's not found
+func pushedDigest(output string) string {
+	match := pushDigestPattern.FindStringSubmatch(output)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// Remove removes the image by its digest, by its tag if the digest is unknown
+func (a *DockerArtifact) Remove(ctx context.Context, image domain.Image) error {
+	if out, err := exec.CommandContext(ctx, "docker", "image", "rm", image.PullPath()).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove docker image: %s: %w", string(out), err)
+	}
+	return nil
+}
+
+// Exists reports whether the image is in the local image store, a missing image is not an error
+func (a *DockerArtifact) Exists(ctx context.Context, image domain.Image) (bool, error) {
+	out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", image.FullPath()).CombinedOutput()
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(out)), "no such image") {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to inspect docker image: %s: %w", string(out), err)
+	}
+	return true, nil
+}
+
+// RegistryDigest returns the manifest digest of the pushed image tag, a tag missing in the registry is not an error
+func (a *DockerArtifact) RegistryDigest(ctx context.Context, image domain.Image) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "buildx", "imagetools", "inspect", "--format", "{{.Manifest.Digest}}", image.FullPath()).CombinedOutput()
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(out)), "not found") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to inspect registry image: %s: %w", string(out), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// RepoDigests returns the registry digests of the local image, the image pushed or pulled before is known by them
+func (a *DockerArtifact) RepoDigests(ctx context.Context, image domain.Image) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", `{{join .RepoDigests "\n"}}`, image.FullPath()).CombinedOutput()
+	if err != nil {
+		if strings.Contains(strings.ToLower(string(out)), "no such image") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to inspect docker image: %s: %w", string(out), err)
+	}
+	return repoDigests(string(out)), nil
+}
+
+// repoDigests returns the digests of the image repo digests output: "registry/api@sha256:..." a line
+func repoDigests(output string) []string {
+	var digests []string
+	for _, line := range strings.Split(output, "\n") {
+		_, digest, ok := strings.Cut(strings.TrimSpace(line), "@")
+		if ok {
+			digests = append(digests, digest)
+		}
+	}
+	return digests
+}
+
+// buildArgs returns the docker cli args to build the image,
+// a selected builder is run via buildx and the result is loaded into the local image store to be tagged and pushed
+func buildArgs(image domain.Image, args domain.BuildArtifactRequest) []string {
+	// the plain progress lists the build steps and their cache hits, see buildMetrics
+	cmd := []string{"build"}
+	if args.Builder != "" {
+		cmd = []string{"buildx", "build", "--builder", args.Builder, "--load"}
+	}
+	cmd = append(cmd, "--progress=plain")
+	if args.NoCache {
+		cmd = append(cmd, "--no-cache")
+	}
+	return append(cmd, "-t", image.Image(), "-f", args.Dockerfile, args.Path)
+}
+
+// packArgs returns the pack cli args to build the image of the source with the buildpack builder,
+// the image is built into the local image store to be tagged and pushed as a docker built one
+func packArgs(image domain.Image, args domain.BuildArtifactRequest, builder string) []string {
+	cmd := []string{"build", image.Image(), "--builder", builder, "--path", args.Path}
+	if args.NoCache {
+		cmd = append(cmd, "--clear-cache")
+	}
+	return cmd
+}
+
+var (
+	// buildStepPattern matches a Dockerfile instruction step of the BuildKit plain progress: "#5 [2/4] RUN go build"
+	buildStepPattern = regexp.MustCompile(`(?m)^#(\d+) \[[^\]]*\d+/\d+\] `)
+	// cachedStepPattern matches a step served from the build cache: "#5 CACHED"
+	cachedStepPattern = regexp.MustCompile(`(?m)^#(\d+) CACHED\s*$`)
+)
+
+// buildMetrics counts the built and the cached layers of the BuildKit plain progress output
+func buildMetrics(output string, duration time.Duration) domain.BuildMetrics {
+	steps := make(map[string]bool)
+	for _, match := range buildStepPattern.FindAllStringSubmatch(output, -1) {
+		steps[match[1]] = true
+	}
+	cached := 0
+	for _, match := range cachedStepPattern.FindAllStringSubmatch(output, -1) {
+		if steps[match[1]] {
+			cached++
+		}
+	}
+	return domain.BuildMetrics{
+		Duration:     duration,
+		CachedLayers: cached,
+		TotalLayers:  len(steps),
+	}
+}
+
+// daemonErrorMarkers are the docker cli outputs of a failed connection to the docker daemon
+var daemonErrorMarkers = []string{"Cannot connect to the Docker daemon", "error during connect"}
+
+// classifyBuildError tells a broken Dockerfile or app code from an unavailable docker daemon
+func classifyBuildError(output string, err error) error {
+	for _, marker := range daemonErrorMarkers {
+		if strings.Contains(output, marker) {
+			return domain.SystemFailure(err)
+		}
+	}
+	return domain.UserFailure(err)
+}
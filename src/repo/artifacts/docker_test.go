@@ -0,0 +1,142 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func TestClassifyBuildError(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		class  domain.FailureClass
+	}{
+		{
+			name:   "dockerfile error",
+			output: "ERROR: failed to solve: dockerfile parse error on line 3: unknown instruction: RUNN",
+			class:  domain.FailureClassUser,
+		},
+		{
+			name:   "failed app build step",
+			output: `ERROR: failed to solve: process "/bin/sh -c go build ./..." did not complete successfully: exit code: 1`,
+			class:  domain.FailureClassUser,
+		},
+		{
+			name:   "docker daemon is down",
+			output: "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?",
+			class:  domain.FailureClassSystem,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyBuildError(tt.output, errors.New("exit status 1"))
+
+			var failureErr *domain.FailureError
+			require.True(t, errors.As(err, &failureErr))
+			assert.Equal(t, tt.class, failureErr.Class)
+		})
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	image := domain.Image{Registry: "registry", Repository: "api", Tag: "latest"}
+
+	assert.Equal(t,
+		[]string{"build", "--progress=plain", "-t", "api:latest", "-f", "/repo/Dockerfile", "/repo"},
+		buildArgs(image, domain.BuildArtifactRequest{Dockerfile: "/repo/Dockerfile", Path: "/repo"}),
+	)
+	assert.Equal(t,
+		[]string{"buildx", "build", "--builder", "buildkit-v0.12", "--load", "--progress=plain", "-t", "api:latest", "-f", "/repo/Dockerfile", "/repo"},
+		buildArgs(image, domain.BuildArtifactRequest{Dockerfile: "/repo/Dockerfile", Path: "/repo", Builder: "buildkit-v0.12"}),
+	)
+	assert.Equal(t,
+		[]string{"build", "--progress=plain", "--no-cache", "-t", "api:latest", "-f", "/repo/Dockerfile", "/repo"},
+		buildArgs(image, domain.BuildArtifactRequest{Dockerfile: "/repo/Dockerfile", Path: "/repo", NoCache: true}),
+	)
+}
+
+func TestPackArgs(t *testing.T) {
+	image := domain.Image{Registry: "registry", Repository: "api", Tag: "latest"}
+
+	assert.Equal(t,
+		[]string{"build", "api:latest", "--builder", "paketobuildpacks/builder-jammy-base", "--path", "/repo"},
+		packArgs(image, domain.BuildArtifactRequest{Path: "/repo", Buildpack: true}, "paketobuildpacks/builder-jammy-base"),
+	)
+	assert.Equal(t,
+		[]string{"build", "api:latest", "--builder", "paketobuildpacks/builder-jammy-base", "--path", "/repo", "--clear-cache"},
+		packArgs(image, domain.BuildArtifactRequest{Path: "/repo", Buildpack: true, NoCache: true}, "paketobuildpacks/builder-jammy-base"),
+	)
+}
+
+func TestBuildBuildpacksDisabled(t *testing.T) {
+	docker := NewDockerArtifactory("registry", nil, "")
+
+	_, _, err := docker.Build(context.Background(), domain.BuildArtifactRequest{Name: "api", Tag: "latest", Buildpack: true})
+	require.ErrorIs(t, err, domain.ErrBuildpacksUnavailable)
+
+	var failureErr *domain.FailureError
+	require.True(t, errors.As(err, &failureErr))
+	assert.Equal(t, domain.FailureClassUser, failureErr.Class)
+}
+
+func TestBuildUnavailableBuilder(t *testing.T) {
+	docker := NewDockerArtifactory("registry", []string{"buildkit-v0.12"}, "")
+
+	_, _, err := docker.Build(context.Background(), domain.BuildArtifactRequest{Name: "api", Tag: "latest", Builder: "buildkit-nightly"})
+	require.ErrorIs(t, err, domain.ErrBuilderUnavailable)
+
+	var failureErr *domain.FailureError
+	require.True(t, errors.As(err, &failureErr))
+	assert.Equal(t, domain.FailureClassUser, failureErr.Class)
+}
+
+func TestPushedDigest(t *testing.T) {
+	output := `The push refers to repository [registry:5000/api]
+5f70bf18a086: Pushed
+latest: digest: sha256:3f1ea6a9e8b0c4c8d6e3b1f2a7c9d0e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0 size: 528
+`
+	assert.Equal(t, "sha256:3f1ea6a9e8b0c4c8d6e3b1f2a7c9d0e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0", pushedDigest(output))
+	assert.Equal(t, "", pushedDigest("5f70bf18a086: Layer already exists"))
+}
+
+func TestBuildMetrics(t *testing.T) {
+	output := `#0 building with "default" instance using docker driver
+
+#1 [internal] load build definition from Dockerfile
+#1 transferring dockerfile: 312B done
+#1 DONE 0.0s
+
+#2 [internal] load metadata for docker.io/library/golang:1.23
+#2 DONE 0.9s
+
+#3 [1/4] FROM docker.io/library/golang:1.23@sha256:abc
+#3 CACHED
+
+#4 [2/4] WORKDIR /app
+#4 CACHED
+
+#5 [3/4] COPY . .
+#5 DONE 0.1s
+
+#6 [4/4] RUN go build -o /bin/app ./cmd/server
+#6 DONE 12.3s
+
+#7 exporting to image
+#7 DONE 0.2s
+`
+	metrics := buildMetrics(output, 15*time.Second)
+	assert.Equal(t, domain.BuildMetrics{Duration: 15 * time.Second, CachedLayers: 2, TotalLayers: 4}, metrics)
+}
+
+func TestRepoDigests(t *testing.T) {
+	output := "registry/api@sha256:1f2e3d\nmirror/api@sha256:4c5b6a\n"
+	assert.Equal(t, []string{"sha256:1f2e3d", "sha256:4c5b6a"}, repoDigests(output))
+	assert.Empty(t, repoDigests("\n"))
+}
@@ -0,0 +1,175 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/treenq/treenq/src/domain"
+)
+
+// manifestMediaTypes are the manifests a registry may hold for a pushed image
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Registry queries the image manifests over the registry HTTP API with the cluster pull credentials
+type Registry struct {
+	client *http.Client
+	// scheme is http for an insecure registry, e.g. a local one
+	scheme   string
+	username string
+	password string
+}
+
+func NewRegistry(client *http.Client, insecure bool, username, password string) *Registry {
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return &Registry{
+		client:   client,
+		scheme:   scheme,
+		username: username,
+		password: password,
+	}
+}
+
+// ManifestExists makes a HEAD request of the image manifest by its digest, by its tag if the digest is unknown.
+// A registry asking for a bearer token is given one issued for the pull credentials.
+func (r *Registry) ManifestExists(ctx context.Context, image domain.Image) (bool, error) {
+	reference := image.Digest
+	if reference == "" {
+		reference = image.Tag
+	}
+	manifestUrl := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", r.scheme, image.Registry, image.Repository, reference)
+
+	resp, err := r.headManifest(ctx, manifestUrl, "")
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		token, err := r.issueToken(ctx, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return false, err
+		}
+		resp, err = r.headManifest(ctx, manifestUrl, token)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		// the cluster can't pull the image with the same credentials either
+		return false, nil
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("registry returned %d for manifest %s", resp.StatusCode, manifestUrl)
+	}
+	return true, nil
+}
+
+func (r *Registry) headManifest(ctx context.Context, manifestUrl, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, manifestUrl, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create manifest request: %w", err)
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request manifest: %w", err)
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// issueToken gets a bearer token from the realm of the registry challenge,
+// e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:api:pull"
+func (r *Registry) issueToken(ctx context.Context, challenge string) (string, error) {
+	params, ok := parseBearerChallenge(challenge)
+	if !ok || params["realm"] == "" {
+		return "", fmt.Errorf("registry requires an unsupported authentication: %q", challenge)
+	}
+	tokenUrl, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid registry token realm: %w", err)
+	}
+	query := tokenUrl.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	tokenUrl.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenUrl.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request returned %d", resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// parseBearerChallenge parses the parameters of a WWW-Authenticate bearer challenge
+func parseBearerChallenge(challenge string) (map[string]string, bool) {
+	rest, ok := strings.CutPrefix(challenge, "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for rest != "" {
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			break
+		}
+		key = strings.TrimSpace(key)
+		if !strings.HasPrefix(value, `"`) {
+			value, rest, _ = strings.Cut(value, ",")
+			params[key] = value
+			continue
+		}
+		end := strings.Index(value[1:], `"`)
+		if end < 0 {
+			break
+		}
+		params[key] = value[1 : end+1]
+		rest = strings.TrimPrefix(value[end+2:], ",")
+	}
+	return params, true
+}
@@ -0,0 +1,84 @@
+package artifacts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func registryImage(server *httptest.Server) domain.Image {
+	return domain.Image{
+		Registry:   strings.TrimPrefix(server.URL, "http://"),
+		Repository: "api",
+		Tag:        "latest",
+		Digest:     "sha256:abc",
+	}
+}
+
+func TestManifestExistsByDigest(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		assert.Contains(t, r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json")
+		username, password, _ := r.BasicAuth()
+		assert.Equal(t, "puller", username)
+		assert.Equal(t, "secret", password)
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/v2/api/manifests/sha256:abc" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	registry := NewRegistry(server.Client(), true, "puller", "secret")
+
+	exists, err := registry.ManifestExists(context.Background(), registryImage(server))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	image := registryImage(server)
+	image.Digest = "sha256:wrong"
+	exists, err = registry.ManifestExists(context.Background(), image)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, []string{"/v2/api/manifests/sha256:abc", "/v2/api/manifests/sha256:wrong"}, paths)
+}
+
+func TestManifestExistsWithBearerToken(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			assert.Equal(t, "registry", r.URL.Query().Get("service"))
+			assert.Equal(t, "repository:api:pull", r.URL.Query().Get("scope"))
+			w.Write([]byte(`{"token":"pull-token"}`))
+		case r.Header.Get("Authorization") == "Bearer pull-token":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry",scope="repository:api:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	exists, err := NewRegistry(server.Client(), true, "", "").ManifestExists(context.Background(), registryImage(server))
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestManifestExistsRegistryError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := NewRegistry(server.Client(), true, "", "").ManifestExists(context.Background(), registryImage(server))
+	assert.Error(t, err)
+}
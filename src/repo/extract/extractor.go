@@ -3,8 +3,10 @@ package extract
 import (
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -12,6 +14,7 @@ import (
 
 	"github.com/google/uuid"
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/src/domain"
 )
 
 //go:embed template.txt
@@ -21,11 +24,13 @@ type Extractor struct {
 	builderDirPrefix string
 	builderPackage   string
 	tpl              *template.Template
+	// strictOverlays fails the .treenq config if its overlays set a scalar to different values
+	strictOverlays bool
 }
 
-func NewExtractor(builderDirPrefix string, builderPackage string) *Extractor {
+func NewExtractor(builderDirPrefix string, builderPackage string, strictOverlays bool) *Extractor {
 	tpl := template.Must(template.New("builder").Parse(string(emptyTqTemplate)))
-	return &Extractor{builderDirPrefix: builderDirPrefix, builderPackage: builderPackage, tpl: tpl}
+	return &Extractor{builderDirPrefix: builderDirPrefix, builderPackage: builderPackage, tpl: tpl, strictOverlays: strictOverlays}
 }
 
 const tqRelativePath = "tq"
@@ -48,9 +53,38 @@ func (e *Extractor) Close(id string) error {
 	return nil
 }
 
-func (e *Extractor) ExtractConfig(id string, repoDir string) (tqsdk.Space, error) {
+// configPath returns the repo relative config dir of the environment, e.g. tq.staging,
+// it falls back to the base tq dir if the environment dir doesn't exist
+func configPath(repoDir, environment string) string {
+	if environment != "" {
+		envPath := tqRelativePath + "." + environment
+		if info, err := os.Stat(filepath.Join(repoDir, envPath)); err == nil && info.IsDir() {
+			return envPath
+		}
+	}
+	return tqRelativePath
+}
+
+// ExtractConfig builds the space of the repo tq dir, a repo holding the .treenq dir is configured by its yaml files instead
+func (e *Extractor) ExtractConfig(id, repoDir, environment string) (domain.ExtractedConfig, error) {
+	if hasOverlayConfig(repoDir) {
+		space, err := extractOverlaySpace(filepath.Join(repoDir, overlayRelativePath), e.strictOverlays)
+		if err != nil {
+			return domain.ExtractedConfig{}, err
+		}
+		return domain.ExtractedConfig{Space: space, Path: overlayRelativePath}, nil
+	}
+
+	path := configPath(repoDir, environment)
+	space, err := e.extractSpace(id, filepath.Join(repoDir, path))
+	if err != nil {
+		return domain.ExtractedConfig{}, err
+	}
+	return domain.ExtractedConfig{Space: space, Path: path}, nil
+}
+
+func (e *Extractor) extractSpace(id string, repoConfigDir string) (tqsdk.Space, error) {
 	builderDir := e.getBuilderPath(id)
-	repoConfigDir := filepath.Join(repoDir, tqRelativePath)
 	targetDir := filepath.Join(builderDir, tqRelativePath)
 
 	if err := os.MkdirAll(targetDir, 0766); err != nil {
@@ -58,7 +92,11 @@ func (e *Extractor) ExtractConfig(id string, repoDir string) (tqsdk.Space, error
 	}
 
 	if err := copyDirectory(repoConfigDir, targetDir); err != nil {
-		return tqsdk.Space{}, fmt.Errorf("failed to copy build config: %w", err)
+		err = fmt.Errorf("failed to copy build config: %w", err)
+		if errors.Is(err, fs.ErrNotExist) {
+			return tqsdk.Space{}, domain.UserFailure(err)
+		}
+		return tqsdk.Space{}, err
 	}
 	defer func() {
 		os.RemoveAll(targetDir)
@@ -67,12 +105,12 @@ func (e *Extractor) ExtractConfig(id string, repoDir string) (tqsdk.Space, error
 	builderLauncherPath := filepath.Join(builderDir, tqBuildLauncherFile)
 	output, err := exec.Command("go", "run", builderLauncherPath).Output()
 	if err != nil {
-		return tqsdk.Space{}, fmt.Errorf("failed to exctract build config: %w", err)
+		return tqsdk.Space{}, domain.UserFailure(fmt.Errorf("failed to exctract build config: %w", err))
 	}
 
 	var res tqsdk.Space
 	if err := json.Unmarshal(output, &res); err != nil {
-		return tqsdk.Space{}, fmt.Errorf("failed to unmarshal resource: %w", err)
+		return tqsdk.Space{}, domain.UserFailure(fmt.Errorf("failed to unmarshal resource: %w", err))
 	}
 
 	return res, nil
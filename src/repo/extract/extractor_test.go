@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/src/domain"
 )
 
 //go:embed testdata/tq.go
@@ -35,7 +36,7 @@ func TestExtractor_ExtractConfig(t *testing.T) {
 	currentDir, err := os.Getwd()
 	require.NoError(t, err)
 	builderDir := filepath.Join(filepath.Dir(currentDir), "builder")
-	extractor := NewExtractor(builderDir, "/src/repo")
+	extractor := NewExtractor(builderDir, "/src/repo", false)
 	id, err := extractor.Open()
 	require.NoError(t, err)
 
@@ -45,11 +46,14 @@ func TestExtractor_ExtractConfig(t *testing.T) {
 	_, err = os.Stat(buildIdDir)
 	assert.ErrorIs(t, err, nil)
 
-	resource, err := extractor.ExtractConfig(id, srcDir)
+	resource, err := extractor.ExtractConfig(id, srcDir, "")
 	assert.ErrorIs(t, err, nil)
-	assert.Equal(t, resource, tqsdk.Space{
-		Key:    "key",
-		Region: "nyc",
+	assert.Equal(t, resource, domain.ExtractedConfig{
+		Space: tqsdk.Space{
+			Key:    "key",
+			Region: "nyc",
+		},
+		Path: "tq",
 	})
 
 	// check the close removes the builder directory
@@ -58,3 +62,34 @@ func TestExtractor_ExtractConfig(t *testing.T) {
 	_, err = os.Stat(buildIdDir)
 	assert.ErrorIs(t, err, os.ErrNotExist)
 }
+
+//go:embed testdata/tqStaging.go
+var testStagingBuildConfig []byte
+
+func TestExtractor_ExtractEnvironmentConfig(t *testing.T) {
+	srcDir := t.TempDir()
+	for dir, config := range map[string][]byte{
+		tqRelativePath:              testBuildConfig,
+		tqRelativePath + ".staging": testStagingBuildConfig,
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(srcDir, dir), 0766))
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, dir, tqBuildLauncherFile), config, 0766))
+	}
+
+	currentDir, err := os.Getwd()
+	require.NoError(t, err)
+	extractor := NewExtractor(filepath.Join(filepath.Dir(currentDir), "builder"), "/src/repo", false)
+	id, err := extractor.Open()
+	require.NoError(t, err)
+	defer extractor.Close(id)
+
+	staging, err := extractor.ExtractConfig(id, srcDir, "staging")
+	require.NoError(t, err)
+	assert.Equal(t, "tq.staging", staging.Path)
+	assert.Equal(t, "staging-key", staging.Space.Key)
+
+	production, err := extractor.ExtractConfig(id, srcDir, "production")
+	require.NoError(t, err)
+	assert.Equal(t, "tq", production.Path, "the base config is used without a production config")
+	assert.Equal(t, "key", production.Space.Key)
+}
@@ -0,0 +1,114 @@
+package extract
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/src/domain"
+	"sigs.k8s.io/yaml"
+)
+
+// overlayRelativePath is the repo dir of a yaml config made of the base file and the overlays
+const overlayRelativePath = ".treenq"
+const overlayBaseFile = "base.yaml"
+
+// hasOverlayConfig reports whether the repo holds the .treenq config dir
+func hasOverlayConfig(repoDir string) bool {
+	info, err := os.Stat(filepath.Join(repoDir, overlayRelativePath))
+	return err == nil && info.IsDir()
+}
+
+// extractOverlaySpace merges the overlays of the config dir over its base.yaml, the overlays are every other yaml file
+// of the dir applied in the alphabetical order. The maps are merged deeply and any other value is replaced by the overlay,
+// e.g. a list. The strict merge fails if two overlays set the same scalar to different values.
+func extractOverlaySpace(configDir string, strict bool) (tqsdk.Space, error) {
+	config, err := readYamlConfig(filepath.Join(configDir, overlayBaseFile))
+	if err != nil {
+		return tqsdk.Space{}, err
+	}
+
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return tqsdk.Space{}, fmt.Errorf("failed to read config dir: %w", err)
+	}
+	var overlays []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || entry.Name() == overlayBaseFile || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		overlays = append(overlays, entry.Name())
+	}
+	slices.Sort(overlays)
+
+	// setBy holds the overlay which has set a scalar by its path
+	setBy := make(map[string]string)
+	for _, overlay := range overlays {
+		overlayConfig, err := readYamlConfig(filepath.Join(configDir, overlay))
+		if err != nil {
+			return tqsdk.Space{}, err
+		}
+		if err := mergeConfig(config, overlayConfig, "", overlay, setBy, strict); err != nil {
+			return tqsdk.Space{}, domain.UserFailure(err)
+		}
+	}
+
+	merged, err := json.Marshal(config)
+	if err != nil {
+		return tqsdk.Space{}, fmt.Errorf("failed to marshal merged config: %w", err)
+	}
+	var space tqsdk.Space
+	if err := json.Unmarshal(merged, &space); err != nil {
+		return tqsdk.Space{}, domain.UserFailure(fmt.Errorf("failed to unmarshal merged config: %w", err))
+	}
+	return space, nil
+}
+
+func readYamlConfig(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read config %s: %w", filepath.Base(path), err)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, domain.UserFailure(err)
+		}
+		return nil, err
+	}
+	config := make(map[string]any)
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, domain.UserFailure(fmt.Errorf("failed to parse config %s: %w", filepath.Base(path), err))
+	}
+	return config, nil
+}
+
+// mergeConfig merges the overlay config into dst
+func mergeConfig(dst, overlay map[string]any, path, file string, setBy map[string]string, strict bool) error {
+	for _, key := range slices.Sorted(maps.Keys(overlay)) {
+		value := overlay[key]
+		keyPath := strings.TrimPrefix(path+"."+key, ".")
+		overlayMap, isMap := value.(map[string]any)
+		if dstMap, ok := dst[key].(map[string]any); ok && isMap {
+			if err := mergeConfig(dstMap, overlayMap, keyPath, file, setBy, strict); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, isList := value.([]any); !isMap && !isList {
+			if previous, ok := setBy[keyPath]; ok && strict && !reflect.DeepEqual(dst[key], value) {
+				return fmt.Errorf("config %s conflicts with %s: %s is set to %v and %v", file, previous, keyPath, dst[key], value)
+			}
+			setBy[keyPath] = file
+		}
+		dst[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func writeOverlayConfig(t *testing.T, files map[string]string) string {
+	repoDir := t.TempDir()
+	configDir := filepath.Join(repoDir, overlayRelativePath)
+	require.NoError(t, os.MkdirAll(configDir, 0766))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(configDir, name), []byte(content), 0644))
+	}
+	return repoDir
+}
+
+func TestExtractor_ExtractOverlayConfig(t *testing.T) {
+	repoDir := writeOverlayConfig(t, map[string]string{
+		"base.yaml": `
+key: api
+region: nyc
+service:
+  name: api
+  httpPort: 8000
+  replicas: 1
+  runtimeEnvs:
+    LOG_LEVEL: info
+    REGION: nyc
+paths: ["src/**"]
+`,
+		"10-scale.yaml": `
+service:
+  replicas: 3
+  runtimeEnvs:
+    LOG_LEVEL: warn
+`,
+		"20-region.yml": `
+region: ams
+service:
+  replicas: 2
+  runtimeEnvs:
+    REGION: ams
+paths: ["api/**", "pkg/**"]
+`,
+		"README.md": "not a config",
+	})
+
+	config, err := NewExtractor("", "", false).ExtractConfig("", repoDir, "")
+	require.NoError(t, err)
+	assert.Equal(t, domain.ExtractedConfig{
+		Space: tqsdk.Space{
+			Key:    "api",
+			Region: "ams",
+			Service: tqsdk.Service{
+				Name:     "api",
+				HttpPort: 8000,
+				Replicas: 2,
+				RuntimeEnvs: map[string]string{
+					"LOG_LEVEL": "warn",
+					"REGION":    "ams",
+				},
+			},
+			Paths: []string{"api/**", "pkg/**"},
+		},
+		Path: ".treenq",
+	}, config, "the overlays are applied over the base in the alphabetical order")
+}
+
+func TestExtractor_ExtractOverlayConfigStrictConflict(t *testing.T) {
+	repoDir := writeOverlayConfig(t, map[string]string{
+		"base.yaml":    "key: api\nservice:\n  name: api\n  replicas: 1\n",
+		"a-scale.yaml": "service:\n  replicas: 3\n",
+		"b-scale.yaml": "service:\n  replicas: 2\n",
+	})
+
+	_, err := NewExtractor("", "", true).ExtractConfig("", repoDir, "")
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "config b-scale.yaml conflicts with a-scale.yaml: service.replicas is set to 3 and 2")
+	var failure *domain.FailureError
+	require.ErrorAs(t, err, &failure)
+	assert.Equal(t, domain.FailureClassUser, failure.Class)
+
+	config, err := NewExtractor("", "", false).ExtractConfig("", repoDir, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, config.Space.Service.Replicas, "the last overlay wins without the strict mode")
+}
+
+func TestExtractor_ExtractOverlayConfigWithoutBase(t *testing.T) {
+	repoDir := writeOverlayConfig(t, map[string]string{"overlay.yaml": "key: api\n"})
+
+	_, err := NewExtractor("", "", false).ExtractConfig("", repoDir, "")
+	assert.ErrorContains(t, err, "base.yaml")
+}
@@ -0,0 +1,12 @@
+package tq
+
+import (
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+)
+
+func Build() (tqsdk.Space, error) {
+	return tqsdk.Space{
+		Key:    "staging-key",
+		Region: "ams",
+	}, nil
+}
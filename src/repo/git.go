@@ -1,14 +1,23 @@
 package repo
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/treenq/treenq/src/domain"
 )
 
 type Git struct {
@@ -19,8 +28,14 @@ func NewGit(dir string) *Git {
 	return &Git{dir: dir}
 }
 
-func (g *Git) Clone(urlStr string, installationID, repoID int, accessToken string) (string, error) {
-	dir := filepath.Join(g.dir, strconv.Itoa(installationID), strconv.Itoa(repoID))
+// Clone clones over HTTPS with an access token or over SSH with a deploy key.
+// The credentials are passed to the transport only, neither the remote url nor any file of the repo dir keeps them.
+// Every clone gets its own dir named by the clone id, so the concurrent deploys of one repo never share a worktree.
+func (g *Git) Clone(urlStr string, installationID, repoID int, cloneID string, creds domain.CloneCredentials) (string, error) {
+	if cloneID == "" || cloneID != filepath.Base(cloneID) || cloneID == "." || cloneID == ".." {
+		return "", fmt.Errorf("invalid clone id %q", cloneID)
+	}
+	dir := filepath.Join(g.dir, strconv.Itoa(installationID), strconv.Itoa(repoID), cloneID)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err = os.MkdirAll(dir, os.ModePerm)
 		if err != nil {
@@ -28,20 +43,26 @@ func (g *Git) Clone(urlStr string, installationID, repoID int, accessToken strin
 		}
 	}
 
-	u, err := url.Parse(urlStr)
-	if err != nil {
+	if _, err := url.Parse(urlStr); err != nil {
 		return "", err
 	}
-	if accessToken != "" {
-		u.User = url.UserPassword("x-access-token", accessToken)
+	auth, err := cloneAuth(creds)
+	if err != nil {
+		return "", err
 	}
 
 	_, err = git.PlainClone(dir, false, &git.CloneOptions{
-		URL:      u.String(),
+		URL:      urlStr,
+		Auth:     auth,
 		Progress: os.Stdout,
 	})
 	if err != nil {
 		if !errors.Is(err, git.ErrRepositoryAlreadyExists) {
+			// the clone may be retried over another protocol in the same dir
+			os.RemoveAll(dir)
+			if connectionFailed(err) {
+				return "", fmt.Errorf("%w: %s", domain.ErrCloneConnection, err)
+			}
 			return "", fmt.Errorf("error while cloning the repo: %s", err)
 		}
 
@@ -53,10 +74,126 @@ func (g *Git) Clone(urlStr string, installationID, repoID int, accessToken strin
 		if err != nil {
 			return "", fmt.Errorf("error while getting worktree: %s", err)
 		}
-		err = w.Pull(&git.PullOptions{RemoteName: "origin"})
+		err = w.Pull(&git.PullOptions{RemoteName: "origin", Auth: auth})
 		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
 			return "", fmt.Errorf("error while pulling latest: %s", err)
 		}
 	}
 	return dir, nil
 }
+
+// connectionFailed reports whether the remote isn't reachable, e.g. its port is blocked or the host isn't resolved,
+// an auth failure means the remote is reached
+func connectionFailed(err error) bool {
+	if errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// cloneAuth returns the transport auth of the credentials, nil for a public repo
+func cloneAuth(creds domain.CloneCredentials) (transport.AuthMethod, error) {
+	if len(creds.DeployKey) > 0 {
+		auth, err := gitssh.NewPublicKeys("git", creds.DeployKey, "")
+		if err != nil {
+			// the parse error never includes the key
+			return nil, domain.UserFailure(fmt.Errorf("failed to parse deploy key: %w", err))
+		}
+		return auth, nil
+	}
+	if creds.AccessToken != "" {
+		return &githttp.BasicAuth{Username: "x-access-token", Password: creds.AccessToken}, nil
+	}
+	return nil, nil
+}
+
+// ExtractArchive unpacks a gzipped tarball into a new temp dir under the clone dir.
+// Only regular files and directories are accepted, an entry must not escape the target dir.
+func (g *Git) ExtractArchive(archive io.Reader, maxSize int64) (string, error) {
+	if err := os.MkdirAll(g.dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create clone directory: %s", err)
+	}
+	dir, err := os.MkdirTemp(g.dir, "archive-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %s", err)
+	}
+
+	if err := extractTarGz(archive, dir, maxSize); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+func extractTarGz(archive io.Reader, dir string, maxSize int64) error {
+	gz, err := gzip.NewReader(archive)
+	if err != nil {
+		return fmt.Errorf("%w: %s", domain.ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	var size int64
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s", domain.ErrInvalidArchive, err)
+		}
+
+		target, err := archiveEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return fmt.Errorf("failed to create archive dir: %w", err)
+			}
+		case tar.TypeReg:
+			size += header.Size
+			if maxSize > 0 && size > maxSize {
+				return fmt.Errorf("%w: unpacked archive exceeds %d bytes", domain.ErrInvalidArchive, maxSize)
+			}
+			if err := writeArchiveFile(target, tr, header); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unsupported entry type of %q", domain.ErrInvalidArchive, header.Name)
+		}
+	}
+}
+
+// archiveEntryPath returns the entry path inside the dir, it rejects the path traversal entries
+func archiveEntryPath(dir, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("%w: absolute entry path %q", domain.ErrInvalidArchive, name)
+	}
+	target := filepath.Join(dir, name)
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: entry %q escapes the archive dir", domain.ErrInvalidArchive, name)
+	}
+	return target, nil
+}
+
+func writeArchiveFile(target string, r io.Reader, header *tar.Header) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create archive dir: %w", err)
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer f.Close()
+
+	// the header size is checked against the limit, copy no more than it declares
+	if _, err := io.CopyN(f, r, header.Size); err != nil {
+		return fmt.Errorf("%w: failed to read %q: %s", domain.ErrInvalidArchive, header.Name, err)
+	}
+	return nil
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/treenq/treenq/src/domain"
+	"golang.org/x/sync/singleflight"
 )
 
 type TokenIssuer interface {
@@ -15,6 +20,9 @@ type TokenIssuer interface {
 type GithubClient struct {
 	tokenIssuer TokenIssuer
 	client      *http.Client
+
+	// tokensGroup deduplicates concurrent token issuance for the same installation
+	tokensGroup singleflight.Group
 }
 
 func NewGithubClient(tokenIssuer TokenIssuer, client *http.Client) *GithubClient {
@@ -27,24 +35,118 @@ func NewGithubClient(tokenIssuer TokenIssuer, client *http.Client) *GithubClient
 	}
 }
 
-var responseBody struct {
-	Token string `json:"token"`
+type accessTokenResponse struct {
+	Token               string            `json:"token"`
+	Permissions         map[string]string `json:"permissions"`
+	RepositorySelection string            `json:"repository_selection"`
+}
+
+// IssueAccessToken issues an installation access token with the permissions it's granted.
+// Concurrent calls for the same installation share a single upstream request.
+func (c *GithubClient) IssueAccessToken(installationID int) (domain.InstallationToken, error) {
+	token, err, _ := c.tokensGroup.Do(strconv.Itoa(installationID), func() (interface{}, error) {
+		return c.issueAccessToken(installationID)
+	})
+	if err != nil {
+		return domain.InstallationToken{}, err
+	}
+	return token.(domain.InstallationToken), nil
 }
 
-func (c *GithubClient) IssueAccessToken(installationID int) (string, error) {
+func (c *GithubClient) issueAccessToken(installationID int) (domain.InstallationToken, error) {
 	jwtToken, err := c.tokenIssuer.GenerateJwtToken(nil)
 	if err != nil {
-		return "", err
+		return domain.InstallationToken{}, err
 	}
 	url := fmt.Sprintf("https://api.github.com/app/installations/%d/access_tokens", installationID)
 	req, err := http.NewRequest("POST", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create new request %s", err)
+		return domain.InstallationToken{}, fmt.Errorf("failed to create new request %s", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
 	req.Header.Set("Accept", "application/vnd.github+json")
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 
+	resp, err := c.client.Do(req)
+	if err != nil || resp == nil {
+		return domain.InstallationToken{}, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return domain.InstallationToken{}, fmt.Errorf("failed to process request: %d, body=%s", resp.StatusCode, string(respBody))
+	}
+
+	var responseBody accessTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+		return domain.InstallationToken{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return domain.InstallationToken{
+		Token:               responseBody.Token,
+		Permissions:         responseBody.Permissions,
+		RepositorySelection: responseBody.RepositorySelection,
+	}, nil
+}
+
+// GetRepository fetches the repo details, e.g. its default branch, using the installation access token
+func (c *GithubClient) GetRepository(installationID int, fullName string) (domain.Repository, error) {
+	token, err := c.IssueAccessToken(installationID)
+	if err != nil {
+		return domain.Repository{}, fmt.Errorf("failed to issue access token: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s", fullName)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return domain.Repository{}, fmt.Errorf("failed to create new request %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.client.Do(req)
+	if err != nil || resp == nil {
+		return domain.Repository{}, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return domain.Repository{}, fmt.Errorf("failed to process request: %d, body=%s", resp.StatusCode, string(respBody))
+	}
+
+	var repo domain.Repository
+	if err := json.NewDecoder(resp.Body).Decode(&repo); err != nil {
+		return domain.Repository{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return repo, nil
+}
+
+type branchResponse struct {
+	Commit struct {
+		Sha string `json:"sha"`
+	} `json:"commit"`
+}
+
+// GetBranchSha returns the current tip commit of the repo branch using the installation access token
+func (c *GithubClient) GetBranchSha(installationID int, fullName, branch string) (string, error) {
+	token, err := c.IssueAccessToken(installationID)
+	if err != nil {
+		return "", fmt.Errorf("failed to issue access token: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.github.com/repos/%s/branches/%s", fullName, branch)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create new request %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
 	resp, err := c.client.Do(req)
 	if err != nil || resp == nil {
 		return "", fmt.Errorf("failed to execute request: %w", err)
@@ -56,9 +158,79 @@ func (c *GithubClient) IssueAccessToken(installationID int) (string, error) {
 		return "", fmt.Errorf("failed to process request: %d, body=%s", resp.StatusCode, string(respBody))
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+	var res branchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
 		return "", fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return responseBody.Token, nil
+	return res.Commit.Sha, nil
+}
+
+type installationReposResponse struct {
+	Repositories []domain.Repository `json:"repositories"`
+}
+
+// ListInstallationRepos fetches all the repos accessible to the installation following the pagination links
+func (c *GithubClient) ListInstallationRepos(installationID int) ([]domain.Repository, error) {
+	token, err := c.IssueAccessToken(installationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue access token: %w", err)
+	}
+
+	var repos []domain.Repository
+	url := "https://api.github.com/installation/repositories?per_page=100"
+	for url != "" {
+		page, next, err := c.listInstallationReposPage(url, token.Token)
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, page...)
+		url = next
+	}
+
+	return repos, nil
+}
+
+func (c *GithubClient) listInstallationReposPage(url, token string) ([]domain.Repository, string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create new request %s", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.client.Do(req)
+	if err != nil || resp == nil {
+		return nil, "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, "", fmt.Errorf("failed to process request: %d, body=%s", resp.StatusCode, string(respBody))
+	}
+
+	var responseBody installationReposResponse
+	if err := json.NewDecoder(resp.Body).Decode(&responseBody); err != nil {
+		return nil, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return responseBody.Repositories, nextPageURL(resp.Header.Get("Link")), nil
+}
+
+// nextPageURL parses the github Link header, e.g. <https://api.github.com/...&page=2>; rel="next"
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 {
+			continue
+		}
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(segments[0]), "<>")
+			}
+		}
+	}
+	return ""
 }
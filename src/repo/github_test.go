@@ -0,0 +1,192 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+type staticTokenIssuer struct{}
+
+func (staticTokenIssuer) GenerateJwtToken(claims map[string]interface{}) (string, error) {
+	return "jwt", nil
+}
+
+type blockingTransport struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (t *blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	<-t.release
+	return &http.Response{
+		StatusCode: http.StatusCreated,
+		Body:       io.NopCloser(strings.NewReader(`{"token":"ghs_token"}`)),
+		Header:     make(http.Header),
+		Request:    r,
+	}, nil
+}
+
+func TestIssueAccessTokenDeduplicatesConcurrentCalls(t *testing.T) {
+	transport := &blockingTransport{release: make(chan struct{})}
+	client := NewGithubClient(staticTokenIssuer{}, &http.Client{Transport: transport})
+
+	const n = 10
+	var wg sync.WaitGroup
+	tokens := make([]domain.InstallationToken, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = client.IssueAccessToken(42)
+		}(i)
+	}
+
+	// let all the callers join the in-flight request before it completes
+	time.Sleep(100 * time.Millisecond)
+	close(transport.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), transport.calls.Load())
+	for i := 0; i < n; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, "ghs_token", tokens[i].Token)
+	}
+}
+
+type githubAPITransport struct{}
+
+func (githubAPITransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body := `{"token":"ghs_token","permissions":{"contents":"read","metadata":"read"},"repository_selection":"selected"}`
+	status := http.StatusCreated
+	if r.Method == http.MethodGet {
+		switch {
+		case r.Header.Get("Authorization") != "Bearer ghs_token":
+			status = http.StatusNotFound
+			body = `{"message":"Not Found"}`
+		case r.URL.Path == "/repos/treenq/treenq/branches/main":
+			status = http.StatusOK
+			body = `{"name":"main","commit":{"sha":"4b2d5e3c6f"}}`
+		case r.URL.Path != "/repos/treenq/treenq":
+			status = http.StatusNotFound
+			body = `{"message":"Not Found"}`
+		default:
+			status = http.StatusOK
+			body = `{"id":805585115,"full_name":"treenq/treenq","private":false,"default_branch":"trunk"}`
+		}
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     make(http.Header),
+		Request:    r,
+	}, nil
+}
+
+func TestIssueAccessTokenPermissions(t *testing.T) {
+	client := NewGithubClient(staticTokenIssuer{}, &http.Client{Transport: githubAPITransport{}})
+
+	token, err := client.IssueAccessToken(42)
+	require.NoError(t, err)
+	assert.Equal(t, domain.InstallationToken{
+		Token:               "ghs_token",
+		Permissions:         map[string]string{"contents": "read", "metadata": "read"},
+		RepositorySelection: "selected",
+	}, token)
+}
+
+func TestGetRepository(t *testing.T) {
+	client := NewGithubClient(staticTokenIssuer{}, &http.Client{Transport: githubAPITransport{}})
+
+	repo, err := client.GetRepository(42, "treenq/treenq")
+	require.NoError(t, err)
+	assert.Equal(t, 805585115, repo.ID)
+	assert.Equal(t, "trunk", repo.DefaultBranch)
+
+	_, err = client.GetRepository(42, "treenq/unknown")
+	assert.Error(t, err)
+}
+
+func TestGetBranchSha(t *testing.T) {
+	client := NewGithubClient(staticTokenIssuer{}, &http.Client{Transport: githubAPITransport{}})
+
+	sha, err := client.GetBranchSha(42, "treenq/treenq", "main")
+	require.NoError(t, err)
+	assert.Equal(t, "4b2d5e3c6f", sha)
+
+	_, err = client.GetBranchSha(42, "treenq/treenq", "unknown")
+	assert.Error(t, err)
+}
+
+type paginatedReposTransport struct {
+	pages [][]string
+}
+
+func (t *paginatedReposTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	header := make(http.Header)
+	if r.Method == http.MethodPost {
+		return &http.Response{
+			StatusCode: http.StatusCreated,
+			Body:       io.NopCloser(strings.NewReader(`{"token":"ghs_token"}`)),
+			Header:     header,
+			Request:    r,
+		}, nil
+	}
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		page, _ = strconv.Atoi(p)
+	}
+	if page < len(t.pages) {
+		header.Set("Link", fmt.Sprintf(`<https://api.github.com/installation/repositories?per_page=100&page=%d>; rel="next", <https://api.github.com/installation/repositories?per_page=100&page=%d>; rel="last"`, page+1, len(t.pages)))
+	}
+
+	repos := make([]string, len(t.pages[page-1]))
+	for i, name := range t.pages[page-1] {
+		repos[i] = fmt.Sprintf(`{"id":%d,"full_name":%q,"private":false,"default_branch":"main"}`, page*100+i, name)
+	}
+	body := fmt.Sprintf(`{"total_count":5,"repositories":[%s]}`, strings.Join(repos, ","))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     header,
+		Request:    r,
+	}, nil
+}
+
+func TestListInstallationReposCollectsAllPages(t *testing.T) {
+	transport := &paginatedReposTransport{pages: [][]string{
+		{"treenq/one", "treenq/two"},
+		{"treenq/three", "treenq/four"},
+		{"treenq/five"},
+	}}
+	client := NewGithubClient(staticTokenIssuer{}, &http.Client{Transport: transport})
+
+	repos, err := client.ListInstallationRepos(42)
+	require.NoError(t, err)
+
+	names := make([]string, len(repos))
+	for i := range repos {
+		names[i] = repos[i].FullName
+	}
+	assert.Equal(t, []string{"treenq/one", "treenq/two", "treenq/three", "treenq/four", "treenq/five"}, names)
+	assert.Equal(t, "main", repos[4].DefaultBranch)
+}
+
+func TestNextPageURL(t *testing.T) {
+	assert.Equal(t, "https://api.github.com/installation/repositories?page=2", nextPageURL(`<https://api.github.com/installation/repositories?page=2>; rel="next", <https://api.github.com/installation/repositories?page=3>; rel="last"`))
+	assert.Equal(t, "", nextPageURL(`<https://api.github.com/installation/repositories?page=1>; rel="prev"`))
+	assert.Equal(t, "", nextPageURL(""))
+}
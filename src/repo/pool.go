@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/treenq/treenq/pkg/vel"
+)
+
+type webhookPoolKey struct{}
+
+// WithWebhookPool marks the store queries of the context to run on the webhook pool,
+// the context derived from it, e.g. a detached deployment one, keeps the mark
+func WithWebhookPool(ctx context.Context) context.Context {
+	return context.WithValue(ctx, webhookPoolKey{}, true)
+}
+
+// WebhookPoolMiddleware runs the store queries of the request on the webhook pool
+var WebhookPoolMiddleware vel.Middleware = func(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(WithWebhookPool(r.Context())))
+	})
+}
+
+// conn returns the connection pool of the context
+func (s *Store) conn(ctx context.Context) *sqlx.DB {
+	if webhook, _ := ctx.Value(webhookPoolKey{}).(bool); webhook {
+		return s.webhookDB
+	}
+	return s.db
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+// poolConnector opens the connections of a fake pool, a query of a blocking pool holds its connection until released
+type poolConnector struct {
+	blocking bool
+	release  chan struct{}
+}
+
+func (c *poolConnector) Connect(context.Context) (driver.Conn, error) {
+	return &poolConn{connector: c}, nil
+}
+
+func (c *poolConnector) Driver() driver.Driver {
+	return nil
+}
+
+type poolConn struct {
+	connector *poolConnector
+}
+
+func (c *poolConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.connector.blocking {
+		select {
+		case <-c.connector.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &userRows{}, nil
+}
+
+func (c *poolConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *poolConn) Close() error {
+	return nil
+}
+
+func (c *poolConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+// userRows is a single user id row
+type userRows struct {
+	done bool
+}
+
+func (r *userRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *userRows) Close() error {
+	return nil
+}
+
+func (r *userRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = "user-1"
+	return nil
+}
+
+func TestWebhookStormDoesNotExhaustApiPool(t *testing.T) {
+	release := make(chan struct{})
+	db := sqlx.NewDb(sql.OpenDB(&poolConnector{}), "pgx")
+	db.SetMaxOpenConns(2)
+	webhookDB := sqlx.NewDb(sql.OpenDB(&poolConnector{blocking: true, release: release}), "pgx")
+	webhookDB.SetMaxOpenConns(2)
+	store, err := NewStore(db, webhookDB)
+	require.NoError(t, err)
+
+	const webhooks = 10
+	var wg sync.WaitGroup
+	for i := 0; i < webhooks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.GetOrCreateUser(WithWebhookPool(context.Background()), domain.UserInfo{Email: "hook@treenq.com"})
+			assert.NoError(t, err)
+		}()
+	}
+	// the pool is exhausted once all the webhooks over its size wait for a connection
+	require.Eventually(t, func() bool {
+		return webhookDB.Stats().InUse == 2 && webhookDB.Stats().WaitCount == webhooks-2
+	}, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	user, err := store.GetOrCreateUser(ctx, domain.UserInfo{Email: "login@treenq.com"})
+	require.NoError(t, err, "the auth request gets a connection of its own pool")
+	assert.Equal(t, "user-1", user.ID)
+
+	close(release)
+	wg.Wait()
+}
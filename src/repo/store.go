@@ -10,7 +10,6 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	tqsdk "github.com/treenq/treenq/pkg/sdk"
 	"github.com/treenq/treenq/src/domain"
 
 	sq "github.com/Masterminds/squirrel"
@@ -18,13 +17,20 @@ import (
 
 type Store struct {
 	db *sqlx.DB
-	sq sq.StatementBuilderType
+	// webhookDB serves the webhook requests, so a webhook storm can't take the connections of the interactive requests
+	webhookDB *sqlx.DB
+	sq        sq.StatementBuilderType
 }
 
-func NewStore(db *sqlx.DB) (*Store, error) {
+// NewStore serves the requests marked by WithWebhookPool from the webhookDB pool and the rest from the db one,
+// a nil webhookDB shares the db pool
+func NewStore(db, webhookDB *sqlx.DB) (*Store, error) {
 	sq := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	if webhookDB == nil {
+		webhookDB = db
+	}
 
-	return &Store{db: db, sq: sq}, nil
+	return &Store{db: db, webhookDB: webhookDB, sq: sq}, nil
 }
 
 var now = func() time.Time {
@@ -38,7 +44,7 @@ func (s *Store) GetOrCreateUser(ctx context.Context, user domain.UserInfo) (doma
 	if err != nil {
 		return user, fmt.Errorf("failed to build select query GetOrCreateUser: %w", err)
 	}
-	row := s.db.QueryRow(query, args...)
+	row := s.conn(ctx).QueryRowContext(ctx, query, args...)
 	if err := row.Scan(&user.ID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return s.createUser(ctx, user)
@@ -59,7 +65,7 @@ func (s *Store) createUser(ctx context.Context, user domain.UserInfo) (domain.Us
 	if err != nil {
 		return user, fmt.Errorf("failed to build query createUser: %w", err)
 	}
-	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
 		return user, fmt.Errorf("failed to exec createUser: %w", err)
 	}
 
@@ -68,40 +74,440 @@ func (s *Store) createUser(ctx context.Context, user domain.UserInfo) (domain.Us
 }
 
 func (s *Store) SaveDeployment(ctx context.Context, def domain.AppDefinition) (domain.AppDefinition, error) {
-	id := uuid.NewString()
+	// the id of a deployment queued by a webhook is reserved before it's saved
+	id := def.ID
+	if id == "" {
+		id = uuid.NewString()
+	}
 	def.ID = id
+	def.CreatedAt = now()
+	if def.Status.Terminal() {
+		def.FinishedAt = def.CreatedAt
+	}
 	appPayload, err := json.Marshal(def.App)
 	if err != nil {
 		return def, fmt.Errorf("failed to marshal app definition to json: %w", err)
 	}
+	failure, err := failurePayload(def.Failure)
+	if err != nil {
+		return def, err
+	}
+	buildMetrics, err := mapPayload(def.BuildMetrics)
+	if err != nil {
+		return def, fmt.Errorf("failed to marshal build metrics to json: %w", err)
+	}
+	signatures, err := mapPayload(def.Signatures)
+	if err != nil {
+		return def, fmt.Errorf("failed to marshal signatures to json: %w", err)
+	}
+	buildInputs, err := mapPayload(def.BuildInputs)
+	if err != nil {
+		return def, fmt.Errorf("failed to marshal build inputs to json: %w", err)
+	}
+	env, err := mapPayload(def.Env)
+	if err != nil {
+		return def, fmt.Errorf("failed to marshal deployment env to json: %w", err)
+	}
+	digests, err := mapPayload(def.Digests)
+	if err != nil {
+		return def, fmt.Errorf("failed to marshal image digests to json: %w", err)
+	}
+	objects, err := objectsPayload(def.Objects)
+	if err != nil {
+		return def, err
+	}
+	timeline, err := timelinePayload(def.Timeline)
+	if err != nil {
+		return def, err
+	}
 
 	query, args, err := s.sq.Insert("deployments").
-		Columns("id", "appId", "app", "tag", "sha", "user", "createdAt").
-		Values(id, def.AppID, string(appPayload), def.Tag, def.Sha, def.User, now()).
+		Columns(deploymentColumns...).
+		Values(id, def.AppID, string(appPayload), def.Tag, def.Sha, def.User, def.Environment, def.Status, nullTime(def.ApprovalExpiresAt), failure, def.ConfigPath, def.SkipReason, buildMetrics, signatures, def.SkipMigrations, def.MigrationLogs, def.CreatedAt, nullTime(def.FinishedAt), timeline, def.ImportedFrom, def.Message, def.Event, def.Action, def.Ref, nullTime(def.PromotionExpiresAt), objects, def.ForceRebuild, buildInputs, def.RebuildRequired, env, digests).
 		ToSql()
 	if err != nil {
 		return def, fmt.Errorf("failed to build SaveDeployment query: %w", err)
 	}
 
-	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
 		return def, fmt.Errorf("failed to exec SaveDeployment: %w", err)
 	}
 
 	return def, nil
 }
 
+var deploymentColumns = []string{"id", "appId", "app", "tag", "sha", `"user"`, "environment", "status", "approvalExpiresAt", "failure", "configPath", "skipReason", "buildMetrics", "signatures", "skipMigrations", "migrationLogs", "createdAt", "finishedAt", "timeline", "importedFrom", "message", "event", "action", "ref", "promotionExpiresAt", "objects", "forceRebuild", "buildInputs", "rebuildRequired", "env", "digests"}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeployment(row rowScanner) (domain.AppDefinition, error) {
+	var def domain.AppDefinition
+	var appPayload string
+	var approvalExpiresAt, finishedAt, promotionExpiresAt sql.NullTime
+	var failure, buildMetrics, signatures, timeline, objects, buildInputs, env, digests sql.NullString
+	if err := row.Scan(&def.ID, &def.AppID, &appPayload, &def.Tag, &def.Sha, &def.User, &def.Environment, &def.Status, &approvalExpiresAt, &failure, &def.ConfigPath, &def.SkipReason, &buildMetrics, &signatures, &def.SkipMigrations, &def.MigrationLogs, &def.CreatedAt, &finishedAt, &timeline, &def.ImportedFrom, &def.Message, &def.Event, &def.Action, &def.Ref, &promotionExpiresAt, &objects, &def.ForceRebuild, &buildInputs, &def.RebuildRequired, &env, &digests); err != nil {
+		return def, err
+	}
+	def.ApprovalExpiresAt = approvalExpiresAt.Time
+	def.FinishedAt = finishedAt.Time
+	def.PromotionExpiresAt = promotionExpiresAt.Time
+
+	if err := json.Unmarshal([]byte(appPayload), &def.App); err != nil {
+		return def, fmt.Errorf("failed to decode app payload: %w", err)
+	}
+	if failure.Valid {
+		def.Failure = &domain.DeploymentFailure{}
+		if err := json.Unmarshal([]byte(failure.String), def.Failure); err != nil {
+			return def, fmt.Errorf("failed to decode deployment failure: %w", err)
+		}
+	}
+	if buildMetrics.Valid {
+		if err := json.Unmarshal([]byte(buildMetrics.String), &def.BuildMetrics); err != nil {
+			return def, fmt.Errorf("failed to decode build metrics: %w", err)
+		}
+	}
+	if signatures.Valid {
+		if err := json.Unmarshal([]byte(signatures.String), &def.Signatures); err != nil {
+			return def, fmt.Errorf("failed to decode signatures: %w", err)
+		}
+	}
+	if timeline.Valid {
+		if err := json.Unmarshal([]byte(timeline.String), &def.Timeline); err != nil {
+			return def, fmt.Errorf("failed to decode timeline: %w", err)
+		}
+	}
+	if objects.Valid {
+		if err := json.Unmarshal([]byte(objects.String), &def.Objects); err != nil {
+			return def, fmt.Errorf("failed to decode deployment objects: %w", err)
+		}
+	}
+	if buildInputs.Valid {
+		if err := json.Unmarshal([]byte(buildInputs.String), &def.BuildInputs); err != nil {
+			return def, fmt.Errorf("failed to decode build inputs: %w", err)
+		}
+	}
+	if env.Valid {
+		if err := json.Unmarshal([]byte(env.String), &def.Env); err != nil {
+			return def, fmt.Errorf("failed to decode deployment env: %w", err)
+		}
+	}
+	if digests.Valid {
+		if err := json.Unmarshal([]byte(digests.String), &def.Digests); err != nil {
+			return def, fmt.Errorf("failed to decode image digests: %w", err)
+		}
+	}
+
+	return def, nil
+}
+
+func failurePayload(failure *domain.DeploymentFailure) (sql.NullString, error) {
+	if failure == nil {
+		return sql.NullString{}, nil
+	}
+	payload, err := json.Marshal(failure)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to marshal deployment failure to json: %w", err)
+	}
+	return sql.NullString{String: string(payload), Valid: true}, nil
+}
+
+// timelinePayload encodes the timeline to a nullable jsonb column, an empty timeline is stored as null
+func timelinePayload(timeline []domain.TimelineEvent) (sql.NullString, error) {
+	if len(timeline) == 0 {
+		return sql.NullString{}, nil
+	}
+	payload, err := json.Marshal(timeline)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to marshal timeline to json: %w", err)
+	}
+	return sql.NullString{String: string(payload), Valid: true}, nil
+}
+
+// objectsPayload encodes the deployment objects to a nullable jsonb column, no objects are stored as null
+func objectsPayload(objects []domain.ObjectRef) (sql.NullString, error) {
+	if len(objects) == 0 {
+		return sql.NullString{}, nil
+	}
+	payload, err := json.Marshal(objects)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to marshal deployment objects to json: %w", err)
+	}
+	return sql.NullString{String: string(payload), Valid: true}, nil
+}
+
+// mapPayload encodes the map to a nullable jsonb column, a nil map is stored as null
+func mapPayload[V any](m map[string]V) (sql.NullString, error) {
+	if m == nil {
+		return sql.NullString{}, nil
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(payload), Valid: true}, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func (s *Store) GetDeployment(ctx context.Context, id string) (domain.AppDefinition, error) {
+	query, args, err := s.sq.Select(deploymentColumns...).
+		From("deployments").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return domain.AppDefinition{}, fmt.Errorf("failed to build GetDeployment query: %w", err)
+	}
+
+	def, err := scanDeployment(s.conn(ctx).QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return def, domain.ErrDeploymentNotFound
+		}
+		return def, fmt.Errorf("failed to scan GetDeployment: %w", err)
+	}
+
+	return def, nil
+}
+
+func (s *Store) UpdateDeploymentStatus(ctx context.Context, id string, status domain.DeploymentStatus) error {
+	update := s.sq.Update("deployments").
+		Set("status", status).
+		Where(sq.Eq{"id": id})
+	if status.Terminal() {
+		update = update.Set("finishedAt", now())
+	}
+	query, args, err := update.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build UpdateDeploymentStatus query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec UpdateDeploymentStatus: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) UpdateDeploymentStatuses(ctx context.Context, statuses map[string]domain.DeploymentStatus) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(statuses))
+	status := sq.Case("id")
+	for id, st := range statuses {
+		ids = append(ids, id)
+		status = status.When(sq.Expr("?", id), sq.Expr("?", st))
+	}
+
+	query, args, err := s.sq.Update("deployments").
+		Set("status", status).
+		Where(sq.And{
+			sq.Eq{"id": ids},
+			sq.NotEq{"status": domain.TerminalDeploymentStatuses},
+		}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build UpdateDeploymentStatuses query: %w", err)
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec UpdateDeploymentStatuses: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) FailDeployment(ctx context.Context, id string, failure domain.DeploymentFailure) error {
+	payload, err := failurePayload(&failure)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := s.sq.Update("deployments").
+		Set("status", domain.DeploymentStatusFailed).
+		Set("failure", payload).
+		Set("finishedAt", now()).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build FailDeployment query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec FailDeployment: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) SetDeploymentEnv(ctx context.Context, id string, env map[string][]domain.EnvVar) error {
+	payload, err := mapPayload(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment env to json: %w", err)
+	}
+	query, args, err := s.sq.Update("deployments").
+		Set("env", payload).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetDeploymentEnv query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SetDeploymentEnv: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+	return nil
+}
+
+func (s *Store) SetDeploymentObjects(ctx context.Context, id string, objects []domain.ObjectRef) error {
+	payload, err := objectsPayload(objects)
+	if err != nil {
+		return err
+	}
+	query, args, err := s.sq.Update("deployments").
+		Set("objects", payload).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetDeploymentObjects query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SetDeploymentObjects: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+	return nil
+}
+
+func (s *Store) SetPromotionExpiresAt(ctx context.Context, id string, expiresAt time.Time) error {
+	query, args, err := s.sq.Update("deployments").
+		Set("promotionExpiresAt", expiresAt).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetPromotionExpiresAt query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SetPromotionExpiresAt: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+	return nil
+}
+
+func (s *Store) SaveMigrationLogs(ctx context.Context, id string, logs string) error {
+	query, args, err := s.sq.Update("deployments").
+		Set("migrationLogs", logs).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SaveMigrationLogs query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec SaveMigrationLogs: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) AddTimelineEvent(ctx context.Context, id string, event domain.TimelineEvent) error {
+	payload, err := json.Marshal([]domain.TimelineEvent{event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal timeline event to json: %w", err)
+	}
+	query, args, err := s.sq.Update("deployments").
+		Set("timeline", sq.Expr("COALESCE(timeline, '[]'::jsonb) || ?::jsonb", string(payload))).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build AddTimelineEvent query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to exec AddTimelineEvent: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrDeploymentNotFound
+	}
+
+	return nil
+}
+
 func (s *Store) GetDeploymentHistory(ctx context.Context, appID string) ([]domain.AppDefinition, error) {
-	query, args, err := s.sq.Select("id", "appId", "app", "tag", "sha", "user", "createdAt").
+	query, args, err := s.sq.Select(deploymentColumns...).
 		From("deployments").
 		Where(sq.Eq{"appId": appID}).
 		OrderBy("createdAt DESC").
 		Limit(20).
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build SaveDeployment query: %w", err)
+		return nil, fmt.Errorf("failed to build GetDeploymentHistory query: %w", err)
 	}
 
-	rows, err := s.db.QueryContext(ctx, query, args)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query GetDeploymentHistory: %w", err)
 	}
@@ -109,29 +515,84 @@ func (s *Store) GetDeploymentHistory(ctx context.Context, appID string) ([]domai
 
 	var defs []domain.AppDefinition
 	for rows.Next() {
-		var def domain.AppDefinition
-		var appPayload string
-		if err := rows.Scan(&def.ID, &def.AppID, &appPayload, &def.Tag, &def.Sha, &def.User, &def.CreatedAt); err != nil {
+		def, err := scanDeployment(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan GetDeploymentHistory row: %w", err)
 		}
+		defs = append(defs, def)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occured in iterating GetDeploymentHistory rows: %w", err)
+	}
+
+	return defs, nil
+}
+
+func (s *Store) ListDeployments(ctx context.Context, appID string) ([]domain.AppDefinition, error) {
+	return s.listDeployments(ctx, s.sq.Select(deploymentColumns...).
+		From("deployments").
+		Where(sq.Eq{"appId": appID}).
+		OrderBy("createdAt DESC"))
+}
 
-		var a tqsdk.Space
-		if err := json.Unmarshal([]byte(appPayload), &appPayload); err != nil {
-			return nil, fmt.Errorf("failed to decode app payload in GetDeploymentHistory: %w", err)
+func (s *Store) ListRecentDeployments(ctx context.Context, appID string, limit int) ([]domain.AppDefinition, error) {
+	return s.listDeployments(ctx, s.sq.Select(deploymentColumns...).
+		From("deployments").
+		Where(sq.Eq{"appId": appID}).
+		OrderBy("createdAt DESC").
+		Limit(uint64(limit)))
+}
+
+func (s *Store) listDeployments(ctx context.Context, selectQuery sq.SelectBuilder) ([]domain.AppDefinition, error) {
+	query, args, err := selectQuery.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build ListDeployments query: %w", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ListDeployments: %w", err)
+	}
+	defer rows.Close()
+
+	var defs []domain.AppDefinition
+	for rows.Next() {
+		def, err := scanDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ListDeployments row: %w", err)
 		}
-		def.App = a
 		defs = append(defs, def)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("an error occured in iterating GetDeploymentHistory rows: %w", err)
+		return nil, fmt.Errorf("an error occured in iterating ListDeployments rows: %w", err)
 	}
 
 	return defs, nil
 }
 
+func (s *Store) DeleteDeployments(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query, args, err := s.sq.Delete("deployments").
+		Where(sq.Eq{"id": ids}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build DeleteDeployments query: %w", err)
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to exec DeleteDeployments: %w", err)
+	}
+
+	return nil
+}
+
 func (s *Store) LinkGithub(ctx context.Context, installationID int, senderLogin string, repos []domain.InstalledRepository) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction for LinkGithub: %w", err)
 	}
@@ -180,7 +641,7 @@ func (s *Store) LinkGithub(ctx context.Context, installationID int, senderLogin
 				repo.Private,
 				installationInternalID,
 				userID,
-				"",
+				repo.Branch,
 				timestamp,
 				timestamp,
 			)
@@ -208,7 +669,7 @@ func (s *Store) SaveGithubRepos(ctx context.Context, userID int, installationID
 		return nil
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction for SaveGithubRepos: %w", err)
 	}
@@ -248,7 +709,7 @@ func (s *Store) RemoveGithubRepos(ctx context.Context, installationID int, repos
 		return nil
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction for RemoveGithubRepos: %w", err)
 	}
@@ -282,17 +743,23 @@ func (s *Store) RemoveGithubRepos(ctx context.Context, installationID int, repos
 	return nil
 }
 
-func (s *Store) GetGithubRepos(ctx context.Context, userID string) ([]domain.InstalledRepository, error) {
-	query, args, err := s.sq.Select("r.githubId", "r.fullName", "r.private", "r.branch").
+func (s *Store) GetGithubRepos(ctx context.Context, email string) ([]domain.InstalledRepository, error) {
+	query, args, err := s.sq.Select("r.id", "r.githubId", "r.fullName", "r.private", "r.branch", "r.authType", "COALESCE(i.githubId, 0)").
 		From("installedRepos r").
-		Where(sq.Eq{"r.userId": userID}).
+		Join("users u ON u.id = r.userId").
+		LeftJoin("installations i ON i.id = r.installationId").
+		// the repos of an organization installation are managed by its members too
+		Where(sq.Or{
+			sq.Eq{"u.email": email},
+			sq.Expr("i.githubId IN (SELECT m.installationGithubId FROM installationMembers m JOIN users mu ON mu.displayName = m.login WHERE mu.email = ?)", email),
+		}).
 		OrderBy("r.createdAt DESC").
 		ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build GetGithubRepos query: %w", err)
 	}
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query GetGithubRepos: %w", err)
 	}
@@ -301,7 +768,7 @@ func (s *Store) GetGithubRepos(ctx context.Context, userID string) ([]domain.Ins
 	var repos []domain.InstalledRepository
 	for rows.Next() {
 		var repo domain.InstalledRepository
-		if err := rows.Scan(&repo.ID, &repo.FullName, &repo.Private, &repo.Branch); err != nil {
+		if err := rows.Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Branch, &repo.AuthType, &repo.InstallationID); err != nil {
 			return nil, fmt.Errorf("failed to scan GetGithubRepos row: %w", err)
 		}
 		repos = append(repos, repo)
@@ -314,6 +781,58 @@ func (s *Store) GetGithubRepos(ctx context.Context, userID string) ([]domain.Ins
 	return repos, nil
 }
 
+func (s *Store) GetRepoByGithub(ctx context.Context, githubRepoID int) (domain.InstalledRepository, error) {
+	query, args, err := s.sq.Select("id", "githubId", "fullName", "private", "branch", "authType").
+		From("installedRepos").
+		Where(sq.Eq{"githubId": githubRepoID}).
+		ToSql()
+	if err != nil {
+		return domain.InstalledRepository{}, fmt.Errorf("failed to build GetRepoByGithub query: %w", err)
+	}
+
+	var repo domain.InstalledRepository
+	if err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Branch, &repo.AuthType); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return repo, domain.ErrRepoNotFound
+		}
+		return repo, fmt.Errorf("failed to scan GetRepoByGithub: %w", err)
+	}
+
+	return repo, nil
+}
+
+func (s *Store) GetReposWithoutBranch(ctx context.Context) ([]domain.InstalledRepository, error) {
+	query, args, err := s.sq.Select("r.id", "r.githubId", "r.fullName", "r.private", "r.branch", "r.authType", "COALESCE(i.githubId, 0)").
+		From("installedRepos r").
+		LeftJoin("installations i ON i.id = r.installationId").
+		Where(sq.Eq{"r.branch": ""}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetReposWithoutBranch query: %w", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetReposWithoutBranch: %w", err)
+	}
+	defer rows.Close()
+
+	var repos []domain.InstalledRepository
+	for rows.Next() {
+		var repo domain.InstalledRepository
+		if err := rows.Scan(&repo.TreenqID, &repo.ID, &repo.FullName, &repo.Private, &repo.Branch, &repo.AuthType, &repo.InstallationID); err != nil {
+			return nil, fmt.Errorf("failed to scan GetReposWithoutBranch row: %w", err)
+		}
+		repos = append(repos, repo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetReposWithoutBranch rows: %w", err)
+	}
+
+	return repos, nil
+}
+
 func (s *Store) ConnectRepoBranch(ctx context.Context, repoID int, branch string) error {
 	query, args, err := s.sq.Update("installedRepos").
 		Set("branch", branch).
@@ -323,7 +842,7 @@ func (s *Store) ConnectRepoBranch(ctx context.Context, repoID int, branch string
 		return fmt.Errorf("failed to build ConnectRepoBranch query: %w", err)
 	}
 
-	result, err := s.db.ExecContext(ctx, query, args...)
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
 	if err != nil {
 		return fmt.Errorf("failed to execute ConnectRepoBranch: %w", err)
 	}
@@ -339,3 +858,308 @@ func (s *Store) ConnectRepoBranch(ctx context.Context, repoID int, branch string
 
 	return nil
 }
+
+func (s *Store) SetRepoDeployKey(ctx context.Context, appID, privateKey string) error {
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for SetRepoDeployKey: %w", err)
+	}
+	defer tx.Rollback()
+
+	query, args, err := s.sq.Insert("repoDeployKeys").
+		Columns("appId", "privateKey", "updatedAt").
+		Values(appID, privateKey, now()).
+		Suffix("ON CONFLICT (appId) DO UPDATE SET privateKey = EXCLUDED.privateKey, updatedAt = EXCLUDED.updatedAt").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build upsert deploy key query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to upsert deploy key: %w", err)
+	}
+
+	query, args, err = s.sq.Update("installedRepos").
+		Set("authType", domain.RepoAuthDeployKey).
+		Where(sq.Eq{"id": appID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update auth type query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update auth type: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) SetAppFeedToken(ctx context.Context, appID, tokenHash string) error {
+	query, args, err := s.sq.Insert("appFeedTokens").
+		Columns("appId", "tokenHash", "updatedAt").
+		Values(appID, tokenHash, now()).
+		Suffix("ON CONFLICT (appId) DO UPDATE SET tokenHash = EXCLUDED.tokenHash, updatedAt = EXCLUDED.updatedAt").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SetAppFeedToken query: %w", err)
+	}
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to execute SetAppFeedToken: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetAppFeedToken(ctx context.Context, appID string) (string, error) {
+	query, args, err := s.sq.Select("tokenHash").
+		From("appFeedTokens").
+		Where(sq.Eq{"appId": appID}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build GetAppFeedToken query: %w", err)
+	}
+
+	var tokenHash string
+	if err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&tokenHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrFeedTokenNotFound
+		}
+		return "", fmt.Errorf("failed to scan GetAppFeedToken: %w", err)
+	}
+	return tokenHash, nil
+}
+
+func (s *Store) GetRepoDeployKey(ctx context.Context, appID string) (string, error) {
+	query, args, err := s.sq.Select("privateKey").
+		From("repoDeployKeys").
+		Where(sq.Eq{"appId": appID}).
+		ToSql()
+	if err != nil {
+		return "", fmt.Errorf("failed to build GetRepoDeployKey query: %w", err)
+	}
+
+	var key string
+	if err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&key); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", domain.ErrDeployKeyNotFound
+		}
+		return "", fmt.Errorf("failed to scan GetRepoDeployKey: %w", err)
+	}
+
+	return key, nil
+}
+
+func (s *Store) RenameGithubRepo(ctx context.Context, repoID int, fullName string) error {
+	query, args, err := s.sq.Update("installedRepos").
+		Set("fullName", fullName).
+		Where(sq.Eq{"githubId": repoID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RenameGithubRepo query: %w", err)
+	}
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute RenameGithubRepo: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return domain.ErrRepoNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) AddInstallationMember(ctx context.Context, installationID int, login string) error {
+	query, args, err := s.sq.Insert("installationMembers").
+		Columns("installationGithubId", "login", "createdAt").
+		Values(installationID, login, now()).
+		Suffix("ON CONFLICT (installationGithubId, login) DO NOTHING").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build AddInstallationMember query: %w", err)
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to execute AddInstallationMember: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) SaveInstallationPermissions(ctx context.Context, installationID int, permissions domain.InstallationPermissions) error {
+	payload, err := mapPayload(permissions.Permissions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal installation permissions to json: %w", err)
+	}
+	query, args, err := s.sq.Update("installations").
+		Set("permissions", payload).
+		Set("repositorySelection", permissions.RepositorySelection).
+		Set("permissionsCheckedAt", permissions.CheckedAt).
+		Where(sq.Eq{"githubId": installationID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build SaveInstallationPermissions query: %w", err)
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to execute SaveInstallationPermissions: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) RemoveInstallationMember(ctx context.Context, installationID int, login string) error {
+	query, args, err := s.sq.Delete("installationMembers").
+		Where(sq.Eq{"installationGithubId": installationID, "login": login}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build RemoveInstallationMember query: %w", err)
+	}
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to execute RemoveInstallationMember: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetAppEnvs(ctx context.Context, appID string) ([]domain.AppEnv, error) {
+	query, args, err := s.sq.Select("environment", "key", "value", "secret").
+		From("appEnvs").
+		Where(sq.Eq{"appId": appID}).
+		OrderBy("environment", "key").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetAppEnvs query: %w", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetAppEnvs: %w", err)
+	}
+	defer rows.Close()
+
+	var envs []domain.AppEnv
+	for rows.Next() {
+		var env domain.AppEnv
+		if err := rows.Scan(&env.Environment, &env.Key, &env.Value, &env.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan GetAppEnvs row: %w", err)
+		}
+		envs = append(envs, env)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetAppEnvs rows: %w", err)
+	}
+
+	return envs, nil
+}
+
+func (s *Store) SetAppEnvs(ctx context.Context, appID, environment string, envs []domain.AppEnv, remove []string) error {
+	tx, err := s.conn(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for SetAppEnvs: %w", err)
+	}
+	defer tx.Rollback()
+
+	if len(remove) > 0 {
+		query, args, err := s.sq.Delete("appEnvs").
+			Where(sq.And{
+				sq.Eq{"appId": appID},
+				sq.Eq{"environment": environment},
+				sq.Eq{"key": remove},
+			}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build delete envs query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to delete envs: %w", err)
+		}
+	}
+
+	if len(envs) > 0 {
+		timestamp := now()
+		envsQuery := s.sq.Insert("appEnvs").
+			Columns("appId", "environment", "key", "value", "secret", "updatedAt")
+		for _, env := range envs {
+			envsQuery = envsQuery.Values(appID, environment, env.Key, env.Value, env.Secret, timestamp)
+		}
+		query, args, err := envsQuery.
+			Suffix("ON CONFLICT (appId, environment, key) DO UPDATE SET value = EXCLUDED.value, secret = EXCLUDED.secret, updatedAt = EXCLUDED.updatedAt").
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build upsert envs query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to upsert envs: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) AppendAppEvent(ctx context.Context, event domain.AppEvent) (domain.AppEvent, error) {
+	config, err := json.Marshal(event.Config)
+	if err != nil {
+		return event, fmt.Errorf("failed to marshal app config to json: %w", err)
+	}
+	event.CreatedAt = now()
+
+	// the version is the next one of the app, a concurrent change taking the same version fails on the primary key
+	query, args, err := s.sq.Insert("appEvents").
+		Columns("appId", "version", "change", "config", `"user"`, "revertedTo", "createdAt").
+		Values(event.AppID, sq.Expr("(SELECT COALESCE(MAX(version), 0) + 1 FROM appEvents WHERE appId = ?)", event.AppID), event.Change, string(config), event.User, event.RevertedTo, event.CreatedAt).
+		Suffix("RETURNING version").
+		ToSql()
+	if err != nil {
+		return event, fmt.Errorf("failed to build AppendAppEvent query: %w", err)
+	}
+	if err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&event.Version); err != nil {
+		return event, fmt.Errorf("failed to execute AppendAppEvent: %w", err)
+	}
+	return event, nil
+}
+
+func (s *Store) GetAppEvents(ctx context.Context, appID string) ([]domain.AppEvent, error) {
+	query, args, err := s.sq.Select("appId", "version", "change", "config", `"user"`, "revertedTo", "createdAt").
+		From("appEvents").
+		Where(sq.Eq{"appId": appID}).
+		OrderBy("version").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GetAppEvents query: %w", err)
+	}
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query GetAppEvents: %w", err)
+	}
+	defer rows.Close()
+
+	var events []domain.AppEvent
+	for rows.Next() {
+		var event domain.AppEvent
+		var config []byte
+		if err := rows.Scan(&event.AppID, &event.Version, &event.Change, &config, &event.User, &event.RevertedTo, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan GetAppEvents row: %w", err)
+		}
+		if err := json.Unmarshal(config, &event.Config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal app config: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate GetAppEvents rows: %w", err)
+	}
+
+	return events, nil
+}
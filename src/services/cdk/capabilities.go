@@ -0,0 +1,55 @@
+package cdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/treenq/treenq/src/domain"
+	"k8s.io/client-go/discovery"
+)
+
+func (k *Kube) MissingAPIs(ctx context.Context, rawConig string, kinds []domain.APIKind) ([]domain.APIKind, error) {
+	clientset, err := newClientset(rawConig)
+	if err != nil {
+		return nil, err
+	}
+	return missingAPIs(clientset.Discovery(), kinds)
+}
+
+// missingAPIs discovers the kinds served by the cluster and returns the given ones it doesn't serve.
+// A group which fails to be discovered fails the check only if a given kind belongs to it,
+// e.g. an unavailable metrics api doesn't matter to an app without autoscaling.
+func missingAPIs(client discovery.DiscoveryInterface, kinds []domain.APIKind) ([]domain.APIKind, error) {
+	_, resources, err := client.ServerGroupsAndResources()
+	var failedGroups map[string]error
+	if err != nil {
+		var groupErr *discovery.ErrGroupDiscoveryFailed
+		if !errors.As(err, &groupErr) {
+			return nil, domain.SystemFailure(fmt.Errorf("failed to discover cluster apis: %w", err))
+		}
+		failedGroups = make(map[string]error, len(groupErr.Groups))
+		for gv, err := range groupErr.Groups {
+			failedGroups[gv.String()] = err
+		}
+	}
+
+	served := make(map[domain.APIKind]bool)
+	for _, list := range resources {
+		for _, resource := range list.APIResources {
+			served[domain.APIKind{APIVersion: list.GroupVersion, Kind: resource.Kind}] = true
+		}
+	}
+
+	var missing []domain.APIKind
+	for _, kind := range kinds {
+		if served[kind] {
+			continue
+		}
+		if err, ok := failedGroups[kind.APIVersion]; ok {
+			return nil, domain.SystemFailure(fmt.Errorf("failed to discover %s: %w", kind.APIVersion, err))
+		}
+		missing = append(missing, kind)
+	}
+	return missing, nil
+}
@@ -0,0 +1,32 @@
+package cdk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMissingAPIs(t *testing.T) {
+	client := kubefake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+	client.Resources = []*metav1.APIResourceList{
+		{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{{Name: "deployments", Kind: "Deployment"}}},
+		{GroupVersion: "networking.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "ingresses", Kind: "Ingress"}}},
+	}
+
+	missing, err := missingAPIs(client, []domain.APIKind{
+		{APIVersion: "apps/v1", Kind: "Deployment"},
+		{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+		{APIVersion: "cert-manager.io/v1", Kind: "Certificate"},
+		{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.APIKind{
+		{APIVersion: "cert-manager.io/v1", Kind: "Certificate"},
+		{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscaler"},
+	}, missing)
+}
@@ -0,0 +1,133 @@
+package cdk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/treenq/treenq/src/domain"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+)
+
+// ImportWorkload reads the live Deployment and labels it, its namespace and the Services selecting its pods
+// as owned by treenq for the app. The pod template is left as is, so the running pods aren't restarted.
+func (k *Kube) ImportWorkload(ctx context.Context, rawConig, namespace, name, appID string) (domain.Workload, error) {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return domain.Workload{}, err
+	}
+	return importWorkload(ctx, dynamicClient, namespace, name, appID)
+}
+
+func importWorkload(ctx context.Context, client dynamic.Interface, namespace, name, appID string) (domain.Workload, error) {
+	deployment, err := client.Resource(deploymentsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return domain.Workload{}, fmt.Errorf("%w: deployment %s/%s", domain.ErrWorkloadNotFound, namespace, name)
+		}
+		return domain.Workload{}, fmt.Errorf("failed to get deployment %s/%s: %w", namespace, name, err)
+	}
+	workload, err := deploymentWorkload(deployment)
+	if err != nil {
+		return domain.Workload{}, err
+	}
+
+	podLabels, _, _ := unstructured.NestedStringMap(deployment.Object, "spec", "template", "metadata", "labels")
+	services, err := client.Resource(servicesResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return domain.Workload{}, fmt.Errorf("failed to list services of %s: %w", namespace, err)
+	}
+	stampOwnership(deployment, appID)
+	if _, err := client.Resource(deploymentsResource).Namespace(namespace).Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		return domain.Workload{}, fmt.Errorf("failed to label deployment %s: %w", name, err)
+	}
+	for i := range services.Items {
+		service := &services.Items[i]
+		selector, found, _ := unstructured.NestedStringMap(service.Object, "spec", "selector")
+		if !found || len(selector) == 0 || !labels.SelectorFromSet(selector).Matches(labels.Set(podLabels)) {
+			continue
+		}
+		stampOwnership(service, appID)
+		if _, err := client.Resource(servicesResource).Namespace(namespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+			return domain.Workload{}, fmt.Errorf("failed to label service %s: %w", service.GetName(), err)
+		}
+	}
+
+	ns, err := client.Resource(namespacesResource).Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return domain.Workload{}, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+	if err == nil {
+		stampOwnership(ns, appID)
+		if _, err := client.Resource(namespacesResource).Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+			return domain.Workload{}, fmt.Errorf("failed to label namespace %s: %w", namespace, err)
+		}
+	}
+
+	return workload, nil
+}
+
+// stampOwnership sets the treenq ownership labels on the object metadata only
+func stampOwnership(obj *unstructured.Unstructured, appID string) {
+	objLabels := obj.GetLabels()
+	if objLabels == nil {
+		objLabels = make(map[string]string)
+	}
+	objLabels[managedByLabel] = managedBy
+	objLabels[appIDLabel] = appID
+	obj.SetLabels(objLabels)
+}
+
+// deploymentWorkload reads the workload from the first container of the Deployment pod template
+func deploymentWorkload(deployment *unstructured.Unstructured) (domain.Workload, error) {
+	workload := domain.Workload{
+		Namespace: deployment.GetNamespace(),
+		Name:      deployment.GetName(),
+		Replicas:  1,
+	}
+	if replicas, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas"); found {
+		workload.Replicas = int(replicas)
+	}
+
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	if len(containers) == 0 {
+		return workload, fmt.Errorf("deployment %s/%s has no containers", workload.Namespace, workload.Name)
+	}
+	container, ok := containers[0].(map[string]interface{})
+	if !ok {
+		return workload, fmt.Errorf("deployment %s/%s has a malformed container", workload.Namespace, workload.Name)
+	}
+	workload.Image, _, _ = unstructured.NestedString(container, "image")
+
+	ports, _, _ := unstructured.NestedSlice(container, "ports")
+	if len(ports) > 0 {
+		if port, ok := ports[0].(map[string]interface{}); ok {
+			containerPort, _, _ := unstructured.NestedInt64(port, "containerPort")
+			workload.HttpPort = int(containerPort)
+		}
+	}
+
+	envs, _, _ := unstructured.NestedSlice(container, "env")
+	for _, item := range envs {
+		env, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		// an env referring a secret or a field has no value to import
+		if _, ok := env["valueFrom"]; ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(env, "name")
+		value, _, _ := unstructured.NestedString(env, "value")
+		if workload.Envs == nil {
+			workload.Envs = make(map[string]string)
+		}
+		workload.Envs[name] = value
+	}
+
+	return workload, nil
+}
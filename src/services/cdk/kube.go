@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
@@ -16,29 +17,48 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	sigsyaml "sigs.k8s.io/yaml"
 )
 
 type Kube struct {
+	// maintenanceHost is a host of the treenq maintenance page backend
+	maintenanceHost string
 }
 
-func NewKube() *Kube {
-	return &Kube{}
+func NewKube(maintenanceHost string) *Kube {
+	return &Kube{
+		maintenanceHost: maintenanceHost,
+	}
 }
 
-func (k *Kube) DefineApp(ctx context.Context, id string, app tqsdk.Space, image domain.Image) string {
+// ownership labels are set on every object treenq creates for an app
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "treenq"
+	appIDLabel     = "treenq.io/app-id"
+)
+
+func (k *Kube) DefineApp(ctx context.Context, id, appID string, app tqsdk.Space, images map[string]domain.Image) string {
 	a := cdk8s.NewApp(nil)
-	k.newAppChart(a, id, app, image)
+	k.newAppChart(a, id, appID, app, images)
 	out := a.SynthYaml()
 	return *out
 }
 
-func (k *Kube) newAppChart(scope constructs.Construct, id string, app tqsdk.Space, image domain.Image) cdk8s.Chart {
-	ns := jsii.String(id + "-" + app.Key)
+func (k *Kube) newAppChart(scope constructs.Construct, id, appID string, app tqsdk.Space, images map[string]domain.Image) cdk8s.Chart {
+	ns := jsii.String(appNamespace(id, app.Key))
 	chart := cdk8s.NewChart(scope, jsii.String(id), &cdk8s.ChartProps{
 		Namespace: ns,
+		Labels: &map[string]*string{
+			managedByLabel: jsii.String(managedBy),
+			appIDLabel:     jsii.String(appID),
+		},
 	})
 
 	cdk8splus.NewNamespace(chart, jsii.String(id+"-ns"), &cdk8splus.NamespaceProps{
@@ -48,111 +68,374 @@ func (k *Kube) newAppChart(scope constructs.Construct, id string, app tqsdk.Spac
 		},
 	})
 
+	for _, service := range app.AllServices() {
+		k.newService(chart, appID, service, images[service.Name])
+	}
+
+	return chart
+}
+
+// appNamespace is a namespace of the deployment objects
+func appNamespace(id, spaceKey string) string {
+	return dnsLabel(id + "-" + spaceKey)
+}
+
+func (k *Kube) newService(chart cdk8s.Chart, appID string, service tqsdk.Service, image domain.Image) {
 	envs := make(map[string]cdk8splus.EnvValue)
-	for k, v := range app.Service.RuntimeEnvs {
+	for k, v := range service.RuntimeEnvs {
 		envs[k] = cdk8splus.EnvValue_FromValue(jsii.String(v))
 	}
-	computeRes := app.Service.SizeSlug.ToComputationResource()
-
-	tmpVolume := cdk8splus.Volume_FromEmptyDir(chart, jsii.String(app.Service.Name+"-volume-tmp"), jsii.String("tmp"), nil)
-
-	deployment := cdk8splus.NewDeployment(chart, jsii.String(app.Service.Name+"-deployment"), &cdk8splus.DeploymentProps{
-		Replicas: jsii.Number(app.Service.Replicas),
-		Containers: &[]*cdk8splus.ContainerProps{{
-			Name:  jsii.String(app.Service.Name),
-			Image: jsii.String(image.FullPath()),
-			Ports: &[]*cdk8splus.ContainerPort{{
-				Number: jsii.Number(app.Service.HttpPort),
-				Name:   jsii.String("http"),
-			}},
-			EnvVariables: &envs,
-			VolumeMounts: &[]*cdk8splus.VolumeMount{
-				{
-					Path:   jsii.String("/tmp"),
-					Volume: tmpVolume,
-				},
+	computeRes := service.SizeSlug.ToComputationResource()
+
+	tmpVolume := cdk8splus.Volume_FromEmptyDir(chart, jsii.String(service.Name+"-volume-tmp"), jsii.String("tmp"), nil)
+
+	container := &cdk8splus.ContainerProps{
+		Name:  jsii.String(service.Name),
+		Image: jsii.String(image.PullPath()),
+		Ports: &[]*cdk8splus.ContainerPort{{
+			Number: jsii.Number(service.HttpPort),
+			Name:   jsii.String("http"),
+		}},
+		EnvVariables: &envs,
+		VolumeMounts: &[]*cdk8splus.VolumeMount{
+			{
+				Path:   jsii.String("/tmp"),
+				Volume: tmpVolume,
 			},
-			Resources: &cdk8splus.ContainerResources{
-				Cpu: &cdk8splus.CpuResources{
-					Limit:   cdk8splus.Cpu_Millis(jsii.Number(computeRes.CpuUnits)),
-					Request: cdk8splus.Cpu_Millis(jsii.Number(computeRes.CpuUnits)),
-				},
-				EphemeralStorage: &cdk8splus.EphemeralStorageResources{
-					Limit:   cdk8s.Size_Gibibytes(jsii.Number(computeRes.DiskGibs)),
-					Request: cdk8s.Size_Gibibytes(jsii.Number(computeRes.DiskGibs)),
-				},
-				Memory: &cdk8splus.MemoryResources{
-					Limit:   cdk8s.Size_Mebibytes(jsii.Number(computeRes.MemoryMibs)),
-					Request: cdk8s.Size_Mebibytes(jsii.Number(computeRes.MemoryMibs)),
-				},
+		},
+		Resources: &cdk8splus.ContainerResources{
+			Cpu: &cdk8splus.CpuResources{
+				Limit:   cdk8splus.Cpu_Millis(jsii.Number(computeRes.CpuUnits)),
+				Request: cdk8splus.Cpu_Millis(jsii.Number(computeRes.CpuUnits)),
 			},
-		}},
-		Volumes: &[]cdk8splus.Volume{tmpVolume},
+			EphemeralStorage: &cdk8splus.EphemeralStorageResources{
+				Limit:   cdk8s.Size_Gibibytes(jsii.Number(computeRes.DiskGibs)),
+				Request: cdk8s.Size_Gibibytes(jsii.Number(computeRes.DiskGibs)),
+			},
+			Memory: &cdk8splus.MemoryResources{
+				Limit:   cdk8s.Size_Mebibytes(jsii.Number(computeRes.MemoryMibs)),
+				Request: cdk8s.Size_Mebibytes(jsii.Number(computeRes.MemoryMibs)),
+			},
+		},
+	}
+	if len(service.ReadinessCommand) > 0 {
+		container.Readiness = cdk8splus.Probe_FromCommand(jsii.Strings(service.ReadinessCommand...), nil)
+	}
+
+	deployment := cdk8splus.NewDeployment(chart, jsii.String(service.Name+"-deployment"), &cdk8splus.DeploymentProps{
+		Metadata: &cdk8s.ApiObjectMetadata{
+			Name: jsii.String(objectName(appID, service.Name, "deployment")),
+		},
+		Replicas:   jsii.Number(service.Replicas),
+		Containers: &[]*cdk8splus.ContainerProps{container},
+		Volumes:    &[]cdk8splus.Volume{tmpVolume},
 	})
 
-	service := cdk8splus.NewService(chart, jsii.String(app.Service.Name+"-service"), &cdk8splus.ServiceProps{
+	kubeService := cdk8splus.NewService(chart, jsii.String(service.Name+"-service"), &cdk8splus.ServiceProps{
+		Metadata: &cdk8s.ApiObjectMetadata{
+			Name: jsii.String(objectName(appID, service.Name, "service")),
+		},
 		Ports: &[]*cdk8splus.ServicePort{{
 			Name:       jsii.String("http"),
 			Port:       jsii.Number(80),
-			TargetPort: jsii.Number(app.Service.HttpPort),
+			TargetPort: jsii.Number(service.HttpPort),
 		}},
 		Selector: deployment,
 	})
 
-	cdk8splus.NewIngress(chart, jsii.String(app.Service.Name+"-ingress"), &cdk8splus.IngressProps{
-		// Metadata: &cdk8s.ApiObjectMetadata{
-		// 	Annotations: &map[string]*string{
-		// 		"nginx.ingress.kubernetes.io/rewrite-target": jsii.String("/"),
-		// 	},
-		// },
+	ingressMetadata := &cdk8s.ApiObjectMetadata{
+		Name: jsii.String(objectName(appID, service.Name, "ingress")),
+	}
+	if service.MaintenanceMode {
+		ingressMetadata.Annotations = &map[string]*string{
+			maintenanceModeAnnotation: jsii.String("true"),
+		}
+	}
+	cdk8splus.NewIngress(chart, jsii.String(service.Name+"-ingress"), &cdk8splus.IngressProps{
+		Metadata: ingressMetadata,
 		Rules: &[]*cdk8splus.IngressRule{{
-			Host:     jsii.String(app.Service.Host),
+			Host:     jsii.String(service.Host),
 			Path:     jsii.String("/"),
 			PathType: cdk8splus.HttpIngressPathType_PREFIX,
-			Backend:  cdk8splus.IngressBackend_FromResource(service),
+			Backend:  cdk8splus.IngressBackend_FromResource(kubeService),
 		}},
 	})
-
-	return chart
 }
 
 func (k *Kube) Apply(ctx context.Context, rawConig, data string) error {
-	decoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
-	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConig))
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return err
+	}
+
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return err
+	}
+	return applyObjects(ctx, dynamicClient, objs)
+}
+
+func (k *Kube) DefinedObjects(data string) ([]domain.ObjectRef, error) {
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]domain.ObjectRef, 0, len(objs))
+	for _, obj := range objs {
+		refs = append(refs, domain.ObjectRef{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+	return refs, nil
+}
+
+func (k *Kube) ApplyPaused(ctx context.Context, rawConig, data string) error {
+	return k.applyFiltered(ctx, rawConig, data, func(obj *unstructured.Unstructured) bool {
+		return obj.GetKind() != "Ingress"
+	})
+}
+
+func (k *Kube) RouteTraffic(ctx context.Context, rawConig, data string) error {
+	return k.applyFiltered(ctx, rawConig, data, func(obj *unstructured.Unstructured) bool {
+		return obj.GetKind() == "Ingress"
+	})
+}
+
+// applyFiltered applies the decoded objects matching the filter
+func (k *Kube) applyFiltered(ctx context.Context, rawConig, data string, filter func(*unstructured.Unstructured) bool) error {
+	dynamicClient, err := newDynamicClient(rawConig)
 	if err != nil {
 		return err
 	}
 
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return err
+	}
+	var filtered []*unstructured.Unstructured
+	for _, obj := range objs {
+		if filter(obj) {
+			filtered = append(filtered, obj)
+		}
+	}
+	return applyObjects(ctx, dynamicClient, filtered)
+}
+
+func applyObjects(ctx context.Context, client dynamic.Interface, objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
+		// a cancelled deployment stops applying the rest of the objects
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("apply of %s %s is stopped: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+		resourceClient := client.Resource(gvr).Namespace(obj.GetNamespace())
+
+		_, err := resourceClient.Create(ctx, obj, metav1.CreateOptions{})
+		if errors.IsAlreadyExists(err) {
+			if inMaintenance(ctx, resourceClient, obj) {
+				// the Ingress is restored by SetMaintenance once the services are ready
+				continue
+			}
+			_, err = resourceClient.Update(ctx, obj, metav1.UpdateOptions{})
+			if err != nil {
+				return classifyApplyError(fmt.Errorf("failed to update object: %w", err))
+			}
+		} else if err != nil {
+			return classifyApplyError(fmt.Errorf("failed to create object: %w", err))
+		}
+	}
+
+	return nil
+}
+
+func newDynamicClient(rawConig string) (dynamic.Interface, error) {
+	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConig))
+	if err != nil {
+		return nil, domain.SystemFailure(err)
+	}
+
 	dynamicClient, err := dynamic.NewForConfig(conf)
 	if err != nil {
-		return fmt.Errorf("failed to create dynamic client: %w", err)
+		return nil, domain.SystemFailure(fmt.Errorf("failed to create dynamic client: %w", err))
+	}
+	return dynamicClient, nil
+}
+
+func newClientset(rawConig string) (kubernetes.Interface, error) {
+	conf, err := clientcmd.RESTConfigFromKubeConfig([]byte(rawConig))
+	if err != nil {
+		return nil, domain.SystemFailure(err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return nil, domain.SystemFailure(fmt.Errorf("failed to create clientset: %w", err))
 	}
+	return clientset, nil
+}
 
+func decodeObjects(data string) ([]*unstructured.Unstructured, error) {
+	decoder := yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 	dataChunks := strings.Split(data, "---")
 
 	objs := make([]*unstructured.Unstructured, len(dataChunks))
 	for i, chunk := range dataChunks {
 		var obj unstructured.Unstructured
-		_, _, err = decoder.Decode([]byte(chunk), nil, &obj)
+		_, _, err := decoder.Decode([]byte(chunk), nil, &obj)
 		if err != nil {
-			return fmt.Errorf("failed to decode YAML: %w", err)
+			return nil, domain.SystemFailure(fmt.Errorf("failed to decode YAML: %w", err))
 		}
 		objs[i] = &obj
 	}
+	return objs, nil
+}
+
+var eventsResource = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// RecordEvent records the event on every Deployment of the given app objects
+func (k *Kube) RecordEvent(ctx context.Context, rawConig, data string, event domain.KubeEvent) error {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return err
+	}
+
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return err
+	}
+	return recordEvent(ctx, dynamicClient, objs, event)
+}
+
+func recordEvent(ctx context.Context, client dynamic.Interface, objs []*unstructured.Unstructured, event domain.KubeEvent) error {
+	eventType := "Normal"
+	if event.Warning {
+		eventType = "Warning"
+	}
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+
 	for _, obj := range objs {
-		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
-		resourceClient := dynamicClient.Resource(gvr).Namespace(obj.GetNamespace())
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		kubeEvent := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Event",
+			"metadata": map[string]interface{}{
+				// the same naming client-go event recorder uses
+				"name":      fmt.Sprintf("%s.%x", obj.GetName(), time.Now().UnixNano()),
+				"namespace": obj.GetNamespace(),
+			},
+			"involvedObject": map[string]interface{}{
+				"apiVersion": obj.GetAPIVersion(),
+				"kind":       obj.GetKind(),
+				"name":       obj.GetName(),
+				"namespace":  obj.GetNamespace(),
+			},
+			"reason":         string(event.Reason),
+			"message":        event.Message,
+			"type":           eventType,
+			"source":         map[string]interface{}{"component": "treenq"},
+			"firstTimestamp": timestamp,
+			"lastTimestamp":  timestamp,
+			"count":          int64(1),
+		}}
 
-		_, err = resourceClient.Create(ctx, obj, metav1.CreateOptions{})
-		if errors.IsAlreadyExists(err) {
-			_, err = resourceClient.Update(ctx, obj, metav1.UpdateOptions{})
+		_, err := client.Resource(eventsResource).Namespace(obj.GetNamespace()).Create(ctx, kubeEvent, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create %s event for %s: %w", event.Reason, obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// appResources are the object kinds treenq creates for an app
+var appResources = []schema.GroupVersionResource{
+	{Version: "v1", Resource: "namespaces"},
+	{Group: "apps", Version: "v1", Resource: "deployments"},
+	{Version: "v1", Resource: "services"},
+	{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+	{Version: "v1", Resource: "configmaps"},
+	{Version: "v1", Resource: "secrets"},
+}
+
+var secretsResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// redactedValue replaces the secret values of the returned objects
+const redactedValue = "<redacted>"
+
+// GetResources lists the live app objects labeled as owned by treenq
+func (k *Kube) GetResources(ctx context.Context, rawConig, appID string) ([]domain.KubeResource, error) {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return nil, err
+	}
+	return getResources(ctx, dynamicClient, appID)
+}
+
+func getResources(ctx context.Context, client dynamic.Interface, appID string) ([]domain.KubeResource, error) {
+	selector := labels.SelectorFromSet(labels.Set{
+		managedByLabel: managedBy,
+		appIDLabel:     appID,
+	}).String()
+
+	var resources []domain.KubeResource
+	for _, gvr := range appResources {
+		list, err := client.Resource(gvr).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+
+		for _, obj := range list.Items {
+			obj.SetManagedFields(nil)
+			if gvr == secretsResource {
+				redactSecret(&obj)
+			}
+			manifest, err := sigsyaml.Marshal(obj.Object)
 			if err != nil {
-				return fmt.Errorf("failed to update object: %w", err)
+				return nil, fmt.Errorf("failed to encode %s %s: %w", obj.GetKind(), obj.GetName(), err)
 			}
-		} else if err != nil {
-			return fmt.Errorf("failed to create object: %w", err)
+			resources = append(resources, domain.KubeResource{
+				APIVersion: obj.GetAPIVersion(),
+				Kind:       obj.GetKind(),
+				Namespace:  obj.GetNamespace(),
+				Name:       obj.GetName(),
+				Manifest:   string(manifest),
+			})
 		}
 	}
 
-	return nil
+	return resources, nil
+}
+
+// redactSecret keeps the secret keys and replaces their values
+func redactSecret(obj *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		values, ok := obj.Object[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range values {
+			values[key] = redactedValue
+		}
+	}
+
+	// the last applied configuration holds the secret values too
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+		annotations["kubectl.kubernetes.io/last-applied-configuration"] = redactedValue
+		obj.SetAnnotations(annotations)
+	}
+}
+
+// classifyApplyError blames the user for the objects rejected by the cluster validation,
+// the rest of the errors come from the unavailable or broken cluster
+func classifyApplyError(err error) error {
+	if errors.IsInvalid(err) || errors.IsBadRequest(err) {
+		return domain.UserFailure(err)
+	}
+	return domain.SystemFailure(err)
 }
@@ -3,11 +3,21 @@ package cdk
 import (
 	"context"
 	_ "embed"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	tqsdk "github.com/treenq/treenq/pkg/sdk"
 	"github.com/treenq/treenq/src/domain"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
 )
 
 //go:embed testdata/app.yaml
@@ -17,9 +27,9 @@ var appYaml string
 var conf string
 
 func TestAppDefinition(t *testing.T) {
-	k := NewKube()
+	k := NewKube("")
 	ctx := context.Background()
-	res := k.DefineApp(ctx, "id-1234", tqsdk.Space{
+	res := k.DefineApp(ctx, "id-1234", "app-1234", tqsdk.Space{
 		Key: "space",
 		Service: tqsdk.Service{
 			Name: "simple-app",
@@ -33,10 +43,12 @@ func TestAppDefinition(t *testing.T) {
 			Host:     "treenq.local",
 			SizeSlug: tqsdk.SizeSlugS,
 		},
-	}, domain.Image{
-		Registry:   "registry:5000",
-		Repository: "treenq",
-		Tag:        "0.0.1",
+	}, map[string]domain.Image{
+		"simple-app": {
+			Registry:   "registry:5000",
+			Repository: "treenq",
+			Tag:        "0.0.1",
+		},
 	})
 
 	assert.Equal(t, appYaml, res)
@@ -45,6 +57,307 @@ func TestAppDefinition(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestApplyUnreachableClusterIsSystemFailure(t *testing.T) {
+	k := NewKube("")
+	unreachableConf := strings.Replace(conf, "https://127.0.0.1:6443", "https://127.0.0.1:1", 1)
+
+	err := k.Apply(context.Background(), unreachableConf, appYaml)
+	require.Error(t, err)
+
+	var failureErr *domain.FailureError
+	require.True(t, errors.As(err, &failureErr))
+	assert.Equal(t, domain.FailureClassSystem, failureErr.Class)
+}
+
+func TestRecordEventOnDeployments(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		eventsResource: "EventList",
+	})
+	objs, err := decodeObjects(appYaml)
+	require.NoError(t, err)
+
+	err = recordEvent(context.Background(), client, objs, domain.KubeEvent{
+		Reason:  domain.KubeEventDeploySucceeded,
+		Message: "treenq deployment id-1234 succeeded",
+	})
+	require.NoError(t, err)
+
+	events, err := client.Resource(eventsResource).Namespace("id-1234-space").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1)
+
+	event := events.Items[0].Object
+	assert.Equal(t, "DeploySucceeded", event["reason"])
+	assert.Equal(t, "Normal", event["type"])
+	assert.Equal(t, "treenq deployment id-1234 succeeded", event["message"])
+	assert.Equal(t, map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"name":       "app-1234-simple-app-deployment",
+		"namespace":  "id-1234-space",
+	}, event["involvedObject"])
+}
+
+func testObject(apiVersion, kind, namespace, name string, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    labels,
+		},
+	}}
+}
+
+func TestGetResourcesReturnsOwnedObjects(t *testing.T) {
+	owned := map[string]interface{}{managedByLabel: managedBy, appIDLabel: "app-1234"}
+	secret := testObject("v1", "Secret", "id-1234-space", "db", owned)
+	secret.Object["data"] = map[string]interface{}{"password": "c2VjcmV0"}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		appResources[0]: "NamespaceList",
+		appResources[1]: "DeploymentList",
+		appResources[2]: "ServiceList",
+		appResources[3]: "IngressList",
+		appResources[4]: "ConfigMapList",
+		appResources[5]: "SecretList",
+	},
+		testObject("apps/v1", "Deployment", "id-1234-space", "api", owned),
+		testObject("v1", "Service", "id-1234-space", "api", owned),
+		testObject("networking.k8s.io/v1", "Ingress", "id-1234-space", "api", owned),
+		secret,
+		testObject("apps/v1", "Deployment", "id-1234-space", "sidecar", nil),
+		testObject("apps/v1", "Deployment", "id-5678-space", "other-app", map[string]interface{}{managedByLabel: managedBy, appIDLabel: "app-5678"}),
+		testObject("v1", "Service", "id-1234-space", "foreign", map[string]interface{}{appIDLabel: "app-1234"}),
+	)
+
+	resources, err := getResources(context.Background(), client, "app-1234")
+	require.NoError(t, err)
+
+	names := make([]string, len(resources))
+	for i := range resources {
+		names[i] = resources[i].Kind + "/" + resources[i].Name
+	}
+	assert.Equal(t, []string{"Deployment/api", "Service/api", "Ingress/api", "Secret/db"}, names)
+
+	assert.Contains(t, resources[3].Manifest, "password: "+redactedValue)
+	assert.NotContains(t, resources[3].Manifest, "c2VjcmV0")
+	assert.Contains(t, resources[0].Manifest, "name: api")
+}
+
+func TestMaintenanceRoutesIngressAndRestoresIt(t *testing.T) {
+	k := NewKube("maintenance.treenq.svc.cluster.local")
+	data := k.DefineApp(context.Background(), "id-1234", "app-1234", tqsdk.Space{
+		Key:     "space",
+		Service: tqsdk.Service{Name: "api", HttpPort: 8000, Replicas: 1, Host: "api.treenq.local", SizeSlug: tqsdk.SizeSlugS, MaintenanceMode: true},
+	}, map[string]domain.Image{"api": {Registry: "registry", Repository: "api", Tag: "latest"}})
+	objs, err := decodeObjects(data)
+	require.NoError(t, err)
+	ingress := maintenanceIngresses(objs)
+	require.Len(t, ingress, 1)
+
+	ctx := context.Background()
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	require.NoError(t, applyObjects(ctx, client, objs))
+
+	backend := func() map[string]interface{} {
+		live, err := client.Resource(ingressesResource).Namespace("id-1234-space").Get(ctx, ingress[0].GetName(), metav1.GetOptions{})
+		require.NoError(t, err)
+		rules, _, _ := unstructured.NestedSlice(live.Object, "spec", "rules")
+		paths, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "http", "paths")
+		return paths[0].(map[string]interface{})["backend"].(map[string]interface{})
+	}
+	maintenanceBackend := map[string]interface{}{
+		"service": map[string]interface{}{
+			"name": maintenanceService,
+			"port": map[string]interface{}{"number": maintenancePort},
+		},
+	}
+
+	require.NoError(t, enableMaintenance(ctx, client, objs, k.maintenanceHost))
+	assert.Equal(t, maintenanceBackend, backend())
+	service, err := client.Resource(servicesResource).Namespace("id-1234-space").Get(ctx, maintenanceService, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "maintenance.treenq.svc.cluster.local", service.Object["spec"].(map[string]interface{})["externalName"])
+
+	// applying the new version keeps the traffic on the maintenance page
+	require.NoError(t, applyObjects(ctx, client, objs))
+	assert.Equal(t, maintenanceBackend, backend())
+
+	require.NoError(t, disableMaintenance(ctx, client, objs))
+	assert.Contains(t, backend(), "resource")
+}
+
+func TestWaitReady(t *testing.T) {
+	deployment := testObject("apps/v1", "Deployment", "id-1234-space", "api", nil)
+	deployment.SetGeneration(2)
+	deployment.Object["spec"] = map[string]interface{}{"replicas": int64(2)}
+	deployment.Object["status"] = map[string]interface{}{
+		"observedGeneration": int64(2),
+		"updatedReplicas":    int64(2),
+		"availableReplicas":  int64(1),
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := waitReady(ctx, client, []*unstructured.Unstructured{deployment})
+	var failureErr *domain.FailureError
+	require.True(t, errors.As(err, &failureErr))
+	assert.Equal(t, domain.FailureClassUser, failureErr.Class)
+
+	deployment.Object["status"].(map[string]interface{})["availableReplicas"] = int64(2)
+	_, err = client.Resource(deploymentsResource).Namespace("id-1234-space").Update(context.Background(), deployment, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.NoError(t, waitReady(context.Background(), client, []*unstructured.Unstructured{deployment}))
+}
+
+func TestReadinessCommandProbe(t *testing.T) {
+	k := NewKube("")
+	consumer := tqsdk.Service{Name: "consumer", HttpPort: 8000, Replicas: 1, Host: "consumer.treenq.local", SizeSlug: tqsdk.SizeSlugS, ReadinessCommand: []string{"test", "-f", "/tmp/connected"}}
+	objs, err := decodeObjects(k.DefineApp(context.Background(), "id-1234", "app", tqsdk.Space{Key: "space", Service: consumer}, map[string]domain.Image{
+		"consumer": {Registry: "registry:5000", Repository: "consumer", Tag: "latest"},
+	}))
+	require.NoError(t, err)
+
+	var deployment *unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetKind() == "Deployment" {
+			deployment = obj
+		}
+	}
+	require.NotNil(t, deployment)
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	require.Len(t, containers, 1)
+	command, _, _ := unstructured.NestedStringSlice(containers[0].(map[string]interface{}), "readinessProbe", "exec", "command")
+	assert.Equal(t, []string{"test", "-f", "/tmp/connected"}, command)
+}
+
+func TestDeploymentPullsImageByDigest(t *testing.T) {
+	k := NewKube("")
+	api := tqsdk.Service{Name: "api", HttpPort: 8000, Replicas: 1, Host: "api.treenq.local", SizeSlug: tqsdk.SizeSlugS}
+	objs, err := decodeObjects(k.DefineApp(context.Background(), "id-1234", "app", tqsdk.Space{Key: "space", Service: api}, map[string]domain.Image{
+		"api": {Registry: "registry:5000", Repository: "api", Tag: "latest", Digest: "sha256:abc"},
+	}))
+	require.NoError(t, err)
+
+	var deployment *unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetKind() == "Deployment" {
+			deployment = obj
+		}
+	}
+	require.NotNil(t, deployment)
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+	require.Len(t, containers, 1)
+	image, _, _ := unstructured.NestedString(containers[0].(map[string]interface{}), "image")
+	assert.Equal(t, "registry:5000/api@sha256:abc", image, "a moved tag must not change the pulled content")
+}
+
+func TestRunMigrationsAwaitsJobAndCollectsLogs(t *testing.T) {
+	job := domain.MigrationJob{ID: "id-1234", AppID: "app", SpaceKey: "space", Image: "registry/api:latest", Command: []string{"./migrate"}}
+	obj := newMigrationJob(job)
+	assert.Equal(t, "id-1234-migrations", obj.GetName())
+	assert.Equal(t, "id-1234-space", obj.GetNamespace())
+	backoffLimit, _, _ := unstructured.NestedInt64(obj.Object, "spec", "backoffLimit")
+	assert.Zero(t, backoffLimit, "the migrations must run once")
+
+	// the Job has been created by a previous attempt of the deployment
+	obj.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{"type": "Complete", "status": "True"}},
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+	clientset := kubefake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "id-1234-migrations-x7k2p",
+		Namespace: "id-1234-space",
+		Labels:    map[string]string{"job-name": "id-1234-migrations"},
+	}})
+
+	logs, err := runMigrations(context.Background(), client, clientset, job)
+	require.NoError(t, err)
+	assert.Equal(t, "fake logs", logs)
+
+	_, err = client.Resource(namespacesResource).Get(context.Background(), "id-1234-space", metav1.GetOptions{})
+	assert.NoError(t, err, "the namespace must be created before the rollout")
+}
+
+func TestMigrationJobRestartPolicyAndBackoff(t *testing.T) {
+	obj := newMigrationJob(domain.MigrationJob{ID: "id-1234", AppID: "app", SpaceKey: "space", Image: "registry/api:latest", RestartPolicy: "OnFailure", BackoffLimit: 3})
+
+	backoffLimit, _, _ := unstructured.NestedInt64(obj.Object, "spec", "backoffLimit")
+	assert.Equal(t, int64(3), backoffLimit)
+	restartPolicy, _, _ := unstructured.NestedString(obj.Object, "spec", "template", "spec", "restartPolicy")
+	assert.Equal(t, "OnFailure", restartPolicy)
+
+	obj = newMigrationJob(domain.MigrationJob{ID: "id-1234", AppID: "app", SpaceKey: "space", Image: "registry/api:latest"})
+	restartPolicy, _, _ = unstructured.NestedString(obj.Object, "spec", "template", "spec", "restartPolicy")
+	assert.Equal(t, "Never", restartPolicy)
+}
+
+func TestRunMigrationsFailedJobIsUserFailure(t *testing.T) {
+	job := domain.MigrationJob{ID: "id-1234", AppID: "app", SpaceKey: "space", Image: "registry/api:latest"}
+	obj := newMigrationJob(job)
+	obj.Object["status"] = map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{"type": "Failed", "status": "True"}},
+	}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+
+	_, err := runMigrations(context.Background(), client, kubefake.NewSimpleClientset(), job)
+	var failureErr *domain.FailureError
+	require.True(t, errors.As(err, &failureErr))
+	assert.Equal(t, domain.FailureClassUser, failureErr.Class)
+}
+
+func TestRunMigrationsTimedOutJobIsDeleted(t *testing.T) {
+	job := domain.MigrationJob{ID: "id-1234", AppID: "app", SpaceKey: "space", Image: "registry/api:latest"}
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := runMigrations(ctx, client, kubefake.NewSimpleClientset(), job)
+	require.Error(t, err)
+
+	_, err = client.Resource(jobsResource).Namespace("id-1234-space").Get(context.Background(), "id-1234-migrations", metav1.GetOptions{})
+	assert.Error(t, err, "the timed out job must not migrate later")
+}
+
+func TestPlanObjects(t *testing.T) {
+	k := NewKube("")
+	ctx := context.Background()
+	api := tqsdk.Service{Name: "api", HttpPort: 8000, Replicas: 1, Host: "api.treenq.local", SizeSlug: tqsdk.SizeSlugS}
+	worker := tqsdk.Service{Name: "worker", HttpPort: 8001, Replicas: 1, Host: "worker.treenq.local", SizeSlug: tqsdk.SizeSlugS}
+	images := map[string]domain.Image{
+		"api":    {Registry: "registry:5000", Repository: "api", Tag: "latest"},
+		"worker": {Registry: "registry:5000", Repository: "worker", Tag: "latest"},
+	}
+
+	live, err := decodeObjects(k.DefineApp(ctx, "id-1234", "app", tqsdk.Space{Key: "space", Service: api}, images))
+	require.NoError(t, err)
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	require.NoError(t, applyObjects(ctx, client, live))
+
+	api.Replicas = 2
+	objs, err := decodeObjects(k.DefineApp(ctx, "id-1234", "app", tqsdk.Space{Key: "space", Service: api, Services: []tqsdk.Service{worker}}, images))
+	require.NoError(t, err)
+	plans, err := planObjects(ctx, client, objs)
+	require.NoError(t, err)
+
+	actions := make(map[string]domain.PlanAction)
+	for _, plan := range plans {
+		actions[plan.Kind+"/"+plan.Name] = plan.Action
+	}
+	assert.Equal(t, map[string]domain.PlanAction{
+		"Namespace/id-1234-space":          domain.PlanActionUnchanged,
+		"Deployment/app-api-deployment":    domain.PlanActionUpdate,
+		"Service/app-api-service":          domain.PlanActionUnchanged,
+		"Ingress/app-api-ingress":          domain.PlanActionUnchanged,
+		"Deployment/app-worker-deployment": domain.PlanActionCreate,
+		"Service/app-worker-service":       domain.PlanActionCreate,
+		"Ingress/app-worker-ingress":       domain.PlanActionCreate,
+	}, actions)
+}
+
 func TestInvalidNamespaceName(t *testing.T) {
 
 }
@@ -52,3 +365,78 @@ func TestInvalidNamespaceName(t *testing.T) {
 func TestRunAsNonNumbericNonRootUser(t *testing.T) {
 
 }
+
+func TestImportWorkloadLabelsLiveObjects(t *testing.T) {
+	deployment := testObject("apps/v1", "Deployment", "legacy", "api", map[string]interface{}{"team": "core"})
+	deployment.Object["spec"] = map[string]interface{}{
+		"replicas": int64(3),
+		"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "api"}},
+			"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{
+				"name":  "api",
+				"image": "registry/api:v1.2.0",
+				"ports": []interface{}{map[string]interface{}{"containerPort": int64(8000)}},
+				"env": []interface{}{
+					map[string]interface{}{"name": "LOG_LEVEL", "value": "debug"},
+					map[string]interface{}{"name": "DB_PASSWORD", "valueFrom": map[string]interface{}{"secretKeyRef": map[string]interface{}{"name": "db", "key": "password"}}},
+				},
+			}}},
+		},
+	}
+	service := testObject("v1", "Service", "legacy", "api", nil)
+	service.Object["spec"] = map[string]interface{}{"selector": map[string]interface{}{"app": "api"}}
+	other := testObject("v1", "Service", "legacy", "worker", nil)
+	other.Object["spec"] = map[string]interface{}{"selector": map[string]interface{}{"app": "worker"}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		servicesResource: "ServiceList",
+	}, deployment, service, other, testObject("v1", "Namespace", "", "legacy", nil))
+
+	ctx := context.Background()
+	workload, err := importWorkload(ctx, client, "legacy", "api", "app-1234")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Workload{
+		Namespace: "legacy",
+		Name:      "api",
+		Image:     "registry/api:v1.2.0",
+		HttpPort:  8000,
+		Replicas:  3,
+		Envs:      map[string]string{"LOG_LEVEL": "debug"},
+	}, workload)
+
+	owned := map[string]string{managedByLabel: managedBy, appIDLabel: "app-1234"}
+	live, err := client.Resource(deploymentsResource).Namespace("legacy").Get(ctx, "api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "core", managedByLabel: managedBy, appIDLabel: "app-1234"}, live.GetLabels())
+	podLabels, _, _ := unstructured.NestedStringMap(live.Object, "spec", "template", "metadata", "labels")
+	assert.Equal(t, map[string]string{"app": "api"}, podLabels, "the pod template is kept, so the pods aren't restarted")
+
+	liveService, err := client.Resource(servicesResource).Namespace("legacy").Get(ctx, "api", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, owned, liveService.GetLabels())
+	liveOther, err := client.Resource(servicesResource).Namespace("legacy").Get(ctx, "worker", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, liveOther.GetLabels())
+	ns, err := client.Resource(namespacesResource).Get(ctx, "legacy", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, owned, ns.GetLabels())
+
+	_, err = importWorkload(ctx, client, "legacy", "missing", "app-1234")
+	assert.ErrorIs(t, err, domain.ErrWorkloadNotFound)
+}
+
+func TestApplyStopsOnCancelledContext(t *testing.T) {
+	k := NewKube("")
+	data := k.DefineApp(context.Background(), "id-1234", "app-1234", tqsdk.Space{
+		Key:     "space",
+		Service: tqsdk.Service{Name: "api", HttpPort: 8000, Replicas: 1, SizeSlug: tqsdk.SizeSlugS},
+	}, map[string]domain.Image{"api": {Registry: "registry", Repository: "api", Tag: "latest"}})
+	objs, err := decodeObjects(data)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	err = applyObjects(ctx, client, objs)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, client.Actions(), "no object is applied")
+}
@@ -0,0 +1,221 @@
+package cdk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/treenq/treenq/src/domain"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// maintenanceModeAnnotation marks the Ingress of a service deployed in the maintenance mode
+	maintenanceModeAnnotation = "treenq.io/maintenance-mode"
+	// maintenanceActiveAnnotation marks the live Ingress routed to the maintenance page
+	maintenanceActiveAnnotation = "treenq.io/maintenance-active"
+	// maintenanceService is created in the app namespace to refer the maintenance backend,
+	// an Ingress can route only to the services of its namespace
+	maintenanceService = "treenq-maintenance"
+	maintenancePort    = int64(80)
+)
+
+var (
+	ingressesResource   = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	servicesResource    = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	deploymentsResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+// readyPollInterval is how often the Deployments are checked by WaitReady
+var readyPollInterval = 2 * time.Second
+
+// SetMaintenance routes the maintenance mode Ingresses of the app objects to the maintenance page if enabled,
+// otherwise the Ingresses are restored as they are defined.
+func (k *Kube) SetMaintenance(ctx context.Context, rawConig, data string, enabled bool) error {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return err
+	}
+
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return enableMaintenance(ctx, dynamicClient, objs, k.maintenanceHost)
+	}
+	return disableMaintenance(ctx, dynamicClient, objs)
+}
+
+func maintenanceIngresses(objs []*unstructured.Unstructured) []*unstructured.Unstructured {
+	var ingresses []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GetKind() == "Ingress" && obj.GetAnnotations()[maintenanceModeAnnotation] == "true" {
+			ingresses = append(ingresses, obj)
+		}
+	}
+	return ingresses
+}
+
+func enableMaintenance(ctx context.Context, client dynamic.Interface, objs []*unstructured.Unstructured, host string) error {
+	for _, obj := range maintenanceIngresses(objs) {
+		ingresses := client.Resource(ingressesResource).Namespace(obj.GetNamespace())
+		live, err := ingresses.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			// the service is deployed for the first time, there is no traffic to switch
+			continue
+		}
+		if err != nil {
+			return domain.SystemFailure(fmt.Errorf("failed to get ingress %s: %w", obj.GetName(), err))
+		}
+
+		if err := ensureMaintenanceService(ctx, client, obj.GetNamespace(), host); err != nil {
+			return err
+		}
+
+		routeToMaintenance(live)
+		annotations := live.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[maintenanceActiveAnnotation] = "true"
+		live.SetAnnotations(annotations)
+		if _, err := ingresses.Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+			return classifyApplyError(fmt.Errorf("failed to route ingress %s to maintenance: %w", obj.GetName(), err))
+		}
+	}
+	return nil
+}
+
+func disableMaintenance(ctx context.Context, client dynamic.Interface, objs []*unstructured.Unstructured) error {
+	for _, obj := range maintenanceIngresses(objs) {
+		ingresses := client.Resource(ingressesResource).Namespace(obj.GetNamespace())
+		_, err := ingresses.Update(ctx, obj, metav1.UpdateOptions{})
+		if errors.IsNotFound(err) {
+			_, err = ingresses.Create(ctx, obj, metav1.CreateOptions{})
+		}
+		if err != nil {
+			return classifyApplyError(fmt.Errorf("failed to restore ingress %s: %w", obj.GetName(), err))
+		}
+	}
+	return nil
+}
+
+// ensureMaintenanceService creates an ExternalName Service of the maintenance backend host in the namespace
+func ensureMaintenanceService(ctx context.Context, client dynamic.Interface, namespace, host string) error {
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":      maintenanceService,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{managedByLabel: managedBy},
+		},
+		"spec": map[string]interface{}{
+			"type":         "ExternalName",
+			"externalName": host,
+			"ports": []interface{}{
+				map[string]interface{}{"name": "http", "port": maintenancePort},
+			},
+		},
+	}}
+
+	_, err := client.Resource(servicesResource).Namespace(namespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return domain.SystemFailure(fmt.Errorf("failed to create maintenance service: %w", err))
+	}
+	return nil
+}
+
+// routeToMaintenance replaces the backends of all the Ingress paths with the maintenance service
+func routeToMaintenance(ingress *unstructured.Unstructured) {
+	rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, path := range paths {
+			path, ok := path.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			path["backend"] = map[string]interface{}{
+				"service": map[string]interface{}{
+					"name": maintenanceService,
+					"port": map[string]interface{}{"number": maintenancePort},
+				},
+			}
+		}
+		_ = unstructured.SetNestedSlice(rule, paths, "http", "paths")
+	}
+	_ = unstructured.SetNestedSlice(ingress.Object, rules, "spec", "rules")
+}
+
+// inMaintenance reports whether the live object is an Ingress routed to the maintenance page
+func inMaintenance(ctx context.Context, client dynamic.ResourceInterface, obj *unstructured.Unstructured) bool {
+	if obj.GetKind() != "Ingress" || obj.GetAnnotations()[maintenanceModeAnnotation] != "true" {
+		return false
+	}
+	live, err := client.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	return live.GetAnnotations()[maintenanceActiveAnnotation] == "true"
+}
+
+// WaitReady waits until all the Deployments of the app objects roll out their new replicas
+func (k *Kube) WaitReady(ctx context.Context, rawConig, data string) error {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return err
+	}
+
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return err
+	}
+	return waitReady(ctx, dynamicClient, objs)
+}
+
+func waitReady(ctx context.Context, client dynamic.Interface, objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
+		if obj.GetKind() != "Deployment" {
+			continue
+		}
+		for {
+			live, err := client.Resource(deploymentsResource).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return domain.SystemFailure(fmt.Errorf("failed to get deployment %s: %w", obj.GetName(), err))
+			}
+			if deploymentReady(live) {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				// a rollout stuck on crashing or unschedulable pods is up to the app
+				return domain.UserFailure(fmt.Errorf("deployment %s is not ready: %w", obj.GetName(), ctx.Err()))
+			case <-time.After(readyPollInterval):
+			}
+		}
+	}
+	return nil
+}
+
+func deploymentReady(deployment *unstructured.Unstructured) bool {
+	generation := deployment.GetGeneration()
+	observed, _, _ := unstructured.NestedInt64(deployment.Object, "status", "observedGeneration")
+	replicas, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(deployment.Object, "status", "updatedReplicas")
+	available, _, _ := unstructured.NestedInt64(deployment.Object, "status", "availableReplicas")
+	return observed >= generation && updated >= replicas && available >= replicas
+}
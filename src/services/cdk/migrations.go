@@ -0,0 +1,206 @@
+package cdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/treenq/treenq/src/domain"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	jobsResource       = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+	namespacesResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+)
+
+// jobPollInterval is how often the migrations Job is checked by RunMigrations
+var jobPollInterval = 2 * time.Second
+
+// RunMigrations runs the migrations Job in the app namespace, the namespace is created if the app isn't deployed yet.
+// The Job is named after the deployment, a Job created by a previous attempt of the deployment is awaited instead.
+func (k *Kube) RunMigrations(ctx context.Context, rawConig string, job domain.MigrationJob) (string, error) {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return "", err
+	}
+	clientset, err := newClientset(rawConig)
+	if err != nil {
+		return "", err
+	}
+	return runMigrations(ctx, dynamicClient, clientset, job)
+}
+
+func runMigrations(ctx context.Context, client dynamic.Interface, clientset kubernetes.Interface, job domain.MigrationJob) (string, error) {
+	namespace := appNamespace(job.ID, job.SpaceKey)
+	if err := ensureNamespace(ctx, client, namespace, job.AppID); err != nil {
+		return "", err
+	}
+
+	obj := newMigrationJob(job)
+	_, err := client.Resource(jobsResource).Namespace(namespace).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return "", classifyApplyError(fmt.Errorf("failed to create migrations job: %w", err))
+	}
+
+	jobErr := waitJob(ctx, client, namespace, obj.GetName())
+	// the logs are collected even if the Job has timed out
+	logs, err := jobLogs(context.WithoutCancel(ctx), clientset, namespace, obj.GetName())
+	if ctx.Err() != nil {
+		// the deployment is failed, the Job must not complete the migrations later,
+		// e.g. while the next deployment runs its own ones
+		if deleteErr := deleteJob(context.WithoutCancel(ctx), client, namespace, obj.GetName()); deleteErr != nil {
+			jobErr = fmt.Errorf("%w, %w", jobErr, deleteErr)
+		}
+	}
+	if jobErr != nil {
+		return logs, jobErr
+	}
+	return logs, err
+}
+
+// deleteJob deletes the Job along with its pods
+func deleteJob(ctx context.Context, client dynamic.Interface, namespace, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	err := client.Resource(jobsResource).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return domain.SystemFailure(fmt.Errorf("failed to delete migrations job: %w", err))
+	}
+	return nil
+}
+
+func ensureNamespace(ctx context.Context, client dynamic.Interface, namespace, appID string) error {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name": namespace,
+			"labels": map[string]interface{}{
+				managedByLabel: managedBy,
+				appIDLabel:     appID,
+			},
+		},
+	}}
+
+	_, err := client.Resource(namespacesResource).Create(ctx, obj, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return classifyApplyError(fmt.Errorf("failed to create namespace: %w", err))
+	}
+	return nil
+}
+
+// newMigrationJob defines a Job which runs the migrations, a failed pod is not restarted
+// and the Job isn't retried unless the space sets the restart policy and the backoff limit
+func newMigrationJob(job domain.MigrationJob) *unstructured.Unstructured {
+	envs := make([]interface{}, 0, len(job.Envs))
+	for key, value := range job.Envs {
+		envs = append(envs, map[string]interface{}{"name": key, "value": value})
+	}
+	container := map[string]interface{}{
+		"name":  "migrations",
+		"image": job.Image,
+		"env":   envs,
+	}
+	if len(job.Command) > 0 {
+		command := make([]interface{}, len(job.Command))
+		for i, arg := range job.Command {
+			command[i] = arg
+		}
+		container["command"] = command
+	}
+
+	labels := map[string]interface{}{
+		managedByLabel: managedBy,
+		appIDLabel:     job.AppID,
+	}
+	restartPolicy := job.RestartPolicy
+	if restartPolicy == "" {
+		restartPolicy = "Never"
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":      dnsLabel(job.ID + "-migrations"),
+			"namespace": appNamespace(job.ID, job.SpaceKey),
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit": int64(job.BackoffLimit),
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec": map[string]interface{}{
+					"restartPolicy": restartPolicy,
+					"containers":    []interface{}{container},
+				},
+			},
+		},
+	}}
+}
+
+// waitJob waits until the Job completes, a failed Job is up to the app
+func waitJob(ctx context.Context, client dynamic.Interface, namespace, name string) error {
+	for {
+		live, err := client.Resource(jobsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return domain.SystemFailure(fmt.Errorf("failed to get migrations job: %w", err))
+		}
+		switch jobCondition(live) {
+		case "Complete":
+			return nil
+		case "Failed":
+			return domain.UserFailure(fmt.Errorf("migrations job %s failed", name))
+		}
+
+		select {
+		case <-ctx.Done():
+			return domain.UserFailure(fmt.Errorf("migrations job %s is not complete: %w", name, ctx.Err()))
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// jobCondition returns the finished condition type of the Job, empty if it's running
+func jobCondition(job *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(job.Object, "status", "conditions")
+	for _, condition := range conditions {
+		condition, ok := condition.(map[string]interface{})
+		if !ok || condition["status"] != "True" {
+			continue
+		}
+		if condition["type"] == "Complete" || condition["type"] == "Failed" {
+			return condition["type"].(string)
+		}
+	}
+	return ""
+}
+
+// jobLogs returns the logs of all the Job pods
+func jobLogs(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (string, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "job-name=" + name})
+	if err != nil {
+		return "", domain.SystemFailure(fmt.Errorf("failed to list migrations pods: %w", err))
+	}
+
+	var logs strings.Builder
+	for _, pod := range pods.Items {
+		stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(ctx)
+		if err != nil {
+			return logs.String(), domain.SystemFailure(fmt.Errorf("failed to get logs of pod %s: %w", pod.Name, err))
+		}
+		_, err = io.Copy(&logs, stream)
+		stream.Close()
+		if err != nil {
+			return logs.String(), domain.SystemFailure(fmt.Errorf("failed to read logs of pod %s: %w", pod.Name, err))
+		}
+	}
+	return logs.String(), nil
+}
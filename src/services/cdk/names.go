@@ -0,0 +1,49 @@
+package cdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// maxNameLength is the kubernetes limit of a DNS label, e.g. a Service or a Namespace name
+const maxNameLength = 63
+
+// nameHashLength is the length of the hash suffix of a truncated name
+const nameHashLength = 8
+
+// appShortIDLength is the length of the app id prefix of the object names, it's the first group of a uuid
+const appShortIDLength = 8
+
+// objectName is the name of a generated app object, <app-short-id>-<service>-<kind>.
+// The app id prefix keeps the objects of two apps apart, a Service name must start with a letter,
+// so a prefix starting with a digit is prefixed with tq.
+func objectName(appID, service, kind string) string {
+	shortID := dnsLabel(appID)
+	if len(shortID) > appShortIDLength {
+		shortID = strings.TrimRight(shortID[:appShortIDLength], "-")
+	}
+	if shortID == "" || (shortID[0] >= '0' && shortID[0] <= '9') {
+		shortID = "tq" + shortID
+	}
+	return dnsLabel(shortID + "-" + service + "-" + kind)
+}
+
+// dnsLabel turns the name into a DNS label, a name over the limit is truncated and suffixed with a hash of the whole name,
+// so the truncated name is stable and two long names sharing a prefix stay distinct
+func dnsLabel(name string) string {
+	label := []byte(strings.ToLower(name))
+	for i, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			label[i] = '-'
+		}
+	}
+	trimmed := strings.Trim(string(label), "-")
+	if len(trimmed) <= maxNameLength {
+		return trimmed
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+	return strings.TrimRight(trimmed[:maxNameLength-nameHashLength-1], "-") + "-" + hash
+}
@@ -0,0 +1,48 @@
+package cdk
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tqsdk "github.com/treenq/treenq/pkg/sdk"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func TestObjectNameTruncatesLongName(t *testing.T) {
+	service := strings.Repeat("very-long-service-name-", 4)
+	name := objectName("7c9e6679-7425-40de-944b-e07fc1f90ae7", service, "deployment")
+
+	assert.Len(t, name, maxNameLength)
+	assert.True(t, strings.HasPrefix(name, "tq7c9e6679-very-long-service-name-"), name)
+	assert.Equal(t, name, objectName("7c9e6679-7425-40de-944b-e07fc1f90ae7", service, "deployment"), "the hash is stable")
+	assert.NotEqual(t, name, objectName("7c9e6679-7425-40de-944b-e07fc1f90ae7", service+"x", "deployment"),
+		"the names sharing the truncated prefix differ by the hash")
+}
+
+func TestObjectNamesOfTwoAppsDontCollide(t *testing.T) {
+	k := NewKube("")
+	space := tqsdk.Space{Key: "space", Service: tqsdk.Service{Name: "api", HttpPort: 8000, Replicas: 1, Host: "api.treenq.local", SizeSlug: tqsdk.SizeSlugS}}
+	images := map[string]domain.Image{"api": {Registry: "registry:5000", Repository: "api", Tag: "latest"}}
+
+	names := func(appID string) []string {
+		objs, err := decodeObjects(k.DefineApp(context.Background(), "id-1234", appID, space, images))
+		require.NoError(t, err)
+		var names []string
+		for _, obj := range objs {
+			if obj.GetKind() != "Namespace" {
+				names = append(names, obj.GetName())
+			}
+		}
+		return names
+	}
+
+	first := names("0f8fad5b-d9cb-469f-a165-70867728950e")
+	second := names("7c9e6679-7425-40de-944b-e07fc1f90ae7")
+	assert.Equal(t, []string{"tq0f8fad5b-api-deployment", "tq0f8fad5b-api-service", "tq0f8fad5b-api-ingress"}, first)
+	for _, name := range second {
+		assert.NotContains(t, first, name)
+	}
+}
@@ -0,0 +1,114 @@
+package cdk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/treenq/treenq/src/domain"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// PlanApp compares every app object with its live version, the cluster is only read
+func (k *Kube) PlanApp(ctx context.Context, rawConig, data string) ([]domain.ObjectPlan, error) {
+	dynamicClient, err := newDynamicClient(rawConig)
+	if err != nil {
+		return nil, err
+	}
+
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return nil, err
+	}
+	return planObjects(ctx, dynamicClient, objs)
+}
+
+func planObjects(ctx context.Context, client dynamic.Interface, objs []*unstructured.Unstructured) ([]domain.ObjectPlan, error) {
+	plans := make([]domain.ObjectPlan, 0, len(objs))
+	for _, obj := range objs {
+		gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+		plan := domain.ObjectPlan{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		}
+
+		live, err := client.Resource(gvr).Namespace(obj.GetNamespace()).Get(ctx, obj.GetName(), metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			plan.Action = domain.PlanActionCreate
+		case err != nil:
+			return nil, domain.SystemFailure(fmt.Errorf("failed to get %s %s: %w", obj.GetKind(), obj.GetName(), err))
+		case objectChanged(obj, live):
+			plan.Action = domain.PlanActionUpdate
+		default:
+			plan.Action = domain.PlanActionUnchanged
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// objectChanged reports whether an update changes the live object.
+// The cluster adds the defaults and the status to the live object, so only the defined fields are compared,
+// the metadata is compared by the labels and annotations.
+func objectChanged(obj, live *unstructured.Unstructured) bool {
+	if !definedIn(obj.GetLabels(), live.GetLabels()) || !definedIn(obj.GetAnnotations(), live.GetAnnotations()) {
+		return true
+	}
+	for field, value := range obj.Object {
+		if field == "apiVersion" || field == "kind" || field == "metadata" {
+			continue
+		}
+		if !definedIn(value, live.Object[field]) {
+			return true
+		}
+	}
+	return false
+}
+
+// definedIn reports whether every defined value is set to the same value in the live one
+func definedIn(defined, live interface{}) bool {
+	switch defined := defined.(type) {
+	case map[string]interface{}:
+		live, _ := live.(map[string]interface{})
+		for key, value := range defined {
+			if !definedIn(value, live[key]) {
+				return false
+			}
+		}
+		return true
+	case map[string]string:
+		live, _ := live.(map[string]string)
+		for key, value := range defined {
+			if live[key] != value {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		live, _ := live.([]interface{})
+		if len(defined) != len(live) {
+			return false
+		}
+		for i := range defined {
+			if !definedIn(defined[i], live[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return true
+	default:
+		if live == nil {
+			return reflect.ValueOf(defined).IsZero()
+		}
+		// the numbers are decoded as int64 or float64 depending on the source
+		return fmt.Sprint(defined) == fmt.Sprint(live)
+	}
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/treenq/treenq/src/domain"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var received domain.Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	notification := domain.Notification{
+		Event:   domain.NotificationDeploymentSlow,
+		AppID:   "app",
+		Stage:   domain.DeploymentStageBuild,
+		Elapsed: 10 * time.Minute,
+	}
+	require.NoError(t, NewWebhookNotifier(server.Client(), server.URL).Notify(context.Background(), notification))
+	assert.Equal(t, notification, received)
+}
+
+func TestWebhookNotifierRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.Client(), server.URL).Notify(context.Background(), domain.Notification{})
+	assert.ErrorContains(t, err, "502")
+}